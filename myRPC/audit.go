@@ -0,0 +1,155 @@
+package myRPC
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"myRPC/internal/rpclog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAuditArgs is the max length of the summary of arguments in an audit record
+const maxAuditArgs = 256
+
+// AuditRecord records a call of an audited method
+type AuditRecord struct {
+	Time      time.Time
+	Method    string    // "<service>.<method>"
+	Principal string    // identity of the caller, see Audit
+	Peer      string    // address of the caller, empty if it's unknown
+	Cred      *PeerCred `json:",omitempty"` // credentials of a caller connected by a unix socket
+	Args      string    // summary of arguments, truncated to 256 bytes
+	Status    string    // "ok", "error", or "denied" if the call isn't authorized
+	Error     string    `json:",omitempty"`
+	Duration  time.Duration
+	RequestID string `json:",omitempty"`
+}
+
+// AuditSink writes audit records, eg, to a file, an RPC service or Kafka
+type AuditSink interface {
+	Audit(record *AuditRecord) error
+}
+
+// AuditSinkFunc is a function writing audit records, eg, by a Kafka producer
+type AuditSinkFunc func(record *AuditRecord) error
+
+func (f AuditSinkFunc) Audit(record *AuditRecord) error {
+	return f(record)
+}
+
+// Audit is the config of auditing calls, see Server.SetAudit
+type Audit struct {
+	Sink AuditSink
+	// Methods audited, like "Service.Method", or "Service.*" for all methods of a service
+	Methods []string
+	// Principal returns the identity of the caller from the context of the call,
+	// eg, the user of a token in metadata. It's "uid:<uid>" of PeerCred by default.
+	Principal func(ctx context.Context) string
+}
+
+// SetAudit makes the server write a record of each call of methods audited to the
+// sink, including calls not authorized. Nil means no audit. It should be called before serving.
+func (server *Server) SetAudit(audit *Audit) {
+	server.audit = audit
+}
+
+func (a *Audit) audited(serviceMethod string) bool {
+	for _, method := range a.Methods {
+		if method == serviceMethod || strings.HasSuffix(method, ".*") &&
+			strings.HasPrefix(serviceMethod, method[:len(method)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditCall writes the record of a call started at start to the sink if it's audited,
+// args is nil if they're unknown
+func (server *Server) auditCall(ctx context.Context, serviceMethod string, args interface{}, start time.Time, status string, err error) {
+	a := server.audit
+	if a == nil || a.Sink == nil || !a.audited(serviceMethod) {
+		return
+	}
+	record := &AuditRecord{
+		Time:      start,
+		Method:    serviceMethod,
+		Peer:      PeerAddrFrom(ctx),
+		Status:    status,
+		Duration:  time.Since(start),
+		RequestID: RequestIDFrom(ctx),
+	}
+	if cred, ok := PeerCredFrom(ctx); ok {
+		record.Cred = &cred
+		record.Principal = fmt.Sprintf("uid:%d", cred.UID)
+	}
+	if a.Principal != nil {
+		record.Principal = a.Principal(ctx)
+	}
+	if args != nil {
+		record.Args = fmt.Sprintf("%+v", args)
+		if len(record.Args) > maxAuditArgs {
+			record.Args = record.Args[:maxAuditArgs]
+		}
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err := a.Sink.Audit(record); err != nil {
+		rpclog.Error("rpc server: write audit record", "method", serviceMethod, "err", err)
+	}
+}
+
+// auditStatus returns the status of a call returning err
+func auditStatus(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// writerAuditSink writes audit records as lines of JSON
+type writerAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterAuditSink returns a sink writing audit records to w as lines of JSON,
+// eg, to a file opened for appending
+func NewWriterAuditSink(w io.Writer) AuditSink {
+	return &writerAuditSink{w: w}
+}
+
+func (s *writerAuditSink) Audit(record *AuditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// rpcAuditSink sends audit records to an RPC service
+type rpcAuditSink struct {
+	client        *Client
+	serviceMethod string
+	timeout       time.Duration
+}
+
+// NewRPCAuditSink returns a sink sending each audit record to serviceMethod by client,
+// the method is like func(record AuditRecord, reply *bool) error. A record fails if it isn't
+// sent in timeout.
+func NewRPCAuditSink(client *Client, serviceMethod string, timeout time.Duration) AuditSink {
+	return &rpcAuditSink{client: client, serviceMethod: serviceMethod, timeout: timeout}
+}
+
+func (s *rpcAuditSink) Audit(record *AuditRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	var reply bool
+	return s.client.Call(ctx, s.serviceMethod, record, &reply)
+}
@@ -0,0 +1,98 @@
+package myRPC
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type AuditLog struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+func (a *AuditLog) Write(record AuditRecord, reply *bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, record)
+	return nil
+}
+
+func TestServer_Audit(t *testing.T) {
+	var buf safeBuffer
+	server := NewServer()
+	var foo Foo
+	var bar Bar
+	_ = server.Register(&foo)
+	_ = server.Register(&bar)
+	server.SetAuth(func(ctx context.Context, serviceMethod string) error {
+		if strings.HasPrefix(serviceMethod, "Bar.") {
+			return errors.New("unauthorized")
+		}
+		return nil
+	})
+	server.SetAudit(&Audit{Sink: NewWriterAuditSink(&buf), Methods: []string{"Foo.*", "Bar.Timeout"}})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	ctx := WithRequestID(context.Background(), "req-1")
+	_ = client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_ = client.Call(ctx, "Bar.Timeout", 1, &reply)
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(strings.NewReader(buf.String()))
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expect 2 audit records, but got %q", buf.String())
+	}
+	if r := records[0]; r.Method != "Foo.Sum" || r.Status != "ok" || r.Args != "{Num1:1 Num2:2}" ||
+		!strings.HasPrefix(r.Peer, "127.0.0.1:") || r.RequestID != "req-1" || r.Time.IsZero() {
+		t.Fatalf("unexpected audit record %+v", r)
+	}
+	if r := records[1]; r.Method != "Bar.Timeout" || r.Status != "denied" || r.Error != "unauthorized" {
+		t.Fatalf("unexpected audit record %+v", r)
+	}
+}
+
+func TestRPCAuditSink(t *testing.T) {
+	collector := NewServer()
+	var log AuditLog
+	_ = collector.Register(&log)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go collector.Accept(l)
+	defer func() { _ = collector.Shutdown(context.Background()) }()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	sink := NewRPCAuditSink(client, "AuditLog.Write", time.Second)
+	if err = sink.Audit(&AuditRecord{Method: "Foo.Sum", Principal: "uid:0", Status: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if len(log.records) != 1 || log.records[0].Principal != "uid:0" {
+		t.Fatalf("unexpected records %+v", log.records)
+	}
+}
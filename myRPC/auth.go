@@ -0,0 +1,84 @@
+package myRPC
+
+import (
+	"context"
+	"errors"
+	"io"
+	"myRPC/internal/rpclog"
+	"net"
+	"time"
+)
+
+// AuthFunc authorizes a call of serviceMethod, ctx is the context of the connection,
+// which carries the credentials of a peer connected by a unix socket, see PeerCredFrom.
+// The call fails with the error returned if it's not nil.
+type AuthFunc func(ctx context.Context, serviceMethod string) error
+
+// ErrUnauthenticated may be returned by AuthFunc, wrapped or not, if the peer has no
+// valid credentials, as opposed to a peer not allowed to call the method. Bridges
+// tell it apart, eg, gRPC answers UNAUTHENTICATED instead of PERMISSION_DENIED.
+var ErrUnauthenticated = errors.New("rpc server: unauthenticated")
+
+// SetAuth sets the hook authorizing calls, it should be called before serving
+func (server *Server) SetAuth(auth AuthFunc) {
+	server.auth = auth
+}
+
+func (server *Server) authorize(ctx context.Context, serviceMethod string) error {
+	if server.auth == nil {
+		return nil
+	}
+	err := server.auth(ctx, serviceMethod)
+	if err != nil {
+		server.auditCall(ctx, serviceMethod, nil, time.Now(), "denied", err)
+	}
+	return err
+}
+
+// PeerCred is the credentials of the process of a peer connected by a unix socket
+type PeerCred struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+type peerCredKey struct{}
+
+// PeerCredFrom returns the credentials of the peer in the context of a connection,
+// it's passed to the auth hook and methods taking a context.Context
+func PeerCredFrom(ctx context.Context) (PeerCred, bool) {
+	cred, ok := ctx.Value(peerCredKey{}).(PeerCred)
+	return cred, ok
+}
+
+type peerAddrKey struct{}
+
+// PeerAddrFrom returns the address of the peer in the context of a connection,
+// empty if it's unknown
+func PeerAddrFrom(ctx context.Context) string {
+	addr, _ := ctx.Value(peerAddrKey{}).(string)
+	return addr
+}
+
+func withPeerAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, peerAddrKey{}, addr)
+}
+
+// connContext returns the context of calls on conn, with the address of the peer
+// if conn is a net.Conn, and the credentials of the peer if it's a unix socket
+func connContext(conn io.ReadWriteCloser) context.Context {
+	ctx := context.Background()
+	if nc, ok := conn.(net.Conn); ok && nc.RemoteAddr() != nil {
+		ctx = withPeerAddr(ctx, nc.RemoteAddr().String())
+	}
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	cred, err := readPeerCred(uc)
+	if err != nil {
+		rpclog.Warn("rpc server: read peer credentials", "err", err)
+		return ctx
+	}
+	return context.WithValue(ctx, peerCredKey{}, cred)
+}
@@ -0,0 +1,66 @@
+package myRPC
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type Who int
+
+func (w Who) Cred(ctx context.Context, args int, reply *PeerCred) error {
+	cred, ok := PeerCredFrom(ctx)
+	if !ok {
+		return errors.New("no peer credentials")
+	}
+	*reply = cred
+	return nil
+}
+
+func TestServer_PeerCred(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are read on linux")
+	}
+	server := NewServer()
+	var w Who
+	_ = server.Register(&w)
+	// only peers of the same user are authorized
+	server.SetAuth(func(ctx context.Context, serviceMethod string) error {
+		if cred, ok := PeerCredFrom(ctx); !ok || int(cred.UID) != os.Getuid() {
+			return errors.New("unauthorized")
+		}
+		return nil
+	})
+	addr := t.TempDir() + "/myrpc.sock"
+	unix, _ := net.Listen("unix", addr)
+	go server.Accept(unix)
+	tcp, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(tcp)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+
+	client, err := XDial("unix@" + addr)
+	if err != nil {
+		t.Fatal("failed to connect unix socket:", err)
+	}
+	defer func() { _ = client.Close() }()
+	var cred PeerCred
+	if err = client.Call(context.Background(), "Who.Cred", 0, &cred); err != nil {
+		t.Fatal("expect the call of the peer authorized, but got", err)
+	}
+	if int(cred.PID) != os.Getpid() || int(cred.UID) != os.Getuid() || int(cred.GID) != os.Getgid() {
+		t.Fatalf("expect credentials of this process, but got %+v", cred)
+	}
+
+	client, err = XDial("tcp@" + tcp.Addr().String())
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	defer func() { _ = client.Close() }()
+	if err = client.Call(context.Background(), "Who.Cred", 0, &cred); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatal("expect the call over tcp unauthorized, but got", err)
+	}
+}
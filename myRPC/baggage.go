@@ -0,0 +1,88 @@
+package myRPC
+
+import (
+	"context"
+	"myRPC/internal/rpclog"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// baggageMetadataPrefix prefixes keys of metadata carrying baggage
+	baggageMetadataPrefix = "baggage-"
+	// maxBaggageValue is the max length of a value of baggage, longer ones are dropped
+	maxBaggageValue = 256
+)
+
+// baggageKeys is the allowlist of keys of baggage propagated, nil means none
+var baggageKeys atomic.Pointer[map[string]bool]
+
+// SetBaggageKeys sets the keys of baggage propagated by all clients and servers in
+// the process, eg, "tenant" and experiment flags. Baggage of other keys is neither
+// sent nor accepted. No key is allowed by default.
+func SetBaggageKeys(keys ...string) {
+	allowed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		allowed[strings.ToLower(key)] = true
+	}
+	baggageKeys.Store(&allowed)
+}
+
+func baggageAllowed(key string) bool {
+	allowed := baggageKeys.Load()
+	return allowed != nil && (*allowed)[key]
+}
+
+type baggageKey struct{}
+
+// WithBaggage returns a context carrying baggage of key and value, keys are case insensitive.
+// Calls made by Client.Call of the context carry baggage of keys allowed by SetBaggageKeys,
+// and the server passes it in the context of the method, so calls the method makes by
+// the context carry it on automatically.
+func WithBaggage(ctx context.Context, key, value string) context.Context {
+	baggage := make(map[string]string)
+	for k, v := range BaggageFrom(ctx) {
+		baggage[k] = v
+	}
+	baggage[strings.ToLower(key)] = value
+	return context.WithValue(ctx, baggageKey{}, baggage)
+}
+
+// BaggageFrom returns baggage of the context by key, it mustn't be modified
+func BaggageFrom(ctx context.Context) map[string]string {
+	baggage, _ := ctx.Value(baggageKey{}).(map[string]string)
+	return baggage
+}
+
+// injectBaggage adds baggage of ctx allowed to md
+func injectBaggage(ctx context.Context, md map[string]string) {
+	for k, v := range BaggageFrom(ctx) {
+		if !baggageAllowed(k) {
+			continue
+		}
+		if len(v) > maxBaggageValue {
+			rpclog.Warn("rpc client: baggage too long", "key", k, "size", len(v))
+			continue
+		}
+		md[baggageMetadataPrefix+k] = v
+	}
+}
+
+// extractBaggage returns a context carrying baggage allowed in md
+func extractBaggage(ctx context.Context, md map[string]string) context.Context {
+	var baggage map[string]string
+	for k, v := range md {
+		key, ok := strings.CutPrefix(k, baggageMetadataPrefix)
+		if !ok || !baggageAllowed(key) || len(v) > maxBaggageValue {
+			continue
+		}
+		if baggage == nil {
+			baggage = make(map[string]string)
+		}
+		baggage[key] = v
+	}
+	if baggage == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, baggageKey{}, baggage)
+}
@@ -0,0 +1,48 @@
+package myRPC
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// BaggageHop returns baggage seen by itself and by the next hop if any
+type BaggageHop struct{ next *Client }
+
+func (h *BaggageHop) Baggage(ctx context.Context, _ int, seen *[]map[string]string) error {
+	*seen = append(*seen, BaggageFrom(ctx))
+	if h.next == nil {
+		return nil
+	}
+	var next []map[string]string
+	err := h.next.Call(ctx, "BaggageHop.Baggage", 0, &next)
+	*seen = append(*seen, next...)
+	return err
+}
+
+func TestBaggage(t *testing.T) {
+	SetBaggageKeys("Tenant", "exp")
+	defer baggageKeys.Store(nil)
+	client := startHop(t, &BaggageHop{next: startHop(t, &BaggageHop{})})
+
+	ctx := WithBaggage(context.Background(), "tenant", "acme")
+	ctx = WithBaggage(ctx, "secret", "s3cr3t")                            // not allowed
+	ctx = WithBaggage(ctx, "exp", strings.Repeat("x", maxBaggageValue+1)) // too long
+	var seen []map[string]string
+	if err := client.Call(ctx, "BaggageHop.Baggage", 0, &seen); err != nil {
+		t.Fatal(err)
+	}
+	expect := []map[string]string{{"tenant": "acme"}, {"tenant": "acme"}}
+	if !reflect.DeepEqual(seen, expect) {
+		t.Fatalf("expect allowed baggage carried through hops, but got %v", seen)
+	}
+
+	// none is propagated by default
+	baggageKeys.Store(nil)
+	seen = nil
+	_ = client.Call(ctx, "BaggageHop.Baggage", 0, &seen)
+	if len(seen) != 2 || len(seen[0]) != 0 || len(seen[1]) != 0 {
+		t.Fatalf("expect no baggage without keys allowed, but got %v", seen)
+	}
+}
@@ -3,12 +3,14 @@ package myRPC
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"myRPC/codec"
+	"myRPC/internal/rpclog"
 	"net"
 	"net/http"
 	"strings"
@@ -17,16 +19,22 @@ import (
 )
 
 type Call struct {
-	Seq           uint64      // to uniquely identify a call
-	ServiceMethod string      // format "<service>.<method>"
-	Args          interface{} // arguments passed in
-	Reply         interface{} // values returned
-	Error         error       // in case if error occurs
-	Done          chan *Call  // strobes when call is complete
+	Seq           uint64            // to uniquely identify a call
+	ServiceMethod string            // format "<service>.<method>"
+	Args          interface{}       // arguments passed in
+	Reply         interface{}       // values returned
+	Error         error             // in case if error occurs
+	Done          chan *Call        // strobes when call is complete
+	Metadata      map[string]string // carried with the request, see WithMetadata
+	sent          time.Time         // when the call was registered
+	size          CallSize          // bytes of the call on the connection
 }
 
 // done is written to support asynchronous call
 func (call *Call) done() {
+	if call.Error != nil {
+		clientErrors.Add(1)
+	}
 	call.Done <- call
 }
 
@@ -40,6 +48,10 @@ type Client struct {
 	pending    map[uint64]*Call
 	isClosed   bool
 	isShutdown bool
+	peer       string // address of the server if it's known
+	stats      statsTable
+	counted    *countedConn // counts sizes of calls, nil if there is none
+	read       int64        // bytes read until the last response, by receive
 }
 
 func (client *Client) GetPending() map[uint64]*Call {
@@ -48,6 +60,14 @@ func (client *Client) GetPending() map[uint64]*Call {
 
 var ErrShutdown = errors.New("connection is shut down")
 
+// ServerError is an error returned by the server, eg, by the method called,
+// which tells that the request has reached the server, unlike other errors of Call
+type ServerError string
+
+func (e ServerError) Error() string {
+	return string(e)
+}
+
 func (client *Client) Close() error {
 	client.mu.Lock()
 	defer client.mu.Unlock()
@@ -64,26 +84,51 @@ func NewClient(conn net.Conn, opt *Option) (*Client, error) {
 	f := codec.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
 		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
-		log.Println("rpc client: codec error:", err)
+		rpclog.Error("rpc client: codec", "err", err)
 		return nil, err
 	}
-	if err := json.NewEncoder(conn).Encode(opt); err != nil {
-		log.Println("rpc client: options error: ", err)
+	var peer string
+	if conn.RemoteAddr() != nil {
+		peer = conn.RemoteAddr().String()
+	}
+	counted := &countedConn{ReadWriteCloser: conn, read: clientBytesRead, written: clientBytesWritten}
+	var rw io.ReadWriteCloser = counted
+	if opt.FrameDump != nil {
+		rw = opt.FrameDump.conn(counted, peer)
+	}
+	if err := json.NewEncoder(rw).Encode(opt); err != nil {
+		rpclog.Error("rpc client: send options", "err", err)
 		_ = conn.Close()
 		return nil, err
 	}
-	return NewClientCodec(f(conn), opt), nil
+	return newClientConn(f(rw), opt, peer, counted), nil
 }
 
 func NewClientCodec(codec codec.Codec, opt *Option) (client *Client) {
-	client = &Client{
+	return newClientCodec(codec, opt, "")
+}
+
+// newClientCodec returns a client of the server at peer by cc, peer is empty if it's unknown
+func newClientCodec(cc codec.Codec, opt *Option, peer string) *Client {
+	return newClientConn(cc, opt, peer, nil)
+}
+
+// newClientConn returns a client of the server at peer by cc, counted is the
+// connection of cc counting sizes of frames, nil if there is none
+func newClientConn(cc codec.Codec, opt *Option, peer string, counted *countedConn) *Client {
+	if opt.FrameDump != nil {
+		cc = opt.FrameDump.codec(cc, peer, counted)
+	}
+	client := &Client{
 		seq:     1,
-		codec:   codec,
+		codec:   cc,
 		opt:     opt,
 		pending: make(map[uint64]*Call),
+		peer:    peer,
+		counted: counted,
 	}
 	go client.receive()
-	return
+	return client
 }
 
 // IsAvailable returns true if the client is working
@@ -99,19 +144,45 @@ func (client *Client) IsAvailable() bool {
 //     then read from call.Done will be blocked because it's null
 //  2. if error occurs,call will put itself into call.done
 //     and return call.Error to client
+//
+// Metadata and the request ID of ctx are carried with the request, see WithMetadata
+// and RequestIDFrom.
 func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	call := client.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Done:          make(chan *Call, 1),
+		Metadata:      outgoingMetadata(ctx),
+		size:          CallSize{Request: -1, Response: -1},
+	}
+	start := time.Now()
+	client.send(call)
 	select {
 	case <-ctx.Done():
 		client.removeCall(call.Seq)
-		return errors.New("rpc client: call failed: " + ctx.Err().Error())
+		// the response may be being read, so only the size of the request is told
+		recordCallSize(ctx, CallSize{Request: call.size.Request, Response: -1})
+		err := fmt.Errorf("rpc client: call failed: %w", ctx.Err())
+		clientErrors.Add(1)
+		client.stats.record(serviceMethod, time.Since(start), err)
+		return err
 	case call = <-call.Done:
+		d := time.Since(start)
+		recordCallSize(ctx, call.size)
+		client.stats.record(serviceMethod, d, call.Error)
+		if client.opt.SlowThreshold > 0 && d > client.opt.SlowThreshold {
+			rpclog.Warn("rpc client: slow call", "method", serviceMethod, "duration", d,
+				"peer", client.peer, "seq", call.Seq, "size", call.size.Request, "request_id", call.Metadata[requestIDMetadata])
+		}
 		return call.Error
 	}
 	// call := <-client.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done
 	// return call.Error
 }
 
+// Go sends the call asynchronously and returns it, call.Done receives it once
+// it completes. It carries a new request ID, Call carries those of a context.
 func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	if done == nil {
 		done = make(chan *Call, 10)
@@ -123,6 +194,7 @@ func (client *Client) Go(serviceMethod string, args, reply interface{}, done cha
 		Args:          args,
 		Reply:         reply,
 		Done:          done,
+		Metadata:      outgoingMetadata(context.Background()),
 	}
 	client.send(call)
 	return call
@@ -145,16 +217,20 @@ func (client *Client) send(call *Call) {
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Seq = seq
 	client.header.Error = ""
+	client.header.Metadata = call.Metadata
 
 	// step3: send header and args to server
 	// 		  remove call from client.pending if it occurs error
-	if err = client.codec.Write(&client.header, call.Args); err != nil {
+	size, err := client.counted.writtenBy(func() error { return client.codec.Write(&client.header, call.Args) })
+	if err != nil {
 		call = client.removeCall(seq)
 		if call != nil {
 			call.Error = err
 			call.done()
 		}
+		return
 	}
+	call.size.Request = size
 }
 
 // registerCall is used to put a call into pending in a working client
@@ -168,8 +244,11 @@ func (client *Client) registerCall(call *Call) (uint64, error) {
 	}
 
 	call.Seq = client.seq
+	call.sent = time.Now()
 	client.pending[call.Seq] = call
 	client.seq++
+	clientCalls.Add(1)
+	clientPending.Add(1)
 	return call.Seq, nil
 }
 
@@ -178,8 +257,11 @@ func (client *Client) registerCall(call *Call) (uint64, error) {
 func (client *Client) removeCall(seq uint64) *Call {
 	client.mu.Lock()
 	defer client.mu.Unlock()
-	call := client.pending[seq]
-	delete(client.pending, seq)
+	call, ok := client.pending[seq]
+	if ok {
+		delete(client.pending, seq)
+		clientPending.Add(-1)
+	}
 	return call
 }
 
@@ -195,6 +277,8 @@ func (client *Client) terminateCalls(err error) {
 		call.Error = err
 		call.done()
 	}
+	clientPending.Add(int64(-len(client.pending)))
+	client.pending = make(map[uint64]*Call)
 }
 
 // receive the reply from server
@@ -209,15 +293,18 @@ func (client *Client) receive() {
 		switch {
 		case call == nil:
 			err = client.codec.ReadBody(nil)
+			client.counted.readSince(&client.read)
 		case h.Error != "":
-			call.Error = fmt.Errorf(h.Error)
+			call.Error = ServerError(h.Error)
 			err = client.codec.ReadBody(nil)
+			call.size.Response = client.counted.readSince(&client.read)
 			call.done()
 		default:
 			err = client.codec.ReadBody(call.Reply)
 			if err != nil {
 				call.Error = errors.New("reading body " + err.Error())
 			}
+			call.size.Response = client.counted.readSince(&client.read)
 			call.done()
 		}
 	}
@@ -241,7 +328,7 @@ func dialTimeout(f newClientFunc, network, address string, opts ...*Option) (cli
 		return nil, err
 	}
 	// case1: timeout when create connection
-	conn, err := net.DialTimeout(network, address, opt.ConnectTimeout)
+	conn, err := connect(network, address, opt)
 	if err != nil {
 		return nil, err
 	}
@@ -277,6 +364,39 @@ func dialTimeout(f newClientFunc, network, address string, opts ...*Option) (cli
 	}
 }
 
+// connect connects to address on network, network "tls" is TLS over TCP,
+// "unix+tls" is TLS over a unix socket, "quic" is a stream of a QUIC connection
+// shared by clients, "kcp" is a KCP connection, "mem" is a connection in memory, "ssh" is
+// a connection forwarded by an SSH bastion, "socks5" is a connection through
+// a SOCKS5 proxy, and "mux" is a stream of a TCP connection shared by clients
+func connect(network, address string, opt *Option) (net.Conn, error) {
+	switch network {
+	case "socks5":
+		return dialSOCKS5(address, opt)
+	case "mux":
+		return dialMux(address, opt)
+	case "ssh":
+		return dialSSH(address, opt)
+	case "mem":
+		return dialMem(address, opt.ConnectTimeout)
+	case "quic":
+		return dialQUIC(address, opt)
+	case "kcp":
+		return dialKCP(address, opt.ConnectTimeout)
+	case "tls":
+		network = "tcp"
+	case "unix+tls":
+		network = "unix"
+	default:
+		return net.DialTimeout(network, address, opt.ConnectTimeout)
+	}
+	config := opt.TLSConfig
+	if config == nil {
+		config = &tls.Config{}
+	}
+	return tls.DialWithDialer(&net.Dialer{Timeout: opt.ConnectTimeout}, network, address, config)
+}
+
 func parseOption(opts ...*Option) (*Option, error) {
 	if len(opts) == 0 || opts[0] == nil {
 		return DefaultOption, nil
@@ -295,22 +415,57 @@ func parseOption(opts ...*Option) (*Option, error) {
 // XDial calls different functions to connect to an RPC server
 // according the first parameter rpcAddr.
 // rpcAddr is a general format (protocol@addr) to represent a rpc server
-// eg, http@10.0.0.1:7001, tcp@10.0.0.1:9999, unix@/tmp/geerpc.sock
+// eg, http@10.0.0.1:7001, tcp@10.0.0.1:9999, unix@/tmp/geerpc.sock,
+// tls@10.0.0.1:9999 and unix+tls@/tmp/geerpc.sock for TLS, see DialTLS,
+// quic@10.0.0.1:9999 for a call per QUIC stream configured by TLSConfig of Option, see DialQUIC,
+// kcp@10.0.0.1:9999 for KCP over UDP, see ListenKCP,
+// h2@10.0.0.1:7001 for a call per HTTP/2 stream, see DialHTTP2,
+// httppoll@10.0.0.1:7001 for a POST request per call, see DialHTTPPoll,
+// mem@serviceA for a connection in memory, see ListenMem,
+// ssh@user@bastion/10.0.0.1:9999 through an SSH bastion configured by SSHConfig of Option,
+// mux@10.0.0.1:9999 for a call per stream of a TCP connection shared by clients, see DialMux,
+// socks5@proxyhost:1080/10.0.0.1:9999 through a SOCKS5 proxy, with user:password@ before
+// proxyhost if it needs
 func XDial(rpcAddr string, opts ...*Option) (*Client, error) {
-	parts := strings.Split(rpcAddr, "@")
-	if len(parts) != 2 {
+	protocol, addr, ok := strings.Cut(rpcAddr, "@")
+	if !ok || protocol == "" || addr == "" {
 		return nil, fmt.Errorf("rpc client err: wrong format '%s', expect protocol@addr", rpcAddr)
 	}
-	protocol, addr := parts[0], parts[1]
 	switch protocol {
 	case "http":
 		return DialHTTP("tcp", addr, opts...)
+	case "h2":
+		return DialHTTP2(addr, opts...)
+	case "httppoll":
+		return DialHTTPPoll(addr, opts...)
+	case "quic":
+		return DialQUIC(addr, opts...)
+	case "mux":
+		return DialMux(addr, opts...)
+	case "tls":
+		return DialTLS("tcp", addr, opts...)
+	case "unix+tls":
+		return DialTLS("unix", addr, opts...)
 	default:
 		// tcp, unix or other transport protocol
 		return Dial(protocol, addr, opts...)
 	}
 }
 
+// DialTLS connects to an RPC server over TLS on network "tcp" or "unix",
+// configured by TLSConfig of Option, which verifies the server as the host of
+// address by default, so ServerName of it must be set for a unix socket
+func DialTLS(network, address string, opts ...*Option) (*Client, error) {
+	switch network {
+	case "tcp":
+		return Dial("tls", address, opts...)
+	case "unix":
+		return Dial("unix+tls", address, opts...)
+	default:
+		return nil, fmt.Errorf("rpc client err: TLS over %s is not supported", network)
+	}
+}
+
 // DialHTTP connects to an HTTP RPC server at the specified network address
 // listening on the default HTTP RPC path.
 func DialHTTP(network, address string, opts ...*Option) (*Client, error) {
@@ -2,6 +2,13 @@ package myRPC
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"net"
 	"os"
 	"runtime"
@@ -53,7 +60,8 @@ func TestClient_Call(t *testing.T) {
 	time.Sleep(time.Second)
 	t.Run("client timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr)
-		ctx, _ := context.WithTimeout(context.Background(), time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
 		var reply int
 		err := client.Call(ctx, "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), ctx.Err().Error()), "expect a timeout error")
@@ -70,19 +78,85 @@ func TestClient_Call(t *testing.T) {
 
 func TestXDial(t *testing.T) {
 	if runtime.GOOS == "linux" {
-		ch := make(chan struct{})
 		addr := "/tmp/geerpc.sock"
-		go func() {
-			_ = os.Remove(addr)
-			l, err := net.Listen("unix", addr)
-			if err != nil {
-				t.Fatal("failed to listen unix socket")
-			}
-			ch <- struct{}{}
-			Accept(l)
-		}()
-		<-ch
-		_, err := XDial("unix@" + addr)
+		_ = os.Remove(addr)
+		l, err := net.Listen("unix", addr)
+		if err != nil {
+			t.Fatal("failed to listen unix socket")
+		}
+		go Accept(l)
+		_, err = XDial("unix@" + addr)
 		_assert(err == nil, "failed to connect unix socket")
 	}
 }
+
+// newServerCert returns a self-signed certificate of a server at 127.0.0.1 and the pool trusting it
+func newServerCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "myrpc server"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("failed to create certificate:", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, roots
+}
+
+func TestXDial_TLS(t *testing.T) {
+	cert, roots := newServerCert(t)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+	defer func() { _ = l.Close() }()
+	server := NewServer()
+	var b Bar
+	_ = server.Register(&b)
+	go server.Accept(l)
+
+	if _, err := XDial("tls@"+l.Addr().String(), &Option{ConnectTimeout: time.Second}); err == nil {
+		t.Fatal("expect the certificate of server not trusted")
+	}
+	client, err := XDial("tls@"+l.Addr().String(), &Option{ConnectTimeout: time.Second, TLSConfig: &tls.Config{RootCAs: roots}})
+	if err != nil {
+		t.Fatal("failed to connect over TLS:", err)
+	}
+	_ = client.Close()
+}
+
+func TestXDial_UnixTLS(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("unix sockets are tested on linux")
+	}
+	cert, roots := newServerCert(t)
+	addr := t.TempDir() + "/myrpc.sock"
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal("failed to listen unix socket:", err)
+	}
+	l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+	defer func() { _ = l.Close() }()
+	server := NewServer()
+	var b Bar
+	_ = server.Register(&b)
+	go server.Accept(l)
+
+	// the server is verified by ServerName, as a unix socket has no host
+	client, err := XDial("unix+tls@"+addr, &Option{ConnectTimeout: time.Second, TLSConfig: &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}})
+	if err != nil {
+		t.Fatal("failed to connect over TLS on unix socket:", err)
+	}
+	_ = client.Close()
+
+	if _, err = DialTLS("udp", "127.0.0.1:1"); err == nil {
+		t.Fatal("expect TLS over udp not supported")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// stubMethod is a method of a service called by the stub
+type stubMethod struct {
+	Name      string
+	ArgType   string
+	ReplyType string // the type pointed by the reply of the method
+}
+
+type stub struct {
+	Command string
+	Package string
+	Type    string
+	Service string
+	Imports []string // quoted paths, with names if they're not the last element
+	Methods []stubMethod
+}
+
+var stubText = `// Code generated by {{.Command}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+	"myRPC/xclient"
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+
+// {{.Type}}Client is a typed client of service {{.Service}}
+type {{.Type}}Client struct {
+	xc *xclient.XClient
+}
+
+// New{{.Type}}Client returns a typed client of service {{.Service}} calling by xc
+func New{{.Type}}Client(xc *xclient.XClient) *{{.Type}}Client {
+	return &{{.Type}}Client{xc: xc}
+}
+{{range .Methods}}
+// {{.Name}} calls {{$.Service}}.{{.Name}}
+func (c *{{$.Type}}Client) {{.Name}}(ctx context.Context, args {{.ArgType}}, opts ...xclient.CallOption) ({{.ReplyType}}, error) {
+	var reply {{.ReplyType}}
+	err := c.xc.Call(ctx, "{{$.Service}}.{{.Name}}", args, &reply, opts...)
+	return reply, err
+}
+{{end}}`
+
+var stubTemplate = template.Must(template.New("stub").Parse(stubText))
+
+// generate returns the source of a typed client of the service of typeName, which is
+// a struct or an interface declared in files of a package, service is its name in calls.
+// Methods are taken like servers register them, that is exported methods like
+// func(args A, reply *R) error, or with a context.Context first, others are skipped.
+func generate(fset *token.FileSet, files []*ast.File, typeName, service, command string) ([]byte, error) {
+	var file *ast.File
+	var typ ast.Expr
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if spec, ok := n.(*ast.TypeSpec); ok && spec.Name.Name == typeName {
+				file, typ = f, spec.Type
+			}
+			return typ == nil
+		})
+	}
+	if typ == nil {
+		return nil, fmt.Errorf("myrpc-gen: type %s not found", typeName)
+	}
+	s := &stub{Command: command, Package: file.Name.Name, Type: typeName, Service: service}
+	imports := make(map[string]bool)
+	add := func(f *ast.File, name string, ft *ast.FuncType) {
+		m, ok := stubMethodOf(fset, f, name, ft, imports)
+		if ok {
+			s.Methods = append(s.Methods, m)
+		}
+	}
+	if iface, ok := typ.(*ast.InterfaceType); ok {
+		for _, field := range iface.Methods.List {
+			if ft, ok := field.Type.(*ast.FuncType); ok && len(field.Names) == 1 {
+				add(file, field.Names[0].Name, ft)
+			}
+		}
+	} else {
+		for _, f := range files {
+			for _, decl := range f.Decls {
+				if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv != nil && receiverName(fd.Recv) == typeName {
+					add(f, fd.Name.Name, fd.Type)
+				}
+			}
+		}
+	}
+	if len(s.Methods) == 0 {
+		return nil, fmt.Errorf("myrpc-gen: type %s has no method to call", typeName)
+	}
+	sort.Slice(s.Methods, func(i, j int) bool { return s.Methods[i].Name < s.Methods[j].Name })
+	for spec := range imports {
+		if spec != `"context"` && spec != `"myRPC/xclient"` { // imported by the stub already
+			s.Imports = append(s.Imports, spec)
+		}
+	}
+	sort.Strings(s.Imports)
+	var buf bytes.Buffer
+	if err := stubTemplate.Execute(&buf, s); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// receiverName returns the name of the type of a receiver, T of both T and *T
+func receiverName(recv *ast.FieldList) string {
+	if len(recv.List) != 1 {
+		return ""
+	}
+	t := recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	if ident, ok := t.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// stubMethodOf returns the stub of method name of type ft declared in f, and adds
+// imports of packages its types refer to, it returns false if the method can't be called
+func stubMethodOf(fset *token.FileSet, f *ast.File, name string, ft *ast.FuncType, imports map[string]bool) (stubMethod, bool) {
+	if !ast.IsExported(name) || ft.Results == nil || len(ft.Results.List) != 1 || len(ft.Results.List[0].Names) > 1 {
+		return stubMethod{}, false
+	}
+	if ident, ok := ft.Results.List[0].Type.(*ast.Ident); !ok || ident.Name != "error" {
+		return stubMethod{}, false
+	}
+	var params []ast.Expr
+	for _, field := range ft.Params.List {
+		for i := 0; i < max(len(field.Names), 1); i++ {
+			params = append(params, field.Type)
+		}
+	}
+	if len(params) == 3 && isContext(f, params[0]) {
+		params = params[1:]
+	}
+	if len(params) != 2 {
+		return stubMethod{}, false
+	}
+	reply, ok := params[1].(*ast.StarExpr)
+	if !ok {
+		return stubMethod{}, false
+	}
+	for _, t := range []ast.Expr{params[0], reply.X} {
+		for pkg := range packagesOf(t) {
+			if spec, _, ok := importOf(f, pkg); ok {
+				imports[spec] = true
+			}
+		}
+	}
+	return stubMethod{Name: name, ArgType: exprString(fset, params[0]), ReplyType: exprString(fset, reply.X)}, true
+}
+
+// isContext reports whether t is context.Context of the context package imported by f
+func isContext(f *ast.File, t ast.Expr) bool {
+	sel, ok := t.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Context" {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, path, ok := importOf(f, pkg.Name)
+	return ok && path == "context"
+}
+
+// packagesOf returns names of packages types in t refer to
+func packagesOf(t ast.Expr) map[string]bool {
+	pkgs := make(map[string]bool)
+	ast.Inspect(t, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				pkgs[ident.Name] = true
+			}
+			return false
+		}
+		return true
+	})
+	return pkgs
+}
+
+// importOf returns the import spec of package pkg in f, like "path" or name "path",
+// and its path
+func importOf(f *ast.File, pkg string) (spec, path string, ok bool) {
+	for _, is := range f.Imports {
+		path, _ = strconv.Unquote(is.Path.Value)
+		switch {
+		case is.Name != nil && is.Name.Name == pkg:
+			return is.Name.Name + " " + is.Path.Value, path, true
+		case is.Name == nil && path[strings.LastIndex(path, "/")+1:] == pkg:
+			return is.Path.Value, path, true
+		}
+	}
+	return "", "", false
+}
+
+func exprString(fset *token.FileSet, e ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, e)
+	return buf.String()
+}
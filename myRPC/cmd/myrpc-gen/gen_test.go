@@ -0,0 +1,102 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const source = `package svc
+
+import (
+	"context"
+	"time"
+
+	stdctx "context"
+)
+
+type Args struct{ Num1, Num2 int }
+
+type Foo int
+
+func (f Foo) Sum(args Args, reply *int) error { return nil }
+
+func (f *Foo) Wait(ctx context.Context, d time.Duration, reply *[]time.Time) error { return nil }
+
+func (f Foo) Other(ctx stdctx.Context, args *Args, reply *map[string]int) error { return nil }
+
+func (f Foo) notExported(args Args, reply *int) error { return nil }
+
+func (f Foo) NoPointer(args Args, reply int) error { return nil }
+
+func (f Foo) Two(args Args, reply *int) (int, error) { return 0, nil }
+
+type Greeter interface {
+	Hello(ctx context.Context, name string, reply *string) error
+	Bad(name string) error
+}
+`
+
+func parse(t *testing.T) (*token.FileSet, []*ast.File) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "svc.go", source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fset, []*ast.File{f}
+}
+
+func TestGenerate(t *testing.T) {
+	fset, files := parse(t)
+	src, err := generate(fset, files, "Foo", "Foo", "myrpc-gen -type Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parser.ParseFile(token.NewFileSet(), "foo_client.go", src, 0); err != nil {
+		t.Fatalf("expect a valid source, but got %v:\n%s", err, src)
+	}
+	stub := string(src)
+	for _, expect := range []string{
+		"// Code generated by myrpc-gen -type Foo. DO NOT EDIT.\n\npackage svc\n",
+		"\t\"context\"\n\t\"myRPC/xclient\"\n\t\"time\"\n)",
+		"func NewFooClient(xc *xclient.XClient) *FooClient {",
+		"func (c *FooClient) Sum(ctx context.Context, args Args, opts ...xclient.CallOption) (int, error) {",
+		`err := c.xc.Call(ctx, "Foo.Sum", args, &reply, opts...)`,
+		"func (c *FooClient) Wait(ctx context.Context, args time.Duration, opts ...xclient.CallOption) ([]time.Time, error) {",
+		"func (c *FooClient) Other(ctx context.Context, args *Args, opts ...xclient.CallOption) (map[string]int, error) {",
+	} {
+		if !strings.Contains(stub, expect) {
+			t.Fatalf("expect %q in the stub, but got:\n%s", expect, stub)
+		}
+	}
+	for _, skipped := range []string{"notExported", "NoPointer", "Two"} {
+		if strings.Contains(stub, skipped) {
+			t.Fatalf("expect %s skipped, but got:\n%s", skipped, stub)
+		}
+	}
+}
+
+func TestGenerate_Interface(t *testing.T) {
+	fset, files := parse(t)
+	src, err := generate(fset, files, "Greeter", "Hi", "myrpc-gen -type Greeter -service Hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := string(src)
+	if !strings.Contains(stub, "func (c *GreeterClient) Hello(ctx context.Context, args string, opts ...xclient.CallOption) (string, error) {") ||
+		!strings.Contains(stub, `"Hi.Hello"`) || strings.Contains(stub, "Bad") {
+		t.Fatalf("unexpected stub:\n%s", stub)
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	fset, files := parse(t)
+	if _, err := generate(fset, files, "Missing", "Missing", ""); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatal("expect an error of a type not found, but got", err)
+	}
+	if _, err := generate(fset, files, "Args", "Args", ""); err == nil || !strings.Contains(err.Error(), "no method") {
+		t.Fatal("expect an error of a type without methods, but got", err)
+	}
+}
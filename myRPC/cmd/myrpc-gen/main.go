@@ -0,0 +1,75 @@
+// Command myrpc-gen generates a typed client stub of a service, so that call sites
+// call methods with concrete types of arguments and replies instead of
+// "Service.Method" and interface{}. It's typically run by go generate, eg,
+//
+//	//go:generate go run myRPC/cmd/myrpc-gen -type Foo
+//
+// which writes foo_client.go with FooClient calling service Foo by an XClient.
+// The type is a struct whose methods are registered by a server, or an interface
+// of such methods, declared in the package of the directory given, "." by default.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "name of the service type, required")
+	service := flag.String("service", "", "name of the service in calls, the type name by default")
+	output := flag.String("o", "", "output file, <type>_client.go in the directory by default")
+	flag.Parse()
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	if *service == "" {
+		*service = *typeName
+	}
+	if *output == "" {
+		*output = filepath.Join(dir, strings.ToLower(*typeName)+"_client.go")
+	}
+	if err := run(dir, *typeName, *service, *output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run generates the stub of typeName declared in the package of dir to output
+func run(dir, typeName, service, output string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") || filepath.Clean(path) == filepath.Clean(output) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	command := "myrpc-gen -type " + typeName
+	if service != typeName {
+		command += " -service " + service
+	}
+	src, err := generate(fset, files, typeName, service, command)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, src, 0644)
+}
@@ -8,6 +8,7 @@ type Header struct {
 	ServiceMethod string
 	Seq           uint64
 	Error         string
+	Metadata      map[string]string // carried with a request, eg, trace context, see myRPC.WithMetadata
 }
 
 type Codec interface {
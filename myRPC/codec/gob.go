@@ -4,7 +4,7 @@ import (
 	"bufio"
 	"encoding/gob"
 	"io"
-	"log"
+	"myRPC/internal/rpclog"
 )
 
 type GobCodec struct {
@@ -46,11 +46,11 @@ func (c *GobCodec) Write(header *Header, body interface{}) (err error) {
 		}
 	}()
 	if err = c.enc.Encode(header); err != nil {
-		log.Println("rpc:gob error encoding header:", err)
+		rpclog.Error("rpc codec: gob encode header", "err", err)
 		return
 	}
 	if err = c.enc.Encode(body); err != nil {
-		log.Println("rpc:gob error encoding body:", err)
+		rpclog.Error("rpc codec: gob encode body", "err", err)
 		return
 	}
 	return
@@ -4,21 +4,66 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
 const debugText = `<html>
 	<body>
 	<title>GeeRPC Services</title>
-	{{range .}}
+	{{range $svc := .Services}}
 	<hr>
 	Service {{.Name}}
 	<hr>
 		<table>
 		<th align=center>Method</th><th align=center>Calls</th>
+		<th align=center>Calls (1m)</th><th align=center>Errors (1m)</th>
+		<th align=center>p50</th><th align=center>p95</th><th align=center>p99</th>
 		{{range $name, $mtype := .Method}}
 			<tr>
 			<td align=left font=fixed>{{$name}}({{$mtype.ArgType}}, {{$mtype.ReplyType}}) error</td>
 			<td align=center>{{$mtype.NumCalls}}</td>
+			{{with index $svc.Stats $name}}
+			<td align=center>{{.Count}}</td><td align=center>{{.Errors}}</td>
+			<td align=center>{{.P50}}</td><td align=center>{{.P95}}</td><td align=center>{{.P99}}</td>
+			{{end}}
+			</tr>
+		{{end}}
+		</table>
+	{{end}}
+	<hr>
+	Connections
+	<hr>
+		<table>
+		<th align=center>Peer</th><th align=center>Codec</th><th align=center>Age</th><th align=center>In flight</th>
+		{{range .Conns}}
+			<tr>
+			<td align=left font=fixed>{{.Peer}}</td><td align=center>{{.Codec}}</td>
+			<td align=center>{{.Age}}</td><td align=center>{{.InFlight}}</td>
+			</tr>
+		{{end}}
+		</table>
+	{{range .Clients}}
+	<hr>
+	Client {{.Name}}{{with .State.RefreshError}} (last refresh err: {{.}}){{end}}
+	<hr>
+		{{with .State.Servers}}
+		<table>
+		<th align=center>Server</th><th align=center>Healthy</th><th align=center>Connections</th>
+		{{range .}}
+			<tr>
+			<td align=left font=fixed>{{.Addr}}</td><td align=center>{{.Healthy}}</td><td align=center>{{.Connections}}</td>
+			</tr>
+		{{end}}
+		</table>
+		{{end}}
+		<table>
+		<th align=center>Seq</th><th align=center>Method</th><th align=center>Server</th><th align=center>Age</th>
+		{{range .State.Pending}}
+			<tr>
+			<td align=center>{{.Seq}}</td><td align=left font=fixed>{{.ServiceMethod}}</td>
+			<td align=left font=fixed>{{.Server}}</td><td align=center>{{.Age}}</td>
 			</tr>
 		{{end}}
 		</table>
@@ -35,21 +80,133 @@ type debugHTTP struct {
 type debugService struct {
 	Name   string
 	Method map[string]*methodType
+	Stats  map[string]MethodStats // statistics of the latest minute by method
+}
+
+type debugClient struct {
+	Name  string
+	State ClientState
+}
+
+// ConnState is the state of a connection being served
+type ConnState struct {
+	Peer     string // address of the client, empty if it's unknown
+	Codec    string
+	Age      time.Duration
+	InFlight int // requests being handled
+}
+
+// PendingCall is a call waiting for its response
+type PendingCall struct {
+	Seq           uint64
+	ServiceMethod string
+	Server        string // address of the server, empty if it's unknown
+	Age           time.Duration
+}
+
+// ServerState is the state of a server discovered by a client
+type ServerState struct {
+	Addr        string
+	Healthy     bool // false if it failed the latest health check
+	Connections int  // connections dialed to it
+}
+
+// ClientState is the state of a client shown on the debug page
+type ClientState struct {
+	Pending      []PendingCall // by age, the oldest first
+	Servers      []ServerState // discovered, empty for a Client
+	RefreshError string        // of the latest refresh of discovery, empty if it succeeded
+}
+
+// DebugClient is a client shown on the debug page, eg, *Client or *xclient.XClient
+type DebugClient interface {
+	DebugState() ClientState
+}
+
+// Conns returns the state of connections being served, the oldest first
+func (server *Server) Conns() []ConnState {
+	now := time.Now()
+	server.mu.Lock()
+	conns := make([]ConnState, 0, len(server.conns))
+	for sc := range server.conns {
+		conns = append(conns, ConnState{Peer: sc.peer, Codec: sc.codec, Age: now.Sub(sc.opened), InFlight: sc.pending})
+	}
+	server.mu.Unlock()
+	sort.Slice(conns, func(i, j int) bool { return conns[i].Age > conns[j].Age })
+	return conns
+}
+
+// AddDebugClient shows the pending calls of client on the debug page under name,
+// and the discovery state of it if it's an XClient. Nil removes the client of name.
+func (server *Server) AddDebugClient(name string, client DebugClient) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if client == nil {
+		delete(server.debugClients, name)
+		return
+	}
+	if server.debugClients == nil {
+		server.debugClients = make(map[string]DebugClient)
+	}
+	server.debugClients[name] = client
+}
+
+// PendingCalls returns calls waiting for their responses, the oldest first
+func (client *Client) PendingCalls() []PendingCall {
+	now := time.Now()
+	client.mu.Lock()
+	calls := make([]PendingCall, 0, len(client.pending))
+	for _, call := range client.pending {
+		calls = append(calls, PendingCall{Seq: call.Seq, ServiceMethod: call.ServiceMethod, Server: client.peer, Age: now.Sub(call.sent)})
+	}
+	client.mu.Unlock()
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Seq < calls[j].Seq })
+	return calls
+}
+
+// DebugState returns the pending calls of client
+func (client *Client) DebugState() ClientState {
+	return ClientState{Pending: client.PendingCalls()}
 }
 
 // Runs at /debug/geerpc
 func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Build a sorted version of the data.
 	var services []debugService
+	stats := server.MethodStats()
 	server.serviceMap.Range(func(namei, svci interface{}) bool {
 		svc := svci.(*service)
-		services = append(services, debugService{
+		ds := debugService{
 			Name:   namei.(string),
 			Method: svc.methods,
-		})
+			Stats:  make(map[string]MethodStats),
+		}
+		for _, s := range stats {
+			if s.Method[:strings.LastIndex(s.Method, ".")] == ds.Name {
+				ds.Stats[s.Method[len(ds.Name)+1:]] = s
+			}
+		}
+		services = append(services, ds)
 		return true
 	})
-	err := debug.Execute(w, services)
+	server.mu.Lock()
+	clients := make([]debugClient, 0, len(server.debugClients))
+	sources := make([]DebugClient, 0, len(server.debugClients))
+	for name, c := range server.debugClients {
+		clients = append(clients, debugClient{Name: name})
+		sources = append(sources, c)
+	}
+	server.mu.Unlock()
+	// states are taken without the lock of server, a client may be served by it
+	for i := range clients {
+		clients[i].State = sources[i].DebugState()
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+	err := debug.Execute(w, struct {
+		Services []debugService
+		Conns    []ConnState
+		Clients  []debugClient
+	}{services, server.Conns(), clients})
 	if err != nil {
 		_, _ = fmt.Fprintln(w, "rpc: error executing template:", err.Error())
 	}
@@ -0,0 +1,58 @@
+package myRPC
+
+import (
+	"context"
+	"myRPC/codec"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_DebugConns(t *testing.T) {
+	server := NewServer()
+	var slow Slow
+	_ = server.Register(&slow)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	server.AddDebugClient("loopback", client)
+
+	var reply int
+	call := client.Go("Slow.Sleep", time.Millisecond*300, &reply, make(chan *Call, 1))
+	time.Sleep(time.Millisecond * 100)
+
+	conns := server.Conns()
+	if len(conns) != 1 || conns[0].Codec != string(codec.GobType) || conns[0].InFlight != 1 || conns[0].Age <= 0 ||
+		!strings.HasPrefix(conns[0].Peer, "127.0.0.1:") {
+		t.Fatalf("unexpected connections %+v", conns)
+	}
+	pending := client.PendingCalls()
+	if len(pending) != 1 || pending[0].ServiceMethod != "Slow.Sleep" || pending[0].Server != l.Addr().String() {
+		t.Fatalf("unexpected pending calls %+v", pending)
+	}
+	w := httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath, nil))
+	for _, expect := range []string{conns[0].Peer, "Client loopback", "Slow.Sleep</td>"} {
+		if !strings.Contains(w.Body.String(), expect) {
+			t.Fatalf("expect %q on the debug page, but got %s", expect, w.Body.String())
+		}
+	}
+
+	<-call.Done
+	if pending = client.PendingCalls(); len(pending) != 0 {
+		t.Fatalf("expect no pending call, but got %+v", pending)
+	}
+	server.AddDebugClient("loopback", nil)
+	w = httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath, nil))
+	if strings.Contains(w.Body.String(), "Client loopback") {
+		t.Fatal("expect the client removed from the debug page")
+	}
+}
@@ -0,0 +1,161 @@
+package myRPC
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultErrorRateWindow   = time.Second * 10
+	defaultErrorRateMinCalls = 10
+	errorRateSlots           = 10
+)
+
+// ErrorRateAlert reports the error rate of a method or a connection crossing its threshold
+type ErrorRateAlert struct {
+	Method  string  // "<service>.<method>", empty for a connection
+	Peer    string  // address of the connection, empty for a method
+	Rate    float64 // ratio of failed calls in the window
+	Calls   uint64  // calls in the window
+	Tripped bool    // true when the rate reaches the threshold, false when it's back below
+}
+
+// ErrorRateConfig is the config of tracking error rates, see Server.SetErrorRate
+type ErrorRateConfig struct {
+	Window    time.Duration // sliding window of rates, 10s by default
+	Threshold float64       // ratio of failed calls tripping an alert, eg, 0.5
+	MinCalls  uint64        // calls needed in the window to trip an alert, 10 by default
+	// OnAlert is called when a rate reaches the threshold or is back below it,
+	// it's called synchronously by the call crossing, so it should be fast
+	OnAlert func(alert ErrorRateAlert)
+}
+
+// SetErrorRate makes the server track error rates of each method and each connection
+// in a sliding window, and call OnAlert of config when they cross the threshold.
+// Nil means no tracking. It should be called before serving.
+func (server *Server) SetErrorRate(config *ErrorRateConfig) {
+	if config == nil {
+		server.errorRate = nil
+		return
+	}
+	c := *config
+	if c.Window <= 0 {
+		c.Window = defaultErrorRateWindow
+	}
+	if c.MinCalls == 0 {
+		c.MinCalls = defaultErrorRateMinCalls
+	}
+	server.errorRate = &errorRateTracker{
+		config:  c,
+		methods: make(map[string]*errorWindow),
+		peers:   make(map[string]*errorWindow),
+	}
+}
+
+// errorRateTracker tracks error rates of methods and connections
+type errorRateTracker struct {
+	config  ErrorRateConfig
+	mu      sync.Mutex
+	methods map[string]*errorWindow
+	peers   map[string]*errorWindow // by address of connections
+	swept   int64                   // epoch of slots when windows idle were removed
+}
+
+// errorWindow is a ring of slots of a sliding window
+type errorWindow struct {
+	slots   [errorRateSlots]errorSlot
+	tripped bool
+	last    int64 // epoch of the latest call
+}
+
+type errorSlot struct {
+	epoch  int64
+	calls  uint64
+	errors uint64
+}
+
+// add records a call at epoch, and returns calls and errors in the window
+func (w *errorWindow) add(epoch int64, failed bool) (calls, errors uint64) {
+	slot := &w.slots[epoch%errorRateSlots]
+	if slot.epoch != epoch {
+		*slot = errorSlot{epoch: epoch}
+	}
+	slot.calls++
+	if failed {
+		slot.errors++
+	}
+	w.last = epoch
+	for _, s := range w.slots {
+		if epoch-s.epoch < errorRateSlots {
+			calls += s.calls
+			errors += s.errors
+		}
+	}
+	return
+}
+
+// record records a call of serviceMethod from peer, and calls OnAlert for rates crossing
+func (t *errorRateTracker) record(serviceMethod, peer string, err error) {
+	epoch := time.Now().UnixNano() / int64(t.config.Window/errorRateSlots)
+	var alerts []ErrorRateAlert
+	t.mu.Lock()
+	if epoch-t.swept >= errorRateSlots {
+		alerts = t.sweep(epoch)
+	}
+	if alert, ok := t.add(t.methods, serviceMethod, epoch, err != nil); ok {
+		alert.Method = serviceMethod
+		alerts = append(alerts, alert)
+	}
+	if peer != "" {
+		if alert, ok := t.add(t.peers, peer, epoch, err != nil); ok {
+			alert.Peer = peer
+			alerts = append(alerts, alert)
+		}
+	}
+	t.mu.Unlock()
+	for _, alert := range alerts {
+		if t.config.OnAlert != nil {
+			t.config.OnAlert(alert)
+		}
+	}
+}
+
+// add records a call in the window of key, and returns an alert if its rate crosses, t.mu must be held
+func (t *errorRateTracker) add(windows map[string]*errorWindow, key string, epoch int64, failed bool) (ErrorRateAlert, bool) {
+	w := windows[key]
+	if w == nil {
+		w = &errorWindow{}
+		windows[key] = w
+	}
+	calls, errors := w.add(epoch, failed)
+	rate := float64(errors) / float64(calls)
+	tripped := calls >= t.config.MinCalls && rate >= t.config.Threshold
+	if tripped == w.tripped {
+		return ErrorRateAlert{}, false
+	}
+	w.tripped = tripped
+	return ErrorRateAlert{Rate: rate, Calls: calls, Tripped: tripped}, true
+}
+
+// sweep removes windows without calls in the window, eg, of connections closed,
+// and returns alerts of those tripped being back, t.mu must be held
+func (t *errorRateTracker) sweep(epoch int64) (alerts []ErrorRateAlert) {
+	for key, w := range t.methods {
+		if epoch-w.last >= errorRateSlots {
+			delete(t.methods, key)
+			if w.tripped {
+				alerts = append(alerts, ErrorRateAlert{Method: key})
+			}
+		}
+	}
+	for key, w := range t.peers {
+		if epoch-w.last >= errorRateSlots {
+			delete(t.peers, key)
+			if w.tripped {
+				alerts = append(alerts, ErrorRateAlert{Peer: key})
+			}
+		}
+	}
+	t.swept = epoch
+	return
+}
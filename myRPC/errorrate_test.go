@@ -0,0 +1,95 @@
+package myRPC
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestErrorRateTracker(t *testing.T) {
+	var alerts []ErrorRateAlert
+	server := NewServer()
+	server.SetErrorRate(&ErrorRateConfig{Window: time.Minute, Threshold: .5, MinCalls: 4,
+		OnAlert: func(alert ErrorRateAlert) { alerts = append(alerts, alert) }})
+	tracker := server.errorRate
+	failed := errors.New("failed")
+
+	// not tripped before MinCalls
+	for i := 0; i < 3; i++ {
+		tracker.record("Foo.Sum", "peer1", failed)
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("expect no alert before MinCalls, but got %+v", alerts)
+	}
+	tracker.record("Foo.Sum", "peer1", failed)
+	if len(alerts) != 2 || alerts[0] != (ErrorRateAlert{Method: "Foo.Sum", Rate: 1, Calls: 4, Tripped: true}) ||
+		alerts[1] != (ErrorRateAlert{Peer: "peer1", Rate: 1, Calls: 4, Tripped: true}) {
+		t.Fatalf("unexpected alerts %+v", alerts)
+	}
+	// tripped once until the rate is back below the threshold
+	tracker.record("Foo.Sum", "peer2", failed)
+	if len(alerts) != 2 {
+		t.Fatalf("expect the method tripped once, but got %+v", alerts)
+	}
+	for i := 0; i < 6; i++ {
+		tracker.record("Foo.Sum", "peer2", nil)
+	}
+	if len(alerts) != 3 || alerts[2] != (ErrorRateAlert{Method: "Foo.Sum", Rate: 5.0 / 11, Calls: 11}) {
+		t.Fatalf("expect the method back, but got %+v", alerts)
+	}
+
+	// windows idle are removed, and those tripped are reported back
+	tracker.mu.Lock()
+	for _, w := range tracker.peers {
+		w.last -= errorRateSlots
+	}
+	tracker.swept -= errorRateSlots
+	tracker.mu.Unlock()
+	tracker.record("Foo.Sum", "", nil)
+	if len(alerts) != 4 || alerts[3] != (ErrorRateAlert{Peer: "peer1"}) || len(tracker.peers) != 0 {
+		t.Fatalf("expect peer1 swept, but got %+v", alerts)
+	}
+}
+
+type Flaky int
+
+func (f Flaky) Call(fail bool, reply *int) error {
+	if fail {
+		return errors.New("flaky")
+	}
+	return nil
+}
+
+func TestServer_ErrorRate(t *testing.T) {
+	var mu sync.Mutex
+	var alerts []ErrorRateAlert
+	server := NewServer()
+	var f Flaky
+	_ = server.Register(&f)
+	server.SetErrorRate(&ErrorRateConfig{Threshold: .5, MinCalls: 2, OnAlert: func(alert ErrorRateAlert) {
+		mu.Lock()
+		defer mu.Unlock()
+		alerts = append(alerts, alert)
+	}})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	for i := 0; i < 2; i++ {
+		_ = client.Call(context.Background(), "Flaky.Call", true, &reply)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(alerts) != 2 || alerts[0].Method != "Flaky.Call" || !alerts[0].Tripped || alerts[1].Peer == "" || !alerts[1].Tripped {
+		t.Fatalf("unexpected alerts %+v", alerts)
+	}
+}
@@ -0,0 +1,127 @@
+package myRPC
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is an event of the lifecycle of servers, clients and discoveries, it's one of
+// ConnOpened, ConnClosed, CallStarted, CallFinished, RegistryRefreshed and ServerEvicted
+type Event interface {
+	event()
+}
+
+// ConnOpened is published when a server starts serving a connection
+type ConnOpened struct {
+	Time  time.Time
+	Peer  string // address of the client, empty if it's unknown
+	Codec string
+}
+
+// ConnClosed is published when a server stops serving a connection
+type ConnClosed struct {
+	Time     time.Time
+	Peer     string
+	Codec    string
+	Duration time.Duration // how long the connection was served
+}
+
+// CallStarted is published when a server starts handling a call
+type CallStarted struct {
+	Time      time.Time
+	Method    string // "<service>.<method>"
+	Peer      string
+	RequestID string
+}
+
+// CallFinished is published when a server finishes handling a call
+type CallFinished struct {
+	Time      time.Time
+	Method    string
+	Peer      string
+	RequestID string
+	Duration  time.Duration
+	Err       error
+}
+
+// RegistryRefreshed is published by discoveries of xclient after each refresh
+// of servers from a remote source, eg, a registry, including watches
+type RegistryRefreshed struct {
+	Time    time.Time
+	Servers []string // servers known after the refresh
+	Err     error
+}
+
+// ServerEvicted is published when a server is removed by a registry as it expired
+// or it's evicted by an admin, with Reason "expire" or "evict", or ejected by an
+// XClient as an outlier, with Reason "outlier"
+type ServerEvicted struct {
+	Time   time.Time
+	Addr   string
+	Reason string
+}
+
+func (ConnOpened) event()        {}
+func (ConnClosed) event()        {}
+func (CallStarted) event()       {}
+func (CallFinished) event()      {}
+func (RegistryRefreshed) event() {}
+func (ServerEvicted) event()     {}
+
+// EventBus dispatches events to subscribers, the zero value is ready to use.
+// Servers, XClients, discoveries and registries publish their events on a bus
+// of their own, eg, see Server.Events.
+type EventBus struct {
+	mu          sync.RWMutex
+	next        int
+	subscribers map[int]func(Event)
+	count       atomic.Int32 // subscribers, to publish nothing at once if there is none
+}
+
+// Subscribe calls handler with each event published on b until unsubscribe is called.
+// Handlers are called synchronously by the code path publishing, which may hold locks,
+// so they should return quickly and not call back into it.
+func (b *EventBus) Subscribe(handler func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[int]func(Event))
+	}
+	id := b.next
+	b.next++
+	b.subscribers[id] = handler
+	b.count.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+			b.count.Add(-1)
+		})
+	}
+}
+
+// Publish calls subscribers with event, it's used by packages of myRPC and plugins.
+// Handlers are called without the lock of b, so they may subscribe or unsubscribe.
+func (b *EventBus) Publish(event Event) {
+	if b.count.Load() == 0 {
+		return
+	}
+	b.mu.RLock()
+	handlers := make([]func(Event), 0, len(b.subscribers))
+	for _, handler := range b.subscribers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Subscribed reports whether anyone subscribes events of b, so that building an event
+// can be skipped if nobody listens
+func (b *EventBus) Subscribed() bool {
+	return b.count.Load() > 0
+}
@@ -0,0 +1,99 @@
+package myRPC
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	var mu sync.Mutex
+	var events []Event
+	server := NewServer()
+	unsubscribe := server.Events().Subscribe(func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(conn, DefaultOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply int
+	_ = client.Call(WithRequestID(context.Background(), "req-1"), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	peer := conn.LocalAddr().String()
+	_ = client.Close()
+	_ = server.Shutdown(context.Background())
+	// the connection is closed by the server once it reads EOF
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond * 10) {
+		mu.Lock()
+		closed := false
+		for _, event := range events {
+			if e, ok := event.(ConnClosed); ok && e.Peer == peer {
+				closed = true
+			}
+		}
+		mu.Unlock()
+		if closed {
+			break
+		}
+	}
+	unsubscribe()
+	unsubscribe() // no-op
+	server.Events().Publish(ServerEvicted{Addr: "tcp@127.0.0.1:1", Reason: "evict"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	var opened, started, finished, closed bool
+	for _, event := range events {
+		switch e := event.(type) {
+		case ConnOpened:
+			opened = opened || e.Peer == peer && e.Codec == string(DefaultOption.CodecType)
+		case CallStarted:
+			started = started || e.Method == "Foo.Sum" && e.RequestID == "req-1" && e.Peer == peer
+		case CallFinished:
+			finished = finished || e.Method == "Foo.Sum" && e.Err == nil && e.Duration > 0 && e.RequestID == "req-1"
+		case ConnClosed:
+			closed = closed || e.Peer == peer && e.Duration > 0
+		case ServerEvicted:
+			t.Fatal("expect no event after unsubscribe, but got", e)
+		}
+	}
+	if !opened || !started || !finished || !closed {
+		t.Fatalf("expect events of the connection and call, but got %+v", events)
+	}
+}
+
+func TestEventBus_Unsubscribe(t *testing.T) {
+	var bus EventBus
+	var calls int
+	var unsubscribe func()
+	unsubscribe = bus.Subscribe(func(Event) {
+		calls++
+		unsubscribe()
+	})
+	done := make(chan struct{})
+	go func() {
+		bus.Publish(ServerEvicted{})
+		bus.Publish(ServerEvicted{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect a handler to unsubscribe while it's called")
+	}
+	if calls != 1 || bus.Subscribed() {
+		t.Fatalf("expect the handler called once and unsubscribed, but it's called %d times", calls)
+	}
+}
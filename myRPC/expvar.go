@@ -0,0 +1,77 @@
+package myRPC
+
+import (
+	"expvar"
+	"io"
+	"sync/atomic"
+)
+
+// counters of all servers and clients in the process, published by expvar at
+// /debug/vars for deployments without Prometheus
+var (
+	serverCalls        = expvar.NewInt("myrpc.server.calls")
+	serverErrors       = expvar.NewInt("myrpc.server.errors")
+	serverConns        = expvar.NewInt("myrpc.server.conns") // connections being served
+	serverBytesRead    = expvar.NewInt("myrpc.server.bytes_read")
+	serverBytesWritten = expvar.NewInt("myrpc.server.bytes_written")
+	clientCalls        = expvar.NewInt("myrpc.client.calls")
+	clientErrors       = expvar.NewInt("myrpc.client.errors")
+	clientPending      = expvar.NewInt("myrpc.client.pending") // calls waiting for responses
+	clientBytesRead    = expvar.NewInt("myrpc.client.bytes_read")
+	clientBytesWritten = expvar.NewInt("myrpc.client.bytes_written")
+)
+
+// countedConn counts bytes read from and written to a connection, both in the counters
+// of the process and of the connection, which tell sizes of frames on it
+type countedConn struct {
+	io.ReadWriteCloser
+	read, written       *expvar.Int
+	connRead, connWrote atomic.Int64
+	preamble            int64 // bytes read before frames, ie, of options, set before serving frames
+}
+
+func (c *countedConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	c.read.Add(int64(n))
+	c.connRead.Add(int64(n))
+	return n, err
+}
+
+func (c *countedConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	c.written.Add(int64(n))
+	c.connWrote.Add(int64(n))
+	return n, err
+}
+
+// framesRead returns bytes read before frames, which sizes of frames read count from,
+// or 0 if c is nil
+func (c *countedConn) framesRead() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.preamble
+}
+
+// readSince returns bytes read since last, and sets last to bytes read so far,
+// or -1 if c is nil. Bytes read ahead by buffers of codecs count in the frame read.
+func (c *countedConn) readSince(last *int64) int64 {
+	if c == nil {
+		return -1
+	}
+	read := c.connRead.Load()
+	size := read - *last
+	*last = read
+	return size
+}
+
+// writtenBy returns bytes written by write, which must not be concurrent with other
+// writes, or -1 if c is nil
+func (c *countedConn) writtenBy(write func() error) (int64, error) {
+	if c == nil {
+		return -1, write()
+	}
+	written := c.connWrote.Load()
+	err := write()
+	return c.connWrote.Load() - written, err
+}
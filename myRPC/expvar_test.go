@@ -0,0 +1,68 @@
+package myRPC
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExpvar(t *testing.T) {
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+
+	before := make(map[string]int64)
+	expvar.Do(func(kv expvar.KeyValue) {
+		if v, ok := kv.Value.(*expvar.Int); ok {
+			before[kv.Key] = v.Value()
+		}
+	})
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	var reply int
+	_ = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_ = client.Call(context.Background(), "Foo.Missing", Args{}, &reply)
+	time.Sleep(time.Millisecond * 50) // let the server finish counting
+
+	// counters are published at /debug/vars
+	w := httptest.NewRecorder()
+	expvar.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars map[string]interface{}
+	if err = json.Unmarshal(w.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	delta := func(name string) int64 {
+		v, ok := vars[name].(float64)
+		if !ok {
+			t.Fatalf("expect %s published, but got %v", name, vars[name])
+		}
+		return int64(v) - before[name]
+	}
+	for name, expect := range map[string]int64{
+		"myrpc.server.calls": 1, "myrpc.server.errors": 0,
+		"myrpc.client.calls": 2, "myrpc.client.errors": 1, "myrpc.client.pending": 0,
+	} {
+		if got := delta(name); got != expect {
+			t.Fatalf("expect %s changed by %d, but got %d", name, expect, got)
+		}
+	}
+	// connections of other tests may be closing, so only this one is sure
+	if conns, _ := vars["myrpc.server.conns"].(float64); conns < 1 {
+		t.Fatalf("expect the connection counted, but got %v", vars["myrpc.server.conns"])
+	}
+	for _, name := range []string{"myrpc.server.bytes_read", "myrpc.server.bytes_written", "myrpc.client.bytes_read", "myrpc.client.bytes_written"} {
+		if delta(name) <= 0 {
+			t.Fatalf("expect %s counted", name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package myRPC
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"myRPC/codec"
+	"myRPC/internal/rpclog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FrameDump dumps frames of connections to debug codec mismatches and protocol errors,
+// each frame with its direction, seq, method and size on the connection, and optionally bytes
+// of connections as they are read and written in hex. It's set on servers by
+// Server.SetFrameDump and on clients by FrameDump of Option, and can be turned on
+// and off at runtime for connections opened already.
+type FrameDump struct {
+	w       io.Writer // frames are logged at info level if it's nil
+	mu      sync.Mutex
+	enabled atomic.Bool
+	hex     atomic.Bool
+}
+
+// NewFrameDump returns a FrameDump writing to w, eg, a file, or logging frames by
+// the logger if w is nil. It's enabled, and dumps bytes in hex if hex is true.
+func NewFrameDump(w io.Writer, hex bool) *FrameDump {
+	d := &FrameDump{w: w}
+	d.enabled.Store(true)
+	d.hex.Store(hex)
+	return d
+}
+
+// SetEnabled turns dumping on or off
+func (d *FrameDump) SetEnabled(enabled bool) {
+	d.enabled.Store(enabled)
+}
+
+// SetHex turns dumping bytes in hex on or off
+func (d *FrameDump) SetHex(hex bool) {
+	d.hex.Store(hex)
+}
+
+// SetFrameDump makes the server dump frames of connections served by d,
+// nil means no dump. It should be called before serving.
+func (server *Server) SetFrameDump(d *FrameDump) {
+	server.frameDump = d
+}
+
+// frame dumps a frame sent or received on the connection of peer, size is bytes of it
+// read or written on the connection, -1 if it's unknown. It must be enabled.
+func (d *FrameDump) frame(direction, peer string, h *codec.Header, size int64, err error) {
+	if d.w == nil {
+		rpclog.Info("rpc frame", "direction", direction, "peer", peer, "seq", h.Seq, "method", h.ServiceMethod,
+			"size", size, "error", h.Error, "err", err)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, _ = fmt.Fprintf(d.w, "%s %s peer=%s seq=%d method=%s size=%d error=%q err=%v\n",
+		time.Now().Format(time.RFC3339Nano), direction, peer, h.Seq, h.ServiceMethod, size, h.Error, err)
+}
+
+// bytes dumps bytes read or written on the connection of peer in hex
+func (d *FrameDump) bytes(direction, peer string, p []byte) {
+	if len(p) == 0 || !d.enabled.Load() || !d.hex.Load() {
+		return
+	}
+	if d.w == nil {
+		rpclog.Info("rpc frame bytes", "direction", direction, "peer", peer, "size", len(p), "hex", hex.EncodeToString(p))
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, _ = fmt.Fprintf(d.w, "%s %s peer=%s bytes=%d\n%s", time.Now().Format(time.RFC3339Nano), direction, peer, len(p), hex.Dump(p))
+}
+
+// conn returns conn dumping bytes read and written by d
+func (d *FrameDump) conn(conn io.ReadWriteCloser, peer string) *dumpConn {
+	return &dumpConn{ReadWriteCloser: conn, d: d, peer: peer}
+}
+
+// codec returns cc dumping frames by d, conn is the connection of cc counting bytes
+// of frames, or nil if there is none
+func (d *FrameDump) codec(cc codec.Codec, peer string, conn *countedConn) codec.Codec {
+	return &dumpCodec{Codec: cc, d: d, peer: peer, conn: conn, read: conn.framesRead()}
+}
+
+// dumpConn dumps bytes read and written
+type dumpConn struct {
+	io.ReadWriteCloser
+	d    *FrameDump
+	peer string
+}
+
+func (c *dumpConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	c.d.bytes("read", c.peer, p[:n])
+	return n, err
+}
+
+func (c *dumpConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	c.d.bytes("write", c.peer, p[:n])
+	return n, err
+}
+
+// dumpCodec dumps a frame received once its body is read, and a frame sent once it's
+// written. Sizes of frames received include bytes read ahead by buffers of the codec.
+type dumpCodec struct {
+	codec.Codec
+	d    *FrameDump
+	peer string
+	conn *countedConn // nil if sizes are unknown
+	h    codec.Header // the header read last
+	read int64        // bytes read from conn until the last frame
+}
+
+func (c *dumpCodec) ReadHeader(h *codec.Header) error {
+	err := c.Codec.ReadHeader(h)
+	if err != nil {
+		size := c.conn.readSince(&c.read)
+		if err != io.EOF && c.d.enabled.Load() {
+			c.d.frame("recv", c.peer, h, size, err)
+		}
+		return err
+	}
+	c.h = *h
+	return nil
+}
+
+func (c *dumpCodec) ReadBody(body interface{}) error {
+	err := c.Codec.ReadBody(body)
+	size := c.conn.readSince(&c.read)
+	if c.d.enabled.Load() {
+		c.d.frame("recv", c.peer, &c.h, size, err)
+	}
+	return err
+}
+
+// Write dumps the frame written, writes are not concurrent, so bytes written
+// meanwhile are those of the frame
+func (c *dumpCodec) Write(h *codec.Header, body interface{}) error {
+	size, err := c.conn.writtenBy(func() error { return c.Codec.Write(h, body) })
+	if !c.d.enabled.Load() {
+		return err
+	}
+	c.d.frame("send", c.peer, h, size, err)
+	return err
+}
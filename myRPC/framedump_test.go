@@ -0,0 +1,76 @@
+package myRPC
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameDump(t *testing.T) {
+	var serverBuf, clientBuf safeBuffer
+	serverDump, clientDump := NewFrameDump(&serverBuf, false), NewFrameDump(&clientBuf, true)
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	server.SetFrameDump(serverDump)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+	client, err := Dial("tcp", l.Addr().String(), &Option{FrameDump: clientDump})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	_ = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	// the server dumps a frame sent after the client may have received it
+	waitDumped := func(expect string) string {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond * 10) {
+			if strings.Contains(serverBuf.String(), expect) {
+				break
+			}
+		}
+		return serverBuf.String()
+	}
+	dumped := waitDumped(" send peer=")
+	for _, expect := range []string{" recv peer=127.0.0.1:", " seq=1 method=Foo.Sum size=", " send peer="} {
+		if !strings.Contains(dumped, expect) {
+			t.Fatalf("expect %q dumped by the server, but got %q", expect, dumped)
+		}
+	}
+	if strings.Contains(dumped, "bytes=") {
+		t.Fatalf("expect no bytes dumped without hex, but got %q", dumped)
+	}
+	dumped = clientBuf.String()
+	for _, expect := range []string{" send peer=" + l.Addr().String() + " seq=1 method=Foo.Sum", " write peer=", " read peer=", "00000000  "} {
+		if !strings.Contains(dumped, expect) {
+			t.Fatalf("expect %q dumped by the client, but got %q", expect, dumped)
+		}
+	}
+	// sizes are bytes of frames on the connection
+	for _, direction := range []string{"send", "recv"} {
+		m := regexp.MustCompile(direction + ` peer=\S+ seq=1 method=Foo.Sum size=(\d+) `).FindStringSubmatch(dumped)
+		if m == nil || m[1] == "0" {
+			t.Fatalf("expect the size of the frame %s dumped, but got %q", direction, dumped)
+		}
+	}
+
+	// turned off at runtime
+	serverDump.SetEnabled(false)
+	clientDump.SetEnabled(false)
+	n, m := len(serverBuf.String()), len(clientBuf.String())
+	_ = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	if len(serverBuf.String()) != n || len(clientBuf.String()) != m {
+		t.Fatal("expect nothing dumped once disabled")
+	}
+	serverDump.SetEnabled(true)
+	serverDump.SetHex(true)
+	_ = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	if dumped = waitDumped(" send peer=127.0.0.1:")[n:]; !strings.Contains(dumped, " seq=3 method=Foo.Sum") || !strings.Contains(dumped, " read peer=") {
+		t.Fatalf("expect frames and bytes dumped once enabled, but got %q", dumped)
+	}
+}
@@ -0,0 +1,296 @@
+package myRPC
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// status codes of gRPC
+const (
+	grpcOK               = 0
+	grpcCanceled         = 1
+	grpcUnknown          = 2
+	grpcInvalidArgument  = 3
+	grpcDeadlineExceeded = 4
+	grpcPermissionDenied = 7
+	grpcUnimplemented    = 12
+	grpcInternal         = 13
+	grpcUnavailable      = 14
+	grpcUnauthenticated  = 16
+)
+
+// maxGRPCMessage is the size of a message at most, like the default of gRPC
+const maxGRPCMessage = 4 << 20
+
+// GRPCHandler returns a http.Handler that answers gRPC calls, serve it by an
+// http.Server speaking HTTP/2. A call of "/<package>.<service>/<method>" calls
+// "<service>.<method>", whose argument and reply are the messages as they are if
+// they are []byte, eg, protobuf encoded by generated code, or JSON encoded with
+// content type "application/grpc+json" otherwise. The method is called with the
+// deadline of grpc-timeout if it's set.
+func (server *Server) GRPCHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		contentType := req.Header.Get("Content-Type")
+		if req.Method != http.MethodPost || req.ProtoMajor != 2 || !strings.HasPrefix(contentType, "application/grpc") {
+			http.Error(w, "415 must be gRPC over HTTP/2", http.StatusUnsupportedMediaType)
+			return
+		}
+		sc := server.trackConn(req.Body, req.RemoteAddr, "grpc")
+		defer server.untrackConn(sc)
+		w.Header().Set("Content-Type", contentType)
+		reply, code, msg := server.serveGRPC(sc, req, contentType)
+		if code == grpcOK {
+			_, _ = w.Write(reply)
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+		if msg != "" {
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeGRPCMessage(msg))
+		}
+	})
+}
+
+// serveGRPC calls the method of req, it returns the framed reply, or the status
+// code and message of the error
+func (server *Server) serveGRPC(sc *serverConn, req *http.Request, contentType string) ([]byte, int, string) {
+	serviceMethod := strings.TrimPrefix(req.URL.Path, "/")
+	if i := strings.LastIndex(serviceMethod, "/"); i >= 0 {
+		service := serviceMethod[:i]
+		service = service[strings.LastIndex(service, ".")+1:]
+		serviceMethod = service + "." + serviceMethod[i+1:]
+	}
+	svc, mtype, err := server.findService(serviceMethod)
+	if err != nil {
+		return nil, grpcUnimplemented, err.Error()
+	}
+	ctx := req.Context()
+	if timeout := req.Header.Get("Grpc-Timeout"); timeout != "" {
+		d, err := parseGRPCTimeout(timeout)
+		if err != nil {
+			return nil, grpcInvalidArgument, err.Error()
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	message, err := readGRPCMessage(req.Body)
+	if err != nil {
+		return nil, grpcInvalidArgument, err.Error()
+	}
+	jsonEncoded := contentType == "application/grpc+json"
+	argv, replyv := mtype.newArgv(), mtype.newReplyv()
+	argvi := argv.Interface()
+	if argv.Type().Kind() != reflect.Ptr {
+		argvi = argv.Addr().Interface()
+	}
+	if b, ok := argvi.(*[]byte); ok {
+		*b = message
+	} else if !jsonEncoded {
+		return nil, grpcInvalidArgument, fmt.Sprintf("rpc server: argument of %s needs content type application/grpc+json", serviceMethod)
+	} else if err = json.Unmarshal(message, argvi); err != nil {
+		return nil, grpcInvalidArgument, "rpc server: invalid argument: " + err.Error()
+	}
+	if err = server.authorize(ctx, serviceMethod); err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			return nil, grpcUnauthenticated, err.Error()
+		}
+		return nil, grpcPermissionDenied, err.Error()
+	}
+	if !server.startRequest(sc) {
+		return nil, grpcUnavailable, ErrServerClosed.Error()
+	}
+	err = server.call(ctx, serviceMethod, svc, mtype, argv, replyv)
+	server.finishRequest(sc)
+	if err == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// the reply is of no use to the caller once its deadline has passed
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, grpcCode(err), err.Error()
+	}
+	reply, ok := replyv.Interface().(*[]byte)
+	if !ok {
+		if !jsonEncoded {
+			return nil, grpcInternal, fmt.Sprintf("rpc server: reply of %s needs content type application/grpc+json", serviceMethod)
+		}
+		b, err := json.Marshal(replyv.Interface())
+		if err != nil {
+			return nil, grpcInternal, "rpc server: invalid reply: " + err.Error()
+		}
+		reply = &b
+	}
+	return frameGRPCMessage(*reply), grpcOK, ""
+}
+
+// grpcCode returns the status code of gRPC for an error returned by a method
+func grpcCode(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return grpcDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return grpcCanceled
+	case errors.Is(err, ErrUnauthenticated):
+		return grpcUnauthenticated
+	case errors.Is(err, ErrServerClosed):
+		return grpcUnavailable
+	default:
+		return grpcUnknown
+	}
+}
+
+// parseGRPCTimeout parses grpc-timeout, an integer of at most 8 digits followed by
+// a unit of H, M, S, m, u or n
+func parseGRPCTimeout(timeout string) (time.Duration, error) {
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	if len(timeout) < 2 || len(timeout) > 9 {
+		return 0, fmt.Errorf("rpc grpc: invalid timeout %q", timeout)
+	}
+	unit, ok := units[timeout[len(timeout)-1]]
+	n, err := strconv.ParseUint(timeout[:len(timeout)-1], 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("rpc grpc: invalid timeout %q", timeout)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// formatGRPCTimeout formats d as grpc-timeout in the finest unit fitting in 8 digits
+func formatGRPCTimeout(d time.Duration) string {
+	if ms := d.Milliseconds(); ms < 1e8 {
+		return strconv.FormatInt(max(ms, 1), 10) + "m"
+	}
+	if s := int64(d / time.Second); s < 1e8 {
+		return strconv.FormatInt(s, 10) + "S"
+	}
+	return strconv.FormatInt(min(int64(d/time.Hour), 1e8-1), 10) + "H"
+}
+
+// frameGRPCMessage prefixes message with the uncompressed flag and its length
+func frameGRPCMessage(message []byte) []byte {
+	b := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(message)))
+	return append(b, message...)
+}
+
+// readGRPCMessage reads a framed message from r
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("rpc grpc: read message error: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, fmt.Errorf("rpc grpc: compressed message is not supported")
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > maxGRPCMessage {
+		return nil, fmt.Errorf("rpc grpc: message of %d bytes is larger than %d", n, maxGRPCMessage)
+	}
+	message := make([]byte, n)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("rpc grpc: read message error: %w", err)
+	}
+	return message, nil
+}
+
+// encodeGRPCMessage percent-encodes msg as grpc-message, ie, bytes not printable
+// in ASCII and '%'
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// GRPCRequest is the argument of GRPCProxy.Invoke
+type GRPCRequest struct {
+	Method  string // full method of gRPC, eg, "/helloworld.Greeter/SayHello"
+	Message []byte // the message encoded, eg, in protobuf
+	Subtype string // the content subtype telling the encoding, eg, "json", protobuf if empty
+}
+
+// GRPCProxy is a service forwarding calls to a gRPC server, so myRPC clients reach
+// gRPC services by calling "GRPCProxy.Invoke" with the message encoded, and get
+// the reply message encoded
+type GRPCProxy struct {
+	transport *http.Transport
+	url       string
+}
+
+// NewGRPCProxy returns a GRPCProxy to the gRPC server at address, it speaks HTTP/2
+// over TLS if TLSConfig of Option is set, or unencrypted HTTP/2 otherwise
+func NewGRPCProxy(address string, opts ...*Option) (*GRPCProxy, error) {
+	opt, err := parseOption(opts...)
+	if err != nil {
+		return nil, err
+	}
+	t, scheme := newHTTP2Transport(opt)
+	return &GRPCProxy{transport: t, url: scheme + "://" + address}, nil
+}
+
+// Invoke calls the gRPC method of req with the context of the call, so it's canceled
+// along with the call, an error status of it is returned as an error
+func (p *GRPCProxy) Invoke(ctx context.Context, req GRPCRequest, reply *[]byte) error {
+	message, err := p.invoke(ctx, req)
+	if err != nil {
+		return err
+	}
+	*reply = message
+	return nil
+}
+
+func (p *GRPCProxy) invoke(ctx context.Context, r GRPCRequest) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+r.Method, bytes.NewReader(frameGRPCMessage(r.Message)))
+	if err != nil {
+		return nil, err
+	}
+	contentType := "application/grpc"
+	if r.Subtype != "" {
+		contentType += "+" + r.Subtype
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Te", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", formatGRPCTimeout(time.Until(deadline)))
+	}
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rpc grpc: unexpected HTTP response: %s", resp.Status)
+	}
+	message, readErr := readGRPCMessage(resp.Body)
+	_, _ = io.Copy(io.Discard, resp.Body) // trailers are read at the end of body
+	status, msg := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// trailers only
+		status, msg = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("rpc grpc: invalid status %q", status)
+	}
+	if code != grpcOK {
+		if m, err := url.PathUnescape(msg); err == nil {
+			msg = m
+		}
+		return nil, fmt.Errorf("rpc grpc: code %d: %s", code, msg)
+	}
+	return message, readErr
+}
@@ -0,0 +1,129 @@
+package myRPC
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Raw int
+
+func (r Raw) Echo(args []byte, reply *[]byte) error {
+	*reply = args
+	return nil
+}
+
+func TestGRPCProxy(t *testing.T) {
+	// a gRPC server by GRPCHandler
+	server := NewServer()
+	var foo Foo
+	var raw Raw
+	_ = server.Register(&foo)
+	_ = server.Register(&raw)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	hs := &http.Server{Handler: server.GRPCHandler(), Protocols: new(http.Protocols)}
+	hs.Protocols.SetUnencryptedHTTP2(true)
+	go func() { _ = hs.Serve(l) }()
+	defer func() { _ = hs.Close() }()
+
+	// a myRPC server forwarding calls to it by GRPCProxy
+	proxy, err := NewGRPCProxy(l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to create the proxy:", err)
+	}
+	gateway := NewServer()
+	_ = gateway.Register(proxy)
+	ml, _ := ListenMem("grpc-proxy")
+	go gateway.Accept(ml)
+	defer func() { _ = gateway.Shutdown(context.Background()) }()
+	client, err := XDial("mem@grpc-proxy")
+	if err != nil {
+		t.Fatal("failed to connect to the proxy:", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	tests := []struct {
+		name   string
+		req    GRPCRequest
+		expect string
+		err    string
+	}{
+		{"json", GRPCRequest{Method: "/test.Foo/Sum", Message: []byte(`{"Num1":1,"Num2":2}`), Subtype: "json"}, "3", ""},
+		{"bytes", GRPCRequest{Method: "/test.Raw/Echo", Message: []byte{0, 1, 2}}, "\x00\x01\x02", ""},
+		{"unimplemented", GRPCRequest{Method: "/test.Foo/Unknown", Subtype: "json"}, "", "code 12"},
+		{"not json", GRPCRequest{Method: "/test.Foo/Sum", Message: []byte{1}}, "", "code 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reply []byte
+			err := client.Call(context.Background(), "GRPCProxy.Invoke", tt.req, &reply)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expect an error of %s, but got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil || string(reply) != tt.expect {
+				t.Fatalf("expect reply %q, but got %q, %v", tt.expect, reply, err)
+			}
+		})
+	}
+}
+
+func TestGRPCHandler_Status(t *testing.T) {
+	server := NewServer()
+	var foo Foo
+	var slow Slow
+	_ = server.Register(&foo)
+	_ = server.Register(&slow)
+	server.SetAuth(func(ctx context.Context, serviceMethod string) error {
+		if serviceMethod == "Foo.Sum" {
+			return fmt.Errorf("no token: %w", ErrUnauthenticated)
+		}
+		return nil
+	})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	hs := &http.Server{Handler: server.GRPCHandler(), Protocols: new(http.Protocols)}
+	hs.Protocols.SetUnencryptedHTTP2(true)
+	go func() { _ = hs.Serve(l) }()
+	defer func() { _ = hs.Close() }()
+	proxy, err := NewGRPCProxy(l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to create the proxy:", err)
+	}
+
+	// the call is canceled along with the context passed to Invoke
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	var reply []byte
+	start := time.Now()
+	err = proxy.Invoke(ctx, GRPCRequest{Method: "/test.Slow/Sleep", Message: []byte(`1000000000`), Subtype: "json"}, &reply)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Millisecond*500 {
+		t.Fatalf("expect the call given up at the deadline of Invoke, but got %v after %s", err, time.Since(start))
+	}
+
+	// the method runs past grpc-timeout
+	hr, _ := http.NewRequest(http.MethodPost, "http://"+l.Addr().String()+"/test.Slow/Sleep", strings.NewReader(string(frameGRPCMessage([]byte(`200000000`)))))
+	hr.Header.Set("Content-Type", "application/grpc+json")
+	hr.Header.Set("Grpc-Timeout", "50m")
+	resp, err := proxy.transport.RoundTrip(hr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if code := resp.Trailer.Get("Grpc-Status"); code != "4" {
+		t.Fatalf("expect DEADLINE_EXCEEDED once grpc-timeout has passed, but got %q", code)
+	}
+
+	err = proxy.Invoke(context.Background(), GRPCRequest{Method: "/test.Foo/Sum", Message: []byte(`{}`), Subtype: "json"}, &reply)
+	if err == nil || !strings.Contains(err.Error(), "code 16") {
+		t.Fatal("expect UNAUTHENTICATED for ErrUnauthenticated of auth, but got", err)
+	}
+}
@@ -0,0 +1,223 @@
+package myRPC
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"myRPC/codec"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// handleTimeoutHeader carries HandleTimeout of Option in POST requests,
+// while Content-Type carries CodecType
+const handleTimeoutHeader = "Myrpc-Handle-Timeout"
+
+// DialHTTP2 returns a client calling the server at address over HTTP/2, where each
+// call is a POST request of its own stream to the RPC path, so L7 proxies route
+// calls one by one and a large reply doesn't block others. It speaks HTTP/2 over
+// TLS if TLSConfig of Option is set, or unencrypted HTTP/2 otherwise. The server
+// is served by an http.Server with the Server as handler, see ServeHTTP.
+// Connections are made when calls are sent.
+func DialHTTP2(address string, opts ...*Option) (*Client, error) {
+	opt, err := parseOption(opts...)
+	if err != nil {
+		return nil, err
+	}
+	f := codec.NewCodecFuncMap[opt.CodecType]
+	if f == nil {
+		return nil, fmt.Errorf("invalid codec type %s", opt.CodecType)
+	}
+	t, scheme := newHTTP2Transport(opt)
+	return newPostClient(t, scheme+"://"+address+defaultRPCPath, address, f, opt), nil
+}
+
+// DialHTTPPoll returns a client calling the server at address by plain HTTP, where
+// each call is a POST request to the RPC path held until its reply, like long
+// polling, for networks where only HTTP passes and the CONNECT of DialHTTP is
+// blocked. Proxies are taken from the environment, see http.ProxyFromEnvironment,
+// and HTTPS is spoken if TLSConfig of Option is set. The server is served by an
+// http.Server with the Server as handler, whose WriteTimeout must allow the
+// longest call.
+func DialHTTPPoll(address string, opts ...*Option) (*Client, error) {
+	opt, err := parseOption(opts...)
+	if err != nil {
+		return nil, err
+	}
+	f := codec.NewCodecFuncMap[opt.CodecType]
+	if f == nil {
+		return nil, fmt.Errorf("invalid codec type %s", opt.CodecType)
+	}
+	t := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		DialContext:     (&net.Dialer{Timeout: opt.ConnectTimeout}).DialContext,
+		TLSClientConfig: opt.TLSConfig,
+	}
+	scheme := "http"
+	if opt.TLSConfig != nil {
+		scheme = "https"
+	}
+	return newPostClient(t, scheme+"://"+address+defaultRPCPath, address, f, opt), nil
+}
+
+// newPostClient returns a client posting each call to url of the server at address by t
+func newPostClient(t *http.Transport, url, address string, f codec.NewCodecFunc, opt *Option) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	cc := &postCodec{
+		transport: t,
+		url:       url,
+		opt:       opt,
+		f:         f,
+		ctx:       ctx,
+		cancel:    cancel,
+		replies:   make(chan *postReply),
+	}
+	return newClientCodec(cc, opt, address)
+}
+
+// newHTTP2Transport returns a transport speaking HTTP/2 over TLS if TLSConfig of opt
+// is set, or unencrypted HTTP/2 otherwise, and the URL scheme of it
+func newHTTP2Transport(opt *Option) (*http.Transport, string) {
+	t := &http.Transport{
+		DialContext:     (&net.Dialer{Timeout: opt.ConnectTimeout}).DialContext,
+		TLSClientConfig: opt.TLSConfig,
+		Protocols:       new(http.Protocols),
+	}
+	if opt.TLSConfig != nil {
+		t.Protocols.SetHTTP2(true)
+		return t, "https"
+	}
+	t.Protocols.SetUnencryptedHTTP2(true)
+	return t, "http"
+}
+
+// postCodec is the codec of a client posting calls over HTTP, Write posts a request,
+// and replies are read in the order they arrive
+type postCodec struct {
+	transport *http.Transport
+	url       string
+	opt       *Option
+	f         codec.NewCodecFunc
+	ctx       context.Context
+	cancel    context.CancelFunc
+	replies   chan *postReply
+	reply     *postReply // the reply being read
+}
+
+// postReply is a reply decoded from the response body, or the error of the request
+type postReply struct {
+	cc  codec.Codec
+	err error
+}
+
+var _ codec.Codec = (*postCodec)(nil)
+
+func (c *postCodec) Write(h *codec.Header, body interface{}) error {
+	var buf bytes.Buffer
+	if err := c.f(&postStream{Writer: &buf}).Write(h, body); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(c.opt.CodecType))
+	if c.opt.HandleTimeout > 0 {
+		req.Header.Set(handleTimeoutHeader, c.opt.HandleTimeout.String())
+	}
+	go c.post(req)
+	return nil
+}
+
+// post sends req and passes its reply to ReadHeader
+func (c *postCodec) post(req *http.Request) {
+	reply := &postReply{}
+	resp, err := c.transport.RoundTrip(req)
+	switch {
+	case err != nil:
+		reply.err = err
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		_ = resp.Body.Close()
+		reply.err = fmt.Errorf("rpc client: unexpected HTTP response: %s %s", resp.Status, bytes.TrimSpace(msg))
+	default:
+		reply.cc = c.f(&postStream{Reader: resp.Body, Closer: resp.Body})
+	}
+	select {
+	case c.replies <- reply:
+	case <-c.ctx.Done():
+		if reply.cc != nil {
+			_ = reply.cc.Close()
+		}
+	}
+}
+
+// ReadHeader waits for the next reply, an error of a request breaks the client
+// like an error of a connection does
+func (c *postCodec) ReadHeader(h *codec.Header) error {
+	select {
+	case c.reply = <-c.replies:
+	case <-c.ctx.Done():
+		return net.ErrClosed
+	}
+	if c.reply.err != nil {
+		return c.reply.err
+	}
+	return c.reply.cc.ReadHeader(h)
+}
+
+func (c *postCodec) ReadBody(body interface{}) error {
+	err := c.reply.cc.ReadBody(body)
+	_ = c.reply.cc.Close()
+	c.reply = nil
+	return err
+}
+
+func (c *postCodec) Close() error {
+	c.cancel()
+	c.transport.CloseIdleConnections()
+	return nil
+}
+
+// postStream is a request or response body as the connection of a codec,
+// closing it closes Closer if any
+type postStream struct {
+	io.Reader
+	io.Writer
+	io.Closer
+	once sync.Once
+}
+
+func (s *postStream) Close() (err error) {
+	s.once.Do(func() {
+		if s.Closer != nil {
+			err = s.Closer.Close()
+		}
+	})
+	return err
+}
+
+// servePost serves the call in the body of a POST request, and writes the reply
+// as the response
+func (server *Server) servePost(w http.ResponseWriter, req *http.Request) {
+	opt := Option{MagicNumber: MagicNumber, CodecType: codec.Type(req.Header.Get("Content-Type"))}
+	f := codec.NewCodecFuncMap[opt.CodecType]
+	if f == nil {
+		http.Error(w, fmt.Sprintf("rpc server: invalid codec type %s", opt.CodecType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if timeout := req.Header.Get(handleTimeoutHeader); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			http.Error(w, "rpc server: invalid handle timeout "+timeout, http.StatusBadRequest)
+			return
+		}
+		opt.HandleTimeout = d
+	}
+	w.Header().Set("Content-Type", string(opt.CodecType))
+	// the body ends with the call, calls are canceled once the client gives up the request
+	server.serveCodec(withPeerAddr(req.Context(), req.RemoteAddr), f(&postStream{Reader: req.Body, Writer: w}), &opt, true, nil)
+}
@@ -0,0 +1,79 @@
+package myRPC
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func startHTTP2Server(t *testing.T, config *tls.Config) string {
+	server := NewServer()
+	var foo Foo
+	var s Slow
+	_ = server.Register(&foo)
+	_ = server.Register(&s)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	hs := &http.Server{Handler: server, TLSConfig: config, Protocols: new(http.Protocols)}
+	hs.Protocols.SetHTTP1(true)
+	if config != nil {
+		hs.Protocols.SetHTTP2(true)
+		go func() { _ = hs.ServeTLS(l, "", "") }()
+	} else {
+		hs.Protocols.SetUnencryptedHTTP2(true)
+		go func() { _ = hs.Serve(l) }()
+	}
+	t.Cleanup(func() { _ = hs.Close() })
+	return l.Addr().String()
+}
+
+func TestXDial_HTTP2(t *testing.T) {
+	addr := startHTTP2Server(t, nil)
+	client, err := XDial("h2@" + addr)
+	if err != nil {
+		t.Fatal("failed to connect over HTTP/2:", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	// a slow call doesn't block others
+	slow := client.Go("Slow.Sleep", time.Millisecond*500, new(int), nil)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		var reply int
+		if err = client.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: 2}, &reply); err != nil || reply != i+2 {
+			t.Fatalf("expect the call over HTTP/2 succeeds, but got %d, %v", reply, err)
+		}
+	}
+	if time.Since(start) > time.Millisecond*300 {
+		t.Fatal("expect calls not blocked by the slow call")
+	}
+	if call := <-slow.Done; call.Error != nil {
+		t.Fatal("expect the slow call succeeds, but got", call.Error)
+	}
+
+	// an error of the server doesn't break the client
+	var se ServerError
+	if err = client.Call(context.Background(), "Foo.Unknown", Args{}, new(int)); !errors.As(err, &se) {
+		t.Fatalf("expect a server error, but got %v", err)
+	}
+	if !client.IsAvailable() {
+		t.Fatal("expect the client available after a server error")
+	}
+}
+
+func TestDialHTTP2_TLS(t *testing.T) {
+	cert, roots := newServerCert(t)
+	addr := startHTTP2Server(t, &tls.Config{Certificates: []tls.Certificate{cert}})
+	client, err := DialHTTP2(addr, &Option{TLSConfig: &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}})
+	if err != nil {
+		t.Fatal("failed to connect over HTTP/2:", err)
+	}
+	defer func() { _ = client.Close() }()
+	var reply int
+	if err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect the call over HTTP/2 with TLS succeeds, but got %d, %v", reply, err)
+	}
+}
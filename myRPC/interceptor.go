@@ -0,0 +1,55 @@
+package myRPC
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// Handler handles the call an interceptor wraps, the method is called with ctx
+type Handler func(ctx context.Context) error
+
+// ServerInterceptor wraps each call handled by the server, eg, for tracing or
+// logging. args and reply are those of the method, reply is filled once handler
+// returns. It calls handler to go on with the call, or returns an error to stop it.
+type ServerInterceptor func(ctx context.Context, serviceMethod string, args, reply interface{}, handler Handler) error
+
+// SetInterceptors makes calls handled by the server go through interceptors,
+// the first one is the outermost. It should be called before serving.
+func (server *Server) SetInterceptors(interceptors ...ServerInterceptor) {
+	server.interceptors = interceptors
+}
+
+// call calls the method of svc through interceptors of the server, and records
+// statistics, error rate, audit and events of the call
+func (server *Server) call(ctx context.Context, serviceMethod string, svc *service, mtype *methodType, argv, replyv reflect.Value) error {
+	handler := func(ctx context.Context) error {
+		return svc.call(ctx, mtype, argv, replyv)
+	}
+	for i := len(server.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := server.interceptors[i], handler
+		handler = func(ctx context.Context) error {
+			return interceptor(ctx, serviceMethod, argv.Interface(), replyv.Interface(), next)
+		}
+	}
+	start := time.Now()
+	if server.events.Subscribed() {
+		server.events.Publish(CallStarted{Time: start, Method: serviceMethod, Peer: PeerAddrFrom(ctx), RequestID: RequestIDFrom(ctx)})
+	}
+	err := handler(ctx)
+	if server.events.Subscribed() {
+		now := time.Now()
+		server.events.Publish(CallFinished{Time: now, Method: serviceMethod, Peer: PeerAddrFrom(ctx), RequestID: RequestIDFrom(ctx),
+			Duration: now.Sub(start), Err: err})
+	}
+	server.stats.record(serviceMethod, time.Since(start), err)
+	serverCalls.Add(1)
+	if err != nil {
+		serverErrors.Add(1)
+	}
+	if server.errorRate != nil {
+		server.errorRate.record(serviceMethod, PeerAddrFrom(ctx), err)
+	}
+	server.auditCall(ctx, serviceMethod, argv.Interface(), start, auditStatus(err), err)
+	return err
+}
@@ -0,0 +1,65 @@
+package myRPC
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+type Meta int
+
+type interceptorKey struct{}
+
+func (m Meta) Get(ctx context.Context, key string, value *string) error {
+	*value = IncomingMetadata(ctx)[key]
+	return nil
+}
+
+func TestServer_SetInterceptors(t *testing.T) {
+	server := NewServer()
+	var meta Meta
+	_ = server.Register(&meta)
+	var trace []string
+	denied := errors.New("denied")
+	server.SetInterceptors(
+		func(ctx context.Context, serviceMethod string, args, reply interface{}, handler Handler) error {
+			trace = append(trace, serviceMethod+" "+args.(string))
+			err := handler(context.WithValue(ctx, interceptorKey{}, "outer"))
+			trace = append(trace, "reply "+*reply.(*string))
+			return err
+		},
+		func(ctx context.Context, serviceMethod string, args, reply interface{}, handler Handler) error {
+			if args.(string) == "deny" {
+				return denied
+			}
+			if ctx.Value(interceptorKey{}) != "outer" {
+				return errors.New("expect the context passed by the outer interceptor")
+			}
+			return handler(ctx)
+		},
+	)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	ctx := WithMetadata(WithMetadata(context.Background(), map[string]string{"tenant": "a", "user": "alice"}), map[string]string{"tenant": "b"})
+	var value string
+	if err = client.Call(ctx, "Meta.Get", "tenant", &value); err != nil || value != "b" {
+		t.Fatalf("expect metadata carried to the method, but got %q, %v", value, err)
+	}
+	if err = client.Call(ctx, "Meta.Get", "user", &value); err != nil || value != "alice" {
+		t.Fatalf("expect metadata merged, but got %q, %v", value, err)
+	}
+	if len(trace) != 4 || trace[0] != "Meta.Get tenant" || trace[1] != "reply b" {
+		t.Fatalf("expect interceptors see args and reply, but got %v", trace)
+	}
+	if err = client.Call(context.Background(), "Meta.Get", "deny", &value); err == nil || err.Error() != denied.Error() {
+		t.Fatalf("expect the call stopped by interceptor, but got %v", err)
+	}
+}
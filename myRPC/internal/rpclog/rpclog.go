@@ -0,0 +1,136 @@
+// Package rpclog holds the logger of myRPC shared by its packages, it's set by
+// myRPC.SetLogger
+package rpclog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// Logger logs messages at levels, keyvals are alternating keys and values,
+// eg, Error("rpc server: write response", "err", err)
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// Level is the severity of a message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+type holder struct{ Logger }
+
+var current atomic.Pointer[holder]
+
+func init() {
+	Set(&textLogger{l: log.Default(), level: LevelInfo})
+}
+
+// Set sets the logger, nil disables logging
+func Set(l Logger) {
+	if l == nil {
+		l = nop{}
+	}
+	current.Store(&holder{l})
+}
+
+func Debug(msg string, keyvals ...interface{}) { current.Load().Debug(msg, keyvals...) }
+func Info(msg string, keyvals ...interface{})  { current.Load().Info(msg, keyvals...) }
+func Warn(msg string, keyvals ...interface{})  { current.Load().Warn(msg, keyvals...) }
+func Error(msg string, keyvals ...interface{}) { current.Load().Error(msg, keyvals...) }
+
+type nop struct{}
+
+func (nop) Debug(string, ...interface{}) {}
+func (nop) Info(string, ...interface{})  {}
+func (nop) Warn(string, ...interface{})  {}
+func (nop) Error(string, ...interface{}) {}
+
+// textLogger writes messages at level or above as lines like
+// "2006/01/02 15:04:05 WARN rpc server: accept err=..."
+type textLogger struct {
+	l     *log.Logger
+	level Level
+}
+
+// NewLogger returns a Logger writing messages at level or above to w as text
+func NewLogger(w io.Writer, level Level) Logger {
+	return &textLogger{l: log.New(w, "", log.LstdFlags), level: level}
+}
+
+func (t *textLogger) Debug(msg string, keyvals ...interface{}) { t.log(LevelDebug, msg, keyvals) }
+func (t *textLogger) Info(msg string, keyvals ...interface{})  { t.log(LevelInfo, msg, keyvals) }
+func (t *textLogger) Warn(msg string, keyvals ...interface{})  { t.log(LevelWarn, msg, keyvals) }
+func (t *textLogger) Error(msg string, keyvals ...interface{}) { t.log(LevelError, msg, keyvals) }
+
+func (t *textLogger) log(level Level, msg string, keyvals []interface{}) {
+	if level < t.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		s := fmt.Sprint(value)
+		if strings.ContainsAny(s, " \t\n\"=") || s == "" {
+			s = fmt.Sprintf("%q", s)
+		}
+		_, _ = fmt.Fprintf(&b, " %v=%s", keyvals[i], s)
+	}
+	_ = t.l.Output(3, b.String())
+}
+
+// slogLogger logs by a slog.Logger
+type slogLogger struct{ l *slog.Logger }
+
+// NewSlogLogger returns a Logger logging by l, keyvals are passed as its attributes
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+func (s slogLogger) Debug(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+func (s slogLogger) Info(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+func (s slogLogger) Warn(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
+
+func (s slogLogger) Error(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelError, msg, keyvals...)
+}
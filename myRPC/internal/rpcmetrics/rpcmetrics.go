@@ -0,0 +1,42 @@
+// Package rpcmetrics holds what collectors of myRPC metrics share, they are
+// Prometheus collectors of client_golang exported by Handler
+package rpcmetrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// LatencyBuckets are upper bounds in seconds of latency histograms
+var LatencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// Handler returns a http.Handler serving metrics of collectors to Prometheus,
+// a collector failing to collect fails the request
+func Handler(collectors ...prometheus.Collector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors...)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Code is the label of the result of a call
+func Code(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// ConstHistogram returns a histogram of LatencyBuckets, counts are observations in
+// each bucket, not cumulative, count includes those beyond the buckets, and sum is
+// in seconds
+func ConstHistogram(desc *prometheus.Desc, counts []uint64, count uint64, sum float64, labelValues ...string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(LatencyBuckets))
+	var cumulative uint64
+	for i, bound := range LatencyBuckets {
+		cumulative += counts[i]
+		buckets[bound] = cumulative
+	}
+	return prometheus.MustNewConstHistogram(desc, count, sum, buckets, labelValues...)
+}
@@ -0,0 +1,241 @@
+package myRPC
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"myRPC/internal/rpclog"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// error codes of JSON-RPC 2.0
+const (
+	jsonRPCParseError     = -32700
+	jsonRPCInvalidRequest = -32600
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInvalidParams  = -32602
+	jsonRPCInternalError  = -32603
+	jsonRPCServerError    = -32000 // an error returned by the method called
+)
+
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"` // nil for a notification
+}
+
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func newJSONRPCError(id json.RawMessage, code int, format string, a ...interface{}) *jsonRPCResponse {
+	return &jsonRPCResponse{JSONRPC: "2.0", ID: id, Error: &jsonRPCError{Code: code, Message: fmt.Sprintf(format, a...)}}
+}
+
+// AcceptJSONRPC accepts connections on the listener and serves JSON-RPC 2.0
+// requests for each incoming connection, see ServeJSONRPC
+func (server *Server) AcceptJSONRPC(lis net.Listener) {
+	if !server.trackListener(lis, true) {
+		return
+	}
+	defer server.trackListener(lis, false)
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if !server.inShutdown.Load() {
+				rpclog.Error("rpc server: accept", "err", err)
+			}
+			return
+		}
+		go server.ServeJSONRPC(conn)
+	}
+}
+
+// ServeJSONRPC serves JSON-RPC 2.0 requests on a single connection, eg, over raw TCP.
+// The method of a request is "<service>.<method>", and params is the argument,
+// or an array of it. Requests are handled concurrently, and responses are written
+// one per line as they are done. It blocks until the client hangs up.
+func (server *Server) ServeJSONRPC(conn io.ReadWriteCloser) {
+	ctx := connContext(conn)
+	sc := server.trackConn(conn, PeerAddrFrom(ctx), "jsonrpc")
+	defer server.untrackConn(sc)
+	var sending sync.Mutex
+	var wg sync.WaitGroup
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	for {
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				// it's not possible to find the next request, so close the connection
+				_ = enc.Encode(newJSONRPCError(nil, jsonRPCParseError, "parse error: %v", err))
+			}
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := server.serveJSONRPC(ctx, sc, msg)
+			if resp == nil {
+				return
+			}
+			sending.Lock()
+			defer sending.Unlock()
+			if err := enc.Encode(resp); err != nil {
+				rpclog.Error("rpc server: write response", "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+	_ = conn.Close()
+}
+
+// JSONRPCHandler returns a http.Handler that answers JSON-RPC 2.0 requests
+// posted to it, eg, by curl
+func (server *Server) JSONRPCHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "405 must POST", http.StatusMethodNotAllowed)
+			return
+		}
+		sc := server.trackConn(req.Body, req.RemoteAddr, "jsonrpc/http")
+		defer server.untrackConn(sc)
+		var resp interface{}
+		body, err := io.ReadAll(req.Body)
+		if err != nil || !json.Valid(body) {
+			resp = newJSONRPCError(nil, jsonRPCParseError, "parse error: invalid JSON")
+		} else if r := server.serveJSONRPC(req.Context(), sc, body); r != nil {
+			resp = r
+		}
+		if resp == nil {
+			// notifications only
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// serveJSONRPC handles a request or a batch of requests, it returns nil
+// if there is nothing to respond, ie, for notifications
+func (server *Server) serveJSONRPC(ctx context.Context, sc *serverConn, msg json.RawMessage) interface{} {
+	msg = bytes.TrimSpace(msg)
+	if len(msg) == 0 || msg[0] != '[' {
+		if resp := server.handleJSONRPC(ctx, sc, msg); resp != nil {
+			return resp
+		}
+		return nil
+	}
+	var batch []json.RawMessage
+	if err := json.Unmarshal(msg, &batch); err != nil || len(batch) == 0 {
+		return newJSONRPCError(nil, jsonRPCInvalidRequest, "invalid request: empty batch")
+	}
+	resps := make([]*jsonRPCResponse, len(batch))
+	var wg sync.WaitGroup
+	for i := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resps[i] = server.handleJSONRPC(ctx, sc, batch[i])
+		}()
+	}
+	wg.Wait()
+	var replies []*jsonRPCResponse
+	for _, resp := range resps {
+		if resp != nil {
+			replies = append(replies, resp)
+		}
+	}
+	if len(replies) == 0 {
+		return nil
+	}
+	return replies
+}
+
+// handleJSONRPC calls the method of a request, it returns nil for a notification
+func (server *Server) handleJSONRPC(ctx context.Context, sc *serverConn, msg json.RawMessage) *jsonRPCResponse {
+	var req jsonRPCRequest
+	if err := json.Unmarshal(msg, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return newJSONRPCError(nil, jsonRPCInvalidRequest, "invalid request")
+	}
+	resp := server.callJSONRPC(ctx, sc, &req)
+	if req.ID == nil {
+		return nil
+	}
+	resp.JSONRPC, resp.ID = "2.0", req.ID
+	return resp
+}
+
+func (server *Server) callJSONRPC(ctx context.Context, sc *serverConn, req *jsonRPCRequest) *jsonRPCResponse {
+	svc, mtype, err := server.findService(req.Method)
+	if err != nil {
+		return newJSONRPCError(nil, jsonRPCMethodNotFound, "%v", err)
+	}
+	argv, replyv := mtype.newArgv(), mtype.newReplyv()
+	argvi := argv.Interface()
+	if argv.Type().Kind() != reflect.Ptr {
+		argvi = argv.Addr().Interface()
+	}
+	if err = decodeJSONRPCParams(req.Params, argvi); err != nil {
+		return newJSONRPCError(nil, jsonRPCInvalidParams, "invalid params: %v", err)
+	}
+	if err = server.authorize(ctx, req.Method); err != nil {
+		return newJSONRPCError(nil, jsonRPCServerError, "%v", err)
+	}
+	if !server.startRequest(sc) {
+		return newJSONRPCError(nil, jsonRPCServerError, "%v", ErrServerClosed)
+	}
+	err = server.call(ctx, req.Method, svc, mtype, argv, replyv)
+	server.finishRequest(sc)
+	if err != nil {
+		return newJSONRPCError(nil, jsonRPCServerError, "%v", err)
+	}
+	result, err := json.Marshal(replyv.Interface())
+	if err != nil {
+		return newJSONRPCError(nil, jsonRPCInternalError, "internal error: %v", err)
+	}
+	return &jsonRPCResponse{Result: result}
+}
+
+// decodeJSONRPCParams decodes params into argv, params is the argument by name,
+// or an array of the argument by position like net/rpc/jsonrpc, or absent for
+// the zero value
+func decodeJSONRPCParams(params json.RawMessage, argv interface{}) error {
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		return nil
+	}
+	if params[0] != '[' {
+		return json.Unmarshal(params, argv)
+	}
+	var args []json.RawMessage
+	if err := json.Unmarshal(params, &args); err != nil {
+		return err
+	}
+	switch len(args) {
+	case 0:
+		return nil
+	case 1:
+		return json.Unmarshal(args[0], argv)
+	default:
+		return fmt.Errorf("expect 1 argument, but got %d", len(args))
+	}
+}
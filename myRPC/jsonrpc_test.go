@@ -0,0 +1,83 @@
+package myRPC
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_ServeJSONRPC(t *testing.T) {
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.AcceptJSONRPC(l)
+	defer func() { _ = l.Close() }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to dial:", err)
+	}
+	defer func() { _ = conn.Close() }()
+	// a notification is not responded
+	_, _ = conn.Write([]byte(`{"jsonrpc":"2.0","method":"Foo.Sum","params":{"Num1":1,"Num2":1}}` + "\n"))
+	_, _ = conn.Write([]byte(`{"jsonrpc":"2.0","method":"Foo.Sum","params":[{"Num1":1,"Num2":2}],"id":1}` + "\n"))
+	var resp jsonRPCResponse
+	if err = json.NewDecoder(bufio.NewReader(conn)).Decode(&resp); err != nil {
+		t.Fatal("failed to read the response:", err)
+	}
+	if string(resp.ID) != "1" || string(resp.Result) != "3" || resp.Error != nil {
+		t.Fatalf("expect result 3 of id 1, but got %+v", resp)
+	}
+}
+
+func TestServer_JSONRPCHandler(t *testing.T) {
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	ts := httptest.NewServer(server.JSONRPCHandler())
+	defer ts.Close()
+
+	post := func(body string) (int, string) {
+		resp, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal("failed to post:", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var b strings.Builder
+		_, _ = bufio.NewReader(resp.Body).WriteTo(&b)
+		return resp.StatusCode, strings.TrimSpace(b.String())
+	}
+	tests := []struct {
+		name, body, expect string
+	}{
+		{"by name", `{"jsonrpc":"2.0","method":"Foo.Sum","params":{"Num1":1,"Num2":2},"id":"a"}`,
+			`{"jsonrpc":"2.0","id":"a","result":3}`},
+		{"zero result", `{"jsonrpc":"2.0","method":"Foo.Sum","id":1}`,
+			`{"jsonrpc":"2.0","id":1,"result":0}`},
+		{"method not found", `{"jsonrpc":"2.0","method":"Foo.Unknown","id":1}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"rpc server: can't find method Unknown"}}`},
+		{"invalid params", `{"jsonrpc":"2.0","method":"Foo.Sum","params":"x","id":1}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"invalid params: json: cannot unmarshal string into Go value of type myRPC.Args"}}`},
+		{"invalid request", `{"method":"Foo.Sum","id":1}`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}`},
+		{"parse error", `{"jsonrpc"`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error: invalid JSON"}}`},
+		{"batch", `[{"jsonrpc":"2.0","method":"Foo.Sum","params":{"Num1":1},"id":1},{"jsonrpc":"2.0","method":"Foo.Sum"},1]`,
+			`[{"jsonrpc":"2.0","id":1,"result":1},{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := post(tt.body); code != http.StatusOK || body != tt.expect {
+				t.Fatalf("expect %s, but got %d %s", tt.expect, code, body)
+			}
+		})
+	}
+	if code, _ := post(`{"jsonrpc":"2.0","method":"Foo.Sum"}`); code != http.StatusNoContent {
+		t.Fatalf("expect no content for a notification, but got %d", code)
+	}
+}
@@ -0,0 +1,234 @@
+package myRPC
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// kcpHandshake is written by the client once a KCP session is opened and echoed by
+// the server, since KCP sends nothing back until data arrives, so a client can't
+// tell whether the server is there otherwise
+var kcpHandshake = []byte("myRPC kcp\n")
+
+const (
+	kcpHandshakeTimeout = time.Second * 10 // how long the server waits for the handshake of a new session
+	kcpKeepAlive        = time.Second * 10
+)
+
+var errKCPHandshake = errors.New("rpc kcp: bad handshake")
+
+// tuneKCP sets the session to the fast mode of KCP, which resends lost segments
+// sooner than TCP, trading bandwidth for latency on lossy links
+func tuneKCP(s *kcp.UDPSession) {
+	s.SetStreamMode(true)
+	s.SetWriteDelay(false)
+	s.SetNoDelay(1, 10, 2, 1)
+	s.SetWindowSize(256, 256)
+	s.SetACKNoDelay(true)
+}
+
+// kcpYamuxConfig returns the config of yamux sessions over KCP, KCP itself neither
+// tells the peer the session is closed nor finds a peer gone while idle, so
+// a single yamux stream runs over the session for its close and keepalive
+func kcpYamuxConfig() *yamux.Config {
+	config := yamuxConfig()
+	config.KeepAliveInterval = kcpKeepAlive
+	return config
+}
+
+// dialKCP opens a KCP session to address, and waits for the server to echo the handshake
+// within timeout, zero means no timeout. The connection is a yamux stream over the session.
+func dialKCP(address string, timeout time.Duration) (net.Conn, error) {
+	s, err := kcp.DialWithOptions(address, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	tuneKCP(s)
+	if timeout > 0 {
+		_ = s.SetDeadline(time.Now().Add(timeout))
+	}
+	if err = handshakeKCP(s, true); err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("rpc client: KCP handshake with %s: %w", address, err)
+	}
+	_ = s.SetDeadline(time.Time{})
+	session, err := yamux.Client(s, kcpYamuxConfig())
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	stream, err := session.OpenStream()
+	if err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	return &kcpConn{Stream: stream, session: session}, nil
+}
+
+// handshakeKCP writes kcpHandshake and reads it back if client, or the other way round
+func handshakeKCP(s *kcp.UDPSession, client bool) error {
+	if client {
+		if _, err := s.Write(kcpHandshake); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, len(kcpHandshake))
+	if _, err := io.ReadFull(s, buf); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf, kcpHandshake) {
+		return errKCPHandshake
+	}
+	if !client {
+		_, err := s.Write(kcpHandshake)
+		return err
+	}
+	return nil
+}
+
+// ListenKCP listens for KCP connections on the UDP address, serve it by Server.Accept.
+// Sessions are accepted once clients complete the handshake. Closing the listener
+// stops accepting, the socket is closed once the connections accepted are all closed,
+// so Server.Shutdown is graceful.
+func ListenKCP(address string) (net.Listener, error) {
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	kl, err := kcp.ServeConn(nil, 0, 0, pc)
+	if err != nil {
+		_ = pc.Close()
+		return nil, err
+	}
+	l := &kcpListener{l: kl, pc: pc, accept: make(chan net.Conn), done: make(chan struct{})}
+	go l.serve()
+	return l, nil
+}
+
+// kcpListener accepts KCP sessions which complete the handshake, and keeps
+// the socket open for them after it's closed
+type kcpListener struct {
+	l      *kcp.Listener
+	pc     net.PacketConn
+	accept chan net.Conn
+	done   chan struct{}
+	mu     sync.Mutex // protect following
+	conns  int        // connections accepted and not closed
+	closed bool
+}
+
+func (l *kcpListener) serve() {
+	for {
+		s, err := l.l.AcceptKCP()
+		if err != nil {
+			return
+		}
+		go l.handshake(s)
+	}
+}
+
+// handshake accepts the stream of s once the client completes the handshake in time
+func (l *kcpListener) handshake(s *kcp.UDPSession) {
+	tuneKCP(s)
+	_ = s.SetDeadline(time.Now().Add(kcpHandshakeTimeout))
+	if err := handshakeKCP(s, false); err != nil {
+		_ = s.Close()
+		return
+	}
+	_ = s.SetDeadline(time.Time{})
+	session, err := yamux.Server(s, kcpYamuxConfig())
+	if err != nil {
+		_ = s.Close()
+		return
+	}
+	timer := time.AfterFunc(kcpHandshakeTimeout, func() { _ = session.Close() })
+	stream, err := session.AcceptStream()
+	timer.Stop()
+	if err != nil {
+		_ = session.Close()
+		return
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		_ = session.Close()
+		return
+	}
+	l.conns++
+	l.mu.Unlock()
+	c := &kcpConn{Stream: stream, session: session, onClose: l.remove}
+	select {
+	case l.accept <- c:
+	case <-l.done:
+		_ = c.Close()
+	}
+}
+
+// remove forgets a connection closed, and closes the socket if the listener is closed
+// and no connection is left
+func (l *kcpListener) remove() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conns--
+	if l.closed && l.conns == 0 {
+		_ = l.pc.Close()
+	}
+}
+
+func (l *kcpListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *kcpListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	// the socket is not owned by the KCP listener, so its sessions keep running
+	_ = l.l.Close()
+	if l.conns == 0 {
+		return l.pc.Close()
+	}
+	return nil
+}
+
+func (l *kcpListener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
+
+// kcpConn is the yamux stream over a KCP session, closing it closes the session
+type kcpConn struct {
+	*yamux.Stream
+	session *yamux.Session
+	onClose func() // tells the listener if the connection is accepted
+	once    sync.Once
+}
+
+func (c *kcpConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		// the peer reads EOF if it gets the FIN, or finds the session gone by keepalive
+		_ = c.Stream.Close()
+		err = c.session.Close()
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	return err
+}
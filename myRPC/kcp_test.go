@@ -0,0 +1,51 @@
+package myRPC
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestXDial_KCP(t *testing.T) {
+	l, err := ListenKCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen KCP:", err)
+	}
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+
+	client, err := XDial("kcp@" + l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to connect over KCP:", err)
+	}
+	defer func() { _ = client.Close() }()
+	for i := 0; i < 3; i++ {
+		var reply int
+		if err = client.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: 2}, &reply); err != nil || reply != i+2 {
+			t.Fatalf("expect the call over KCP succeeds, but got %d, %v", reply, err)
+		}
+	}
+}
+
+func TestDialKCP_Timeout(t *testing.T) {
+	// a UDP socket which never replies the handshake
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen UDP:", err)
+	}
+	defer func() { _ = pc.Close() }()
+	start := time.Now()
+	_, err = Dial("kcp", pc.LocalAddr().String(), &Option{ConnectTimeout: time.Millisecond * 200})
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatal("expect the handshake timed out, but got", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect dialing gives up within ConnectTimeout, but took %s", elapsed)
+	}
+}
@@ -0,0 +1,38 @@
+package myRPC
+
+import (
+	"io"
+	"log/slog"
+	"myRPC/internal/rpclog"
+)
+
+// Logger logs messages of myRPC at levels, keyvals are alternating keys and values,
+// eg, Error("rpc server: write response", "err", err)
+type Logger = rpclog.Logger
+
+// Level is the severity of a message
+type Level = rpclog.Level
+
+const (
+	LevelDebug = rpclog.LevelDebug
+	LevelInfo  = rpclog.LevelInfo
+	LevelWarn  = rpclog.LevelWarn
+	LevelError = rpclog.LevelError
+)
+
+// SetLogger sets the logger of clients, servers, registry and xclient, nil disables
+// logging, eg, when myRPC is used as a library. Messages at LevelInfo or above are
+// written to the standard logger by default.
+func SetLogger(l Logger) {
+	rpclog.Set(l)
+}
+
+// NewLogger returns a Logger writing messages at level or above to w as text
+func NewLogger(w io.Writer, level Level) Logger {
+	return rpclog.NewLogger(w, level)
+}
+
+// NewSlogLogger returns a Logger logging by l, keyvals are passed as its attributes
+func NewSlogLogger(l *slog.Logger) Logger {
+	return rpclog.NewSlogLogger(l)
+}
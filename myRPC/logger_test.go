@@ -0,0 +1,38 @@
+package myRPC
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetLogger(t *testing.T) {
+	defer SetLogger(NewLogger(log.Writer(), LevelInfo))
+
+	var buf bytes.Buffer
+	SetLogger(NewLogger(&buf, LevelInfo))
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	if s := buf.String(); !strings.Contains(s, "INFO rpc server: register method=Foo.Sum\n") {
+		t.Fatalf("expect registration logged with fields, but got %q", s)
+	}
+	buf.Reset()
+	SetLogger(NewLogger(&buf, LevelWarn))
+	_ = NewServer().Register(&foo)
+	if buf.Len() != 0 {
+		t.Fatalf("expect messages below the level dropped, but got %q", buf.String())
+	}
+
+	SetLogger(nil)
+	_ = NewServer().Register(&foo)
+
+	buf.Reset()
+	SetLogger(NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	_ = NewServer().Register(&foo)
+	if s := buf.String(); !strings.Contains(s, `"msg":"rpc server: register","method":"Foo.Sum"`) {
+		t.Fatalf("expect keyvals as attributes of slog, but got %q", s)
+	}
+}
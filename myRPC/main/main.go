@@ -55,7 +55,7 @@ func startServer(registryAddr string, wg *sync.WaitGroup) {
 	l, _ := net.Listen("tcp", ":0")
 	server := myRPC.NewServer()
 	_ = server.Register(&foo)
-	registry.Heartbeat(registryAddr, "tcp@"+l.Addr().String(), 0)
+	registry.HeartbeatServices(registryAddr, "tcp@"+l.Addr().String(), server.Services(), 0)
 	wg.Done()
 	server.Accept(l)
 }
@@ -87,8 +87,9 @@ func broadcast(registry string) {
 			defer wg.Done()
 			foo(xc, context.Background(), "broadcast", "Foo.Sum", &Args{Num1: i, Num2: i * i})
 			// expect 2 - 5 timeout
-			ctx, _ := context.WithTimeout(context.Background(), time.Second*2)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
 			foo(xc, ctx, "broadcast", "Foo.Sleep", &Args{Num1: i, Num2: i * i})
+			cancel()
 		}(i)
 	}
 	wg.Wait()
@@ -0,0 +1,90 @@
+package myRPC
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// memListeners are listeners in memory by name, connected by mem@name
+var memListeners = struct {
+	sync.Mutex
+	m map[string]*memListener
+}{m: make(map[string]*memListener)}
+
+// ListenMem listens in memory by name, serve it by Server.Accept and connect to it
+// by XDial("mem@" + name). Connections are net.Pipe, so the client, codec and server
+// are all run without sockets, eg, in tests.
+func ListenMem(name string) (net.Listener, error) {
+	memListeners.Lock()
+	defer memListeners.Unlock()
+	if _, ok := memListeners.m[name]; ok {
+		return nil, fmt.Errorf("rpc server: mem@%s is already listened", name)
+	}
+	l := &memListener{name: name, conns: make(chan net.Conn), done: make(chan struct{})}
+	memListeners.m[name] = l
+	return l, nil
+}
+
+// memAddr is the address of connections in memory
+type memAddr string
+
+func (a memAddr) Network() string { return "mem" }
+func (a memAddr) String() string  { return string(a) }
+
+type memListener struct {
+	name  string
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memListener) Close() error {
+	l.once.Do(func() {
+		memListeners.Lock()
+		delete(memListeners.m, l.name)
+		memListeners.Unlock()
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr {
+	return memAddr(l.name)
+}
+
+// dialMem connects to the listener in memory by name, waits for it to accept
+// within timeout if timeout isn't 0
+func dialMem(name string, timeout time.Duration) (net.Conn, error) {
+	memListeners.Lock()
+	l := memListeners.m[name]
+	memListeners.Unlock()
+	if l == nil {
+		return nil, fmt.Errorf("rpc client: mem@%s is not listened", name)
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, fmt.Errorf("rpc client: mem@%s is closed", name)
+	case <-expired:
+		return nil, fmt.Errorf("rpc client: connect timeout: expect within %s", timeout)
+	}
+}
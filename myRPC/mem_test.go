@@ -0,0 +1,39 @@
+package myRPC
+
+import (
+	"context"
+	"testing"
+)
+
+func TestXDial_Mem(t *testing.T) {
+	l, err := ListenMem("foo")
+	if err != nil {
+		t.Fatal("failed to listen in memory:", err)
+	}
+	if _, err = ListenMem("foo"); err == nil {
+		t.Fatal("expect a name listened only once")
+	}
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	go server.Accept(l)
+
+	client, err := XDial("mem@foo")
+	if err != nil {
+		t.Fatal("failed to connect in memory:", err)
+	}
+	defer func() { _ = client.Close() }()
+	var reply int
+	if err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect the call in memory succeeds, but got %d, %v", reply, err)
+	}
+
+	_ = server.Shutdown(context.Background())
+	if _, err = XDial("mem@foo"); err == nil {
+		t.Fatal("expect no connection to a closed listener")
+	}
+	if l, err = ListenMem("foo"); err != nil {
+		t.Fatal("expect the name listened again once closed, but got", err)
+	}
+	_ = l.Close()
+}
@@ -0,0 +1,40 @@
+package myRPC
+
+import "context"
+
+type outgoingMetadataKey struct{}
+
+type incomingMetadataKey struct{}
+
+// WithMetadata returns a context carrying md with calls made by Client.Call of it,
+// along with metadata carried already, md takes precedence for the same keys
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range OutgoingMetadata(ctx) {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, outgoingMetadataKey{}, merged)
+}
+
+// OutgoingMetadata returns metadata carried with calls made by the context, see WithMetadata
+func OutgoingMetadata(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(outgoingMetadataKey{}).(map[string]string)
+	return md
+}
+
+// IncomingMetadata returns metadata carried with the request being handled, it's
+// in the context passed to interceptors and methods taking a context.Context
+func IncomingMetadata(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(incomingMetadataKey{}).(map[string]string)
+	return md
+}
+
+func withIncomingMetadata(ctx context.Context, md map[string]string) context.Context {
+	if len(md) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, incomingMetadataKey{}, md)
+}
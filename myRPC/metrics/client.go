@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"myRPC/internal/rpcmetrics"
+	"myRPC/xclient"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ClientMetrics collects calls and connections of XClients as their StatsHandler
+type ClientMetrics struct {
+	collectors
+	calls       *prometheus.CounterVec   // by server, method and code
+	latencies   *prometheus.HistogramVec // by method
+	connections *prometheus.GaugeVec     // open by server
+	opened      *prometheus.CounterVec   // by server
+	closed      *prometheus.CounterVec   // by server
+}
+
+var (
+	_ prometheus.Collector = &ClientMetrics{}
+	_ xclient.StatsHandler = &ClientMetrics{}
+)
+
+func NewClientMetrics() *ClientMetrics {
+	m := &ClientMetrics{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "myrpc_client_calls_total",
+			Help: "Number of calls by server, method and code, failures of dialing included.",
+		}, []string{"server", "method", "code"}),
+		latencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "myrpc_client_call_duration_seconds",
+			Help:    "Latency of calls by method, dialing included.",
+			Buckets: rpcmetrics.LatencyBuckets,
+		}, []string{"method"}),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "myrpc_client_connections",
+			Help: "Number of connections open to each server.",
+		}, []string{"server"}),
+		opened: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "myrpc_client_connections_opened_total",
+			Help: "Number of connections opened to each server.",
+		}, []string{"server"}),
+		closed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "myrpc_client_connections_closed_total",
+			Help: "Number of connections closed to each server.",
+		}, []string{"server"}),
+	}
+	m.collectors = collectors{m.calls, m.latencies, m.connections, m.opened, m.closed}
+	return m
+}
+
+func (m *ClientMetrics) HandleCall(rpcAddr, serviceMethod string, latency time.Duration, err error) {
+	m.calls.WithLabelValues(rpcAddr, serviceMethod, rpcmetrics.Code(err)).Inc()
+	m.latencies.WithLabelValues(serviceMethod).Observe(latency.Seconds())
+}
+
+func (m *ClientMetrics) HandleConn(rpcAddr string, connected bool) {
+	if connected {
+		m.opened.WithLabelValues(rpcAddr).Inc()
+		m.connections.WithLabelValues(rpcAddr).Inc()
+	} else {
+		m.closed.WithLabelValues(rpcAddr).Inc()
+		m.connections.WithLabelValues(rpcAddr).Dec()
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"myRPC/internal/rpcmetrics"
+	"myRPC/xclient"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DiscoveryMetrics collects refreshes and servers of discoveries watched
+type DiscoveryMetrics struct {
+	collectors
+	refreshes *prometheus.CounterVec // by discovery and code
+	failing   *prometheus.GaugeVec   // whether the latest refresh failed by discovery
+	servers   *prometheus.GaugeVec   // by discovery
+	changes   *prometheus.CounterVec // by discovery and op
+}
+
+var _ prometheus.Collector = &DiscoveryMetrics{}
+
+func NewDiscoveryMetrics() *DiscoveryMetrics {
+	m := &DiscoveryMetrics{
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "myrpc_discovery_refreshes_total",
+			Help: "Number of refreshes of servers by code.",
+		}, []string{"discovery", "code"}),
+		failing: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "myrpc_discovery_refresh_failing",
+			Help: "Whether the latest refresh of servers failed.",
+		}, []string{"discovery"}),
+		servers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "myrpc_discovery_servers",
+			Help: "Number of servers discovered.",
+		}, []string{"discovery"}),
+		changes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "myrpc_discovery_server_changes_total",
+			Help: "Number of servers added and removed, those discovered at first included.",
+		}, []string{"discovery", "op"}),
+	}
+	m.collectors = collectors{m.refreshes, m.failing, m.servers, m.changes}
+	return m
+}
+
+// Watch collects refreshes of d by its refresh hook, and servers of it by subscribing,
+// all discoveries of xclient support both. name labels metrics of d.
+// The returned function stops watching servers.
+func (m *DiscoveryMetrics) Watch(name string, d interface {
+	xclient.Subscriber
+	SetRefreshHook(hook func(err error))
+}) (stop func()) {
+	failing := m.failing.WithLabelValues(name)
+	servers := m.servers.WithLabelValues(name)
+	added := m.changes.WithLabelValues(name, "added")
+	removed := m.changes.WithLabelValues(name, "removed")
+	d.SetRefreshHook(func(err error) {
+		m.refreshes.WithLabelValues(name, rpcmetrics.Code(err)).Inc()
+		if err != nil {
+			failing.Set(1)
+		} else {
+			failing.Set(0)
+		}
+	})
+	return d.Subscribe(func(a, r []string) {
+		servers.Add(float64(len(a) - len(r)))
+		added.Add(float64(len(a)))
+		removed.Add(float64(len(r)))
+	})
+}
@@ -0,0 +1,38 @@
+// Package metrics provides Prometheus collectors of myRPC metrics, wired in by
+// the interceptors and hooks of clients, servers, discoveries and heartbeaters,
+// and exported by Handler or registered to a prometheus.Registerer, eg:
+//
+//	s := metrics.NewServerMetrics()
+//	server.SetInterceptors(s.Interceptor())
+//	server.SetConnHook(s.HandleConn)
+//	c := metrics.NewClientMetrics()
+//	xc.SetStatsHandler(c)
+//	http.Handle("/metrics", metrics.Handler(s, c))
+package metrics
+
+import (
+	"myRPC/internal/rpcmetrics"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Handler returns a http.Handler serving metrics of collectors to Prometheus
+func Handler(collectors ...prometheus.Collector) http.Handler {
+	return rpcmetrics.Handler(collectors...)
+}
+
+// collectors describes and collects metrics of cs as a single collector
+type collectors []prometheus.Collector
+
+func (cs collectors) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range cs {
+		c.Describe(ch)
+	}
+}
+
+func (cs collectors) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range cs {
+		c.Collect(ch)
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"myRPC"
+	"myRPC/registry"
+	"myRPC/xclient"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (f Foo) Fail(args Args, reply *int) error {
+	return errors.New("failed")
+}
+
+func TestHandler(t *testing.T) {
+	serverMetrics := NewServerMetrics()
+	server := myRPC.NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	server.SetInterceptors(serverMetrics.Interceptor())
+	server.SetConnHook(serverMetrics.HandleConn)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+	addr := "tcp@" + l.Addr().String()
+
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	registryMetrics := NewRegistryMetrics()
+	h := registry.NewHeartbeater(ts.URL, &registry.ServerItem{Addr: addr}, time.Minute)
+	registryMetrics.Watch(h)
+	if err := h.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Stop()
+
+	discoveryMetrics := NewDiscoveryMetrics()
+	d := xclient.NewCenterRegistryDiscovery(ts.URL, time.Minute)
+	defer discoveryMetrics.Watch("registry", d)()
+	clientMetrics := NewClientMetrics()
+	xc := xclient.NewXClient(d, xclient.RandomSelect, nil)
+	xc.SetStatsHandler(clientMetrics)
+	var reply int
+	_ = xc.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_ = xc.Call(context.Background(), "Foo.Fail", Args{}, &reply)
+	_ = xc.Close()
+	time.Sleep(time.Millisecond * 50) // connections closed are told asynchronously
+
+	w := httptest.NewRecorder()
+	Handler(serverMetrics, clientMetrics, discoveryMetrics, registryMetrics).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+	for _, expect := range []string{
+		`myrpc_server_handled_total{code="ok",method="Foo.Sum"} 1`,
+		`myrpc_server_handled_total{code="error",method="Foo.Fail"} 1`,
+		`myrpc_server_handling_seconds_count{method="Foo.Sum"} 1`,
+		`myrpc_server_connections_opened_total 1`,
+		`myrpc_client_calls_total{code="error",method="Foo.Fail",server="` + addr + `"} 1`,
+		`myrpc_client_call_duration_seconds_count{method="Foo.Sum"} 1`,
+		`myrpc_client_connections_opened_total{server="` + addr + `"} 1`,
+		`myrpc_client_connections{server="` + addr + `"} 0`,
+		`myrpc_discovery_refreshes_total{code="ok",discovery="registry"} 1`,
+		`myrpc_discovery_servers{discovery="registry"} 1`,
+		`myrpc_registry_client_heartbeats_total{code="ok"} 1`,
+		`myrpc_registry_up 1`,
+	} {
+		if !strings.Contains(string(body), expect+"\n") {
+			t.Errorf("expect %s in metrics:\n%s", expect, body)
+		}
+	}
+}
+
+func TestHandler_Escape(t *testing.T) {
+	m := NewDiscoveryMetrics()
+	defer m.Watch("servers \"a\"\\b", xclient.NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1"}))()
+	w := httptest.NewRecorder()
+	Handler(m).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	expect := `myrpc_discovery_servers{discovery="servers \"a\"\\b"} 1`
+	if !strings.Contains(w.Body.String(), expect+"\n") {
+		t.Fatalf("expect %s in metrics:\n%s", expect, w.Body.String())
+	}
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"myRPC/internal/rpcmetrics"
+	"myRPC/registry"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var lastHeartbeatDesc = prometheus.NewDesc("myrpc_registry_last_heartbeat_timestamp_seconds",
+	"Time of the latest heartbeat accepted by registry.", nil, nil)
+
+// RegistryMetrics collects the health of registry as seen by heartbeats of servers,
+// the registry itself exports its metrics at /myRPC/registry/metrics
+type RegistryMetrics struct {
+	heartbeats *prometheus.CounterVec // by code
+	up         prometheus.Gauge       // whether the latest heartbeat succeeded
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+}
+
+var _ prometheus.Collector = &RegistryMetrics{}
+
+func NewRegistryMetrics() *RegistryMetrics {
+	return &RegistryMetrics{
+		heartbeats: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "myrpc_registry_client_heartbeats_total",
+			Help: "Number of heartbeats sent to registry by code.",
+		}, []string{"code"}),
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "myrpc_registry_up",
+			Help: "Whether the latest heartbeat was accepted by registry.",
+		}),
+	}
+}
+
+// Watch collects heartbeats of h by its hooks, OnError set already is still called.
+// It should be called before h is started.
+func (m *RegistryMetrics) Watch(h *registry.Heartbeater) {
+	onError := h.OnError
+	h.OnError = func(err error) {
+		m.observe(err)
+		if onError != nil {
+			onError(err)
+		}
+	}
+	onSuccess := h.OnSuccess
+	h.OnSuccess = func() {
+		m.observe(nil)
+		if onSuccess != nil {
+			onSuccess()
+		}
+	}
+}
+
+func (m *RegistryMetrics) observe(err error) {
+	m.heartbeats.WithLabelValues(rpcmetrics.Code(err)).Inc()
+	if err != nil {
+		m.up.Set(0)
+		return
+	}
+	m.up.Set(1)
+	m.mu.Lock()
+	m.lastSuccess = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *RegistryMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.heartbeats.Describe(ch)
+	m.up.Describe(ch)
+	ch <- lastHeartbeatDesc
+}
+
+// Collect collects the time of the latest heartbeat accepted only if there is one
+func (m *RegistryMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.heartbeats.Collect(ch)
+	m.up.Collect(ch)
+	m.mu.Lock()
+	lastSuccess := m.lastSuccess
+	m.mu.Unlock()
+	if !lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(lastHeartbeatDesc, prometheus.GaugeValue, float64(lastSuccess.Unix()))
+	}
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"myRPC"
+	"myRPC/internal/rpcmetrics"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ServerMetrics collects calls handled by a Server by its interceptor,
+// and connections by HandleConn as its connection hook
+type ServerMetrics struct {
+	collectors
+	handled     *prometheus.CounterVec   // by method and code
+	latencies   *prometheus.HistogramVec // by method
+	inFlight    prometheus.Gauge
+	connections prometheus.Gauge
+	opened      prometheus.Counter
+	closed      prometheus.Counter
+}
+
+var _ prometheus.Collector = &ServerMetrics{}
+
+func NewServerMetrics() *ServerMetrics {
+	m := &ServerMetrics{
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "myrpc_server_handled_total",
+			Help: "Number of calls handled by method and code.",
+		}, []string{"method", "code"}),
+		latencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "myrpc_server_handling_seconds",
+			Help:    "Latency of calls handled by method.",
+			Buckets: rpcmetrics.LatencyBuckets,
+		}, []string{"method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "myrpc_server_in_flight",
+			Help: "Number of calls being handled.",
+		}),
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "myrpc_server_connections",
+			Help: "Number of connections open.",
+		}),
+		opened: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "myrpc_server_connections_opened_total",
+			Help: "Number of connections opened.",
+		}),
+		closed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "myrpc_server_connections_closed_total",
+			Help: "Number of connections closed.",
+		}),
+	}
+	m.collectors = collectors{m.handled, m.latencies, m.inFlight, m.connections, m.opened, m.closed}
+	return m
+}
+
+// Interceptor returns the interceptor of Server counting and timing calls
+func (m *ServerMetrics) Interceptor() myRPC.ServerInterceptor {
+	return func(ctx context.Context, serviceMethod string, args, reply interface{}, handler myRPC.Handler) error {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+		start := time.Now()
+		err := handler(ctx)
+		m.latencies.WithLabelValues(serviceMethod).Observe(time.Since(start).Seconds())
+		m.handled.WithLabelValues(serviceMethod, rpcmetrics.Code(err)).Inc()
+		return err
+	}
+}
+
+// HandleConn counts connections opened and closed, see Server.SetConnHook
+func (m *ServerMetrics) HandleConn(opened bool) {
+	if opened {
+		m.opened.Inc()
+		m.connections.Inc()
+	} else {
+		m.closed.Inc()
+		m.connections.Dec()
+	}
+}
@@ -0,0 +1,164 @@
+package myRPC
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myRPC/internal/rpclog"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/yamux"
+)
+
+var errMuxClosed = errors.New("rpc mux: session closed")
+
+// yamuxConfig returns the config of yamux sessions, which log through rpclog
+func yamuxConfig() *yamux.Config {
+	config := yamux.DefaultConfig()
+	config.LogOutput = nil
+	config.Logger = yamuxLogger{}
+	return config
+}
+
+// yamuxLogger passes logs of yamux to rpclog
+type yamuxLogger struct{}
+
+func (yamuxLogger) Print(v ...interface{}) {
+	rpclog.Warn("rpc transport: " + strings.TrimSpace(fmt.Sprint(v...)))
+}
+
+func (yamuxLogger) Printf(format string, v ...interface{}) {
+	rpclog.Warn("rpc transport: " + strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (yamuxLogger) Println(v ...interface{}) {
+	rpclog.Warn("rpc transport: " + strings.TrimSpace(fmt.Sprintln(v...)))
+}
+
+// muxSession is a yamux session over a TCP connection shared by clients,
+// streams are flow controlled by yamux, so a stream not read doesn't block others
+type muxSession struct {
+	*yamux.Session
+}
+
+func (s muxSession) openStream(context.Context) (sessionStream, error) {
+	st, err := s.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	return muxStream{Stream: st}, nil
+}
+
+func (s muxSession) done() <-chan struct{} { return s.CloseChan() }
+func (s muxSession) err() error            { return errMuxClosed }
+func (s muxSession) close()                { _ = s.Close() }
+
+// muxStream is a yamux stream, whose Close closes writing and keeps reading
+// until the peer closes as well
+type muxStream struct {
+	*yamux.Stream
+}
+
+func (st muxStream) closeWrite() error { return st.Close() }
+func (st muxStream) abort()            { _ = st.Close() }
+
+// dialMuxSession connects a yamux session to address
+func dialMuxSession(address string, opt *Option) (streamSession, error) {
+	conn, err := net.DialTimeout("tcp", address, opt.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	s, err := yamux.Client(conn, yamuxConfig())
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return muxSession{Session: s}, nil
+}
+
+// dialMux opens a stream of the session to address shared by clients, the session
+// is connected at the first stream and closed with the last one, see DialMux
+func dialMux(address string, opt *Option) (net.Conn, error) {
+	return dialStream(sessionKey{protocol: "mux", address: address}, opt,
+		func() (streamSession, error) { return dialMuxSession(address, opt) })
+}
+
+// DialMux returns a client calling the server at address, see ListenMux. Clients
+// of the same address share a TCP connection, and each call is sent on a stream
+// of its own, so a large or slow reply doesn't block others.
+func DialMux(address string, opts ...*Option) (*Client, error) {
+	opt, err := parseOption(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return dialStreams(sessionKey{protocol: "mux", address: address}, opt,
+		func() (streamSession, error) { return dialMuxSession(address, opt) })
+}
+
+// ListenMux multiplexes connections accepted by lis, each of which carries streams
+// of clients dialing mux@addr, and accepts the streams as connections, so calls of
+// clients sharing a connection don't block each other. Serve it by Server.Accept.
+func ListenMux(lis net.Listener) net.Listener {
+	l := &muxListener{Listener: lis, streams: make(chan net.Conn), done: make(chan struct{})}
+	go l.acceptSessions()
+	return l
+}
+
+type muxListener struct {
+	net.Listener
+	streams chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (l *muxListener) acceptSessions() {
+	defer func() { _ = l.Close() }()
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return
+		}
+		s, err := yamux.Server(conn, yamuxConfig())
+		if err != nil {
+			_ = conn.Close()
+			continue
+		}
+		go l.acceptStreams(s)
+	}
+}
+
+// acceptStreams passes streams of s to Accept until s or the listener is closed,
+// yamux queues streams opened meanwhile, so it doesn't hold up the session
+func (l *muxListener) acceptStreams(s *yamux.Session) {
+	for {
+		st, err := s.AcceptStream()
+		if err != nil {
+			return
+		}
+		select {
+		case l.streams <- muxStream{Stream: st}:
+		case <-l.done:
+			_ = st.Close()
+		}
+	}
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.streams:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *muxListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.Listener.Close()
+	})
+	return err
+}
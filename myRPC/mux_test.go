@@ -0,0 +1,121 @@
+package myRPC
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Blob int
+
+func (b Blob) Make(n int, reply *[]byte) error {
+	*reply = make([]byte, n)
+	return nil
+}
+
+// sharedSessionOf returns the session shared by clients of mux@address, nil if there is none
+func sharedSessionOf(address string) *sharedSession {
+	sharedSessions.Lock()
+	defer sharedSessions.Unlock()
+	return sharedSessions.m[sessionKey{protocol: "mux", address: address}]
+}
+
+func startMux(t *testing.T) string {
+	tcp, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := NewServer()
+	var foo Foo
+	var blob Blob
+	_ = server.Register(&foo)
+	_ = server.Register(&blob)
+	go server.Accept(ListenMux(tcp))
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+	return tcp.Addr().String()
+}
+
+func TestXDial_Mux(t *testing.T) {
+	addr := startMux(t)
+	big, err := XDial("mux@" + addr)
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	small, err := XDial("mux@" + addr)
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	session := sharedSessionOf(addr)
+	if session == nil || big.codec.(*streamCodec).c != session || small.codec.(*streamCodec).c != session {
+		t.Fatal("expect clients share a connection")
+	}
+
+	// a large reply doesn't block the reply of another call, even of the same client
+	var smallDone, bigDone atomic.Int64
+	bigCall := big.Go("Blob.Make", 32<<20, new([]byte), nil)
+	bigCalled := make(chan *Call, 1)
+	go func() {
+		call := <-bigCall.Done
+		bigDone.Store(time.Now().UnixNano())
+		bigCalled <- call
+	}()
+	time.Sleep(time.Millisecond * 20)
+	for _, client := range []*Client{small, big} {
+		var reply int
+		if err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect the call on a stream succeeds, but got %d, %v", reply, err)
+		}
+	}
+	smallDone.Store(time.Now().UnixNano())
+	if done := bigDone.Load(); done != 0 && done < smallDone.Load() {
+		t.Fatal("expect the small reply not waiting for the large one")
+	}
+	if call := <-bigCalled; call.Error != nil || len(*call.Reply.(*[]byte)) != 32<<20 {
+		t.Fatal("expect the large reply received, but got", call.Error)
+	}
+
+	// the connection is closed with the last client
+	_ = big.Close()
+	_ = small.Close()
+	if sharedSessionOf(addr) != nil {
+		t.Fatal("expect the session closed with its last client")
+	}
+	client, err := XDial("mux@" + addr)
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	defer func() { _ = client.Close() }()
+	if s := sharedSessionOf(addr); s == nil || s == session {
+		t.Fatal("expect a new connection for a new client")
+	}
+}
+
+func TestDialMux_Concurrent(t *testing.T) {
+	addr := startMux(t)
+	clients := make([]*Client, 10)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i], _ = DialMux(addr)
+		}(i)
+	}
+	wg.Wait()
+	session := sharedSessionOf(addr)
+	for _, client := range clients {
+		if client == nil {
+			t.Fatal("failed to connect")
+		}
+		defer func(client *Client) { _ = client.Close() }(client)
+		if client.codec.(*streamCodec).c != session {
+			t.Fatal("expect clients dialing at once share a connection")
+		}
+	}
+	sharedSessions.Lock()
+	refs := session.refs
+	sharedSessions.Unlock()
+	if refs != len(clients) {
+		t.Fatalf("expect %d clients of the session, but got %d", len(clients), refs)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package myRPC
+
+import (
+	"net"
+	"syscall"
+)
+
+// readPeerCred reads the credentials of the peer by SO_PEERCRED
+func readPeerCred(conn *net.UnixConn) (PeerCred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return PeerCred{}, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return PeerCred{}, err
+	}
+	if credErr != nil {
+		return PeerCred{}, credErr
+	}
+	return PeerCred{PID: cred.Pid, UID: cred.Uid, GID: cred.Gid}, nil
+}
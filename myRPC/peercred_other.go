@@ -0,0 +1,14 @@
+//go:build !linux
+
+package myRPC
+
+import (
+	"errors"
+	"net"
+	"runtime"
+)
+
+// readPeerCred is supported on linux only
+func readPeerCred(conn *net.UnixConn) (PeerCred, error) {
+	return PeerCred{}, errors.New("peer credentials are not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,55 @@
+package myRPC
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestXDial_HTTPPoll(t *testing.T) {
+	server := NewServer()
+	var foo Foo
+	var s Slow
+	_ = server.Register(&foo)
+	_ = server.Register(&s)
+	// a middlebox passing HTTP/1.1 only, without CONNECT
+	var posts atomic.Int32
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	hs := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodConnect || req.ProtoMajor != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		posts.Add(1)
+		server.ServeHTTP(w, req)
+	})}
+	go func() { _ = hs.Serve(l) }()
+	defer func() { _ = hs.Close() }()
+
+	if _, err := XDial("http@" + l.Addr().String()); err == nil {
+		t.Fatal("expect CONNECT blocked")
+	}
+	client, err := XDial("httppoll@" + l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to create the client:", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	// a call held by the server doesn't block others
+	slow := client.Go("Slow.Sleep", time.Millisecond*300, new(int), nil)
+	for i := 0; i < 3; i++ {
+		var reply int
+		if err = client.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: 2}, &reply); err != nil || reply != i+2 {
+			t.Fatalf("expect the call by HTTP POST succeeds, but got %d, %v", reply, err)
+		}
+	}
+	if call := <-slow.Done; call.Error != nil {
+		t.Fatal("expect the slow call succeeds, but got", call.Error)
+	}
+	if n := posts.Load(); n != 4 {
+		t.Fatalf("expect a POST request per call, but got %d", n)
+	}
+}
@@ -0,0 +1,187 @@
+package myRPC
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+// quicALPN is the application protocol negotiated by QUIC connections of myRPC
+const quicALPN = "myrpc"
+
+// ListenQUIC listens for QUIC connections on the UDP address, config is the TLS
+// config of the server, which needs a certificate. Each stream opened by clients
+// is accepted as a connection, a client of DialQUIC opens a stream for each call
+// on a connection shared by clients of the same address, so calls don't block
+// each other. Serve it by Server.Accept.
+func ListenQUIC(address string, config *tls.Config) (net.Listener, error) {
+	l, err := quic.ListenAddr(address, quicTLSConfig(config), nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ql := &quicListener{l: l, cancel: cancel, streams: make(chan net.Conn), done: ctx.Done()}
+	go ql.acceptConns(ctx)
+	return ql, nil
+}
+
+// quicTLSConfig returns a copy of config negotiating quicALPN
+func quicTLSConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{quicALPN}
+	}
+	return config
+}
+
+// quicListener accepts streams of QUIC connections as net.Conn
+type quicListener struct {
+	l       *quic.Listener
+	cancel  context.CancelFunc
+	streams chan net.Conn
+	done    <-chan struct{}
+	once    sync.Once
+}
+
+func (l *quicListener) acceptConns(ctx context.Context) {
+	for {
+		conn, err := l.l.Accept(ctx)
+		if err != nil {
+			return
+		}
+		go l.acceptStreams(ctx, conn)
+	}
+}
+
+func (l *quicListener) acceptStreams(ctx context.Context, conn *quic.Conn) {
+	for {
+		s, err := conn.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		select {
+		case l.streams <- &quicStream{Stream: s, conn: conn}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *quicListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.streams:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *quicListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		l.cancel()
+		err = l.l.Close()
+	})
+	return err
+}
+
+func (l *quicListener) Addr() net.Addr {
+	return l.l.Addr()
+}
+
+// quicSession is a QUIC connection shared by clients
+type quicSession struct {
+	conn *quic.Conn
+}
+
+func (s quicSession) openStream(ctx context.Context) (sessionStream, error) {
+	st, err := s.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &quicStream{Stream: st, conn: s.conn}, nil
+}
+
+func (s quicSession) done() <-chan struct{} { return s.conn.Context().Done() }
+func (s quicSession) err() error            { return context.Cause(s.conn.Context()) }
+func (s quicSession) close()                { _ = s.conn.CloseWithError(0, "") }
+
+// dialQUICSession dials a QUIC connection to address, TLSConfig of opt
+// verifies the server as the host of address by default
+func dialQUICSession(address string, opt *Option) (streamSession, error) {
+	config := quicTLSConfig(opt.TLSConfig)
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	ctx := context.Background()
+	if opt.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.ConnectTimeout)
+		defer cancel()
+	}
+	conn, err := quic.DialAddr(ctx, address, config, nil)
+	if err != nil {
+		return nil, err
+	}
+	return quicSession{conn: conn}, nil
+}
+
+// dialQUIC opens a stream of the QUIC connection to address shared by clients,
+// it's a single connection for calls like a TCP connection, see DialQUIC
+func dialQUIC(address string, opt *Option) (net.Conn, error) {
+	return dialStream(sessionKey{protocol: "quic", address: address, config: opt.TLSConfig}, opt,
+		func() (streamSession, error) { return dialQUICSession(address, opt) })
+}
+
+// quicStream is a QUIC stream as net.Conn
+type quicStream struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+// Close stops reading and closes writing, data written is still delivered
+func (s *quicStream) Close() error {
+	s.CancelRead(0)
+	return s.Stream.Close()
+}
+
+func (s *quicStream) closeWrite() error {
+	return s.Stream.Close()
+}
+
+func (s *quicStream) abort() {
+	s.CancelRead(0)
+	s.CancelWrite(0)
+}
+
+func (s *quicStream) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *quicStream) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// DialQUIC returns a client calling the server at address over QUIC, configured
+// by TLSConfig of Option, which verifies the server as the host of address by default.
+// Each call is sent on a stream of its own, with Option ahead of it, so a large or
+// slow reply doesn't block others. Clients of the same address and TLSConfig share
+// a QUIC connection, see ListenQUIC.
+func DialQUIC(address string, opts ...*Option) (*Client, error) {
+	opt, err := parseOption(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return dialStreams(sessionKey{protocol: "quic", address: address, config: opt.TLSConfig}, opt,
+		func() (streamSession, error) { return dialQUICSession(address, opt) })
+}
@@ -0,0 +1,87 @@
+package myRPC
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+// startQUIC serves Foo and Slow over QUIC, and returns the address with the option to dial it
+func startQUIC(t *testing.T) (string, *Option) {
+	cert, roots := newServerCert(t)
+	l, err := ListenQUIC("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal("failed to listen QUIC:", err)
+	}
+	server := NewServer()
+	var foo Foo
+	var slow Slow
+	_ = server.Register(&foo)
+	_ = server.Register(&slow)
+	go server.Accept(l)
+	t.Cleanup(func() {
+		_ = server.Shutdown(context.Background())
+		_ = l.Close()
+	})
+	return l.Addr().String(), &Option{ConnectTimeout: time.Second * 5, TLSConfig: &tls.Config{RootCAs: roots}}
+}
+
+func TestXDial_QUIC(t *testing.T) {
+	addr, opt := startQUIC(t)
+	client, err := XDial("quic@"+addr, opt)
+	if err != nil {
+		t.Fatal("failed to connect over QUIC:", err)
+	}
+	defer func() { _ = client.Close() }()
+	for i := 0; i < 3; i++ {
+		var reply int
+		if err = client.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: 2}, &reply); err != nil || reply != i+2 {
+			t.Fatalf("expect the call over QUIC succeeds, but got %d, %v", reply, err)
+		}
+	}
+}
+
+func TestDialQUIC_SharedConn(t *testing.T) {
+	addr, opt := startQUIC(t)
+	c1, err := DialQUIC(addr, opt)
+	if err != nil {
+		t.Fatal("failed to connect over QUIC:", err)
+	}
+	c2, err := DialQUIC(addr, opt)
+	if err != nil {
+		t.Fatal("failed to connect over QUIC:", err)
+	}
+	defer func() { _ = c2.Close() }()
+	if c1.codec.(*streamCodec).c != c2.codec.(*streamCodec).c {
+		t.Fatal("expect clients of the same address share the QUIC connection")
+	}
+
+	// a slow call doesn't block the others on the connection
+	slow := make(chan error, 1)
+	go func() {
+		var reply int
+		slow <- c1.Call(context.Background(), "Slow.Sleep", time.Second, &reply)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	start := time.Now()
+	for _, client := range []*Client{c1, c2} {
+		var reply int
+		if err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect the call over QUIC succeeds, but got %d, %v", reply, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("expect calls not blocked by the slow one, but took %s", elapsed)
+	}
+	if err := <-slow; err != nil {
+		t.Fatal("expect the slow call succeeds, but got", err)
+	}
+
+	// the connection is kept until the last client closes
+	_ = c1.Close()
+	var reply int
+	if err := c2.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect the call succeeds after the other client closed, but got %d, %v", reply, err)
+	}
+}
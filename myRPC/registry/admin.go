@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"myRPC/internal/rpclog"
+	"net/http"
+	"time"
+)
+
+// adminServer is a server listed by admin, with when it registered, renewed last, and expires
+type adminServer struct {
+	*ServerItem
+	Expires time.Time `json:"expires,omitempty"` // zero value means never expire
+}
+
+// adminResponse is the JSON body returned by admin endpoints
+type adminResponse struct {
+	Frozen  bool           `json:"frozen"`
+	Servers []*adminServer `json:"servers,omitempty"`
+}
+
+// serveAdminServers returns alive servers of all namespaces with their metadata, and times of
+// their registrations, that is RegisteredAt, and the latest heartbeats, that is Start
+// Runs at /myRPC/registry/admin/servers
+func (r *CenterRegistry) serveAdminServers(w http.ResponseWriter, _ *http.Request) {
+	alive, _, err := r.listServers()
+	if err != nil {
+		rpclog.Error("rpc registry: list servers", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp := &adminResponse{Frozen: r.frozen.Load(), Servers: make([]*adminServer, 0, len(alive))}
+	for _, server := range alive {
+		resp.Servers = append(resp.Servers, &adminServer{ServerItem: server, Expires: deadlineOf(server, r.ttlOf(server))})
+	}
+	writeJSON(w, resp)
+}
+
+// serveEvict removes the server of ?addr= in ?namespace= at once, even if the server set is frozen.
+// The server registers again on its next heartbeat unless it's stopped as well.
+// Runs at /myRPC/registry/admin/servers
+func (r *CenterRegistry) serveEvict(w http.ResponseWriter, req *http.Request) {
+	addr, namespace := req.URL.Query().Get("addr"), req.URL.Query().Get("namespace")
+	if addr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rpclog.Info("rpc registry: evict server", "server", addr, "namespace", namespace)
+	if err := r.deleteServer(namespace, addr); err != nil {
+		rpclog.Error("rpc registry: delete server", "server", addr, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.record("evict", namespace, addr, "", req.RemoteAddr)
+}
+
+// serveFreeze freezes or unfreezes the server set. While it's frozen,
+// new servers can't register and servers can't deregister, but alive servers
+// can still renew, so that a misbehaving deployment can't change the set during incidents.
+// Runs at /myRPC/registry/admin/freeze and /myRPC/registry/admin/unfreeze
+func (r *CenterRegistry) serveFreeze(frozen bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		r.frozen.Store(frozen)
+		rpclog.Info("rpc registry: freeze", "frozen", frozen)
+		writeJSON(w, &adminResponse{Frozen: frozen})
+	}
+}
+
+// checkFrozen returns errFrozen if the server set is frozen
+// and the server of item is not alive
+func (r *CenterRegistry) checkFrozen(item *ServerItem) error {
+	if !r.frozen.Load() {
+		return nil
+	}
+	alive, err := r.findServer(func(server *ServerItem) bool { return server.key() == item.key() })
+	if err != nil {
+		return err
+	}
+	if alive == nil {
+		return errFrozen
+	}
+	return nil
+}
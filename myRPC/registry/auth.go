@@ -0,0 +1,37 @@
+package registry
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// SetToken requires requests which change registrations to carry token,
+// either as "Authorization: Bearer <token>" or as the password of basic auth,
+// so a registry address like http://myrpc:<token>@10.0.0.1:9999/myRPC/registry
+// works for Heartbeat and discovery as is. Requests listing servers
+// need the token as well if protectRead is true, admin requests always need it.
+// It should be called before the registry starts serving.
+func (r *CenterRegistry) SetToken(token string, protectRead bool) {
+	r.token = token
+	r.protectRead = protectRead
+}
+
+// authorized reports whether req is allowed to access the registry
+func (r *CenterRegistry) authorized(req *http.Request) bool {
+	admin := strings.Contains(req.URL.Path, "/admin/")
+	if r.token == "" || (req.Method == "GET" && !r.protectRead && !admin) {
+		return true
+	}
+	token := ""
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	} else if _, password, ok := req.BasicAuth(); ok {
+		token = password
+	}
+	return r.validToken(token)
+}
+
+func (r *CenterRegistry) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(r.token)) == 1
+}
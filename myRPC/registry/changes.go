@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"myRPC/internal/rpclog"
+	"net/http"
+	"strconv"
+)
+
+const maxVersionHistory = 1024
+
+// serverChange is the change of server set made by a version
+type serverChange struct {
+	version uint64
+	added   []string      // serverKey of servers added
+	removed []*ServerItem // servers removed, kept to filter them
+}
+
+// record appends change to history, w.mu must be held
+func (w *watcher) record(change *serverChange) {
+	if len(w.history) == maxVersionHistory {
+		w.history = append(w.history[:0], w.history[1:]...)
+	}
+	w.history = append(w.history, change)
+}
+
+// changesSince returns current version and the servers matched by filter which
+// are added and removed since version, along with loads of the others, ok is false if the version is too old
+// to be found in history, or it's not a version of the registry at all
+func (w *watcher) changesSince(since uint64, filter serverFilter) (update *streamUpdate, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	update = &streamUpdate{Version: w.version}
+	if since > w.version || (since < w.version && (len(w.history) == 0 || w.history[0].version > since+1)) {
+		return update, false
+	}
+	// whether a server existed at version since is decided by its first change after since,
+	// servers are tracked by serverKey, the filter matches servers of a single namespace
+	existed := make(map[string]bool)
+	removed := make(map[string]*ServerItem)
+	for _, change := range w.history {
+		if change.version <= since {
+			continue
+		}
+		for _, key := range change.added {
+			if _, ok := existed[key]; !ok {
+				existed[key] = false
+			}
+		}
+		for _, server := range change.removed {
+			if _, ok := existed[server.key()]; !ok {
+				existed[server.key()] = true
+			}
+			removed[server.key()] = server
+		}
+	}
+	for key, server := range w.items {
+		if _, changed := existed[key]; server.Load != nil && !changed && filter.match(server) {
+			if update.Loads == nil {
+				update.Loads = make(map[string]*Load)
+			}
+			update.Loads[server.Addr] = server.Load
+		}
+	}
+	for key, before := range existed {
+		server := w.items[key]
+		switch {
+		case server != nil && filter.match(server):
+			// a server removed and added again may come back with new metadata
+			update.Added = append(update.Added, server)
+		case server == nil && before && filter.match(removed[key]):
+			update.Removed = append(update.Removed, removed[key].Addr)
+		}
+	}
+	return update, true
+}
+
+// serveChanges returns servers added and removed since ?since=<version> in JSON body,
+// marked by X-Myrpc-Registry-Since header. The full list is returned like serveList
+// instead if the version is unknown, eg, it's too old or registry has restarted.
+func (r *CenterRegistry) serveChanges(w http.ResponseWriter, req *http.Request, since uint64) {
+	// list servers to detect expirations
+	if _, _, err := r.listServers(); err != nil {
+		rpclog.Error("rpc registry: list servers", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	update, ok := r.watcher.changesSince(since, filterOf(req))
+	if !ok {
+		r.writeList(w, req)
+		return
+	}
+	w.Header().Set("X-Myrpc-Registry-Version", strconv.FormatUint(update.Version, 10))
+	w.Header().Set("X-Myrpc-Registry-Since", strconv.FormatUint(since, 10))
+	writeJSON(w, update)
+}
@@ -0,0 +1,206 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"myRPC/internal/rpclog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultClientRetries = 2
+	defaultClientBackoff = time.Millisecond * 100
+)
+
+// Client sends requests to registry. It fails over among the addresses of
+// registry nodes, retries with backoff when none of them is available,
+// and reuses HTTP connections among requests.
+type Client struct {
+	addrs []string
+	// Retries is how many times all registries are tried again after they all failed
+	Retries int
+	// Backoff is the wait before the first retry, it's doubled for each retry
+	Backoff    time.Duration
+	httpClient *http.Client
+
+	mu   sync.Mutex
+	next int // index of the registry which answered last time
+}
+
+// NewClient returns a Client of registry nodes at addrs, each of them may list
+// several addresses separated by commas, eg, http://10.0.0.1:9999/myRPC/registry,http://10.0.0.2:9999/myRPC/registry
+func NewClient(addrs ...string) *Client {
+	c := &Client{
+		Retries: defaultClientRetries,
+		Backoff: defaultClientBackoff,
+		// no timeout for the client, watches and streams are long lived, requests are bound by context
+		httpClient: &http.Client{Transport: http.DefaultTransport},
+	}
+	for _, addr := range addrs {
+		c.addrs = append(c.addrs, splitList(addr)...)
+	}
+	return c
+}
+
+// SetTLSConfig sets the TLS config of HTTPS requests to registry, eg, RootCAs
+// trusting the certificate of registry, and a client certificate if registry
+// requires it for registrations. It should be called before the Client is used.
+func (c *Client) SetTLSConfig(config *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	c.httpClient = &http.Client{Transport: transport}
+}
+
+// Addrs returns addresses of registry nodes
+func (c *Client) Addrs() []string {
+	return c.addrs
+}
+
+// Do sends a request to registry, path and query are appended to the registry address.
+// A registry which can't be reached or responds 502, 503 or 504 is failed over,
+// other responses are returned as is, the caller should close the body of response.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	if len(c.addrs) == 0 {
+		return nil, fmt.Errorf("rpc registry: no registry address")
+	}
+	c.mu.Lock()
+	next := c.next
+	c.mu.Unlock()
+	backoff := c.Backoff
+	var lastErr error
+	for retry := 0; ; retry++ {
+		for i := range c.addrs {
+			index := (next + i) % len(c.addrs)
+			resp, err := c.do(ctx, c.addrs[index], method, path, query, header, body)
+			if err == nil && !retryable(resp.StatusCode) {
+				c.mu.Lock()
+				c.next = index
+				c.mu.Unlock()
+				return resp, nil
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err == nil {
+				err = fmt.Errorf("rpc registry: %s responds %s", c.addrs[index], resp.Status)
+				_ = resp.Body.Close()
+			}
+			lastErr = err
+		}
+		if retry >= c.Retries {
+			return nil, lastErr
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) do(ctx context.Context, addr, method, path string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	u.Path += path
+	q := u.Query()
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return c.httpClient.Do(req)
+}
+
+// retryable reports whether another registry may serve the request of status
+func retryable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// Register registers item and returns its lease
+func (c *Client) Register(ctx context.Context, item *ServerItem) (string, error) {
+	rpclog.Debug("rpc server: send heart beat", "server", item.Addr, "registry", strings.Join(c.addrs, ","))
+	body, _ := json.Marshal(item)
+	resp, err := c.Do(ctx, "POST", "", nil, http.Header{"Content-Type": {jsonContentType}}, body)
+	if err != nil {
+		rpclog.Warn("rpc server: heart beat", "server", item.Addr, "err", err)
+		return "", err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("rpc server: heart beat err: unexpected status %s", resp.Status)
+		rpclog.Warn("rpc server: heart beat", "server", item.Addr, "status", resp.Status)
+		return "", err
+	}
+	return resp.Header.Get("X-Myrpc-Lease"), nil
+}
+
+// Renew renews a registration by its lease, errLeaseNotFound is returned if it has expired
+func (c *Client) Renew(ctx context.Context, lease string) error {
+	return c.RenewLoad(ctx, lease, nil)
+}
+
+// RenewLoad is like Renew, but reports the current load of the server as well
+func (c *Client) RenewLoad(ctx context.Context, lease string, load *Load) error {
+	header := http.Header{"X-Myrpc-Lease": {lease}}
+	if load != nil {
+		header.Set("X-Myrpc-Load", load.encode())
+	}
+	resp, err := c.Do(ctx, "PUT", "", nil, header, nil)
+	if err != nil {
+		rpclog.Warn("rpc server: renew lease", "err", err)
+		return err
+	}
+	_ = resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errLeaseNotFound
+	default:
+		err = fmt.Errorf("rpc server: renew lease err: unexpected status %s", resp.Status)
+		rpclog.Warn("rpc server: renew lease", "status", resp.Status)
+		return err
+	}
+}
+
+// Deregister removes the server of addr in the default namespace from registry immediately
+func (c *Client) Deregister(ctx context.Context, addr string) error {
+	return c.DeregisterNamespace(ctx, "", addr)
+}
+
+// DeregisterNamespace removes the server of addr in namespace from registry immediately
+func (c *Client) DeregisterNamespace(ctx context.Context, namespace, addr string) error {
+	rpclog.Info("rpc server: deregister", "server", addr, "namespace", namespace, "registry", strings.Join(c.addrs, ","))
+	header := http.Header{"X-Myrpc-Server": {addr}}
+	if namespace != "" {
+		header.Set("X-Myrpc-Namespace", namespace)
+	}
+	resp, err := c.Do(ctx, "DELETE", "", nil, header, nil)
+	if err != nil {
+		rpclog.Warn("rpc server: deregister", "server", addr, "err", err)
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc server: deregister err: unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"myRPC/internal/rpclog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	defaultDNSDomain = "myrpc.local."
+	dnsTTL           = 5 // seconds, servers come and go quickly
+	maxDNSPacketSize = 512
+)
+
+// dnsServer is a registered server published in DNS.
+// It's published under _myrpc._<proto>.<domain> and _<service>._<proto>.<domain>
+// for each service it exposes, <namespace>.<domain> is used instead of <domain>
+// if it's registered to a namespace.
+type dnsServer struct {
+	names  []string // owner names of SRV records
+	target string   // host name the SRV records point to
+	ip     net.IP   // address of target, nil if the server is registered with a host name
+	port   uint16
+	weight uint16
+}
+
+// dnsServers converts servers to DNS records under domain,
+// servers which can't be reached by host and port like unix sockets are skipped
+func dnsServers(servers []*ServerItem, domain string) []*dnsServer {
+	records := make([]*dnsServer, 0, len(servers))
+	for _, server := range servers {
+		protocol, address, _ := strings.Cut(server.Addr, "@")
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			continue
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			continue
+		}
+		proto := "_tcp"
+		if strings.HasPrefix(protocol, "udp") || protocol == "quic" || protocol == "kcp" {
+			proto = "_udp"
+		}
+		base := domain
+		if server.Namespace != "" {
+			base = strings.ToLower(server.Namespace) + "." + domain
+		}
+		record := &dnsServer{port: uint16(p), weight: uint16(server.Weight)}
+		if record.weight == 0 {
+			record.weight = 1
+		}
+		record.names = append(record.names, "_myrpc."+proto+"."+base)
+		for _, service := range server.Services {
+			record.names = append(record.names, "_"+strings.ToLower(service)+"."+proto+"."+base)
+		}
+		if record.ip = net.ParseIP(host); record.ip != nil {
+			// an IP can't be the target of SRV, give it a name like 10-0-0-1.<domain>
+			record.target = strings.NewReplacer(".", "-", ":", "-").Replace(host) + "." + domain
+		} else {
+			record.target = strings.TrimSuffix(strings.ToLower(host), ".") + "."
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// fqdn returns domain in lower case ending with a dot
+func fqdn(domain string) string {
+	if domain == "" {
+		domain = defaultDNSDomain
+	}
+	return strings.TrimSuffix(strings.ToLower(domain), ".") + "."
+}
+
+// WriteZone writes SRV, A and AAAA records of alive servers under domain in zone file format,
+// so that they can be loaded to a DNS server, "myrpc.local." is used if domain is empty
+func (r *CenterRegistry) WriteZone(w io.Writer, domain string) error {
+	servers, _, err := r.listServers()
+	if err != nil {
+		return err
+	}
+	domain = fqdn(domain)
+	var lines []string
+	targets := make(map[string]bool)
+	for _, s := range dnsServers(servers, domain) {
+		for _, name := range s.names {
+			lines = append(lines, fmt.Sprintf("%s\t%d\tIN\tSRV\t0 %d %d %s", name, dnsTTL, s.weight, s.port, s.target))
+		}
+		if s.ip != nil && !targets[s.target] {
+			targets[s.target] = true
+			typ := "A"
+			if s.ip.To4() == nil {
+				typ = "AAAA"
+			}
+			lines = append(lines, fmt.Sprintf("%s\t%d\tIN\t%s\t%s", s.target, dnsTTL, typ, s.ip))
+		}
+	}
+	sort.Strings(lines)
+	if _, err = fmt.Fprintf(w, "$ORIGIN %s\n$TTL %d\n", domain, dnsTTL); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err = fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serveZone exports servers in zone file format, under ?domain= or "myrpc.local."
+// Runs at /myRPC/registry/zone
+func (r *CenterRegistry) serveZone(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/dns")
+	if err := r.WriteZone(w, req.URL.Query().Get("domain")); err != nil {
+		rpclog.Error("rpc registry: list servers", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ListenAndServeDNS listens on the UDP address addr and then calls ServeDNS
+func (r *CenterRegistry) ListenAndServeDNS(addr, domain string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return r.ServeDNS(conn, domain)
+}
+
+// ServeDNS answers DNS queries received on conn with SRV, A and AAAA records
+// of alive servers under domain, until conn is closed.
+// It's an authoritative server of domain, queries of other names are refused.
+func (r *CenterRegistry) ServeDNS(conn net.PacketConn, domain string) error {
+	domain = fqdn(domain)
+	rpclog.Info("rpc registry: serve DNS", "domain", domain, "addr", conn.LocalAddr())
+	buf := make([]byte, maxDNSPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		resp, err := r.answerDNS(buf[:n], domain)
+		if err != nil {
+			continue
+		}
+		_, _ = conn.WriteTo(resp, addr)
+	}
+}
+
+// answerDNS builds the response of query
+func (r *CenterRegistry) answerDNS(query []byte, domain string) ([]byte, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, RCode: dnsmessage.RCodeSuccess},
+		Questions: []dnsmessage.Question{q},
+	}
+	name := strings.ToLower(q.Name.String())
+	if name != domain && !strings.HasSuffix(name, "."+domain) {
+		resp.Authoritative = false
+		resp.RCode = dnsmessage.RCodeRefused
+		return resp.Pack()
+	}
+	servers, _, err := r.listServers()
+	if err != nil {
+		rpclog.Error("rpc registry: list servers", "err", err)
+		resp.RCode = dnsmessage.RCodeServerFailure
+		return resp.Pack()
+	}
+	found := false
+	for _, s := range dnsServers(servers, domain) {
+		for _, owner := range s.names {
+			if owner != name {
+				continue
+			}
+			found = true
+			if q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeALL {
+				target, _ := dnsmessage.NewName(s.target)
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: dnsTTL},
+					Body:   &dnsmessage.SRVResource{Weight: s.weight, Port: s.port, Target: target},
+				})
+				if rr := addressResource(s); rr != nil {
+					resp.Additionals = append(resp.Additionals, *rr)
+				}
+			}
+		}
+		if s.target == name && s.ip != nil {
+			found = true
+			if rr := addressResource(s); rr != nil && (rr.Header.Type == q.Type || q.Type == dnsmessage.TypeALL) {
+				resp.Answers = append(resp.Answers, *rr)
+			}
+		}
+	}
+	if !found && name != domain {
+		resp.RCode = dnsmessage.RCodeNameError
+	}
+	b, err := resp.Pack()
+	if err == nil && len(b) > maxDNSPacketSize {
+		// the client should retry over TCP, which isn't supported, but it knows the answer is incomplete
+		resp.Answers, resp.Additionals, resp.Truncated = nil, nil, true
+		return resp.Pack()
+	}
+	return b, err
+}
+
+// addressResource returns the A or AAAA record of target of s, nil if it's a host name
+func addressResource(s *dnsServer) *dnsmessage.Resource {
+	if s.ip == nil {
+		return nil
+	}
+	name, _ := dnsmessage.NewName(s.target)
+	h := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: dnsTTL}
+	if ip4 := s.ip.To4(); ip4 != nil {
+		h.Type = dnsmessage.TypeA
+		rr := &dnsmessage.AResource{}
+		copy(rr.A[:], ip4)
+		return &dnsmessage.Resource{Header: h, Body: rr}
+	}
+	h.Type = dnsmessage.TypeAAAA
+	rr := &dnsmessage.AAAAResource{}
+	copy(rr.AAAA[:], s.ip.To16())
+	return &dnsmessage.Resource{Header: h, Body: rr}
+}
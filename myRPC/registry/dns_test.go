@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCenterRegistry_DNS(t *testing.T) {
+	r := New(time.Minute)
+	_ = r.putServer(&ServerItem{Addr: "tcp@10.0.0.1:9999", Services: []string{"Foo"}, Weight: 2})
+	_ = r.putServer(&ServerItem{Addr: "http@backend.example.com:8080", Services: []string{"Foo", "Bar"}})
+	_ = r.putServer(&ServerItem{Addr: "tcp@10.0.0.2:9999", Namespace: "staging", Services: []string{"Foo"}})
+	_ = r.putServer(&ServerItem{Addr: "unix@/tmp/myrpc.sock"})
+
+	var zone bytes.Buffer
+	if err := r.WriteZone(&zone, "example.org"); err != nil {
+		t.Fatal("failed to write zone:", err)
+	}
+	for _, line := range []string{
+		"_foo._tcp.example.org.\t5\tIN\tSRV\t0 2 9999 10-0-0-1.example.org.",
+		"_bar._tcp.example.org.\t5\tIN\tSRV\t0 1 8080 backend.example.com.",
+		"_foo._tcp.staging.example.org.\t5\tIN\tSRV\t0 1 9999 10-0-0-2.example.org.",
+		"10-0-0-1.example.org.\t5\tIN\tA\t10.0.0.1",
+	} {
+		if !strings.Contains(zone.String(), line+"\n") {
+			t.Fatalf("expect %q in zone, but got:\n%s", line, zone.String())
+		}
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	defer func() { _ = conn.Close() }()
+	go func() { _ = r.ServeDNS(conn, "") }()
+	resolver := &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return net.Dial("udp", conn.LocalAddr().String())
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	_, srvs, err := resolver.LookupSRV(ctx, "foo", "tcp", "myrpc.local")
+	if err != nil || len(srvs) != 2 {
+		t.Fatalf("expect 2 SRV records of Foo, but got %v, %v", srvs, err)
+	}
+	ips, err := resolver.LookupHost(ctx, "10-0-0-1.myrpc.local")
+	if err != nil || len(ips) != 1 || ips[0] != "10.0.0.1" {
+		t.Fatalf("expect A record of the server, but got %v, %v", ips, err)
+	}
+	if _, _, err = resolver.LookupSRV(ctx, "baz", "tcp", "myrpc.local"); err == nil {
+		t.Fatal("expect no SRV record of unknown service")
+	}
+}
@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"myRPC"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	eventLogSize = 1024
+	renewLogSize = 256 // renewals are kept apart, so that heartbeats don't push changes out
+)
+
+// AuditEvent records a change of registrations, so that it can be
+// reconstructed later why traffic went to a server at some time
+type AuditEvent struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"` // "register", "renew", "deregister", "expire" or "evict"
+	Namespace string    `json:"namespace,omitempty"`
+	Addr      string    `json:"addr"`
+	Lease     string    `json:"lease,omitempty"`
+	Remote    string    `json:"remote,omitempty"` // address of the requester, empty for expire
+}
+
+// eventLog keeps the most recent events in memory, the most recent renewals apart
+// from the most recent other events
+type eventLog struct {
+	mu     sync.Mutex
+	seq    uint64
+	events eventRing
+	renews eventRing
+	hook   func(event AuditEvent)
+	bus    myRPC.EventBus // publishes ServerEvicted of servers expired and evicted
+}
+
+// eventRing keeps the most recent events, the oldest is overwritten once it's full
+type eventRing struct {
+	events []*AuditEvent
+	next   int // index of the oldest event once it's full
+}
+
+// add puts event into the ring of size
+func (r *eventRing) add(event *AuditEvent, size int) {
+	if len(r.events) < size {
+		r.events = append(r.events, event)
+		return
+	}
+	r.events[r.next] = event
+	r.next = (r.next + 1) % size
+}
+
+// appendTo appends events matching to events from the oldest
+func (r *eventRing) appendTo(events []*AuditEvent, matching func(event *AuditEvent) bool) []*AuditEvent {
+	for i := range r.events {
+		if event := r.events[(r.next+i)%len(r.events)]; matching(event) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// SetEventHook calls hook with every event recorded, eg, to ship events to a log system.
+// The hook is called synchronously, so it should return quickly.
+// It should be called before the registry starts serving.
+func (r *CenterRegistry) SetEventHook(hook func(event AuditEvent)) {
+	r.events.hook = hook
+}
+
+// Events returns the bus of events of the registry, that is ServerEvicted of servers
+// expired or evicted by an admin
+func (r *CenterRegistry) Events() *myRPC.EventBus {
+	return &r.events.bus
+}
+
+// record appends an event of server addr in namespace requested by remote, remote is
+// empty for expirations
+func (r *CenterRegistry) record(typ, namespace, addr, lease, remote string) {
+	event := &AuditEvent{Time: time.Now(), Type: typ, Namespace: namespace, Addr: addr, Lease: lease, Remote: remote}
+	l := &r.events
+	l.mu.Lock()
+	l.seq++
+	event.Seq = l.seq
+	if typ == "renew" {
+		l.renews.add(event, renewLogSize)
+	} else {
+		l.events.add(event, eventLogSize)
+	}
+	l.mu.Unlock()
+	if l.hook != nil {
+		l.hook(*event)
+	}
+	if typ == "expire" || typ == "evict" {
+		l.bus.Publish(myRPC.ServerEvicted{Time: event.Time, Addr: addr, Reason: typ})
+	}
+}
+
+// eventsResponse is the JSON body returned by serveEvents
+type eventsResponse struct {
+	Events []*AuditEvent `json:"events"`
+}
+
+// serveEvents returns recorded events after ?since=<seq>, of server ?addr= if it's given.
+// Only the most recent events are kept, renewals apart from others. An expiration is recorded when registry notices it,
+// that is the next listing, the next sweep set by SetExpiry, or within a second while servers are watched.
+// Runs at /myRPC/registry/admin/events
+func (r *CenterRegistry) serveEvents(w http.ResponseWriter, req *http.Request) {
+	since, _ := strconv.ParseUint(req.URL.Query().Get("since"), 10, 64)
+	addr := req.URL.Query().Get("addr")
+	matching := func(event *AuditEvent) bool {
+		return event.Seq > since && (addr == "" || event.Addr == addr)
+	}
+	l := &r.events
+	l.mu.Lock()
+	events := l.events.appendTo(make([]*AuditEvent, 0), matching)
+	events = l.renews.appendTo(events, matching)
+	l.mu.Unlock()
+	sort.Slice(events, func(i, j int) bool { return events[i].Seq < events[j].Seq })
+	writeJSON(w, &eventsResponse{Events: events})
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"time"
+)
+
+// SetExpiry tunes how servers missing heartbeats expire. grace is added to
+// the TTL of every server, so that a heartbeat delayed a little doesn't make
+// the server flap. If sweepInterval is positive, expired servers are swept in
+// background every interval, so that expirations are noticed in time even if
+// nobody asks registry; otherwise they're noticed lazily by the next listing,
+// or within a second while servers are watched.
+// It should be called before the registry starts serving.
+func (r *CenterRegistry) SetExpiry(grace, sweepInterval time.Duration) {
+	r.grace = grace
+	if r.stopSweep != nil {
+		close(r.stopSweep)
+		r.stopSweep = nil
+	}
+	if sweepInterval > 0 {
+		r.stopSweep = make(chan struct{})
+		go r.sweepEvery(sweepInterval, r.stopSweep)
+	}
+}
+
+// OnExpire calls hook with the address of every server expired without
+// deregistering, eg, to alert when a server misses heartbeats.
+// The hook is called synchronously when registry notices the expiration,
+// so it should return quickly.
+// It should be called before the registry starts serving.
+func (r *CenterRegistry) OnExpire(hook func(addr string)) {
+	r.onExpire = hook
+}
+
+// ttlOf returns how long item keeps alive since its latest heartbeat, 0 means never expire
+func (r *CenterRegistry) ttlOf(item *ServerItem) time.Duration {
+	ttl := r.timeout
+	if item.TTL > 0 {
+		ttl = time.Duration(item.TTL)
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	return ttl + r.grace
+}
+
+// sweepEvery checks expirations every interval until stop is closed
+func (r *CenterRegistry) sweepEvery(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			r.checkChanges()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package registry
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"myRPC/internal/rpclog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	snapshotFile            = "registry.snapshot"
+	logFile                 = "registry.log"
+	defaultSnapshotInterval = time.Minute
+)
+
+// fileRecord is a line in the append log or the snapshot
+type fileRecord struct {
+	Op        string      `json:"op"` // "put" or "delete"
+	Item      *ServerItem `json:"item,omitempty"`
+	Namespace string      `json:"namespace,omitempty"`
+	Addr      string      `json:"addr,omitempty"`
+	Deadline  time.Time   `json:"deadline,omitempty"` // zero value means never expire
+}
+
+// FileStore is a Store which keeps servers in memory and persists them to dir,
+// every change is appended to a log and a snapshot compacts the log periodically,
+// so that a restarted registry still knows servers registered before
+type FileStore struct {
+	*memoryStore
+	dir     string
+	mu      sync.Mutex // protect log, make sure records are in the same order as changes
+	log     *os.File
+	logW    *bufio.Writer
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+var _ Store = &FileStore{}
+
+// NewFileStore loads servers persisted in dir and snapshots them every interval
+func NewFileStore(dir string, interval time.Duration) (*FileStore, error) {
+	if interval == 0 {
+		interval = defaultSnapshotInterval
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{
+		memoryStore: newMemoryStore(),
+		dir:         dir,
+		closing:     make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	// compact what has been loaded, then start a new log
+	if err := s.Snapshot(); err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.snapshotLoop(interval)
+	return s, nil
+}
+
+// NewPersistent returns a CenterRegistry whose servers are persisted in dir
+func NewPersistent(dir string, timeout time.Duration) (*CenterRegistry, error) {
+	s, err := NewFileStore(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithStore(s, timeout), nil
+}
+
+func (s *FileStore) Put(item *ServerItem, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deadline := deadlineOf(item, ttl)
+	s.memoryStore.put(item, deadline)
+	return s.appendLog(&fileRecord{Op: "put", Item: item, Deadline: deadline})
+}
+
+func (s *FileStore) Delete(namespace, addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.memoryStore.Delete(namespace, addr)
+	return s.appendLog(&fileRecord{Op: "delete", Namespace: namespace, Addr: addr})
+}
+
+func (s *FileStore) appendLog(record *fileRecord) error {
+	if s.logW == nil {
+		return errors.New("rpc registry: file store is closed")
+	}
+	b, _ := json.Marshal(record)
+	_, _ = s.logW.Write(append(b, '\n'))
+	return s.logW.Flush()
+}
+
+// Snapshot writes all servers to the snapshot file and truncates the log
+func (s *FileStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	s.memoryStore.writeRecords(w)
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	// rename is atomic, a crash never leaves a half written snapshot
+	if err = os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+	if s.log != nil {
+		_ = s.log.Close()
+	}
+	s.log, err = os.Create(filepath.Join(s.dir, logFile))
+	if err != nil {
+		s.logW = nil
+		return err
+	}
+	s.logW = bufio.NewWriter(s.log)
+	return nil
+}
+
+// load replays the snapshot and then the log
+func (s *FileStore) load() error {
+	for _, name := range []string{snapshotFile, logFile} {
+		f, err := os.Open(filepath.Join(s.dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = s.memoryStore.replay(f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) snapshotLoop(interval time.Duration) {
+	defer s.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := s.Snapshot(); err != nil {
+				rpclog.Error("rpc registry: snapshot", "err", err)
+			}
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// Close takes a final snapshot and closes the log
+func (s *FileStore) Close() error {
+	close(s.closing)
+	s.wg.Wait()
+	err := s.Snapshot()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log != nil {
+		_ = s.log.Close()
+		s.log, s.logW = nil, nil
+	}
+	return err
+}
+
+// writeRecords writes all servers as put records
+func (s *memoryStore) writeRecords(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	enc := json.NewEncoder(w)
+	for _, server := range s.servers {
+		_ = enc.Encode(&fileRecord{Op: "put", Item: server.ServerItem, Deadline: server.deadline})
+	}
+}
+
+// replay applies records read from r in order
+func (s *memoryStore) replay(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var record fileRecord
+		if err := dec.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			// the last record may be written partially when registry crashed
+			rpclog.Warn("rpc registry: stop replaying broken record", "err", err)
+			return nil
+		}
+		s.apply(&record)
+	}
+}
+
+func (s *memoryStore) apply(record *fileRecord) {
+	switch record.Op {
+	case "put":
+		if record.Item != nil {
+			s.put(record.Item, record.Deadline)
+		}
+	case "delete":
+		_ = s.Delete(record.Namespace, record.Addr)
+	}
+}
@@ -0,0 +1,266 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"myRPC"
+)
+
+const (
+	defaultHeartbeatJitter = 0.1
+	minHeartbeatBackoff    = time.Second
+)
+
+// Heartbeater registers a server to registry and keeps it alive by heartbeats
+// until it's stopped. A failed heartbeat is retried with exponential backoff
+// instead of giving up, so a server survives a registry restarting.
+type Heartbeater struct {
+	RegistryAddr string // addresses of registry nodes separated by commas
+	Item         *ServerItem
+	// Client sends heartbeats to registry, a Client of RegistryAddr by default
+	Client *Client
+	// Interval between two heartbeats, it's a third of TTL of Item by default,
+	// or enough to renew before the default timeout of registry
+	Interval time.Duration
+	// Jitter randomizes each interval by up to the fraction of Interval, 0.1 by default,
+	// so that servers started together don't send heartbeats at the same time, negative disables it
+	Jitter float64
+	// MaxBackoff limits the wait between retries of a failed heartbeat, Interval by default
+	MaxBackoff time.Duration
+	// Timeout bounds each heartbeat along with its retries, Interval by default
+	Timeout time.Duration
+	// OnError is called with the error of every failed heartbeat if it's not nil
+	OnError func(err error)
+	// OnSuccess is called after every heartbeat accepted by registry if it's not nil
+	OnSuccess func()
+	// Load reports the current load of the server with every heartbeat if it's not nil,
+	// eg, ServerLoad(server), so that clients can balance requests by load
+	Load func() *Load
+
+	mu     sync.Mutex
+	lease  string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewHeartbeater returns a Heartbeater sending heartbeats of item every interval,
+// 0 interval means the default one
+func NewHeartbeater(registryAddr string, item *ServerItem, interval time.Duration) *Heartbeater {
+	return &Heartbeater{RegistryAddr: registryAddr, Item: item, Interval: interval}
+}
+
+// Start registers the server at once and returns the error of the registration,
+// then sends heartbeats in background until ctx is done or Stop is called.
+// Heartbeats keep retrying even if the first registration fails.
+func (h *Heartbeater) Start(ctx context.Context) error {
+	h.mu.Lock()
+	if h.cancel != nil {
+		h.mu.Unlock()
+		return errors.New("rpc server: heartbeater already started")
+	}
+	ctx, h.cancel = context.WithCancel(ctx)
+	h.done = make(chan struct{})
+	if h.Client == nil {
+		h.Client = NewClient(h.RegistryAddr)
+	}
+	h.mu.Unlock()
+
+	err := h.beat(ctx)
+	go h.loop(ctx, err)
+	return err
+}
+
+// Stop stops sending heartbeats and waits for the background loop to exit,
+// the server expires from registry later unless it deregisters. h can be started
+// again after it's stopped.
+func (h *Heartbeater) Stop() {
+	h.mu.Lock()
+	cancel, done := h.cancel, h.done
+	h.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	h.mu.Lock()
+	if h.done == done {
+		h.cancel, h.done = nil, nil
+	}
+	h.mu.Unlock()
+}
+
+// Shutdown takes the server out of service gracefully. It stops heartbeats and
+// deregisters the server, then waits delay for clients to learn about it from registry
+// while the server keeps serving requests still routed to it, at last it shuts down
+// server and drains requests being handled. delay should be longer than the interval
+// clients refresh servers from registry, unless they watch registry.
+func (h *Heartbeater) Shutdown(ctx context.Context, server *myRPC.Server, delay time.Duration) error {
+	h.Stop()
+	client := h.Client
+	if client == nil {
+		client = NewClient(h.RegistryAddr)
+	}
+	if err := client.DeregisterNamespace(ctx, h.Item.Namespace, h.Item.Addr); err != nil {
+		// it expires from registry later anyway
+		h.report(err)
+	}
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}
+	return server.Shutdown(ctx)
+}
+
+// Lease returns the lease of the current registration, empty if it's not registered
+func (h *Heartbeater) Lease() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lease
+}
+
+func (h *Heartbeater) loop(ctx context.Context, err error) {
+	defer close(h.done)
+	interval := h.interval()
+	maxBackoff := h.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = interval
+	}
+	backoff := time.Duration(0)
+	for {
+		wait := h.jitter(interval)
+		if err != nil {
+			// retry sooner than a regular heartbeat, and slow down if it keeps failing
+			if backoff == 0 {
+				backoff = minHeartbeatBackoff
+			} else {
+				backoff *= 2
+			}
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			wait = h.jitter(backoff)
+		} else {
+			backoff = 0
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+		err = h.beat(ctx)
+	}
+}
+
+// beat renews the lease, or registers again if the lease has expired
+// or registry of old version doesn't support lease
+func (h *Heartbeater) beat(ctx context.Context) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = h.interval()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	h.mu.Lock()
+	lease := h.lease
+	h.mu.Unlock()
+	var load *Load
+	if h.Load != nil {
+		load = h.Load()
+	}
+	var err error
+	if lease != "" {
+		if err = h.Client.RenewLoad(ctx, lease, load); err != errLeaseNotFound {
+			h.report(err)
+			return err
+		}
+	}
+	item := h.Item
+	if load != nil {
+		item = new(ServerItem)
+		*item = *h.Item
+		item.Load = load
+	}
+	lease, err = h.Client.Register(ctx, item)
+	h.mu.Lock()
+	h.lease = lease
+	h.mu.Unlock()
+	h.report(err)
+	return err
+}
+
+func (h *Heartbeater) report(err error) {
+	switch {
+	case err != nil && h.OnError != nil:
+		h.OnError(err)
+	case err == nil && h.OnSuccess != nil:
+		h.OnSuccess()
+	}
+}
+
+func (h *Heartbeater) interval() time.Duration {
+	switch {
+	case h.Interval > 0:
+		return h.Interval
+	case h.Item.TTL > 0:
+		// leave room for two lost heart beats within the ttl of item
+		return time.Duration(h.Item.TTL) / 3
+	default:
+		// make sure there is enough time to send heart beat
+		// before it's removed from registry
+		return defaultTimeout - time.Duration(1)*time.Minute
+	}
+}
+
+// jitter returns d randomized by up to the fraction Jitter of it
+func (h *Heartbeater) jitter(d time.Duration) time.Duration {
+	jitter := h.Jitter
+	if jitter == 0 {
+		jitter = defaultHeartbeatJitter
+	}
+	if jitter < 0 {
+		return d
+	}
+	return d + time.Duration((rand.Float64()*2-1)*jitter*float64(d))
+}
+
+// Heartbeat send a heartbeat message every once in a while
+// it's a helper function for a server to register or send heartbeat
+func Heartbeat(registryAddr, serverAddr string, duration time.Duration) *Heartbeater {
+	return HeartbeatServer(registryAddr, &ServerItem{Addr: serverAddr}, duration)
+}
+
+// HeartbeatServices is like Heartbeat, but also registers names of
+// services exposed by the server, so that clients can discover by service
+func HeartbeatServices(registryAddr, serverAddr string, services []string, duration time.Duration) *Heartbeater {
+	return HeartbeatServer(registryAddr, &ServerItem{Addr: serverAddr, Services: services}, duration)
+}
+
+// HeartbeatServer is like Heartbeat, but registers services and metadata of item.
+// It returns the started Heartbeater, which can be stopped when the server shuts down.
+func HeartbeatServer(registryAddr string, item *ServerItem, duration time.Duration) *Heartbeater {
+	h := NewHeartbeater(registryAddr, item, duration)
+	_ = h.Start(context.Background())
+	return h
+}
+
+var errLeaseNotFound = errors.New("rpc server: lease not found")
+
+// renewLease renews a registration by its lease
+func renewLease(registryAddr, lease string) error {
+	return NewClient(registryAddr).Renew(context.Background(), lease)
+}
+
+// sendHeartbeat registers item and returns its lease
+func sendHeartbeat(registryAddr string, item *ServerItem) (string, error) {
+	return NewClient(registryAddr).Register(context.Background(), item)
+}
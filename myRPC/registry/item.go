@@ -0,0 +1,247 @@
+package registry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"myRPC/internal/rpclog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerItem is a server registered to CenterRegistry with its metadata
+type ServerItem struct {
+	Addr         string            `json:"addr"`
+	Namespace    string            `json:"namespace,omitempty"` // environment or team like prod, discovered only within it
+	Services     []string          `json:"services,omitempty"`  // names of services exposed by the server
+	Weight       int               `json:"weight,omitempty"`    // relative weight for load balancing, 0 means default
+	Zone         string            `json:"zone,omitempty"`      // availability zone the server located in
+	Version      string            `json:"version,omitempty"`   // build version of the server
+	Codecs       []string          `json:"codecs,omitempty"`    // codec types supported by the server
+	Labels       map[string]string `json:"labels,omitempty"`    // arbitrary metadata to select servers by, eg, track=canary
+	Load         *Load             `json:"load,omitempty"`      // load reported by the latest heartbeat
+	TTL          Duration          `json:"ttl,omitempty"`       // how long it keeps alive, registry timeout is used if it's 0
+	Lease        string            `json:"lease,omitempty"`     // ID of the registration, renew or revoke it by lease
+	Start        time.Time         `json:"start"`               // time of the latest registration or heartbeat
+	RegisteredAt time.Time         `json:"registered_at"`       // time of the registration, which renewals keep
+}
+
+const jsonContentType = "application/json"
+
+// Duration is a time.Duration encoded as a string like "30s" in JSON,
+// a number is decoded as seconds
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value * float64(time.Second))
+	case string:
+		return d.parse(value)
+	default:
+		return errors.New("rpc registry: invalid duration " + string(b))
+	}
+	return nil
+}
+
+// parse parses a duration string like "30s", or a number of seconds
+func (d *Duration) parse(s string) error {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	t, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("rpc registry: invalid duration " + s)
+	}
+	*d = Duration(t)
+	return nil
+}
+
+// HasService reports whether the server exposes the named service
+func (item *ServerItem) HasService(service string) bool {
+	for _, s := range item.Services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// readRegistration parses a registration from JSON body
+// if Content-Type is JSON, otherwise from HTTP header
+func readRegistration(req *http.Request) (*ServerItem, error) {
+	var item *ServerItem
+	if isJSON(req.Header.Get("Content-Type")) {
+		item = new(ServerItem)
+		if err := json.NewDecoder(req.Body).Decode(item); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if item, err = readServerItem(req.Header); err != nil {
+			return nil, err
+		}
+	}
+	if err := item.validate(); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (item *ServerItem) validate() error {
+	if err := validAddr(item.Addr); err != nil {
+		return err
+	}
+	if item.Weight < 0 {
+		return errors.New("rpc registry: invalid weight " + strconv.Itoa(item.Weight))
+	}
+	if item.TTL < 0 {
+		return errors.New("rpc registry: invalid ttl " + time.Duration(item.TTL).String())
+	}
+	if item.Load != nil {
+		return item.Load.validate()
+	}
+	return nil
+}
+
+// validAddr rejects an address no client can dial, like a wildcard address the server listens on
+func validAddr(addr string) error {
+	if addr == "" {
+		return errors.New("rpc registry: server address is missing")
+	}
+	protocol, address, ok := strings.Cut(addr, "@")
+	if !ok || protocol == "" || address == "" {
+		return errors.New("rpc registry: invalid address " + addr + ", expect protocol@addr")
+	}
+	if strings.HasPrefix(protocol, "unix") {
+		// address of unix socket is a file path
+		return nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.New("rpc registry: invalid address " + addr + ": " + err.Error())
+	}
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return errors.New("rpc registry: invalid port of address " + addr)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		return errors.New("rpc registry: invalid host of address " + addr)
+	}
+	return nil
+}
+
+// readServerItem parses a registration from HTTP header
+func readServerItem(h http.Header) (*ServerItem, error) {
+	item := &ServerItem{
+		Addr:      h.Get("X-Myrpc-Server"),
+		Namespace: h.Get("X-Myrpc-Namespace"),
+		Services:  splitList(h.Get("X-Myrpc-Services")),
+		Zone:      h.Get("X-Myrpc-Zone"),
+		Version:   h.Get("X-Myrpc-Version"),
+		Codecs:    splitList(h.Get("X-Myrpc-Codecs")),
+	}
+	if weight := h.Get("X-Myrpc-Weight"); weight != "" {
+		var err error
+		if item.Weight, err = strconv.Atoi(weight); err != nil {
+			return nil, errors.New("rpc registry: invalid weight " + weight)
+		}
+	}
+	if ttl := h.Get("X-Myrpc-TTL"); ttl != "" {
+		if err := item.TTL.parse(ttl); err != nil {
+			return nil, err
+		}
+	}
+	// labels are sent as X-Myrpc-Labels: k1=v1,k2=v2
+	for _, label := range splitList(h.Get("X-Myrpc-Labels")) {
+		k, v, ok := strings.Cut(label, "=")
+		if !ok || k == "" {
+			return nil, errors.New("rpc registry: invalid label " + label)
+		}
+		if item.Labels == nil {
+			item.Labels = make(map[string]string)
+		}
+		item.Labels[k] = v
+	}
+	var err error
+	if item.Load, err = parseLoad(h.Get("X-Myrpc-Load")); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// encodeMeta encodes address and metadata of item in URL query format,
+// eg, addr=tcp%40127.0.0.1%3A9999&weight=2&zone=z1
+func (item *ServerItem) encodeMeta() string {
+	v := url.Values{}
+	v.Set("addr", item.Addr)
+	if item.Weight > 0 {
+		v.Set("weight", strconv.Itoa(item.Weight))
+	}
+	if item.Zone != "" {
+		v.Set("zone", item.Zone)
+	}
+	if item.Version != "" {
+		v.Set("version", item.Version)
+	}
+	if len(item.Codecs) > 0 {
+		v.Set("codecs", strings.Join(item.Codecs, ","))
+	}
+	keys := make([]string, 0, len(item.Labels))
+	for k := range item.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v.Add("label", k+"="+item.Labels[k])
+	}
+	meta := v.Encode()
+	if item.Load != nil {
+		meta += "&" + item.Load.encode()
+	}
+	return meta
+}
+
+// splitList splits a comma separated header value and drops empty elements
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// isJSON reports whether a Content-Type or Accept header value contains JSON
+func isJSON(value string) bool {
+	return strings.Contains(value, jsonContentType)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", jsonContentType)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		rpclog.Error("rpc registry: write response", "err", err)
+	}
+}
+
+// newLease generates a random lease ID
+func newLease() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
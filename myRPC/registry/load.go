@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"errors"
+	"net/url"
+	"runtime/metrics"
+	"strconv"
+	"sync"
+
+	"myRPC"
+)
+
+// Load is the load of a server reported with its heartbeats,
+// so that clients can balance requests by how busy servers are
+type Load struct {
+	InFlight int     `json:"inflight"`        // requests being handled
+	CPU      float64 `json:"cpu"`             // CPU utilization between 0 and 1
+	Queue    int     `json:"queue,omitempty"` // requests waiting to be handled
+}
+
+// encode encodes load in URL query format, eg, inflight=3&cpu=0.42&queue=1
+func (load *Load) encode() string {
+	v := url.Values{}
+	v.Set("inflight", strconv.Itoa(load.InFlight))
+	v.Set("cpu", strconv.FormatFloat(load.CPU, 'f', 3, 64))
+	if load.Queue > 0 {
+		v.Set("queue", strconv.Itoa(load.Queue))
+	}
+	return v.Encode()
+}
+
+// parseLoad parses a load encoded by encode, nil is returned if s is empty
+func parseLoad(s string) (*Load, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, errors.New("rpc registry: invalid load " + s)
+	}
+	load := new(Load)
+	if load.InFlight, err = strconv.Atoi(v.Get("inflight")); err != nil && v.Has("inflight") {
+		return nil, errors.New("rpc registry: invalid load " + s)
+	}
+	if load.CPU, err = strconv.ParseFloat(v.Get("cpu"), 64); err != nil && v.Has("cpu") {
+		return nil, errors.New("rpc registry: invalid load " + s)
+	}
+	if load.Queue, err = strconv.Atoi(v.Get("queue")); err != nil && v.Has("queue") {
+		return nil, errors.New("rpc registry: invalid load " + s)
+	}
+	if err = load.validate(); err != nil {
+		return nil, err
+	}
+	return load, nil
+}
+
+func (load *Load) validate() error {
+	if load.InFlight < 0 || load.Queue < 0 || load.CPU < 0 {
+		return errors.New("rpc registry: invalid load, it can't be negative")
+	}
+	return nil
+}
+
+// ServerLoad returns a function reporting the load of server, which can be
+// used as Heartbeater.Load. CPU is the utilization of GOMAXPROCS by the process
+// since the last report, estimated by Go runtime.
+func ServerLoad(server *myRPC.Server) func() *Load {
+	var cpu cpuSampler
+	return func() *Load {
+		return &Load{InFlight: server.InFlight(), CPU: cpu.sample()}
+	}
+}
+
+// cpuSampler measures CPU utilization between two samples
+type cpuSampler struct {
+	mu          sync.Mutex
+	total, idle float64 // CPU seconds of the last sample
+}
+
+func (s *cpuSampler) sample() float64 {
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindFloat64 || samples[1].Value.Kind() != metrics.KindFloat64 {
+		return 0
+	}
+	total, idle := samples[0].Value.Float64(), samples[1].Value.Float64()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dTotal, dIdle := total-s.total, idle-s.idle
+	s.total, s.idle = total, idle
+	if dTotal <= 0 {
+		return 0
+	}
+	usage := 1 - dIdle/dTotal
+	if usage < 0 {
+		usage = 0
+	}
+	return usage
+}
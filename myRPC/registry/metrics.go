@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"myRPC/internal/rpclog"
+	"myRPC/internal/rpcmetrics"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	serversDesc  = prometheus.NewDesc("myrpc_registry_servers", "Number of alive servers.", nil, nil)
+	watchersDesc = prometheus.NewDesc("myrpc_registry_watchers", "Number of blocking watch and stream requests.", nil, nil)
+)
+
+// registryMetrics counts what happens in a CenterRegistry,
+// they are exported to Prometheus at /myRPC/registry/metrics
+type registryMetrics struct {
+	r               *CenterRegistry
+	handler         http.Handler
+	heartbeats      *prometheus.CounterVec // by op
+	deregistrations prometheus.Counter
+	expirations     prometheus.Counter
+	rateLimited     prometheus.Counter
+	latencies       *prometheus.HistogramVec // by handler
+
+	mu      sync.Mutex
+	deleted map[string]bool // servers deregistered since the server set was compared last time, by serverKey
+}
+
+func newRegistryMetrics(r *CenterRegistry) *registryMetrics {
+	m := &registryMetrics{
+		r: r,
+		heartbeats: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "myrpc_registry_heartbeats_total",
+			Help: "Number of heartbeats received.",
+		}, []string{"op"}),
+		deregistrations: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "myrpc_registry_deregistrations_total",
+			Help: "Number of servers deregistered.",
+		}),
+		expirations: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "myrpc_registry_expirations_total",
+			Help: "Number of servers expired without heartbeats.",
+		}),
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "myrpc_registry_rate_limited_total",
+			Help: "Number of requests rejected by rate limit.",
+		}),
+		latencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "myrpc_registry_request_duration_seconds",
+			Help:    "Latency of registry requests, watches and streams excluded.",
+			Buckets: rpcmetrics.LatencyBuckets,
+		}, []string{"handler"}),
+	}
+	m.heartbeats.WithLabelValues("register")
+	m.heartbeats.WithLabelValues("renew")
+	m.handler = rpcmetrics.Handler(m)
+	return m
+}
+
+func (m *registryMetrics) registered(renew bool) {
+	if renew {
+		m.heartbeats.WithLabelValues("renew").Inc()
+	} else {
+		m.heartbeats.WithLabelValues("register").Inc()
+	}
+}
+
+// deregistered counts a server deregistered or evicted, key is its serverKey
+func (m *registryMetrics) deregistered(key string) {
+	m.deregistrations.Inc()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deleted == nil {
+		m.deleted = make(map[string]bool)
+	}
+	m.deleted[key] = true
+}
+
+// removed counts servers gone from the server set as expired unless they're deleted
+// through the registry, or deleted reports so, and returns them
+func (m *registryMetrics) removed(servers []*ServerItem, deleted func(server *ServerItem) bool) []*ServerItem {
+	m.mu.Lock()
+	local := m.deleted
+	m.deleted = nil
+	m.mu.Unlock()
+	var expired []*ServerItem
+	for _, server := range servers {
+		if !local[server.key()] && !deleted(server) {
+			m.expirations.Inc()
+			expired = append(expired, server)
+		}
+	}
+	return expired
+}
+
+func (m *registryMetrics) limited() {
+	m.rateLimited.Inc()
+}
+
+func (m *registryMetrics) observe(handler string, d time.Duration) {
+	m.latencies.WithLabelValues(handler).Observe(d.Seconds())
+}
+
+func (m *registryMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serversDesc
+	ch <- watchersDesc
+	m.heartbeats.Describe(ch)
+	m.deregistrations.Describe(ch)
+	m.expirations.Describe(ch)
+	m.rateLimited.Describe(ch)
+	m.latencies.Describe(ch)
+}
+
+// Collect collects the servers and watchers of the registry as well as the counters,
+// a failure of listing servers fails the scrape
+func (m *registryMetrics) Collect(ch chan<- prometheus.Metric) {
+	if alive, _, err := m.r.listServers(); err != nil {
+		rpclog.Error("rpc registry: list servers", "err", err)
+		ch <- prometheus.NewInvalidMetric(serversDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(serversDesc, prometheus.GaugeValue, float64(len(alive)))
+	}
+	m.r.watcher.mu.Lock()
+	watchers := m.r.watcher.watchers
+	m.r.watcher.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(watchersDesc, prometheus.GaugeValue, float64(watchers))
+	m.heartbeats.Collect(ch)
+	m.deregistrations.Collect(ch)
+	m.expirations.Collect(ch)
+	m.rateLimited.Collect(ch)
+	m.latencies.Collect(ch)
+}
+
+// serveMetrics serves registry metrics to Prometheus
+// Runs at /myRPC/registry/metrics
+func (r *CenterRegistry) serveMetrics(w http.ResponseWriter, req *http.Request) {
+	r.metrics.handler.ServeHTTP(w, req)
+}
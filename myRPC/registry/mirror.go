@@ -0,0 +1,132 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"myRPC/internal/rpclog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mirrorQueueSize = 1024
+	mirrorTimeout   = time.Second * 5
+)
+
+// MirrorStore is a Store which forwards every change to secondary registries,
+// so that they are warm standbys of the primary registry without a cluster.
+// A registration is forwarded with its lease, so that a server can renew it on
+// a secondary when the primary is down, and discovery can be pointed at
+// either of them, eg, NewCenterRegistryDiscovery("http://primary...,http://secondary...").
+// Changes are forwarded in background in order, a change is dropped if a secondary
+// falls too far behind, then it catches up by the next heartbeat of the server.
+// Secondaries shouldn't mirror changes back to the primary.
+type MirrorStore struct {
+	Store
+	mirrors []*mirror
+	wg      sync.WaitGroup
+}
+
+// mirror is a secondary registry and the changes to forward to it
+type mirror struct {
+	client *Client
+	queue  chan *mirrorChange
+}
+
+type mirrorChange struct {
+	method string
+	body   []byte
+}
+
+var _ Store = &MirrorStore{}
+
+// NewMirrorStore returns a MirrorStore keeping servers in store, and
+// forwarding changes to secondary registries, each Client is a secondary
+func NewMirrorStore(store Store, secondaries ...*Client) *MirrorStore {
+	s := &MirrorStore{Store: store}
+	for _, client := range secondaries {
+		m := &mirror{client: client, queue: make(chan *mirrorChange, mirrorQueueSize)}
+		s.mirrors = append(s.mirrors, m)
+		s.wg.Add(1)
+		go s.forward(m)
+	}
+	return s
+}
+
+// NewMirror returns a CenterRegistry keeping servers in memory, which forwards changes
+// to secondary registries at addrs, each of them may list addresses of one secondary's nodes
+// separated by commas
+func NewMirror(timeout time.Duration, addrs ...string) *CenterRegistry {
+	secondaries := make([]*Client, 0, len(addrs))
+	for _, addr := range addrs {
+		secondaries = append(secondaries, NewClient(addr))
+	}
+	return NewWithStore(NewMirrorStore(newMemoryStore(), secondaries...), timeout)
+}
+
+func (s *MirrorStore) Put(item *ServerItem, ttl time.Duration) error {
+	if err := s.Store.Put(item, ttl); err != nil {
+		return err
+	}
+	// secondaries expire the server by the same ttl, and keep its lease
+	forwarded := *item
+	forwarded.TTL = Duration(ttl)
+	body, _ := json.Marshal(&forwarded)
+	s.enqueue(&mirrorChange{method: "POST", body: body})
+	return nil
+}
+
+func (s *MirrorStore) Delete(namespace, addr string) error {
+	if err := s.Store.Delete(namespace, addr); err != nil {
+		return err
+	}
+	body, _ := json.Marshal(&ServerItem{Addr: addr, Namespace: namespace})
+	s.enqueue(&mirrorChange{method: "DELETE", body: body})
+	return nil
+}
+
+func (s *MirrorStore) enqueue(change *mirrorChange) {
+	for _, m := range s.mirrors {
+		select {
+		case m.queue <- change:
+		default:
+			rpclog.Warn("rpc registry: mirror falls behind, drop a change", "mirror", strings.Join(m.client.Addrs(), ","))
+		}
+	}
+}
+
+// forward sends changes queued to the secondary of m until the queue is closed
+func (s *MirrorStore) forward(m *mirror) {
+	defer s.wg.Done()
+	for change := range m.queue {
+		if err := m.send(change); err != nil {
+			rpclog.Warn("rpc registry: mirror", "err", err)
+		}
+	}
+}
+
+func (m *mirror) send(change *mirrorChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	defer cancel()
+	resp, err := m.client.Do(ctx, change.method, "", nil, http.Header{"Content-Type": {jsonContentType}}, change.body)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc registry: mirror to %s: unexpected status %s", strings.Join(m.client.Addrs(), ","), resp.Status)
+	}
+	return nil
+}
+
+// Close forwards the changes queued and stops mirroring, the Store wrapped isn't closed
+func (s *MirrorStore) Close() error {
+	for _, m := range s.mirrors {
+		close(m.queue)
+	}
+	s.wg.Wait()
+	return nil
+}
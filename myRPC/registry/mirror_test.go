@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMirrorStore(t *testing.T) {
+	secondary := httptest.NewServer(New(time.Minute))
+	defer secondary.Close()
+	r := NewMirror(time.Minute, secondary.URL)
+	defer func() { _ = r.store.(*MirrorStore).Close() }()
+	primary := httptest.NewServer(r)
+	defer primary.Close()
+
+	waitServers := func(expect string) {
+		deadline := time.Now().Add(time.Second * 2)
+		for getServers(t, secondary.URL) != expect {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %q mirrored to secondary, but got %q", expect, getServers(t, secondary.URL))
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+	lease, err := NewClient(primary.URL).Register(context.Background(), &ServerItem{Addr: "tcp@127.0.0.1:1"})
+	if err != nil {
+		t.Fatal("failed to register:", err)
+	}
+	waitServers("tcp@127.0.0.1:1")
+	// the server fails over to secondary with the lease given by primary
+	if err = NewClient(secondary.URL).Renew(context.Background(), lease); err != nil {
+		t.Fatal("expect lease mirrored to secondary, but got", err)
+	}
+	if err = Deregister(primary.URL, "tcp@127.0.0.1:1"); err != nil {
+		t.Fatal("failed to deregister:", err)
+	}
+	waitServers("")
+}
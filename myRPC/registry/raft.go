@@ -0,0 +1,302 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"myRPC/internal/rpclog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+// RaftPeer is a member of a registry cluster
+type RaftPeer struct {
+	ID       string // unique ID of the node
+	RaftAddr string // address for raft communication, eg, 10.0.0.1:7000
+	HTTPAddr string // address of the registry, eg, http://10.0.0.1:9999/myRPC/registry
+}
+
+// RaftOption configures a node of a registry cluster
+type RaftOption struct {
+	RaftPeer                // the local node
+	Dir       string        // directory to keep the raft log and snapshots
+	Peers     []RaftPeer    // all members of the cluster, including the local node
+	Bootstrap bool          // bootstrap a new cluster with Peers, only one node should do it
+	Timeout   time.Duration // timeout of applying a change or forwarding it to leader
+	// Secret is shared by the nodes to authenticate changes forwarded to leader,
+	// which skip the token, client certificate and rate limit checked by the follower.
+	// It's required if any of them is set on the registries of cluster.
+	Secret    string
+	TLSConfig *tls.Config // for forwarding to leader if registries are served over HTTPS
+}
+
+const defaultRaftTimeout = time.Second * 5
+
+// RaftStore is a Store replicated by Raft among the nodes of a registry cluster.
+// Any node serves reads from its local replica, changes are applied by the leader,
+// a follower forwards registrations it receives to the leader at raftForwardPath
+// under the registry of leader over HTTP.
+// The raft log, and the term and vote of the node, are kept in Dir with snapshots.
+type RaftStore struct {
+	*memoryStore
+	raft      *raft.Raft
+	logs      *boltStore
+	transport *raft.NetworkTransport
+	peers     map[raft.ServerID]string // registry HTTP address of peers
+	timeout   time.Duration
+	client    *http.Client
+	secret    string
+}
+
+// raftForwardPath is the path of changes forwarded to leader, under the path of registry
+const raftForwardPath = "/raft/forward"
+
+var _ Store = &RaftStore{}
+
+func NewRaftStore(opt RaftOption) (*RaftStore, error) {
+	if opt.Timeout == 0 {
+		opt.Timeout = defaultRaftTimeout
+	}
+	s := &RaftStore{
+		memoryStore: newMemoryStore(),
+		peers:       make(map[raft.ServerID]string),
+		timeout:     opt.Timeout,
+		client:      &http.Client{Timeout: opt.Timeout},
+		secret:      opt.Secret,
+	}
+	if opt.TLSConfig != nil {
+		s.client.Transport = &http.Transport{TLSClientConfig: opt.TLSConfig}
+	}
+	logger := newRaftLogger()
+	config := raft.DefaultConfig()
+	config.LocalID = raft.ServerID(opt.ID)
+	config.Logger = logger
+
+	if err := os.MkdirAll(opt.Dir, 0755); err != nil {
+		return nil, err
+	}
+	snapshots, err := raft.NewFileSnapshotStoreWithLogger(opt.Dir, 2, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.logs, err = openBoltStore(filepath.Join(opt.Dir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	s.transport, err = raft.NewTCPTransportWithLogger(opt.RaftAddr, nil, 3, opt.Timeout, logger)
+	if err != nil {
+		_ = s.logs.Close()
+		return nil, err
+	}
+	s.raft, err = raft.NewRaft(config, (*raftFSM)(s.memoryStore), s.logs, s.logs, snapshots, s.transport)
+	if err != nil {
+		_ = s.transport.Close()
+		_ = s.logs.Close()
+		return nil, err
+	}
+
+	var servers []raft.Server
+	for _, peer := range opt.Peers {
+		s.peers[raft.ServerID(peer.ID)] = peer.HTTPAddr
+		servers = append(servers, raft.Server{ID: raft.ServerID(peer.ID), Address: raft.ServerAddress(peer.RaftAddr)})
+	}
+	if opt.Bootstrap {
+		err = s.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+		if err != nil && err != raft.ErrCantBootstrap {
+			_ = s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// NewRaft returns a CenterRegistry which is a node of a registry cluster
+func NewRaft(opt RaftOption, timeout time.Duration) (*CenterRegistry, error) {
+	s, err := NewRaftStore(opt)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithStore(s, timeout), nil
+}
+
+func (s *RaftStore) Put(item *ServerItem, ttl time.Duration) error {
+	if s.raft.State() != raft.Leader {
+		return s.forward(&raftChange{Op: "put", Item: item, TTL: Duration(ttl)})
+	}
+	// deadline is decided by leader, so that every replica expires the server at the same time
+	return s.apply(&fileRecord{Op: "put", Item: item, Deadline: deadlineOf(item, ttl)})
+}
+
+func (s *RaftStore) Delete(namespace, addr string) error {
+	if s.raft.State() != raft.Leader {
+		return s.forward(&raftChange{Op: "delete", Namespace: namespace, Addr: addr})
+	}
+	return s.apply(&fileRecord{Op: "delete", Namespace: namespace, Addr: addr})
+}
+
+func (s *RaftStore) apply(record *fileRecord) error {
+	b, _ := json.Marshal(record)
+	return s.raft.Apply(b, s.timeout).Error()
+}
+
+// raftChange is a change forwarded by a follower to leader
+type raftChange struct {
+	Op        string      `json:"op"` // put or delete
+	Item      *ServerItem `json:"item,omitempty"`
+	TTL       Duration    `json:"ttl,omitempty"`
+	Namespace string      `json:"namespace,omitempty"`
+	Addr      string      `json:"addr,omitempty"`
+}
+
+// forward sends a change to the registry of leader
+func (s *RaftStore) forward(change *raftChange) error {
+	_, id := s.raft.LeaderWithID()
+	addr := s.peers[id]
+	if addr == "" {
+		return errors.New("rpc registry: raft leader is unknown")
+	}
+	body, _ := json.Marshal(change)
+	req, _ := http.NewRequest("POST", strings.TrimSuffix(addr, "/")+raftForwardPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", jsonContentType)
+	if s.secret != "" {
+		req.Header.Set("Authorization", "Bearer "+s.secret)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc registry: forward to leader %s: unexpected status %s", id, resp.Status)
+	}
+	return nil
+}
+
+// serveRaftForward applies a change forwarded by a follower of the cluster,
+// the original request is checked by the follower already
+func (r *CenterRegistry) serveRaftForward(w http.ResponseWriter, req *http.Request) {
+	s, ok := r.store.(*RaftStore)
+	if !ok || req.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !r.fromRaftPeer(req, s.secret) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var change raftChange
+	if err := json.NewDecoder(req.Body).Decode(&change); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var err error
+	switch {
+	case change.Op == "put" && change.Item != nil:
+		err = s.Put(change.Item, time.Duration(change.TTL))
+	case change.Op == "delete":
+		err = s.Delete(change.Namespace, change.Addr)
+	default:
+		http.Error(w, "unknown change "+change.Op, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		rpclog.Warn("rpc registry: apply forwarded change", "op", change.Op, "err", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// fromRaftPeer reports whether req is sent by a node knowing the secret of cluster
+func (r *CenterRegistry) fromRaftPeer(req *http.Request, secret string) bool {
+	if secret == "" {
+		// anyone could forward changes, so they are only accepted if nothing is checked
+		return r.token == "" && r.clientCAs == nil && r.limiter == nil
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// IsLeader reports whether the local node is the leader of cluster
+func (s *RaftStore) IsLeader() bool {
+	return s.raft.State() == raft.Leader
+}
+
+// Close shuts down the raft node
+func (s *RaftStore) Close() error {
+	err := s.raft.Shutdown().Error()
+	_ = s.transport.Close()
+	_ = s.logs.Close()
+	return err
+}
+
+// raftFSM applies replicated records to the local replica
+type raftFSM memoryStore
+
+var _ raft.FSM = &raftFSM{}
+
+func (f *raftFSM) Apply(l *raft.Log) interface{} {
+	var record fileRecord
+	if err := json.Unmarshal(l.Data, &record); err != nil {
+		return err
+	}
+	(*memoryStore)(f).apply(&record)
+	return nil
+}
+
+func (f *raftFSM) Snapshot() (raft.FSMSnapshot, error) {
+	var buf bytes.Buffer
+	(*memoryStore)(f).writeRecords(&buf)
+	return &raftSnapshot{data: buf.Bytes()}, nil
+}
+
+func (f *raftFSM) Restore(rc io.ReadCloser) error {
+	defer func() { _ = rc.Close() }()
+	f.mu.Lock()
+	f.servers = make(map[string]*memoryItem)
+	f.leases = make(map[string]string)
+	f.mu.Unlock()
+	return (*memoryStore)(f).replay(rc)
+}
+
+type raftSnapshot struct {
+	data []byte
+}
+
+func (s *raftSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(s.data); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *raftSnapshot) Release() {}
+
+// newRaftLogger returns a logger of raft writing to rpclog, messages below warnings are dropped
+func newRaftLogger() hclog.Logger {
+	logger := hclog.NewInterceptLogger(&hclog.LoggerOptions{Name: "raft", Level: hclog.Warn, Output: io.Discard})
+	logger.RegisterSink(raftLogSink{})
+	return logger
+}
+
+// raftLogSink passes messages of raft to rpclog
+type raftLogSink struct{}
+
+func (raftLogSink) Accept(name string, level hclog.Level, msg string, args ...interface{}) {
+	msg = "rpc registry: " + name + ": " + msg
+	switch {
+	case level >= hclog.Error:
+		rpclog.Error(msg, args...)
+	case level == hclog.Warn:
+		rpclog.Warn(msg, args...)
+	}
+}
@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	defer func() { _ = l.Close() }()
+	return l.Addr().String()
+}
+
+// startRaftCluster starts a registry cluster of n nodes sharing secret, each of which
+// is served at defaultPath as HandleHTTP does. setup is called on the registry of every
+// node before it serves.
+func startRaftCluster(t *testing.T, n int, secret string, setup func(r *CenterRegistry)) ([]RaftPeer, []*RaftStore) {
+	var peers []RaftPeer
+	muxes := make([]*http.ServeMux, n)
+	for i := 0; i < n; i++ {
+		muxes[i] = http.NewServeMux()
+		ts := httptest.NewServer(muxes[i])
+		t.Cleanup(ts.Close)
+		peers = append(peers, RaftPeer{ID: fmt.Sprint("node", i), RaftAddr: freeAddr(t), HTTPAddr: ts.URL + defaultPath})
+	}
+	stores := make([]*RaftStore, n)
+	for i := 0; i < n; i++ {
+		s, err := NewRaftStore(RaftOption{RaftPeer: peers[i], Dir: t.TempDir(), Peers: peers, Bootstrap: i == 0, Secret: secret})
+		if err != nil {
+			t.Fatal("failed to start raft node:", err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+		stores[i] = s
+		r := NewWithStore(s, time.Minute)
+		if setup != nil {
+			setup(r)
+		}
+		r.handle(muxes[i], defaultPath)
+	}
+	return peers, stores
+}
+
+// registerEverywhere registers a server through every node of registryAddrs, followers forward to leader,
+// and waits until all of them are replicated to every store
+func registerEverywhere(t *testing.T, registryAddrs []string, stores []*RaftStore) {
+	deadline := time.Now().Add(time.Second * 10)
+	for i := 0; i < len(registryAddrs); {
+		_, err := sendHeartbeat(registryAddrs[i], &ServerItem{Addr: fmt.Sprint("tcp@127.0.0.1:", i+1)})
+		if err == nil {
+			i++
+			continue
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("failed to register before leader elected:", err)
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	for i := range stores {
+		for {
+			if servers, _ := stores[i].List(); len(servers) == len(registryAddrs) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expect servers replicated to node%d", i)
+			}
+			time.Sleep(time.Millisecond * 50)
+		}
+	}
+}
+
+func TestRaftStore(t *testing.T) {
+	peers, stores := startRaftCluster(t, 3, "", nil)
+	var addrs []string
+	for _, peer := range peers {
+		addrs = append(addrs, peer.HTTPAddr)
+	}
+	registerEverywhere(t, addrs, stores)
+}
+
+func TestRaftStore_Secret(t *testing.T) {
+	peers, stores := startRaftCluster(t, 3, "cluster secret", func(r *CenterRegistry) {
+		r.SetToken("secret", false)
+		// forwarded changes would run out of the limit of followers' IP otherwise
+		r.SetRateLimit(0.001, 1)
+	})
+	// every node takes a single registration, so it's not retried before leader elected
+	deadline := time.Now().Add(time.Second * 10)
+	for _, s := range stores {
+		for addr, _ := s.raft.LeaderWithID(); addr == ""; addr, _ = s.raft.LeaderWithID() {
+			if time.Now().After(deadline) {
+				t.Fatal("expect leader elected")
+			}
+			time.Sleep(time.Millisecond * 50)
+		}
+	}
+	var addrs []string
+	for _, peer := range peers {
+		addrs = append(addrs, strings.Replace(peer.HTTPAddr, "http://", "http://myrpc:secret@", 1))
+	}
+	registerEverywhere(t, addrs, stores)
+
+	// changes can't be forwarded without the secret of cluster
+	req, _ := http.NewRequest("POST", peers[0].HTTPAddr+raftForwardPath, strings.NewReader(`{"op":"delete","addr":"tcp@127.0.0.1:1"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expect a change without the secret forbidden, but got %s", resp.Status)
+	}
+}
+
+func TestRaftStore_Restart(t *testing.T) {
+	peer := RaftPeer{ID: "node0", RaftAddr: freeAddr(t), HTTPAddr: "http://127.0.0.1:1" + defaultPath}
+	opt := RaftOption{RaftPeer: peer, Dir: t.TempDir(), Peers: []RaftPeer{peer}, Bootstrap: true}
+	s, err := NewRaftStore(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second * 10); s.raft.State() != raft.Leader; time.Sleep(time.Millisecond * 50) {
+		if time.Now().After(deadline) {
+			t.Fatal("expect the node elected")
+		}
+	}
+	if err = s.Put(&ServerItem{Addr: "tcp@127.0.0.1:1", Start: time.Now()}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	term, last := s.raft.CurrentTerm(), s.raft.LastIndex()
+	_ = s.Close()
+
+	// term, vote and log survive the restart
+	s, err = NewRaftStore(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	if s.raft.CurrentTerm() < term || s.raft.LastIndex() < last {
+		t.Fatalf("expect term %d and log %d kept, but got %d and %d", term, last, s.raft.CurrentTerm(), s.raft.LastIndex())
+	}
+	for deadline := time.Now().Add(time.Second * 10); ; time.Sleep(time.Millisecond * 50) {
+		if servers, _ := s.List(); len(servers) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expect the server restored from the log")
+		}
+	}
+}
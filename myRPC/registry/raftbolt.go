@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	boltLogs   = []byte("logs")
+	boltStable = []byte("stable")
+
+	// errBoltKeyNotFound is told apart by raft by its message
+	errBoltKeyNotFound = errors.New("not found")
+)
+
+// boltStore keeps the raft log, and the term and vote of a node, in a bbolt file,
+// so that a node restarted never votes twice in a term
+type boltStore struct {
+	db *bbolt.DB
+}
+
+var (
+	_ raft.LogStore    = &boltStore{}
+	_ raft.StableStore = &boltStore{}
+)
+
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltLogs); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(boltStable)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *boltStore) FirstIndex() (uint64, error) {
+	return s.index(func(c *bbolt.Cursor) ([]byte, []byte) { return c.First() })
+}
+
+func (s *boltStore) LastIndex() (uint64, error) {
+	return s.index(func(c *bbolt.Cursor) ([]byte, []byte) { return c.Last() })
+}
+
+// index returns the index of the log at the position of c moved by move, 0 if there is no log
+func (s *boltStore) index(move func(c *bbolt.Cursor) ([]byte, []byte)) (uint64, error) {
+	var index uint64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if k, _ := move(tx.Bucket(boltLogs).Cursor()); k != nil {
+			index = binary.BigEndian.Uint64(k)
+		}
+		return nil
+	})
+	return index, err
+}
+
+func (s *boltStore) GetLog(index uint64, log *raft.Log) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(boltLogs).Get(boltKey(index))
+		if v == nil {
+			return raft.ErrLogNotFound
+		}
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(log)
+	})
+}
+
+func (s *boltStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+func (s *boltStore) StoreLogs(logs []*raft.Log) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltLogs)
+		for _, log := range logs {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(log); err != nil {
+				return err
+			}
+			if err := bucket.Put(boltKey(log.Index), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteRange deletes logs from min to max inclusive
+func (s *boltStore) DeleteRange(min, max uint64) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltLogs)
+		var keys [][]byte
+		c := bucket.Cursor()
+		for k, _ := c.Seek(boltKey(min)); k != nil && binary.BigEndian.Uint64(k) <= max; k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Set(key, val []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltStable).Put(key, val)
+	})
+}
+
+func (s *boltStore) Get(key []byte) ([]byte, error) {
+	var val []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(boltStable).Get(key)
+		if v == nil {
+			return errBoltKeyNotFound
+		}
+		val = append([]byte(nil), v...)
+		return nil
+	})
+	return val, err
+}
+
+func (s *boltStore) SetUint64(key []byte, val uint64) error {
+	return s.Set(key, boltKey(val))
+}
+
+func (s *boltStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
+
+// boltKey encodes n in big endian, so that keys of logs sort by their index
+func boltKey(n uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, n)
+}
@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter is a token bucket for each source of requests
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens added per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// SetRateLimit limits registrations, renewals and deregistrations sent from each IP
+// to rate per second with bursts of burst, excess requests are rejected with
+// 429 Too Many Requests, so a client stuck in a loop can't starve other requests.
+// Requests are not limited if rate is 0, which is the default.
+// It should be called before the registry starts serving.
+func (r *CenterRegistry) SetRateLimit(rate float64, burst int) {
+	if rate <= 0 {
+		r.limiter = nil
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	r.limiter = &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from the bucket of source, or returns how long to wait for one
+func (l *rateLimiter) allow(source string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		l.sweep(now)
+	}
+	b := l.buckets[source]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[source] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets buckets which are full again, so that sources gone don't pile up
+func (l *rateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for source, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, source)
+		}
+	}
+}
+
+// rateLimited responds 429 and returns true if the source of req runs out of its limit
+func (r *CenterRegistry) rateLimited(w http.ResponseWriter, req *http.Request) bool {
+	limited, wait := r.limited(req.RemoteAddr)
+	if !limited {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	return true
+}
+
+// limited reports whether the IP of remoteAddr runs out of its limit,
+// and how long to wait for the next request if it does
+func (r *CenterRegistry) limited(remoteAddr string) (bool, time.Duration) {
+	if r.limiter == nil {
+		return false, 0
+	}
+	source, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		source = remoteAddr
+	}
+	ok, wait := r.limiter.allow(source, time.Now())
+	if ok {
+		return false, 0
+	}
+	r.metrics.limited()
+	return true, wait
+}
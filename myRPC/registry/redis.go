@@ -0,0 +1,432 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"myRPC/internal/rpclog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisOption configures the connection of a RedisStore
+type RedisOption struct {
+	Addr        string        // address of redis server, eg, 127.0.0.1:6379
+	Password    string        // optional, send AUTH if it's not empty
+	DB          int           // database selected by SELECT
+	Prefix      string        // prefix of keys, "myrpc:registry:" by default
+	Channel     string        // pub/sub channel for change events, disabled if it's empty
+	DialTimeout time.Duration // timeout of connecting to redis
+}
+
+const (
+	defaultRedisPrefix      = "myrpc:registry:"
+	defaultRedisDialTimeout = time.Second * 5
+)
+
+// Event represents a change of registered servers published through redis pub/sub
+type Event struct {
+	Type      string // "register" when a new server appears, "deregister" when a server is deleted
+	Addr      string
+	Namespace string
+}
+
+// RedisStore is a Store which keeps every server as a redis key with TTL,
+// so that several registry instances can share the same server list.
+// The key is the prefix followed by the address, or by namespace/address
+// for servers registered to a namespace. Keys of the prefix followed by #
+// are kept along with servers, that is the keys of servers by their leases,
+// and leases of servers deleted.
+type RedisStore struct {
+	opt  RedisOption
+	mu   sync.Mutex // protect conn
+	conn *redisConn
+}
+
+var (
+	_ Store        = &RedisStore{}
+	_ deletedStore = &RedisStore{}
+	_ leaseStore   = &RedisStore{}
+)
+
+// redisMetaMark follows the prefix in keys which are not of servers
+const redisMetaMark = "#"
+
+func NewRedisStore(opt RedisOption) *RedisStore {
+	if opt.Prefix == "" {
+		opt.Prefix = defaultRedisPrefix
+	}
+	if opt.DialTimeout == 0 {
+		opt.DialTimeout = defaultRedisDialTimeout
+	}
+	return &RedisStore{opt: opt}
+}
+
+// NewRedis returns a CenterRegistry backed by redis
+func NewRedis(opt RedisOption, timeout time.Duration) *CenterRegistry {
+	return NewWithStore(NewRedisStore(opt), timeout)
+}
+
+func (s *RedisStore) Put(item *ServerItem, ttl time.Duration) error {
+	value, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	key := s.opt.Prefix + item.key()
+	exists := int64(0)
+	if s.opt.Channel != "" {
+		if exists, err = redisInt(s.do("EXISTS", key)); err != nil {
+			return err
+		}
+	}
+	if _, err = s.do(withTTL([]string{"SET", key, string(value)}, ttl)...); err != nil {
+		return err
+	}
+	if item.Lease != "" {
+		// the key of the server by its lease expires along with the server
+		if _, err = s.do(withTTL([]string{"SET", s.metaKey("lease", item.Lease), item.key()}, ttl)...); err != nil {
+			return err
+		}
+	}
+	if exists == 0 && s.opt.Channel != "" {
+		return s.publish(Event{Type: "register", Addr: item.Addr, Namespace: item.Namespace})
+	}
+	return nil
+}
+
+func (s *RedisStore) Delete(namespace, addr string) error {
+	key := serverKey(namespace, addr)
+	value, err := s.do("GET", s.opt.Prefix+key)
+	if err != nil {
+		return err
+	}
+	n, err := redisInt(s.do("DEL", s.opt.Prefix+key))
+	if err != nil || n == 0 {
+		return err
+	}
+	// remember the lease of the server deleted, see Deleted
+	var item ServerItem
+	if v, ok := value.(string); ok && json.Unmarshal([]byte(v), &item) == nil {
+		if item.Lease != "" {
+			if _, err = s.do("DEL", s.metaKey("lease", item.Lease)); err != nil {
+				return err
+			}
+		}
+		if _, err = s.do(withTTL([]string{"SET", s.metaKey("deleted", key), item.Lease}, deletedTTL)...); err != nil {
+			return err
+		}
+	}
+	if s.opt.Channel != "" {
+		return s.publish(Event{Type: "deregister", Addr: addr, Namespace: namespace})
+	}
+	return nil
+}
+
+// Deleted reports whether item was deleted by any registry sharing redis, rather
+// than a server registered again at its address later
+func (s *RedisStore) Deleted(item *ServerItem) (bool, error) {
+	lease, err := s.do("GET", s.metaKey("deleted", item.key()))
+	if err != nil {
+		return false, err
+	}
+	return lease == item.Lease, nil
+}
+
+// Lease returns the alive server registered with lease, nil if there is none
+func (s *RedisStore) Lease(lease string) (*ServerItem, error) {
+	key, err := s.do("GET", s.metaKey("lease", lease))
+	if err != nil {
+		return nil, err
+	}
+	k, ok := key.(string)
+	if !ok {
+		return nil, nil
+	}
+	value, err := s.do("GET", s.opt.Prefix+k)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := value.(string)
+	if !ok {
+		return nil, nil
+	}
+	var item ServerItem
+	if err = json.Unmarshal([]byte(v), &item); err != nil {
+		return nil, err
+	}
+	// the server may be registered again with another lease
+	if item.Lease != lease {
+		return nil, nil
+	}
+	return &item, nil
+}
+
+// withTTL appends PX of ttl to args of SET if ttl is positive
+func withTTL(args []string, ttl time.Duration) []string {
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	return args
+}
+
+// metaKey returns the key of kind for key of a server, which is not listed as a server
+func (s *RedisStore) metaKey(kind, key string) string {
+	return s.opt.Prefix + redisMetaMark + kind + ":" + key
+}
+
+func (s *RedisStore) List() ([]*ServerItem, error) {
+	var keys []string
+	cursor := "0"
+	// SCAN doesn't block redis like KEYS does
+	for {
+		reply, err := s.do("SCAN", cursor, "MATCH", s.opt.Prefix+"*", "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 2 {
+			return nil, fmt.Errorf("rpc registry: unexpected redis SCAN reply %v", reply)
+		}
+		cursor, _ = values[0].(string)
+		batch, _ := values[1].([]interface{})
+		for _, key := range batch {
+			if k, ok := key.(string); ok && !strings.HasPrefix(k, s.opt.Prefix+redisMetaMark) {
+				keys = append(keys, k)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	reply, err := s.do(append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	values, _ := reply.([]interface{})
+	servers := make([]*ServerItem, 0, len(values))
+	for _, value := range values {
+		// key may expire between SCAN and MGET
+		v, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var item ServerItem
+		if err := json.Unmarshal([]byte(v), &item); err != nil {
+			rpclog.Warn("rpc registry: invalid server item in redis", "err", err)
+			continue
+		}
+		servers = append(servers, &item)
+	}
+	sortServers(servers)
+	return servers, nil
+}
+
+func (s *RedisStore) publish(e Event) error {
+	msg, _ := json.Marshal(e)
+	_, err := s.do("PUBLISH", s.opt.Channel, string(msg))
+	return err
+}
+
+// Subscribe listens to change events on the configured channel until ctx is done
+func (s *RedisStore) Subscribe(ctx context.Context) (<-chan Event, error) {
+	if s.opt.Channel == "" {
+		return nil, errors.New("rpc registry: redis channel is not configured")
+	}
+	conn, err := dialRedis(s.opt)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.send("SUBSCRIBE", s.opt.Channel); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	ch := make(chan Event)
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	go func() {
+		defer close(ch)
+		for {
+			reply, err := conn.receive()
+			if err != nil {
+				if ctx.Err() == nil {
+					rpclog.Warn("rpc registry: redis subscribe", "err", err)
+				}
+				return
+			}
+			// message is formatted as ["message", channel, payload]
+			values, ok := reply.([]interface{})
+			if !ok || len(values) != 3 || values[0] != "message" {
+				continue
+			}
+			payload, _ := values[2].(string)
+			var e Event
+			if err := json.Unmarshal([]byte(payload), &e); err != nil {
+				continue
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Close closes the connection to redis
+func (s *RedisStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// do sends a command and reconnects once if the connection is broken
+func (s *RedisStore) do(args ...string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.conn == nil {
+			if s.conn, err = dialRedis(s.opt); err != nil {
+				return nil, err
+			}
+		}
+		var reply interface{}
+		reply, err = s.conn.do(args...)
+		if _, ok := err.(redisError); ok || err == nil {
+			return reply, err
+		}
+		// network error, the connection can't be used any more
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	return nil, err
+}
+
+// redisError is an error reply sent by redis server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func redisInt(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("rpc registry: unexpected redis reply %v", reply)
+	}
+	return n, nil
+}
+
+// redisConn is a minimal client speaking RESP (REdis Serialization Protocol)
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func dialRedis(opt RedisOption) (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", opt.Addr, opt.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if opt.Password != "" {
+		if _, err = c.do("AUTH", opt.Password); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	if opt.DB != 0 {
+		if _, err = c.do("SELECT", strconv.Itoa(opt.DB)); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.receive()
+}
+
+// send writes a command as an array of bulk strings
+func (c *redisConn) send(args ...string) error {
+	_, _ = fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		_, _ = fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.w.Flush()
+}
+
+// receive reads a reply, which may be string, int64, nil, []interface{} or redisError
+func (c *redisConn) receive() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: invalid reply " + strconv.Quote(line))
+	}
+	typ, body := line[0], line[1:len(line)-2]
+	switch typ {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			v, err := c.receive()
+			if _, ok := err.(redisError); err != nil && !ok {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	default:
+		return nil, errors.New("redis: invalid reply " + strconv.Quote(line))
+	}
+}
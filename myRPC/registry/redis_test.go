@@ -0,0 +1,151 @@
+package registry
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startFakeRedis serves a tiny subset of redis commands used by RedisStore
+func startFakeRedis(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	var mu sync.Mutex // guards data and deadlines, connections are served concurrently
+	data := make(map[string]string)
+	deadlines := make(map[string]time.Time) // of keys set with PX
+	get := func(k string) (string, bool) {
+		if deadline, ok := deadlines[k]; ok && !deadline.After(time.Now()) {
+			delete(data, k)
+			delete(deadlines, k)
+		}
+		v, ok := data[k]
+		return v, ok
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer func() { _ = conn.Close() }()
+				c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+				for {
+					reply, err := c.receive()
+					if err != nil {
+						return
+					}
+					var args []string
+					for _, v := range reply.([]interface{}) {
+						args = append(args, v.(string))
+					}
+					mu.Lock()
+					switch args[0] {
+					case "SET":
+						data[args[1]] = args[2]
+						delete(deadlines, args[1])
+						if len(args) == 5 && args[3] == "PX" {
+							ms, _ := strconv.Atoi(args[4])
+							deadlines[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+						}
+						_, _ = fmt.Fprint(c.w, "+OK\r\n")
+					case "GET":
+						if v, ok := get(args[1]); ok {
+							_, _ = fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(v), v)
+						} else {
+							_, _ = fmt.Fprint(c.w, "$-1\r\n")
+						}
+					case "DEL":
+						_, ok := get(args[1])
+						delete(data, args[1])
+						_, _ = fmt.Fprintf(c.w, ":%d\r\n", map[bool]int{true: 1}[ok])
+					case "EXISTS":
+						_, ok := get(args[1])
+						_, _ = fmt.Fprintf(c.w, ":%d\r\n", map[bool]int{true: 1}[ok])
+					case "PUBLISH":
+						_, _ = fmt.Fprint(c.w, ":0\r\n")
+					case "SCAN":
+						prefix := strings.TrimSuffix(args[3], "*")
+						var keys []string
+						for k := range data {
+							if _, ok := get(k); ok && strings.HasPrefix(k, prefix) {
+								keys = append(keys, k)
+							}
+						}
+						_, _ = fmt.Fprintf(c.w, "*2\r\n$1\r\n0\r\n*%d\r\n", len(keys))
+						for _, k := range keys {
+							_, _ = fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(k), k)
+						}
+					case "MGET":
+						_, _ = fmt.Fprintf(c.w, "*%d\r\n", len(args)-1)
+						for _, k := range args[1:] {
+							if v, ok := get(k); ok {
+								_, _ = fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(v), v)
+							} else {
+								_, _ = fmt.Fprint(c.w, "$-1\r\n")
+							}
+						}
+					default:
+						_, _ = fmt.Fprint(c.w, "-ERR unknown command\r\n")
+					}
+					mu.Unlock()
+					_ = c.w.Flush()
+				}
+			}(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestRedisStore(t *testing.T) {
+	s := NewRedisStore(RedisOption{Addr: startFakeRedis(t), Channel: "myrpc"})
+	defer func() { _ = s.Close() }()
+	r := NewWithStore(s, time.Minute)
+	for _, addr := range []string{"tcp@b:1", "tcp@a:1", "tcp@b:1"} {
+		if err := r.putServer(&ServerItem{Addr: addr}); err != nil {
+			t.Fatal("failed to put server:", err)
+		}
+	}
+	alive, _, err := r.listServers()
+	if err != nil || len(alive) != 2 || alive[0].Addr != "tcp@a:1" || alive[1].Addr != "tcp@b:1" {
+		t.Fatalf("expect 2 sorted servers, but got %v, %v", alive, err)
+	}
+
+	// the same address is a different server in another namespace
+	for _, namespace := range []string{"prod", "dev"} {
+		if err = r.putServer(&ServerItem{Addr: "tcp@a:1", Namespace: namespace}); err != nil {
+			t.Fatal("failed to put server:", err)
+		}
+	}
+	if err = s.Delete("dev", "tcp@a:1"); err != nil {
+		t.Fatal("failed to delete server:", err)
+	}
+	alive, _, err = r.listServers()
+	if err != nil || len(alive) != 3 || alive[0].Addr != "tcp@a:1" || alive[1].Namespace != "prod" {
+		t.Fatalf("expect the server in prod kept, but got %v, %v", alive, err)
+	}
+	if _, err = s.do("FLUSHALL"); err == nil {
+		t.Fatal("expect an error reply for unknown command")
+	}
+}
+
+func TestRedisStore_SharedDeregistration(t *testing.T) {
+	addr := startFakeRedis(t)
+	s1, s2 := NewRedisStore(RedisOption{Addr: addr}), NewRedisStore(RedisOption{Addr: addr})
+	defer func() { _, _ = s1.Close(), s2.Close() }()
+	testSharedDeregistration(t, s1, s2)
+}
+
+func TestRedisStore_Lease(t *testing.T) {
+	s := NewRedisStore(RedisOption{Addr: startFakeRedis(t)})
+	defer func() { _ = s.Close() }()
+	testLeaseStore(t, s)
+}
@@ -1,23 +1,33 @@
 package registry
 
 import (
-	"log"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"myRPC/internal/rpclog"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type CenterRegistry struct {
-	timeout time.Duration
-	mu      sync.Mutex
-	servers map[string]*ServerItem
-}
-
-type ServerItem struct {
-	Addr  string
-	start time.Time
+	timeout     time.Duration
+	store       Store
+	watcher     watcher
+	token       string // required to access registry if it's not empty
+	protectRead bool   // whether listing servers requires token
+	metrics     *registryMetrics
+	frozen      atomic.Bool // whether the server set is frozen by admin
+	events      eventLog
+	limiter     *rateLimiter   // limits changes from each source if it's not nil
+	clientCAs   *x509.CertPool // verifies client certificates of registrations if it's not nil
+	grace       time.Duration  // added to TTL of servers before they expire
+	stopSweep   chan struct{}  // stops sweeping expired servers in background
+	onExpire    func(addr string)
 }
 
 const (
@@ -26,96 +36,468 @@ const (
 )
 
 func New(timeout time.Duration) *CenterRegistry {
-	return &CenterRegistry{
+	return NewWithStore(newMemoryStore(), timeout)
+}
+
+// NewWithStore returns a CenterRegistry which keeps servers in the given store
+func NewWithStore(store Store, timeout time.Duration) *CenterRegistry {
+	r := &CenterRegistry{
 		timeout: timeout,
-		servers: make(map[string]*ServerItem),
+		store:   store,
 	}
+	r.metrics = newRegistryMetrics(r)
+	return r
 }
 
 var DefaultRegister = New(defaultTimeout)
 
-func (r *CenterRegistry) putServer(addr string) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	server := r.servers[addr]
-	if server == nil {
-		r.servers[addr] = &ServerItem{Addr: addr, start: time.Now()}
-	} else {
-		server.start = time.Now()
-	}
-}
-
-func (r *CenterRegistry) getAliveServers() []string {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	var alive []string
-	for addr, server := range r.servers {
-		if r.timeout == 0 || server.start.Add(r.timeout).After(time.Now()) {
-			alive = append(alive, addr)
-		} else {
-			delete(r.servers, addr)
+func (r *CenterRegistry) putServer(item *ServerItem) error {
+	item.Start = time.Now()
+	if err := r.store.Put(item, r.ttlOf(item)); err != nil {
+		return err
+	}
+	// wake up watches only if someone is watching, heartbeats are frequent
+	if r.watcher.watched() {
+		r.checkChanges()
+	}
+	return nil
+}
+
+func (r *CenterRegistry) deleteServer(namespace, addr string) error {
+	r.metrics.deregistered(serverKey(namespace, addr))
+	if err := r.store.Delete(namespace, addr); err != nil {
+		return err
+	}
+	if r.watcher.watched() {
+		r.checkChanges()
+	}
+	return nil
+}
+
+// findLease returns the alive server registered with lease, or nil if it's not found
+func (r *CenterRegistry) findLease(lease string) (*ServerItem, error) {
+	if s, ok := r.store.(leaseStore); ok {
+		return s.Lease(lease)
+	}
+	return r.findServer(func(server *ServerItem) bool { return server.Lease == lease })
+}
+
+// findServer returns the first alive server matched, or nil if it's not found
+func (r *CenterRegistry) findServer(match func(server *ServerItem) bool) (*ServerItem, error) {
+	servers, err := r.store.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range servers {
+		if match(server) {
+			return server, nil
+		}
+	}
+	return nil, nil
+}
+
+// serverFilter selects servers to be listed
+type serverFilter struct {
+	namespace string            // servers out of the namespace are never listed
+	service   string            // only servers exposing the service if it's not empty
+	zone      string            // only servers in the zone if it's not empty
+	labels    map[string]string // only servers having all the labels
+}
+
+// filterOf returns the filter of ?namespace=, ?service=, ?zone= and ?label=k=v of req,
+// label may be given more than once
+func filterOf(req *http.Request) serverFilter {
+	q := req.URL.Query()
+	f := serverFilter{namespace: q.Get("namespace"), service: q.Get("service"), zone: q.Get("zone")}
+	for _, label := range q["label"] {
+		if f.labels == nil {
+			f.labels = make(map[string]string)
 		}
+		k, v, _ := strings.Cut(label, "=")
+		f.labels[k] = v
 	}
-	sort.Strings(alive)
-	return alive
+	return f
+}
+
+func (f serverFilter) match(server *ServerItem) bool {
+	if server.Namespace != f.namespace {
+		return false
+	}
+	if (f.service != "" && !server.HasService(f.service)) || (f.zone != "" && server.Zone != f.zone) {
+		return false
+	}
+	for k, v := range f.labels {
+		if label, ok := server.Labels[k]; !ok || label != v {
+			return false
+		}
+	}
+	return true
+}
+
+// listServers returns alive servers of all namespaces and version of the server set
+func (r *CenterRegistry) listServers() ([]*ServerItem, uint64, error) {
+	servers, err := r.store.List()
+	if err != nil {
+		return nil, 0, err
+	}
+	version, removed := r.watcher.update(servers)
+	r.serversRemoved(removed)
+	return servers, version, nil
+}
+
+// getAliveServers returns alive servers matched by filter and version of the server set
+func (r *CenterRegistry) getAliveServers(filter serverFilter) ([]*ServerItem, uint64, error) {
+	servers, version, err := r.listServers()
+	if err != nil {
+		return nil, 0, err
+	}
+	alive := make([]*ServerItem, 0, len(servers))
+	for _, server := range servers {
+		if filter.match(server) {
+			alive = append(alive, server)
+		}
+	}
+	return alive, version, nil
 }
 
 // Runs at /myRPC/registry
 func (r *CenterRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if strings.HasSuffix(req.URL.Path, raftForwardPath) {
+		r.serveRaftForward(w, req)
+		return
+	}
+	if !r.authorized(req) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="myRPC registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	name, handler := r.route(req)
+	if handler == nil {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if name == "register" || name == "renew" || name == "deregister" {
+		if !r.certified(req) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.rateLimited(w, req) {
+			return
+		}
+	}
+	// watches and streams block until something changes, their latencies mean nothing
+	if name == "watch" || name == "stream" {
+		handler(w, req)
+		return
+	}
+	start := time.Now()
+	handler(w, req)
+	r.metrics.observe(name, time.Since(start))
+}
+
+// route returns the name and handler of req, or a nil handler if the method is not allowed
+func (r *CenterRegistry) route(req *http.Request) (string, http.HandlerFunc) {
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/watch"):
+		return getOnly(req, "watch", r.serveWatch)
+	case strings.HasSuffix(req.URL.Path, "/stream"):
+		return getOnly(req, "stream", r.serveStream)
+	case strings.HasSuffix(req.URL.Path, "/zone"):
+		return getOnly(req, "zone", r.serveZone)
+	case strings.HasSuffix(req.URL.Path, "/metrics"):
+		return getOnly(req, "metrics", r.serveMetrics)
+	case strings.HasSuffix(req.URL.Path, "/admin/servers"):
+		switch req.Method {
+		case "GET":
+			return "admin.servers", r.serveAdminServers
+		case "DELETE":
+			return "admin.evict", r.serveEvict
+		}
+		return "admin.servers", nil
+	case strings.HasSuffix(req.URL.Path, "/admin/events"):
+		return getOnly(req, "admin.events", r.serveEvents)
+	case strings.HasSuffix(req.URL.Path, "/admin/freeze"):
+		return postOnly(req, "admin.freeze", r.serveFreeze(true))
+	case strings.HasSuffix(req.URL.Path, "/admin/unfreeze"):
+		return postOnly(req, "admin.unfreeze", r.serveFreeze(false))
+	}
 	switch req.Method {
 	case "GET":
-		w.Header().Set("X-Myrpc-Servers", strings.Join(r.getAliveServers(), ","))
+		return "list", r.serveList
 	case "POST":
-		addr := req.Header.Get("X-Myrpc-Server")
-		if addr == "" {
-			w.WriteHeader(http.StatusInternalServerError)
+		return "register", r.serveRegister
+	case "PUT":
+		return "renew", r.serveRenew
+	case "DELETE":
+		return "deregister", r.serveDeregister
+	}
+	return req.Method, nil
+}
+
+// getOnly routes to handler only for GET requests
+func getOnly(req *http.Request, name string, handler http.HandlerFunc) (string, http.HandlerFunc) {
+	if req.Method != "GET" {
+		return name, nil
+	}
+	return name, handler
+}
+
+// postOnly routes to handler only for POST requests
+func postOnly(req *http.Request, name string, handler http.HandlerFunc) (string, http.HandlerFunc) {
+	if req.Method != "POST" {
+		return name, nil
+	}
+	return name, handler
+}
+
+// listResponse is the JSON body returned by GET
+type listResponse struct {
+	Version uint64        `json:"version"`
+	Servers []*ServerItem `json:"servers"`
+	Next    string        `json:"next,omitempty"` // pass as ?after= to get the next page
+}
+
+// paginate returns a page of servers sorted by address, which starts after
+// the address ?after= and has ?limit= servers at most, and the cursor of next page
+// if there are more servers. It returns false if the limit is invalid.
+func paginate(servers []*ServerItem, req *http.Request) ([]*ServerItem, string, bool) {
+	q := req.URL.Query()
+	if after := q.Get("after"); after != "" {
+		i := sort.Search(len(servers), func(i int) bool { return servers[i].Addr > after })
+		servers = servers[i:]
+	}
+	if q.Get("limit") == "" {
+		return servers, "", true
+	}
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		return nil, "", false
+	}
+	if len(servers) <= limit {
+		return servers, "", true
+	}
+	return servers[:limit], servers[limit-1].Addr, true
+}
+
+// serveList returns alive servers in JSON body if client accepts JSON,
+// otherwise in X-Myrpc-Servers and X-Myrpc-Server-Meta headers.
+// Only servers of ?namespace= are listed, which are servers registered
+// without namespace if it's absent, they can be selected by ?service=, ?zone=
+// and ?label=k=v further, and paginated by ?limit= and ?after=.
+// A client accepting JSON may ask for changes since ?since=<version> only.
+func (r *CenterRegistry) serveList(w http.ResponseWriter, req *http.Request) {
+	if since := req.URL.Query().Get("since"); since != "" && isJSON(req.Header.Get("Accept")) {
+		if version, err := strconv.ParseUint(since, 10, 64); err == nil {
+			r.serveChanges(w, req, version)
 			return
 		}
-		r.putServer(addr)
-	default:
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+	r.writeList(w, req)
+}
+
+// writeList responds all alive servers selected by req
+func (r *CenterRegistry) writeList(w http.ResponseWriter, req *http.Request) {
+	alive, version, err := r.getAliveServers(filterOf(req))
+	if err != nil {
+		rpclog.Error("rpc registry: list servers", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	alive, next, ok := paginate(alive, req)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("X-Myrpc-Registry-Version", strconv.FormatUint(version, 10))
+	if next != "" {
+		w.Header().Set("X-Myrpc-Next", next)
+	}
+	if isJSON(req.Header.Get("Accept")) {
+		writeJSON(w, &listResponse{Version: version, Servers: alive, Next: next})
+		return
+	}
+	addrs := make([]string, 0, len(alive))
+	for _, server := range alive {
+		addrs = append(addrs, server.Addr)
+		// metadata of each server is sent as a separate header value
+		w.Header().Add("X-Myrpc-Server-Meta", server.encodeMeta())
+	}
+	w.Header().Set("X-Myrpc-Servers", strings.Join(addrs, ","))
+}
+
+var errFrozen = errors.New("rpc registry: server set is frozen")
+
+// register puts a validated registration sent from remote
+func (r *CenterRegistry) register(item *ServerItem, remote string) error {
+	if err := r.checkFrozen(item); err != nil {
+		return err
+	}
+	// a registration forwarded by another registry node brings its lease and time
+	if item.Lease == "" || item.RegisteredAt.IsZero() {
+		item.RegisteredAt = time.Now()
+	}
+	if item.Lease == "" {
+		item.Lease = newLease()
+	}
+	if err := r.putServer(item); err != nil {
+		return err
+	}
+	r.metrics.registered(false)
+	r.record("register", item.Namespace, item.Addr, item.Lease, remote)
+	return nil
+}
+
+// deregister removes the server of addr in namespace on request of remote
+func (r *CenterRegistry) deregister(namespace, addr, remote string) error {
+	if r.frozen.Load() {
+		return errFrozen
+	}
+	if err := r.deleteServer(namespace, addr); err != nil {
+		return err
+	}
+	r.record("deregister", namespace, addr, "", remote)
+	return nil
+}
+
+func (r *CenterRegistry) serveRegister(w http.ResponseWriter, req *http.Request) {
+	item, err := readRegistration(req)
+	if err != nil {
+		rpclog.Warn("rpc registry: invalid registration", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err = r.register(item, req.RemoteAddr); err == errFrozen {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		rpclog.Error("rpc registry: put server", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.writeLease(w, req, item)
+}
+
+// leaseResponse is the JSON body returned by register and renew
+type leaseResponse struct {
+	Lease string   `json:"lease"`
+	TTL   Duration `json:"ttl"`
+}
+
+func (r *CenterRegistry) writeLease(w http.ResponseWriter, req *http.Request, item *ServerItem) {
+	ttl := item.TTL
+	if ttl == 0 {
+		ttl = Duration(r.timeout)
+	}
+	w.Header().Set("X-Myrpc-Lease", item.Lease)
+	if isJSON(req.Header.Get("Accept")) {
+		writeJSON(w, &leaseResponse{Lease: item.Lease, TTL: ttl})
+	}
+}
+
+// serveRenew renews the registration referenced by X-Myrpc-Lease or ?lease=,
+// it responds 404 if the lease has expired, then the server should register again.
+// The load of the server is updated by X-Myrpc-Load if it's sent.
+func (r *CenterRegistry) serveRenew(w http.ResponseWriter, req *http.Request) {
+	load, err := parseLoad(req.Header.Get("X-Myrpc-Load"))
+	if err != nil {
+		rpclog.Error("rpc registry: renew server", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	item, status := r.requestLease(req)
+	if item == nil {
+		w.WriteHeader(status)
+		return
+	}
+	if load != nil {
+		// the item listed may be shared with readers, renew a copy of it
+		renewed := *item
+		renewed.Load = load
+		item = &renewed
+	}
+	if err = r.putServer(item); err != nil {
+		rpclog.Error("rpc registry: renew server", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.metrics.registered(true)
+	r.record("renew", item.Namespace, item.Addr, item.Lease, req.RemoteAddr)
+	r.writeLease(w, req, item)
+}
+
+// requestLease finds the server referenced by lease of req,
+// returns nil and the status to respond if it's not found
+func (r *CenterRegistry) requestLease(req *http.Request) (*ServerItem, int) {
+	lease := req.Header.Get("X-Myrpc-Lease")
+	if lease == "" {
+		lease = req.URL.Query().Get("lease")
+	}
+	if lease == "" {
+		return nil, http.StatusBadRequest
+	}
+	item, err := r.findLease(lease)
+	if err != nil {
+		rpclog.Error("rpc registry: find lease", "err", err)
+		return nil, http.StatusInternalServerError
+	}
+	if item == nil {
+		return nil, http.StatusNotFound
+	}
+	return item, http.StatusOK
+}
+
+// serveDeregister removes the server referenced by lease, or by address
+// and namespace in X-Myrpc-Server and X-Myrpc-Namespace headers or JSON body
+func (r *CenterRegistry) serveDeregister(w http.ResponseWriter, req *http.Request) {
+	addr, namespace := req.Header.Get("X-Myrpc-Server"), req.Header.Get("X-Myrpc-Namespace")
+	if isJSON(req.Header.Get("Content-Type")) {
+		var item ServerItem
+		if err := json.NewDecoder(req.Body).Decode(&item); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		addr, namespace = item.Addr, item.Namespace
+	}
+	if addr == "" {
+		item, status := r.requestLease(req)
+		if item == nil {
+			w.WriteHeader(status)
+			return
+		}
+		addr, namespace = item.Addr, item.Namespace
+	}
+	if err := r.deregister(namespace, addr, req.RemoteAddr); err == errFrozen {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else if err != nil {
+		rpclog.Error("rpc registry: delete server", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
 // HandleHTTP registers an HTTP handler for CenterRegistry messages on registryPath
 // http.Handle(pattern, handler): handler is an interface{}, which should implement method ServeHTTP()
 func (r *CenterRegistry) HandleHTTP(registryPath string) {
-	http.Handle(registryPath, r)
-	log.Println("rpc registry path:", registryPath)
+	r.handle(http.DefaultServeMux, registryPath)
+	rpclog.Info("rpc registry: handle HTTP", "path", registryPath)
 }
 
-func HandleHTTP() {
-	DefaultRegister.HandleHTTP(defaultPath)
+// handle registers r on mux for every path it serves under registryPath
+func (r *CenterRegistry) handle(mux *http.ServeMux, registryPath string) {
+	mux.Handle(registryPath, r)
+	mux.Handle(registryPath+"/watch", r)
+	mux.Handle(registryPath+"/stream", r)
+	mux.Handle(registryPath+"/metrics", r)
+	mux.Handle(registryPath+"/zone", r)
+	mux.Handle(registryPath+"/admin/", r)
+	mux.Handle(registryPath+raftForwardPath, r)
 }
 
-// Heartbeat send a heartbeat message every once in a while
-// it's a helper function for a server to register or send heartbeat
-func Heartbeat(registryAddr, serverAddr string, duration time.Duration) {
-	// set default send cycle
-	if duration == 0 {
-		// make sure there is enough time to send heart beat
-		// before it's removed from registry
-		duration = defaultTimeout - time.Duration(1)*time.Minute
-	}
-	var err error
-	err = sendHeartbeat(registryAddr, serverAddr)
-	go func() {
-		t := time.NewTicker(duration)
-		for err == nil {
-			<-t.C
-			err = sendHeartbeat(registryAddr, serverAddr)
-		}
-	}()
+func HandleHTTP() {
+	DefaultRegister.HandleHTTP(defaultPath)
 }
 
-func sendHeartbeat(registryAddr, serverAddr string) error {
-	log.Println(serverAddr, "send heart beat to registry", registryAddr)
-	httpClient := &http.Client{}
-	req, _ := http.NewRequest("POST", registryAddr, nil)
-	req.Header.Set("X-Myrpc-Server", serverAddr)
-	if _, err := httpClient.Do(req); err != nil {
-		log.Println("rpc server: heart beat err:", err)
-		return err
-	}
-	return nil
+// Deregister removes a server of the default namespace from registry immediately,
+// it's a helper function for a server to call before shutting down
+func Deregister(registryAddr, serverAddr string) error {
+	return NewClient(registryAddr).Deregister(context.Background(), serverAddr)
 }
@@ -0,0 +1,769 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func getServers(t *testing.T, registryAddr string) string {
+	resp, err := http.Get(registryAddr)
+	if err != nil {
+		t.Fatal("failed to get servers:", err)
+	}
+	_ = resp.Body.Close()
+	return resp.Header.Get("X-Myrpc-Servers")
+}
+
+func TestCenterRegistry_Deregister(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	if _, err := sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1"}); err != nil {
+		t.Fatal("failed to send heartbeat:", err)
+	}
+	if servers := getServers(t, ts.URL); servers != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect the registered server, but got %q", servers)
+	}
+	if err := Deregister(ts.URL, "tcp@127.0.0.1:1"); err != nil {
+		t.Fatal("failed to deregister:", err)
+	}
+	if servers := getServers(t, ts.URL); servers != "" {
+		t.Fatalf("expect no server after deregister, but got %q", servers)
+	}
+}
+
+func TestCenterRegistry_Namespaces(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	for _, namespace := range []string{"prod", "dev"} {
+		if _, err := sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1", Namespace: namespace}); err != nil {
+			t.Fatal("failed to send heartbeat:", err)
+		}
+	}
+	for _, namespace := range []string{"prod", "dev"} {
+		if servers := getServers(t, ts.URL+"?namespace="+namespace); servers != "tcp@127.0.0.1:1" {
+			t.Fatalf("expect the server registered to %s, but got %q", namespace, servers)
+		}
+	}
+	if err := NewClient(ts.URL).DeregisterNamespace(context.Background(), "dev", "tcp@127.0.0.1:1"); err != nil {
+		t.Fatal("failed to deregister:", err)
+	}
+	if servers := getServers(t, ts.URL+"?namespace=dev"); servers != "" {
+		t.Fatalf("expect no server in dev after deregister, but got %q", servers)
+	}
+	if servers := getServers(t, ts.URL+"?namespace=prod"); servers != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect the server in prod kept, but got %q", servers)
+	}
+}
+
+func TestCenterRegistry_Service(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1", Services: []string{"Foo", "Bar"}})
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:2", Services: []string{"Bar"}})
+	if servers := getServers(t, ts.URL+"?service=Foo"); servers != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect only the server exposing Foo, but got %q", servers)
+	}
+	if servers := getServers(t, ts.URL+"?service=Bar"); servers != "tcp@127.0.0.1:1,tcp@127.0.0.1:2" {
+		t.Fatalf("expect both servers exposing Bar, but got %q", servers)
+	}
+}
+
+func TestCenterRegistry_Meta(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	// register in headers
+	req, _ := http.NewRequest("POST", ts.URL, nil)
+	req.Header.Set("X-Myrpc-Server", "tcp@127.0.0.1:1")
+	req.Header.Set("X-Myrpc-Weight", "2")
+	req.Header.Set("X-Myrpc-Zone", "z1")
+	req.Header.Set("X-Myrpc-Codecs", "application/gob")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatal("failed to register in headers:", err)
+	}
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal("failed to get servers:", err)
+	}
+	_ = resp.Body.Close()
+	meta := resp.Header.Get("X-Myrpc-Server-Meta")
+	if meta != "addr=tcp%40127.0.0.1%3A1&codecs=application%2Fgob&weight=2&zone=z1" {
+		t.Fatalf("unexpected server metadata %q", meta)
+	}
+}
+
+func TestCenterRegistry_JSON(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1", Services: []string{"Foo"}, Weight: 3})
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Accept", jsonContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("failed to get servers:", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var list listResponse
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal("failed to decode servers:", err)
+	}
+	if len(list.Servers) != 1 || list.Servers[0].Addr != "tcp@127.0.0.1:1" || list.Servers[0].Weight != 3 {
+		t.Fatalf("unexpected servers %+v", list.Servers)
+	}
+}
+
+func TestCenterRegistry_Watch(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1"})
+	resp, err := http.Get(ts.URL + "/watch?since=0")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatal("expect the current servers if version is newer than since:", err)
+	}
+	_ = resp.Body.Close()
+	version := resp.Header.Get("X-Myrpc-Registry-Version")
+
+	resp, err = http.Get(ts.URL + "/watch?timeout=100ms&since=" + version)
+	if err != nil || resp.StatusCode != http.StatusNotModified {
+		t.Fatal("expect 304 if nothing changed before timeout:", err)
+	}
+	_ = resp.Body.Close()
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:2"})
+	}()
+	start := time.Now()
+	resp, err = http.Get(ts.URL + "/watch?since=" + version)
+	if err != nil || resp.StatusCode != http.StatusOK || time.Since(start) > time.Second {
+		t.Fatal("expect watch returns as soon as a server is added:", err)
+	}
+	_ = resp.Body.Close()
+	if servers := resp.Header.Get("X-Myrpc-Servers"); servers != "tcp@127.0.0.1:1,tcp@127.0.0.1:2" {
+		t.Fatalf("unexpected servers %q", servers)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal("failed to create file store:", err)
+	}
+	r := NewWithStore(s, time.Minute)
+	_ = r.putServer(&ServerItem{Addr: "tcp@127.0.0.1:1"})
+	_ = r.putServer(&ServerItem{Addr: "tcp@127.0.0.1:2"})
+	_ = s.Snapshot()
+	_ = r.putServer(&ServerItem{Addr: "tcp@127.0.0.1:3"})
+	_ = r.deleteServer("", "tcp@127.0.0.1:1")
+	// simulate a crash, the log isn't compacted by Close
+	_ = s.log.Close()
+
+	s, err = NewFileStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal("failed to reload file store:", err)
+	}
+	defer func() { _ = s.Close() }()
+	servers, _ := s.List()
+	if len(servers) != 2 || servers[0].Addr != "tcp@127.0.0.1:2" || servers[1].Addr != "tcp@127.0.0.1:3" {
+		t.Fatalf("expect servers restored from snapshot and log, but got %v", servers)
+	}
+}
+
+func TestCenterRegistry_SetToken(t *testing.T) {
+	r := New(time.Minute)
+	r.SetToken("secret", true)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	if _, err := sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1"}); err == nil {
+		t.Fatal("expect registration without token is rejected")
+	}
+	authorized := strings.Replace(ts.URL, "http://", "http://myrpc:secret@", 1)
+	if _, err := sendHeartbeat(authorized, &ServerItem{Addr: "tcp@127.0.0.1:1"}); err != nil {
+		t.Fatal("expect registration with token is accepted:", err)
+	}
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.Header.Get("X-Myrpc-Servers") != "tcp@127.0.0.1:1" {
+		t.Fatal("expect listing with bearer token is accepted:", err)
+	}
+	_ = resp.Body.Close()
+	if resp, _ = http.Get(ts.URL); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect listing without token is rejected, but got %s", resp.Status)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestCenterRegistry_TTL(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1", TTL: Duration(time.Millisecond * 100)})
+	req, _ := http.NewRequest("POST", ts.URL, nil)
+	req.Header.Set("X-Myrpc-Server", "tcp@127.0.0.1:2")
+	req.Header.Set("X-Myrpc-TTL", "0.1")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatal("failed to register with ttl in header:", err)
+	}
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:3"})
+	if servers := getServers(t, ts.URL); servers != "tcp@127.0.0.1:1,tcp@127.0.0.1:2,tcp@127.0.0.1:3" {
+		t.Fatalf("expect all servers alive, but got %q", servers)
+	}
+	time.Sleep(time.Millisecond * 150)
+	if servers := getServers(t, ts.URL); servers != "tcp@127.0.0.1:3" {
+		t.Fatalf("expect servers with short ttl expired, but got %q", servers)
+	}
+}
+
+func TestCenterRegistry_Lease(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	lease, err := sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1", TTL: Duration(time.Millisecond * 200)})
+	if err != nil || lease == "" {
+		t.Fatal("expect a lease returned by registration:", err)
+	}
+	time.Sleep(time.Millisecond * 150)
+	if err = renewLease(ts.URL, lease); err != nil {
+		t.Fatal("failed to renew lease:", err)
+	}
+	time.Sleep(time.Millisecond * 150)
+	if servers := getServers(t, ts.URL); servers != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect server kept alive by renewal, but got %q", servers)
+	}
+	if err = renewLease(ts.URL, "unknown"); err != errLeaseNotFound {
+		t.Fatal("expect renewing an unknown lease fails:", err)
+	}
+
+	req, _ := http.NewRequest("DELETE", ts.URL+"?lease="+lease, nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatal("failed to revoke lease:", err)
+	}
+	if servers := getServers(t, ts.URL); servers != "" {
+		t.Fatalf("expect no server after revoking lease, but got %q", servers)
+	}
+}
+
+func TestCenterRegistry_Metrics(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1", TTL: Duration(time.Millisecond * 100)})
+	lease, _ := sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:2"})
+	_ = renewLease(ts.URL, lease)
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:3"})
+	getServers(t, ts.URL)
+	_ = Deregister(ts.URL, "tcp@127.0.0.1:3")
+	time.Sleep(time.Millisecond * 150)
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal("failed to get metrics:", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, _ := io.ReadAll(resp.Body)
+	for _, line := range []string{
+		"myrpc_registry_servers 1",
+		`myrpc_registry_heartbeats_total{op="register"} 3`,
+		`myrpc_registry_heartbeats_total{op="renew"} 1`,
+		"myrpc_registry_deregistrations_total 1",
+		"myrpc_registry_expirations_total 1",
+		`myrpc_registry_request_duration_seconds_count{handler="register"} 3`,
+	} {
+		if !strings.Contains(string(b), line+"\n") {
+			t.Fatalf("expect %q in metrics, but got:\n%s", line, b)
+		}
+	}
+}
+
+func TestCenterRegistry_Admin(t *testing.T) {
+	r := New(time.Minute)
+	r.SetToken("secret", false)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	admin := func(method, path string) *http.Response {
+		req, _ := http.NewRequest(method, ts.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("failed to request admin:", err)
+		}
+		return resp
+	}
+	authAddr := "http://myrpc:secret@" + strings.TrimPrefix(ts.URL, "http://")
+	_, _ = sendHeartbeat(authAddr, &ServerItem{Addr: "tcp@127.0.0.1:1", Zone: "z1"})
+
+	if resp, _ := http.Get(ts.URL + "/admin/servers"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("expect admin requires token, but got", resp.Status)
+	}
+	resp := admin("GET", "/admin/servers")
+	var list adminResponse
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	_ = resp.Body.Close()
+	if len(list.Servers) != 1 || list.Servers[0].Zone != "z1" || list.Servers[0].Start.IsZero() || list.Servers[0].Expires.IsZero() {
+		t.Fatalf("expect the registered server with its times, but got %+v", list)
+	}
+	registered := list.Servers[0].RegisteredAt
+	time.Sleep(time.Millisecond * 10)
+	if err := renewLease(authAddr, list.Servers[0].Lease); err != nil {
+		t.Fatal("failed to renew:", err)
+	}
+	resp = admin("GET", "/admin/servers")
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	_ = resp.Body.Close()
+	if server := list.Servers[0]; !server.RegisteredAt.Equal(registered) || !server.Start.After(registered) {
+		t.Fatalf("expect the time of registration kept on renewal, but got %+v", server)
+	}
+
+	_ = admin("POST", "/admin/freeze").Body.Close()
+	if _, err := sendHeartbeat(authAddr, &ServerItem{Addr: "tcp@127.0.0.1:2"}); err == nil {
+		t.Fatal("expect a new server can't register while frozen")
+	}
+	if err := Deregister(authAddr, "tcp@127.0.0.1:1"); err == nil {
+		t.Fatal("expect a server can't deregister while frozen")
+	}
+	if resp = admin("DELETE", "/admin/servers?addr=tcp@127.0.0.1:1"); resp.StatusCode != http.StatusOK {
+		t.Fatal("failed to evict server:", resp.Status)
+	}
+	if servers := getServers(t, ts.URL); servers != "" {
+		t.Fatalf("expect no server after eviction, but got %q", servers)
+	}
+	_ = admin("POST", "/admin/unfreeze").Body.Close()
+	if _, err := sendHeartbeat(authAddr, &ServerItem{Addr: "tcp@127.0.0.1:2"}); err != nil {
+		t.Fatal("failed to register after unfreezing:", err)
+	}
+}
+
+func TestHeartbeater(t *testing.T) {
+	r := New(time.Minute)
+	var mu sync.Mutex
+	failures, requests := 2, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests++
+		fail := requests <= failures
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.ServeHTTP(w, req)
+	}))
+	defer ts.Close()
+
+	var errs int32
+	h := NewHeartbeater(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1"}, time.Millisecond*50)
+	h.MaxBackoff = time.Millisecond * 50
+	h.OnError = func(err error) { atomic.AddInt32(&errs, 1) }
+	if err := h.Start(context.Background()); err == nil {
+		t.Fatal("expect the first registration fails")
+	}
+	time.Sleep(time.Millisecond * 300)
+	if servers := getServers(t, ts.URL); servers != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect heartbeats recover from failures, but got %q", servers)
+	}
+	if atomic.LoadInt32(&errs) != 2 || h.Lease() == "" {
+		t.Fatalf("expect 2 errors reported and a lease, but got %d and %q", errs, h.Lease())
+	}
+	h.Stop()
+	mu.Lock()
+	stopped := requests
+	mu.Unlock()
+	time.Sleep(time.Millisecond * 150)
+	mu.Lock()
+	restarted := requests
+	mu.Unlock()
+	if restarted != stopped {
+		t.Fatal("expect no heartbeat after Stop")
+	}
+	if err := h.Start(context.Background()); err != nil {
+		t.Fatal("expect the heartbeater started again after Stop, but got", err)
+	}
+	h.Stop()
+}
+
+func TestHeartbeater_Timeout(t *testing.T) {
+	// registry hangs until the test ends
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-hang
+	}))
+	defer ts.Close()
+	defer close(hang)
+	h := NewHeartbeater(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1"}, time.Minute)
+	h.Timeout = time.Millisecond * 100
+	start := time.Now()
+	if err := h.Start(context.Background()); err == nil {
+		t.Fatal("expect the heartbeat to time out")
+	}
+	h.Stop()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect the heartbeat bounded by its timeout, but it took %s", d)
+	}
+}
+
+func TestCenterRegistry_Events(t *testing.T) {
+	r := New(time.Minute)
+	var hooked []string
+	var mu sync.Mutex
+	r.SetEventHook(func(event AuditEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		hooked = append(hooked, event.Type)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	lease, _ := sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1", TTL: Duration(time.Millisecond * 100)})
+	_ = renewLease(ts.URL, lease)
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:2"})
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:3"})
+	getServers(t, ts.URL)
+	_ = Deregister(ts.URL, "tcp@127.0.0.1:2")
+	req, _ := http.NewRequest("DELETE", ts.URL+"/admin/servers?addr=tcp@127.0.0.1:3", nil)
+	_, _ = http.DefaultClient.Do(req)
+	time.Sleep(time.Millisecond * 150)
+	getServers(t, ts.URL)
+
+	resp, err := http.Get(ts.URL + "/admin/events?since=1")
+	if err != nil {
+		t.Fatal("failed to get events:", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var events eventsResponse
+	_ = json.NewDecoder(resp.Body).Decode(&events)
+	var types []string
+	for _, event := range events.Events {
+		types = append(types, event.Type+" "+event.Addr)
+	}
+	expect := "renew tcp@127.0.0.1:1,register tcp@127.0.0.1:2,register tcp@127.0.0.1:3," +
+		"deregister tcp@127.0.0.1:2,evict tcp@127.0.0.1:3,expire tcp@127.0.0.1:1"
+	if strings.Join(types, ",") != expect {
+		t.Fatalf("expect events %q, but got %q", expect, strings.Join(types, ","))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hooked) != 7 {
+		t.Fatalf("expect every event hooked, but got %v", hooked)
+	}
+}
+
+func TestCenterRegistry_EventsRing(t *testing.T) {
+	r := New(time.Minute)
+	r.record("register", "prod", "tcp@127.0.0.1:1", "lease", "")
+	for i := 0; i < eventLogSize+renewLogSize; i++ {
+		r.record("renew", "prod", "tcp@127.0.0.1:1", "lease", "")
+	}
+	r.record("deregister", "prod", "tcp@127.0.0.1:1", "", "")
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/admin/events")
+	if err != nil {
+		t.Fatal("failed to get events:", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var events eventsResponse
+	_ = json.NewDecoder(resp.Body).Decode(&events)
+	if n := len(events.Events); n != renewLogSize+2 {
+		t.Fatalf("expect the most recent renewals kept apart from changes, but got %d events", n)
+	}
+	first, last := events.Events[0], events.Events[len(events.Events)-1]
+	if first.Type != "register" || first.Namespace != "prod" || last.Type != "deregister" {
+		t.Fatalf("expect changes kept in order of events, but got %+v and %+v", first, last)
+	}
+	for i, event := range events.Events[1 : len(events.Events)-1] {
+		if event.Type != "renew" || event.Seq != uint64(eventLogSize+2+i) {
+			t.Fatalf("expect the most recent renewals in order, but got %+v", event)
+		}
+	}
+}
+
+func TestCenterRegistry_RateLimit(t *testing.T) {
+	r := New(time.Minute)
+	r.SetRateLimit(1, 2)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1"}); err != nil {
+			t.Fatal("expect heartbeats within burst are allowed:", err)
+		}
+	}
+	req, _ := http.NewRequest("POST", ts.URL, nil)
+	req.Header.Set("X-Myrpc-Server", "tcp@127.0.0.1:1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" {
+		t.Fatal("expect heartbeats beyond burst are rejected:", err, resp.Status)
+	}
+	if servers := getServers(t, ts.URL); servers != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect listing is not limited, but got %q", servers)
+	}
+}
+
+func TestCenterRegistry_InvalidAddr(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	for _, addr := range []string{"127.0.0.1:1", "tcp@:1", "tcp@0.0.0.0:1", "tcp@[::]:1", "tcp@127.0.0.1:0", "tcp@127.0.0.1"} {
+		if _, err := sendHeartbeat(ts.URL, &ServerItem{Addr: addr}); err == nil {
+			t.Fatalf("expect invalid address %s is rejected", addr)
+		}
+	}
+	if _, err := sendHeartbeat(ts.URL, &ServerItem{Addr: "unix@/tmp/myrpc.sock"}); err != nil {
+		t.Fatal("expect unix socket address is accepted:", err)
+	}
+}
+
+func TestClient_Failover(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+
+	c := NewClient("http://"+freeAddr(t)+"/myRPC/registry", unavailable.URL+","+ts.URL)
+	if len(c.Addrs()) != 3 {
+		t.Fatalf("expect 3 registry addresses, but got %v", c.Addrs())
+	}
+	lease, err := c.Register(context.Background(), &ServerItem{Addr: "tcp@127.0.0.1:1"})
+	if err != nil || lease == "" {
+		t.Fatal("expect registration fails over to the available registry:", err)
+	}
+	if err = c.Renew(context.Background(), lease); err != nil {
+		t.Fatal("failed to renew:", err)
+	}
+
+	c = NewClient(unavailable.URL)
+	c.Backoff = time.Millisecond
+	if _, err = c.Register(context.Background(), &ServerItem{Addr: "tcp@127.0.0.1:1"}); err == nil {
+		t.Fatal("expect registration fails when no registry is available")
+	}
+}
+
+func TestCenterRegistry_Since(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	getChanges := func(query string) (*streamUpdate, bool) {
+		req, _ := http.NewRequest("GET", ts.URL+query, nil)
+		req.Header.Set("Accept", jsonContentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("failed to get changes:", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var update streamUpdate
+		_ = json.NewDecoder(resp.Body).Decode(&update)
+		return &update, resp.Header.Get("X-Myrpc-Registry-Since") != ""
+	}
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1"})
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:2", Services: []string{"Foo"}})
+	base, _ := getChanges("?since=0")
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:3", Services: []string{"Foo"}})
+	getServers(t, ts.URL)
+	_ = Deregister(ts.URL, "tcp@127.0.0.1:2")
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:4"})
+	_ = Deregister(ts.URL, "tcp@127.0.0.1:4")
+
+	update, ok := getChanges(fmt.Sprint("?service=Foo&since=", base.Version))
+	if !ok || update.Version <= base.Version {
+		t.Fatalf("expect changes since version %d, but got %+v", base.Version, update)
+	}
+	if len(update.Added) != 1 || update.Added[0].Addr != "tcp@127.0.0.1:3" || len(update.Removed) != 1 || update.Removed[0] != "tcp@127.0.0.1:2" {
+		t.Fatalf("expect server 3 added and 2 removed, but got %+v", update)
+	}
+	if update, ok = getChanges(fmt.Sprint("?since=", update.Version)); !ok || len(update.Added)+len(update.Removed) != 0 {
+		t.Fatalf("expect no change since the current version, but got %+v", update)
+	}
+	if _, ok = getChanges("?since=1000"); ok {
+		t.Fatal("expect full list for an unknown version")
+	}
+}
+
+func TestCenterRegistry_FilterAndPaginate(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1", Zone: "z1", Labels: map[string]string{"track": "canary"}})
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:2", Zone: "z1", Labels: map[string]string{"track": "stable"}})
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:3", Zone: "z2", Labels: map[string]string{"track": "stable"}})
+	req, _ := http.NewRequest("POST", ts.URL, nil)
+	req.Header.Set("X-Myrpc-Server", "tcp@127.0.0.1:4")
+	req.Header.Set("X-Myrpc-Labels", "track=stable, team=a")
+	_, _ = http.DefaultClient.Do(req)
+
+	for query, expect := range map[string]string{
+		"?zone=z1":                         "tcp@127.0.0.1:1,tcp@127.0.0.1:2",
+		"?label=track=stable":              "tcp@127.0.0.1:2,tcp@127.0.0.1:3,tcp@127.0.0.1:4",
+		"?label=track=stable&label=team=a": "tcp@127.0.0.1:4",
+		"?zone=z1&label=track=stable":      "tcp@127.0.0.1:2",
+	} {
+		if servers := getServers(t, ts.URL+query); servers != expect {
+			t.Fatalf("expect %q for %s, but got %q", expect, query, servers)
+		}
+	}
+
+	var pages []string
+	after := ""
+	for {
+		resp, err := http.Get(ts.URL + "?limit=3&after=" + after)
+		if err != nil {
+			t.Fatal("failed to get servers:", err)
+		}
+		_ = resp.Body.Close()
+		pages = append(pages, resp.Header.Get("X-Myrpc-Servers"))
+		if after = resp.Header.Get("X-Myrpc-Next"); after == "" {
+			break
+		}
+	}
+	if strings.Join(pages, "|") != "tcp@127.0.0.1:1,tcp@127.0.0.1:2,tcp@127.0.0.1:3|tcp@127.0.0.1:4" {
+		t.Fatalf("expect 2 pages of servers, but got %q", pages)
+	}
+}
+
+func TestCenterRegistry_Load(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	client := NewClient(ts.URL)
+	lease, _ := client.Register(context.Background(), &ServerItem{Addr: "tcp@127.0.0.1:1", Load: &Load{InFlight: 1}})
+	_, _ = client.Register(context.Background(), &ServerItem{Addr: "tcp@127.0.0.1:2"})
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Accept", jsonContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("failed to get servers:", err)
+	}
+	var list listResponse
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	_ = resp.Body.Close()
+	if len(list.Servers) != 2 || list.Servers[0].Load == nil || list.Servers[0].Load.InFlight != 1 || list.Servers[1].Load != nil {
+		t.Fatalf("expect load registered, but got %+v", list.Servers)
+	}
+
+	if err = client.RenewLoad(context.Background(), lease, &Load{InFlight: 5, CPU: 0.5, Queue: 2}); err != nil {
+		t.Fatal("failed to renew with load:", err)
+	}
+	req, _ = http.NewRequest("GET", fmt.Sprint(ts.URL, "?since=", list.Version), nil)
+	req.Header.Set("Accept", jsonContentType)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal("failed to get changes:", err)
+	}
+	var update streamUpdate
+	_ = json.NewDecoder(resp.Body).Decode(&update)
+	_ = resp.Body.Close()
+	if load := update.Loads["tcp@127.0.0.1:1"]; len(update.Added) != 0 || load == nil || *load != (Load{InFlight: 5, CPU: 0.5, Queue: 2}) {
+		t.Fatalf("expect the renewed load without changes, but got %+v", update)
+	}
+
+	req, _ = http.NewRequest("PUT", ts.URL, nil)
+	req.Header.Set("X-Myrpc-Lease", lease)
+	req.Header.Set("X-Myrpc-Load", "inflight=-1")
+	if resp, err = http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid load, but got %v, %v", resp, err)
+	}
+	_ = resp.Body.Close()
+}
+
+// testSharedDeregistration checks registries of two stores sharing servers tell
+// servers deregistered through either of them apart from servers expired
+func testSharedDeregistration(t *testing.T, s1, s2 Store) {
+	r1, r2 := NewWithStore(s1, time.Minute), NewWithStore(s2, time.Minute)
+	var mu sync.Mutex
+	var expired []string
+	for _, r := range []*CenterRegistry{r1, r2} {
+		r.OnExpire(func(addr string) {
+			mu.Lock()
+			defer mu.Unlock()
+			expired = append(expired, addr)
+		})
+	}
+	addr := "tcp@127.0.0.1:1"
+	_ = r1.register(&ServerItem{Addr: addr, Namespace: "prod"}, "")
+	_ = r1.register(&ServerItem{Addr: addr, Namespace: "dev", TTL: Duration(time.Millisecond * 50)}, "")
+	_, _, _ = r1.listServers()
+	_, _, _ = r2.listServers()
+
+	if err := r1.deregister("prod", addr, ""); err != nil {
+		t.Fatal("failed to deregister:", err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	for _, r := range []*CenterRegistry{r1, r2} {
+		if servers, _, err := r.listServers(); err != nil || len(servers) != 0 {
+			t.Fatalf("expect no server left, but got %v, %v", servers, err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// the server in dev expires, but the one in prod at the same address is deregistered
+	if len(expired) != 2 || expired[0] != addr || expired[1] != addr {
+		t.Fatalf("expect the server in dev expired on both registries, but got %v", expired)
+	}
+}
+
+// testLeaseStore checks s finds servers by their leases
+func testLeaseStore(t *testing.T, s Store) {
+	r := NewWithStore(s, time.Minute)
+	item := &ServerItem{Addr: "tcp@127.0.0.1:1", Namespace: "prod"}
+	_ = r.register(item, "")
+	old := item.Lease
+	if found, err := r.findLease(old); err != nil || found == nil || found.key() != item.key() {
+		t.Fatalf("expect the server found by its lease, but got %v, %v", found, err)
+	}
+	// registered again with a new lease
+	again := &ServerItem{Addr: item.Addr, Namespace: item.Namespace}
+	_ = r.register(again, "")
+	if found, err := r.findLease(old); err != nil || found != nil {
+		t.Fatalf("expect the old lease not found, but got %v, %v", found, err)
+	}
+	if found, _ := r.findLease(again.Lease); found == nil || found.Lease != again.Lease {
+		t.Fatalf("expect the server found by the new lease, but got %v", found)
+	}
+	_ = r.deregister(item.Namespace, item.Addr, "")
+	if found, err := r.findLease(again.Lease); err != nil || found != nil {
+		t.Fatalf("expect the lease of the server deregistered not found, but got %v, %v", found, err)
+	}
+	_ = r.register(&ServerItem{Addr: item.Addr, TTL: Duration(time.Millisecond * 50)}, "")
+	expiring, _, _ := r.listServers()
+	time.Sleep(time.Millisecond * 100)
+	if found, err := r.findLease(expiring[0].Lease); err != nil || found != nil {
+		t.Fatalf("expect the lease of the server expired not found, but got %v, %v", found, err)
+	}
+}
+
+func TestMemoryStore_Lease(t *testing.T) {
+	testLeaseStore(t, newMemoryStore())
+}
+
+func TestCenterRegistry_SharedDeregistration(t *testing.T) {
+	s := newMemoryStore()
+	testSharedDeregistration(t, s, s)
+}
+
+func TestCenterRegistry_Expiry(t *testing.T) {
+	r := New(time.Millisecond * 100)
+	expired := make(chan string, 1)
+	r.OnExpire(func(addr string) { expired <- addr })
+	r.SetExpiry(time.Millisecond*100, time.Millisecond*20)
+	defer r.SetExpiry(0, 0)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	_, _ = sendHeartbeat(ts.URL, &ServerItem{Addr: "tcp@127.0.0.1:1"})
+	getServers(t, ts.URL)
+
+	time.Sleep(time.Millisecond * 150)
+	if servers := getServers(t, ts.URL); servers != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect the server alive within grace period, but got %q", servers)
+	}
+	// nobody lists servers, the background sweep notices the expiration
+	select {
+	case addr := <-expired:
+		if addr != "tcp@127.0.0.1:1" {
+			t.Fatalf("expect the server expired, but got %s", addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect OnExpire called after ttl and grace period")
+	}
+}
@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"myRPC"
+)
+
+// Registry exposes a CenterRegistry as a myRPC service named "Registry",
+// so that servers and clients talking myRPC only don't need the HTTP port of registry.
+//
+//	server.Register(registry.NewService(r))
+//
+// Token set by SetToken is carried in arguments, and changes are limited by
+// SetRateLimit like over HTTP. Changes are refused if SetClientCAs is called,
+// as client certificates are only verified over HTTPS. Other methods of HTTP
+// like renewing by lease, watching by stream and admin endpoints are not exposed.
+type Registry struct {
+	r *CenterRegistry
+}
+
+// NewService returns the myRPC service of r
+func NewService(r *CenterRegistry) *Registry {
+	return &Registry{r: r}
+}
+
+type RegisterArgs struct {
+	Item  ServerItem
+	Token string
+}
+
+type RegisterReply struct {
+	Lease string
+	TTL   Duration
+}
+
+type DeregisterArgs struct {
+	Addr      string
+	Namespace string // namespace the server is registered to
+	Token     string
+}
+
+type ListArgs struct {
+	Namespace string            // list servers of the namespace only
+	Service   string            // list servers exposing the service, all servers if it's empty
+	Zone      string            // list servers in the zone, all servers if it's empty
+	Labels    map[string]string // list servers having all the labels
+	Token     string
+}
+
+type ListReply struct {
+	Version uint64
+	Servers []*ServerItem
+}
+
+type WatchArgs struct {
+	Namespace string
+	Service   string
+	Zone      string
+	Labels    map[string]string
+	Since     uint64   // version of server set the caller knows
+	Timeout   Duration // how long to wait for changes, 30s by default and 5m at most
+	Token     string
+}
+
+var (
+	errUnauthorized = errors.New("rpc registry: unauthorized")
+	errCertRequired = errors.New("rpc registry: client certificate required, change registrations over HTTPS")
+)
+
+// checkChange checks a call changing registrations from the peer of ctx
+// like ServeHTTP checks requests of HTTP
+func (s *Registry) checkChange(ctx context.Context, token string) error {
+	if s.r.token != "" && !s.r.validToken(token) {
+		return errUnauthorized
+	}
+	if s.r.clientCAs != nil {
+		return errCertRequired
+	}
+	if limited, wait := s.r.limited(myRPC.PeerAddrFrom(ctx)); limited {
+		return fmt.Errorf("rpc registry: too many requests, retry after %v", wait.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// Register registers a server or renews it if the lease of item is set,
+// a server keeps alive by calling Register with the lease returned
+func (s *Registry) Register(ctx context.Context, args RegisterArgs, reply *RegisterReply) error {
+	if err := s.checkChange(ctx, args.Token); err != nil {
+		return err
+	}
+	item := args.Item
+	if err := item.validate(); err != nil {
+		return err
+	}
+	if err := s.r.register(&item, ""); err != nil {
+		return err
+	}
+	reply.Lease, reply.TTL = item.Lease, item.TTL
+	if reply.TTL == 0 {
+		reply.TTL = Duration(s.r.timeout)
+	}
+	return nil
+}
+
+// Deregister removes a server at once
+func (s *Registry) Deregister(ctx context.Context, args DeregisterArgs, reply *bool) error {
+	if err := s.checkChange(ctx, args.Token); err != nil {
+		return err
+	}
+	if err := s.r.deregister(args.Namespace, args.Addr, ""); err != nil {
+		return err
+	}
+	*reply = true
+	return nil
+}
+
+// List returns alive servers and version of the server set
+func (s *Registry) List(args ListArgs, reply *ListReply) error {
+	if s.r.protectRead && !s.r.validToken(args.Token) {
+		return errUnauthorized
+	}
+	var err error
+	reply.Servers, reply.Version, err = s.r.getAliveServers(serverFilter{
+		namespace: args.Namespace, service: args.Service, zone: args.Zone, labels: args.Labels,
+	})
+	return err
+}
+
+// Watch blocks until the version of server set is greater than Since, then works like List.
+// It returns the same version as Since if timeout expires without changes,
+// so the timeout of call should be longer than Timeout.
+func (s *Registry) Watch(args WatchArgs, reply *ListReply) error {
+	if s.r.protectRead && !s.r.validToken(args.Token) {
+		return errUnauthorized
+	}
+	version := s.r.waitChange(context.Background(), args.Since, time.Duration(args.Timeout))
+	if version <= args.Since {
+		reply.Version = version
+		return nil
+	}
+	return s.List(ListArgs{Namespace: args.Namespace, Service: args.Service, Zone: args.Zone, Labels: args.Labels, Token: args.Token}, reply)
+}
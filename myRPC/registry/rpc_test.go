@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"myRPC"
+)
+
+func TestRegistryService(t *testing.T) {
+	r := New(time.Minute)
+	server := myRPC.NewServer()
+	if err := server.Register(NewService(r)); err != nil {
+		t.Fatal("failed to register service:", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, err := myRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to dial:", err)
+	}
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+
+	var list ListReply
+	if err = client.Call(ctx, "Registry.List", ListArgs{}, &list); err != nil || len(list.Servers) != 0 {
+		t.Fatal("expect no server at first:", err, list.Servers)
+	}
+	since := list.Version
+	watched := make(chan *ListReply)
+	go func() {
+		var reply ListReply
+		_ = client.Call(ctx, "Registry.Watch", WatchArgs{Since: since}, &reply)
+		watched <- &reply
+	}()
+
+	var lease RegisterReply
+	args := RegisterArgs{Item: ServerItem{Addr: "tcp@127.0.0.1:1", Services: []string{"Foo"}}}
+	if err = client.Call(ctx, "Registry.Register", args, &lease); err != nil || lease.Lease == "" {
+		t.Fatal("failed to register:", err)
+	}
+	select {
+	case reply := <-watched:
+		if reply.Version <= since || len(reply.Servers) != 1 || reply.Servers[0].Addr != "tcp@127.0.0.1:1" {
+			t.Fatalf("expect watch returns the registered server, but got %+v", reply)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("expect watch returns after registration")
+	}
+
+	args.Item.Addr = "tcp@0.0.0.0:1"
+	if err = client.Call(ctx, "Registry.Register", args, &lease); err == nil {
+		t.Fatal("expect invalid address is rejected")
+	}
+	var ok bool
+	if err = client.Call(ctx, "Registry.Deregister", DeregisterArgs{Addr: "tcp@127.0.0.1:1"}, &ok); err != nil || !ok {
+		t.Fatal("failed to deregister:", err)
+	}
+	if err = client.Call(ctx, "Registry.List", ListArgs{Service: "Foo"}, &list); err != nil || len(list.Servers) != 0 {
+		t.Fatal("expect no server after deregister:", err, list.Servers)
+	}
+
+	r.SetToken("secret", false)
+	if err = client.Call(ctx, "Registry.Register", RegisterArgs{Item: ServerItem{Addr: "tcp@127.0.0.1:1"}}, &lease); err == nil {
+		t.Fatal("expect register without token fails")
+	}
+}
+
+// dialService serves the Registry service of r and returns a client connected to it
+func dialService(t *testing.T, r *CenterRegistry) *myRPC.Client {
+	server := myRPC.NewServer()
+	if err := server.Register(NewService(r)); err != nil {
+		t.Fatal("failed to register service:", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	client, err := myRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to dial:", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestRegistryService_ClientCAs(t *testing.T) {
+	_, pool := newClientCert(t)
+	r := New(time.Minute)
+	r.SetClientCAs(pool)
+	client := dialService(t, r)
+	ctx := context.Background()
+
+	var lease RegisterReply
+	args := RegisterArgs{Item: ServerItem{Addr: "tcp@127.0.0.1:1"}}
+	if err := client.Call(ctx, "Registry.Register", args, &lease); err == nil {
+		t.Fatal("expect register without client certificate refused")
+	}
+	var ok bool
+	if err := client.Call(ctx, "Registry.Deregister", DeregisterArgs{Addr: "tcp@127.0.0.1:1"}, &ok); err == nil {
+		t.Fatal("expect deregister without client certificate refused")
+	}
+	var list ListReply
+	if err := client.Call(ctx, "Registry.List", ListArgs{}, &list); err != nil {
+		t.Fatal("expect listing servers doesn't need a certificate:", err)
+	}
+}
+
+func TestRegistryService_RateLimit(t *testing.T) {
+	r := New(time.Minute)
+	r.SetRateLimit(1, 2)
+	client := dialService(t, r)
+	ctx := context.Background()
+
+	var lease RegisterReply
+	args := RegisterArgs{Item: ServerItem{Addr: "tcp@127.0.0.1:1"}}
+	for i := 0; i < 2; i++ {
+		if err := client.Call(ctx, "Registry.Register", args, &lease); err != nil {
+			t.Fatal("expect registrations within the burst allowed:", err)
+		}
+	}
+	if err := client.Call(ctx, "Registry.Register", args, &lease); err == nil {
+		t.Fatal("expect registration beyond the burst limited")
+	}
+	var ok bool
+	if err := client.Call(ctx, "Registry.Deregister", DeregisterArgs{Addr: "tcp@127.0.0.1:1"}, &ok); err == nil {
+		t.Fatal("expect deregistration beyond the burst limited")
+	}
+}
+
+func TestHeartbeater_Shutdown(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	server := myRPC.NewServer()
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	addr := "tcp@" + l.Addr().String()
+	h := HeartbeatServer(ts.URL, &ServerItem{Addr: addr}, time.Minute)
+	if servers := getServers(t, ts.URL); servers != addr {
+		t.Fatalf("expect the server registered, but got %q", servers)
+	}
+
+	shutdown := make(chan error)
+	go func() { shutdown <- h.Shutdown(context.Background(), server, time.Millisecond*200) }()
+	time.Sleep(time.Millisecond * 100)
+	if servers := getServers(t, ts.URL); servers != "" {
+		t.Fatalf("expect the server deregistered before shutting down, but got %q", servers)
+	}
+	client, err := myRPC.XDial(addr)
+	if err != nil {
+		t.Fatal("expect the server still serves during the delay:", err)
+	}
+	_ = client.Close()
+	if err = <-shutdown; err != nil {
+		t.Fatal("failed to shut down:", err)
+	}
+	if _, err = myRPC.XDial(addr); err == nil {
+		t.Fatal("expect the server is shut down after the delay")
+	}
+}
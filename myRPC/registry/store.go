@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps the servers registered to a CenterRegistry,
+// so that the registry can be backed by memory or an external storage
+type Store interface {
+	// Put registers a server or renews it if it exists,
+	// ttl represents how long it keeps alive and 0 means never expire
+	Put(item *ServerItem, ttl time.Duration) error
+	// Delete removes the server of addr in namespace, it's not an error if the server doesn't exist
+	Delete(namespace, addr string) error
+	// List returns all alive servers sorted by address and namespace
+	List() ([]*ServerItem, error)
+}
+
+// deletedTTL is how long a store remembers a server deleted, registries sharing the
+// store should compare the server set within it to tell deregistrations apart
+const deletedTTL = time.Minute * 5
+
+// deletedStore is a Store remembering servers deleted for deletedTTL, so that
+// every registry sharing it tells servers deregistered through any of them apart
+// from servers expired
+type deletedStore interface {
+	// Deleted reports whether item, which is gone from the store, was deleted
+	Deleted(item *ServerItem) (bool, error)
+}
+
+// leaseStore is a Store finding the server of a lease by the lease, so that a renewal
+// doesn't list all servers
+type leaseStore interface {
+	// Lease returns the alive server registered with lease, nil if there is none
+	Lease(lease string) (*ServerItem, error)
+}
+
+// serverKey identifies the server of addr in namespace, the same address may be
+// registered to several namespaces. It's the address for the default namespace.
+func serverKey(namespace, addr string) string {
+	if namespace == "" {
+		return addr
+	}
+	return namespace + "/" + addr
+}
+
+func (item *ServerItem) key() string {
+	return serverKey(item.Namespace, item.Addr)
+}
+
+// sortServers sorts servers by address and namespace
+func sortServers(servers []*ServerItem) {
+	sort.Slice(servers, func(i, j int) bool {
+		if servers[i].Addr != servers[j].Addr {
+			return servers[i].Addr < servers[j].Addr
+		}
+		return servers[i].Namespace < servers[j].Namespace
+	})
+}
+
+// memoryStore is the default Store which keeps servers in a map
+type memoryStore struct {
+	mu      sync.Mutex
+	servers map[string]*memoryItem  // by serverKey
+	leases  map[string]string       // serverKey of servers by their leases
+	deleted map[string]*deletedItem // servers deleted within deletedTTL by serverKey
+}
+
+type memoryItem struct {
+	*ServerItem
+	deadline time.Time // zero value means never expire
+}
+
+// deletedItem remembers the lease of a server deleted
+type deletedItem struct {
+	lease   string
+	expires time.Time
+}
+
+var (
+	_ Store        = &memoryStore{}
+	_ deletedStore = &memoryStore{}
+	_ leaseStore   = &memoryStore{}
+)
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		servers: make(map[string]*memoryItem),
+		leases:  make(map[string]string),
+		deleted: make(map[string]*deletedItem),
+	}
+}
+
+func (s *memoryStore) Put(item *ServerItem, ttl time.Duration) error {
+	s.put(item, deadlineOf(item, ttl))
+	return nil
+}
+
+func (s *memoryStore) put(item *ServerItem, deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := item.key()
+	if old, ok := s.servers[key]; ok {
+		delete(s.leases, old.Lease)
+	}
+	s.servers[key] = &memoryItem{ServerItem: item, deadline: deadline}
+	if item.Lease != "" {
+		s.leases[item.Lease] = key
+	}
+}
+
+// remove deletes the server of key, s.mu must be held
+func (s *memoryStore) remove(key string, server *memoryItem) {
+	delete(s.servers, key)
+	delete(s.leases, server.Lease)
+}
+
+// deadlineOf returns when item expires, zero value means never expire
+func deadlineOf(item *ServerItem, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return item.Start.Add(ttl)
+}
+
+func (s *memoryStore) Delete(namespace, addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := serverKey(namespace, addr)
+	if server, ok := s.servers[key]; ok {
+		s.deleted[key] = &deletedItem{lease: server.Lease, expires: time.Now().Add(deletedTTL)}
+		s.remove(key, server)
+	}
+	return nil
+}
+
+// Deleted reports whether item was deleted, rather than a server registered again
+// at its address later
+func (s *memoryStore) Deleted(item *ServerItem) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted, ok := s.deleted[item.key()]
+	return ok && deleted.lease == item.Lease, nil
+}
+
+func (s *memoryStore) List() ([]*ServerItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	alive := make([]*ServerItem, 0, len(s.servers))
+	for key, server := range s.servers {
+		if server.deadline.IsZero() || server.deadline.After(now) {
+			alive = append(alive, server.ServerItem)
+		} else {
+			s.remove(key, server)
+		}
+	}
+	for key, deleted := range s.deleted {
+		if deleted.expires.Before(now) {
+			delete(s.deleted, key)
+		}
+	}
+	sortServers(alive)
+	return alive, nil
+}
+
+func (s *memoryStore) Lease(lease string) (*ServerItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	server, ok := s.servers[s.leases[lease]]
+	if !ok || !server.deadline.IsZero() && !server.deadline.After(time.Now()) {
+		return nil, nil
+	}
+	return server.ServerItem, nil
+}
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"myRPC/internal/rpclog"
+	"net/http"
+	"time"
+)
+
+const streamKeepAlive = time.Second * 15
+
+// streamUpdate is the data of an "update" event pushed by serveStream,
+// and the body of changes returned by serveChanges
+type streamUpdate struct {
+	Version uint64        `json:"version"`
+	Added   []*ServerItem `json:"added,omitempty"`
+	Removed []string      `json:"removed,omitempty"`
+	// Loads are the latest loads of servers matched, which change with heartbeats
+	// without changing the server set, only returned by serveChanges
+	Loads map[string]*Load `json:"loads,omitempty"`
+}
+
+// serveStream pushes server list to subscribers as Server-Sent Events.
+// A "servers" event carrying the full list is sent first, then an "update" event
+// carrying added and removed servers is sent every time the server set changes.
+// Servers are selected by ?namespace= and ?service= like serveList.
+// Runs at /myRPC/registry/stream
+func (r *CenterRegistry) serveStream(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	filter := filterOf(req)
+	r.addWatcher()
+	defer r.removeWatcher()
+	alive, version, err := r.getAliveServers(filter)
+	if err != nil {
+		rpclog.Error("rpc registry: list servers", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err = writeEvent(w, "servers", &listResponse{Version: version, Servers: alive}); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	last := make(map[string]bool, len(alive))
+	for _, server := range alive {
+		last[server.Addr] = true
+	}
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		current, changed := r.watcher.current()
+		if current == version {
+			select {
+			case <-changed:
+			case <-keepAlive.C:
+				// comment line keeps proxies from closing an idle connection
+				if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+				continue
+			case <-req.Context().Done():
+				return
+			}
+		}
+		if alive, version, err = r.getAliveServers(filter); err != nil {
+			rpclog.Error("rpc registry: list servers", "err", err)
+			return
+		}
+		update := &streamUpdate{Version: version}
+		servers := make(map[string]bool, len(alive))
+		for _, server := range alive {
+			servers[server.Addr] = true
+			if !last[server.Addr] {
+				update.Added = append(update.Added, server)
+			}
+		}
+		for addr := range last {
+			if !servers[addr] {
+				update.Removed = append(update.Removed, addr)
+			}
+		}
+		last = servers
+		// the change may not belong to the service subscribed
+		if len(update.Added) == 0 && len(update.Removed) == 0 {
+			continue
+		}
+		if err = writeEvent(w, "update", update); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+)
+
+// SetClientCAs requires requests which register, renew or deregister servers
+// to be sent over TLS with a client certificate signed by pool, so that
+// registrations can't be forged by anyone else on the network.
+// Requests listing servers don't need a certificate.
+// It should be called before the registry starts serving.
+func (r *CenterRegistry) SetClientCAs(pool *x509.CertPool) {
+	r.clientCAs = pool
+}
+
+// TLSConfig returns a TLS config for serving the registry with certs,
+// which asks clients for certificates verified by the pool of SetClientCAs
+func (r *CenterRegistry) TLSConfig(certs ...tls.Certificate) *tls.Config {
+	config := &tls.Config{Certificates: certs, MinVersion: tls.VersionTLS12}
+	if r.clientCAs != nil {
+		// listing servers doesn't need a certificate, so it's only verified if given
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		config.ClientCAs = r.clientCAs
+	}
+	return config
+}
+
+// ServeTLS accepts HTTPS connections on l and serves them by handler,
+// which is http.DefaultServeMux if it's nil, eg, the registry after HandleHTTP.
+// certFile and keyFile are the certificate and private key of the registry.
+func (r *CenterRegistry) ServeTLS(l net.Listener, handler http.Handler, certFile, keyFile string) error {
+	srv := &http.Server{Handler: handler, TLSConfig: r.TLSConfig()}
+	return srv.ServeTLS(l, certFile, keyFile)
+}
+
+// certified reports whether req carries a client certificate signed by the pool
+// of SetClientCAs, it's verified here again in case the registry is served
+// with a TLS config not verifying client certificates
+func (r *CenterRegistry) certified(req *http.Request) bool {
+	if r.clientCAs == nil {
+		return true
+	}
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return false
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range req.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := req.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         r.clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newClientCert returns a self-signed client certificate and the pool trusting it
+func newClientCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "myrpc server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("failed to create certificate:", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+func TestCenterRegistry_TLS(t *testing.T) {
+	cert, pool := newClientCert(t)
+	r := New(time.Minute)
+	r.SetClientCAs(pool)
+	ts := httptest.NewUnstartedServer(r)
+	ts.TLS = r.TLSConfig()
+	ts.StartTLS()
+	defer ts.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	anonymous := NewClient(ts.URL)
+	anonymous.Retries = 0
+	anonymous.SetTLSConfig(&tls.Config{RootCAs: roots})
+	if _, err := anonymous.Register(context.Background(), &ServerItem{Addr: "tcp@127.0.0.1:1"}); err == nil {
+		t.Fatal("expect registration without client certificate rejected")
+	}
+
+	client := NewClient(ts.URL)
+	client.SetTLSConfig(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}})
+	if _, err := client.Register(context.Background(), &ServerItem{Addr: "tcp@127.0.0.1:1"}); err != nil {
+		t.Fatal("failed to register with client certificate:", err)
+	}
+
+	// listing servers doesn't need a certificate
+	resp, err := anonymous.Do(context.Background(), "GET", "", nil, nil, nil)
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Header.Get("X-Myrpc-Servers") != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect servers listed over TLS, but got %v, %v", resp, err)
+	}
+	_ = resp.Body.Close()
+}
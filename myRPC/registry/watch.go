@@ -0,0 +1,211 @@
+package registry
+
+import (
+	"context"
+	"myRPC/internal/rpclog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWatchTimeout = time.Second * 30
+	maxWatchTimeout     = time.Minute * 5
+	sweepInterval       = time.Second // how often expirations are checked while watched
+)
+
+// watcher tracks the version of the server set and wakes up long-polling watches
+type watcher struct {
+	mu       sync.Mutex
+	version  uint64                 // increased whenever the server set changes
+	keys     []string               // server set of current version by serverKey
+	items    map[string]*ServerItem // servers of current version by serverKey
+	history  []*serverChange        // changes of recent versions in order
+	changed  chan struct{}          // closed and replaced when version increases
+	watchers int                    // number of blocking watch requests
+}
+
+// update compares servers with the server set of current version,
+// and increases version if they are different.
+// It returns the servers removed from the server set as well.
+func (w *watcher) update(servers []*ServerItem) (uint64, []*ServerItem) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.changed == nil {
+		w.changed = make(chan struct{})
+	}
+	var removed []*ServerItem
+	if !sameKeys(w.keys, servers) {
+		change := &serverChange{version: w.version + 1}
+		current := make(map[string]*ServerItem, len(servers))
+		for _, server := range servers {
+			current[server.key()] = server
+			if w.items[server.key()] == nil {
+				change.added = append(change.added, server.key())
+			}
+		}
+		for _, key := range w.keys {
+			if current[key] == nil {
+				removed = append(removed, w.items[key])
+				change.removed = append(change.removed, w.items[key])
+			}
+		}
+		w.keys = make([]string, 0, len(servers))
+		for _, server := range servers {
+			w.keys = append(w.keys, server.key())
+		}
+		w.items = current
+		w.record(change)
+		w.version++
+		close(w.changed)
+		w.changed = make(chan struct{})
+	} else {
+		// keep metadata of servers up to date, it may change on renewal
+		for _, server := range servers {
+			w.items[server.key()] = server
+		}
+	}
+	return w.version, removed
+}
+
+// current returns current version and a channel closed when it changes
+func (w *watcher) current() (uint64, <-chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.changed == nil {
+		w.changed = make(chan struct{})
+	}
+	return w.version, w.changed
+}
+
+func (w *watcher) watched() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.watchers > 0
+}
+
+// sameKeys reports whether keys equals to serverKey of servers, both are sorted
+func sameKeys(keys []string, servers []*ServerItem) bool {
+	if len(keys) != len(servers) {
+		return false
+	}
+	for i, server := range servers {
+		if keys[i] != server.key() {
+			return false
+		}
+	}
+	return true
+}
+
+// checkChanges lists servers from store to detect changes of the server set
+func (r *CenterRegistry) checkChanges() {
+	servers, err := r.store.List()
+	if err != nil {
+		rpclog.Error("rpc registry: list servers", "err", err)
+		return
+	}
+	_, removed := r.watcher.update(servers)
+	r.serversRemoved(removed)
+}
+
+// serversRemoved records servers removed from the server set without deregistering as expired
+func (r *CenterRegistry) serversRemoved(removed []*ServerItem) {
+	for _, item := range r.metrics.removed(removed, r.deleted) {
+		r.record("expire", item.Namespace, item.Addr, "", "")
+		if r.onExpire != nil {
+			r.onExpire(item.Addr)
+		}
+	}
+}
+
+// deleted reports whether item removed from the server set is deregistered or evicted
+// through any registry sharing the store, if the store remembers servers deleted
+func (r *CenterRegistry) deleted(item *ServerItem) bool {
+	s, ok := r.store.(deletedStore)
+	if !ok {
+		return false
+	}
+	deleted, err := s.Deleted(item)
+	if err != nil {
+		rpclog.Warn("rpc registry: check server deleted", "server", item.Addr, "err", err)
+	}
+	return deleted
+}
+
+// addWatcher starts sweeping expired servers when the first watch arrives,
+// because a server expires silently without any request to registry
+func (r *CenterRegistry) addWatcher() {
+	r.watcher.mu.Lock()
+	defer r.watcher.mu.Unlock()
+	r.watcher.watchers++
+	if r.watcher.watchers == 1 {
+		go r.sweep()
+	}
+}
+
+func (r *CenterRegistry) removeWatcher() {
+	r.watcher.mu.Lock()
+	defer r.watcher.mu.Unlock()
+	r.watcher.watchers--
+}
+
+func (r *CenterRegistry) sweep() {
+	t := time.NewTicker(sweepInterval)
+	defer t.Stop()
+	for range t.C {
+		if !r.watcher.watched() {
+			return
+		}
+		r.checkChanges()
+	}
+}
+
+// serveWatch blocks until the version of server set is greater than ?since=<version>,
+// then responds like serveList, or responds 304 Not Modified if ?timeout=<duration> expires
+// Runs at /myRPC/registry/watch
+func (r *CenterRegistry) serveWatch(w http.ResponseWriter, req *http.Request) {
+	since, _ := strconv.ParseUint(req.URL.Query().Get("since"), 10, 64)
+	timeout, _ := time.ParseDuration(req.URL.Query().Get("timeout"))
+	version := r.waitChange(req.Context(), since, timeout)
+	if req.Context().Err() != nil {
+		return
+	}
+	if version > since {
+		r.writeList(w, req)
+		return
+	}
+	w.Header().Set("X-Myrpc-Registry-Version", strconv.FormatUint(version, 10))
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// waitChange blocks until the version of server set is greater than since,
+// timeout expires or ctx is done, and returns the current version.
+// timeout is limited to maxWatchTimeout, 0 means defaultWatchTimeout.
+func (r *CenterRegistry) waitChange(ctx context.Context, since uint64, timeout time.Duration) uint64 {
+	if timeout <= 0 {
+		timeout = defaultWatchTimeout
+	}
+	if timeout > maxWatchTimeout {
+		timeout = maxWatchTimeout
+	}
+	r.addWatcher()
+	defer r.removeWatcher()
+	r.checkChanges()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		version, changed := r.watcher.current()
+		if version > since {
+			return version
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return version
+		case <-ctx.Done():
+			return version
+		}
+	}
+}
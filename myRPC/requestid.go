@@ -0,0 +1,56 @@
+package myRPC
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// requestIDMetadata is the key of metadata carrying the request ID
+const requestIDMetadata = "x-request-id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose calls carry id as their request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID of the context, empty if there is none.
+// A call made by Client.Call carries the request ID of its context, or a new one
+// if there is none, and the server passes it in the context of the method, so
+// calls the method makes by the context carry the same ID, and calls of a request
+// through services can be joined by the ID in logs.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// outgoingMetadata returns metadata carried with a call of ctx, with its request ID and baggage
+func outgoingMetadata(ctx context.Context) map[string]string {
+	id := RequestIDFrom(ctx)
+	if id == "" {
+		id = newRequestID()
+	}
+	md := map[string]string{requestIDMetadata: id}
+	injectBaggage(ctx, md)
+	for k, v := range OutgoingMetadata(ctx) {
+		md[k] = v
+	}
+	return md
+}
+
+// incomingContext returns the context of a request carrying md
+func incomingContext(ctx context.Context, md map[string]string) context.Context {
+	if id := md[requestIDMetadata]; id != "" {
+		ctx = WithRequestID(ctx, id)
+	}
+	ctx = extractBaggage(ctx, md)
+	return withIncomingMetadata(ctx, md)
+}
@@ -0,0 +1,97 @@
+package myRPC
+
+import (
+	"context"
+	"encoding/json"
+	"myRPC/codec"
+	"net"
+	"testing"
+)
+
+// Hop returns request IDs seen by itself and by the next hop if any
+type Hop struct{ next *Client }
+
+func (h *Hop) IDs(ctx context.Context, _ int, ids *[]string) error {
+	*ids = append(*ids, RequestIDFrom(ctx))
+	if h.next == nil {
+		return nil
+	}
+	var next []string
+	err := h.next.Call(ctx, "Hop.IDs", 0, &next)
+	*ids = append(*ids, next...)
+	return err
+}
+
+// startHop serves rcvr, eg, a Hop, and returns a client of it
+func startHop(t *testing.T, rcvr interface{}) *Client {
+	server := NewServer()
+	_ = server.Register(rcvr)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestRequestID(t *testing.T) {
+	client := startHop(t, &Hop{next: startHop(t, &Hop{})})
+
+	var ids []string
+	if err := client.Call(context.Background(), "Hop.IDs", 0, &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] == "" || ids[0] != ids[1] {
+		t.Fatalf("expect an ID generated and carried through hops, but got %q", ids)
+	}
+	first := ids[0]
+
+	ids = nil
+	_ = client.Call(context.Background(), "Hop.IDs", 0, &ids)
+	if len(ids) != 2 || ids[0] == first {
+		t.Fatalf("expect a new ID of another call, but got %q", ids)
+	}
+
+	ids = nil
+	_ = client.Call(WithRequestID(context.Background(), "req-1"), "Hop.IDs", 0, &ids)
+	if len(ids) != 2 || ids[0] != "req-1" || ids[1] != "req-1" {
+		t.Fatalf("expect the ID of the caller carried through hops, but got %q", ids)
+	}
+
+	ids = nil
+	call := <-client.Go("Hop.IDs", 0, &ids, nil).Done
+	if call.Error != nil || len(ids) != 2 || ids[0] == "" || ids[0] != ids[1] {
+		t.Fatalf("expect an ID generated by Go and carried through hops, but got %q, %v", ids, call.Error)
+	}
+}
+
+func TestRequestID_Response(t *testing.T) {
+	server := NewServer()
+	_ = server.Register(&Hop{})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = json.NewEncoder(conn).Encode(DefaultOption)
+	cc := codec.NewGobCodec(conn)
+	defer func() { _ = cc.Close() }()
+
+	md := map[string]string{requestIDMetadata: "req-1", "k": "v"}
+	if err = cc.Write(&codec.Header{ServiceMethod: "Hop.IDs", Seq: 1, Metadata: md}, 0); err != nil {
+		t.Fatal(err)
+	}
+	var h codec.Header
+	var ids []string
+	if err = cc.ReadHeader(&h); err != nil || cc.ReadBody(&ids) != nil {
+		t.Fatal("failed to read the response:", err)
+	}
+	if h.Metadata != nil || len(ids) != 1 || ids[0] != "req-1" {
+		t.Fatalf("expect metadata of the request not sent back, but got %v with %q", h.Metadata, ids)
+	}
+}
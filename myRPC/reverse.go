@@ -0,0 +1,110 @@
+package myRPC
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myRPC/internal/rpclog"
+	"net"
+	"strings"
+	"time"
+)
+
+const maxReverseBackoff = time.Second * 10
+
+// reverseHello is sent by a server once it has dialed out to a gateway,
+// then roles reverse, and the gateway calls the server over the connection
+type reverseHello struct {
+	MagicNumber int
+	Name        string
+}
+
+// ServeReverse dials out to the gateway at rpcAddr (protocol@addr like XDial, over
+// tcp, unix, tls, quic, kcp or mem) and serves it as a client connected to the server,
+// so the server behind NAT or a firewall needs no inbound port. name tells the
+// server to the gateway, see AcceptReverse. Option of opts configures dialing,
+// while the codec is chosen by the gateway. It redials with backoff once the
+// connection is lost, until the server shuts down, and returns ErrServerClosed then.
+func (server *Server) ServeReverse(rpcAddr, name string, opts ...*Option) error {
+	protocol, addr, ok := strings.Cut(rpcAddr, "@")
+	if !ok || protocol == "" || addr == "" {
+		return fmt.Errorf("rpc server: wrong format '%s', expect protocol@addr", rpcAddr)
+	}
+	if protocol == "http" || protocol == "h2" {
+		return fmt.Errorf("rpc server: serving reverse over %s is not supported", protocol)
+	}
+	opt, err := parseOption(opts...)
+	if err != nil {
+		return err
+	}
+	backoff := time.Millisecond * 100
+	for !server.inShutdown.Load() {
+		conn, err := connect(protocol, addr, opt)
+		if err == nil {
+			// no newline after the hello, which the gateway would take for a reply
+			hello, _ := json.Marshal(&reverseHello{MagicNumber: MagicNumber, Name: name})
+			_, err = conn.Write(hello)
+			if err == nil && !server.inShutdown.Load() {
+				backoff = time.Millisecond * 100
+				server.ServeConn(conn)
+				continue
+			}
+			_ = conn.Close()
+		}
+		if err != nil {
+			rpclog.Warn("rpc server: reverse dial", "addr", rpcAddr, "err", err)
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxReverseBackoff)
+	}
+	return ErrServerClosed
+}
+
+// AcceptReverse accepts connections of servers serving by ServeReverse on lis,
+// and calls handle with the name of each server and a client calling it over the
+// connection, the client is broken once the server is gone. It returns once lis
+// is closed.
+func AcceptReverse(lis net.Listener, handle func(name string, client *Client), opts ...*Option) error {
+	opt, err := parseOption(opts...)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			name, client, err := acceptReverse(conn, opt)
+			if err != nil {
+				rpclog.Warn("rpc client: reverse handshake", "err", err)
+				_ = conn.Close()
+				return
+			}
+			handle(name, client)
+		}()
+	}
+}
+
+// acceptReverse reads the hello of the server within ConnectTimeout, and connects
+// to the server as a client
+func acceptReverse(conn net.Conn, opt *Option) (string, *Client, error) {
+	if opt.ConnectTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(opt.ConnectTimeout))
+	}
+	// the server sends nothing else before the option of the client,
+	// so the decoder doesn't read ahead
+	var hello reverseHello
+	if err := json.NewDecoder(conn).Decode(&hello); err != nil {
+		return "", nil, err
+	}
+	if hello.MagicNumber != MagicNumber {
+		return "", nil, fmt.Errorf("invalid magic number %x", hello.MagicNumber)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	client, err := NewClient(conn, opt)
+	return hello.Name, client, err
+}
@@ -0,0 +1,57 @@
+package myRPC
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_ServeReverse(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	clients := make(chan *Client)
+	go func() {
+		_ = AcceptReverse(l, func(name string, client *Client) {
+			if name != "device" {
+				t.Errorf("expect the server named device, but got %s", name)
+			}
+			clients <- client
+		})
+	}()
+
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	served := make(chan error, 1)
+	go func() { served <- server.ServeReverse("tcp@"+l.Addr().String(), "device") }()
+
+	call := func(client *Client) {
+		var reply int
+		if err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect the gateway calls the server, but got %d, %v", reply, err)
+		}
+	}
+	client := <-clients
+	call(client)
+
+	// the server dials out again once the connection is lost
+	_ = client.Close()
+	select {
+	case client = <-clients:
+		call(client)
+	case <-time.After(time.Second * 5):
+		t.Fatal("expect the server dials out again")
+	}
+
+	_ = server.Shutdown(context.Background())
+	select {
+	case err := <-served:
+		if !errors.Is(err, ErrServerClosed) {
+			t.Fatal("expect ErrServerClosed once the server shuts down, but got", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expect serving reverse stops once the server shuts down")
+	}
+}
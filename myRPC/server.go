@@ -1,18 +1,25 @@
 package myRPC
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"myRPC/codec"
+	"myRPC/internal/rpclog"
 	"net"
 	"net/http"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 const (
@@ -27,6 +34,10 @@ type Option struct {
 	CodecType      codec.Type // Client may choose different type to encode request
 	ConnectTimeout time.Duration
 	HandleTimeout  time.Duration
+	TLSConfig      *tls.Config       `json:"-"` // for servers at tls@addr or quic@addr, verified as the host of addr by default
+	SSHConfig      *ssh.ClientConfig `json:"-"` // for servers at ssh@bastion/addr, authenticating to the bastion
+	SlowThreshold  time.Duration     `json:"-"` // calls of clients longer than it are logged, 0 means never
+	FrameDump      *FrameDump        `json:"-"` // dumps frames of clients if it's not nil
 }
 
 var DefaultOption = &Option{
@@ -37,9 +48,38 @@ var DefaultOption = &Option{
 
 // Server represents an RPC server
 type Server struct {
-	serviceMap sync.Map
+	serviceMap   sync.Map
+	mu           sync.Mutex // protect following
+	listeners    map[net.Listener]struct{}
+	conns        map[*serverConn]struct{}
+	inFlight     int // number of requests being handled on all connections
+	inShutdown   atomic.Bool
+	auth         AuthFunc
+	interceptors []ServerInterceptor
+	connHook     func(opened bool)
+	slow         time.Duration // requests handled longer than it are logged
+	stats        statsTable
+	debugClients map[string]DebugClient // shown on the debug page
+	audit        *Audit
+	errorRate    *errorRateTracker
+	frameDump    *FrameDump
+	events       EventBus // publishes events of connections and calls
+}
+
+// serverConn is a connection being served, tracked for Shutdown
+type serverConn struct {
+	conn    io.Closer
+	pending int  // number of requests being handled
+	closed  bool // closed by Shutdown
+	peer    string
+	codec   string
+	opened  time.Time
 }
 
+var ErrServerClosed = errors.New("rpc server: server is shutting down")
+
+const shutdownPollInterval = time.Millisecond * 50
+
 func (server *Server) Register(rcvr interface{}) error {
 	s := newService(rcvr)
 	// load service if it exists,otherwise store it
@@ -53,6 +93,17 @@ func Register(rcvr interface{}) error {
 	return DefaultServer.Register(rcvr)
 }
 
+// Services returns names of all registered services in sorted order
+func (server *Server) Services() []string {
+	var names []string
+	server.serviceMap.Range(func(name, _ interface{}) bool {
+		names = append(names, name.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
 // NewServer can return a new server
 func NewServer() *Server {
 	return &Server{}
@@ -64,10 +115,16 @@ var DefaultServer = NewServer()
 // Accept accepts connections on the listener and serves requests
 // for each incoming connection
 func (server *Server) Accept(lis net.Listener) {
+	if !server.trackListener(lis, true) {
+		return
+	}
+	defer server.trackListener(lis, false)
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
-			log.Println("rpc server: accept error:", err)
+			if !server.inShutdown.Load() {
+				rpclog.Error("rpc server: accept", "err", err)
+			}
 			return
 		}
 		go server.ServeConn(conn)
@@ -87,34 +144,94 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 		_ = conn.Close()
 	}()
 	var opt Option
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
-		log.Println("rpc server: options error: ", err)
+	ctx := connContext(conn)
+	counted := &countedConn{ReadWriteCloser: conn, read: serverBytesRead, written: serverBytesWritten}
+	var rw io.ReadWriteCloser = counted
+	if server.frameDump != nil {
+		rw = server.frameDump.conn(counted, PeerAddrFrom(ctx))
+	}
+	dec := json.NewDecoder(rw)
+	if err := dec.Decode(&opt); err != nil {
+		rpclog.Error("rpc server: read options", "err", err)
 		return
 	}
 	if opt.MagicNumber != MagicNumber {
-		log.Printf("rpc server: invalid magic number %x", opt.MagicNumber)
+		rpclog.Error("rpc server: invalid magic number", "magic", fmt.Sprintf("%x", opt.MagicNumber))
 		return
 	}
 
 	// f is a constructor(function) for Codec
 	f := codec.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
-		log.Printf("rpc server: invalid codec type %s", opt.CodecType)
+		rpclog.Error("rpc server: invalid codec type", "codec", opt.CodecType)
 		return
 	}
-	server.ServeCodec(f(conn), &opt)
+	// json decoder may read ahead part of the first request,
+	// so the codec must consume the buffered bytes before the connection
+	br := bufio.NewReader(io.MultiReader(dec.Buffered(), rw))
+	// skip the newline appended by json encoder
+	counted.preamble = dec.InputOffset()
+	if b, err := br.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = br.ReadByte()
+		counted.preamble++
+	}
+	_, halfClose := conn.(halfCloser)
+	server.serveCodec(ctx, f(&bufferedConn{Reader: br, ReadWriteCloser: rw}), &opt, halfClose, counted)
+}
+
+// halfCloser is a connection whose peer closes writing once its requests are sent,
+// eg, a stream for each call, so EOF doesn't tell the peer is gone
+type halfCloser interface {
+	closeWrite() error
+}
+
+// bufferedConn reads from Reader while writing and closing the underlying connection
+type bufferedConn struct {
+	io.Reader
+	io.ReadWriteCloser
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
 }
 
 // invalidRequest is a placeholder for response argv when error occurs
 var invalidRequest = struct{}{}
 
 func (server *Server) ServeCodec(cc codec.Codec, opt *Option) {
+	server.serveCodec(context.Background(), cc, opt, false, nil)
+}
+
+// serveCodec serves requests read by cc, ctx is the context of the connection,
+// which is canceled for the calls in flight once the peer is gone, ie, reading
+// fails, or reaches EOF unless the peer closes writing after requests by halfClose.
+// counted is the connection of cc counting sizes of frames, nil if there is none.
+func (server *Server) serveCodec(ctx context.Context, cc codec.Codec, opt *Option, halfClose bool, counted *countedConn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	sending := new(sync.Mutex) // make sure to send a complete response
 	wg := new(sync.WaitGroup)  // wait until all request are handled
+	if server.frameDump != nil {
+		cc = server.frameDump.codec(cc, PeerAddrFrom(ctx), counted)
+	}
+	sc := server.trackConn(cc, PeerAddrFrom(ctx), string(opt.CodecType))
+	defer server.untrackConn(sc)
+	read := counted.framesRead() // bytes read until the last request
 	for {
 		req, err := server.readRequest(cc)
+		size := counted.readSince(&read)
+		if err == nil {
+			req.ctx = withRequestSize(incomingContext(ctx, req.h.Metadata), size)
+			err = server.authorize(ctx, req.h.ServiceMethod)
+		}
+		if err == nil && !server.startRequest(sc) {
+			err = ErrServerClosed
+		}
 		if err != nil {
 			if req == nil {
+				if err != io.EOF || !halfClose {
+					cancel()
+				}
 				break // it's not possible to recover, so close the connection
 			}
 			req.h.Error = err.Error()
@@ -122,12 +239,151 @@ func (server *Server) ServeCodec(cc codec.Codec, opt *Option) {
 			continue
 		}
 		wg.Add(1)
-		go server.handleRequest(cc, req, sending, wg, opt.HandleTimeout)
+		go func() {
+			server.handleRequest(cc, req, sending, wg, opt.HandleTimeout)
+			server.finishRequest(sc)
+		}()
 	}
 	wg.Wait()
 	_ = cc.Close()
 }
 
+// trackListener adds or removes lis, it returns false if lis can't be added
+// because the server is shutting down
+func (server *Server) trackListener(lis net.Listener, add bool) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !add {
+		delete(server.listeners, lis)
+		return true
+	}
+	if server.inShutdown.Load() {
+		_ = lis.Close()
+		return false
+	}
+	if server.listeners == nil {
+		server.listeners = make(map[net.Listener]struct{})
+	}
+	server.listeners[lis] = struct{}{}
+	return true
+}
+
+// SetConnHook sets the hook told when a connection is opened and closed, a call
+// served by an HTTP request counts as a connection of its own. It should be called
+// before serving.
+func (server *Server) SetConnHook(hook func(opened bool)) {
+	server.connHook = hook
+}
+
+// Events returns the bus of events of connections and calls served by the server,
+// that is ConnOpened, ConnClosed, CallStarted and CallFinished
+func (server *Server) Events() *EventBus {
+	return &server.events
+}
+
+func (server *Server) trackConn(conn io.Closer, peer, codec string) *serverConn {
+	server.mu.Lock()
+	if server.conns == nil {
+		server.conns = make(map[*serverConn]struct{})
+	}
+	sc := &serverConn{conn: conn, peer: peer, codec: codec, opened: time.Now()}
+	server.conns[sc] = struct{}{}
+	server.mu.Unlock()
+	serverConns.Add(1)
+	server.events.Publish(ConnOpened{Time: sc.opened, Peer: peer, Codec: codec})
+	if server.connHook != nil {
+		server.connHook(true)
+	}
+	return sc
+}
+
+func (server *Server) untrackConn(sc *serverConn) {
+	server.mu.Lock()
+	delete(server.conns, sc)
+	server.mu.Unlock()
+	serverConns.Add(-1)
+	if server.events.Subscribed() {
+		now := time.Now()
+		server.events.Publish(ConnClosed{Time: now, Peer: sc.peer, Codec: sc.codec, Duration: now.Sub(sc.opened)})
+	}
+	if server.connHook != nil {
+		server.connHook(false)
+	}
+}
+
+// startRequest counts a request being handled on sc,
+// it returns false if no more requests are accepted
+func (server *Server) startRequest(sc *serverConn) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.inShutdown.Load() {
+		return false
+	}
+	sc.pending++
+	server.inFlight++
+	return true
+}
+
+func (server *Server) finishRequest(sc *serverConn) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	sc.pending--
+	server.inFlight--
+}
+
+// InFlight returns the number of requests being handled by the server
+func (server *Server) InFlight() int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.inFlight
+}
+
+// Shutdown gracefully shuts down the server: it closes all listeners, rejects
+// new requests with ErrServerClosed, and closes every connection once requests
+// being handled on it are finished. If ctx is done before that, the remaining
+// connections are closed at once and ctx.Err() is returned.
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.mu.Lock()
+	server.inShutdown.Store(true)
+	for lis := range server.listeners {
+		_ = lis.Close()
+	}
+	server.mu.Unlock()
+
+	t := time.NewTicker(shutdownPollInterval)
+	defer t.Stop()
+	for {
+		if server.closeIdleConns(false) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			server.closeIdleConns(true)
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// closeIdleConns closes connections without pending requests, or all connections
+// if force is true, and reports whether all connections are closed
+func (server *Server) closeIdleConns(force bool) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	done := true
+	for sc := range server.conns {
+		if sc.pending > 0 && !force {
+			done = false
+			continue
+		}
+		if !sc.closed {
+			sc.closed = true
+			_ = sc.conn.Close()
+		}
+	}
+	return done
+}
+
 // request stores all information of a call
 type request struct {
 	h      *codec.Header // header of request
@@ -135,6 +391,7 @@ type request struct {
 	replyv reflect.Value // replyv of request
 	mtype  *methodType
 	svc    *service
+	ctx    context.Context // context of the connection, with metadata of the request
 }
 
 func (server *Server) readRequest(cc codec.Codec) (*request, error) {
@@ -145,7 +402,9 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 	req := &request{h: h}
 	req.svc, req.mtype, err = server.findService(h.ServiceMethod)
 	if err != nil {
-		return req, nil
+		// skip the argv so that the next request is read from its header
+		_ = cc.ReadBody(nil)
+		return req, err
 	}
 	req.argv = req.mtype.newArgv()
 	req.replyv = req.mtype.newReplyv()
@@ -156,7 +415,7 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 	}
 
 	if err = cc.ReadBody(argvi); err != nil {
-		log.Println("rpc server: read argv err:", err)
+		rpclog.Error("rpc server: read argv", "method", h.ServiceMethod, "err", err)
 		return req, err
 	}
 	return req, nil
@@ -186,7 +445,7 @@ func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 	var h codec.Header
 	if err := cc.ReadHeader(&h); err != nil {
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Println("rpc server: read header error:", err)
+			rpclog.Error("rpc server: read header", "err", err)
 		}
 		return nil, err
 	}
@@ -195,11 +454,26 @@ func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 
 func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
 	defer wg.Done()
+	// the context of the call is canceled once it times out or the connection is gone
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(req.ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(req.ctx)
+	}
+	defer cancel()
 	called, sent := make(chan struct{}), make(chan struct{})
 	isReturn := make(chan struct{})
 	defer close(isReturn)
 	go func() {
-		err := req.svc.call(req.mtype, req.argv, req.replyv)
+		start := time.Now()
+		err := server.call(ctx, req.h.ServiceMethod, req.svc, req.mtype, req.argv, req.replyv)
+		if d := time.Since(start); server.slow > 0 && d > server.slow {
+			rpclog.Warn("rpc server: slow request", "method", req.h.ServiceMethod, "duration", d,
+				"peer", PeerAddrFrom(req.ctx), "seq", req.h.Seq, "size", RequestSizeFrom(req.ctx),
+				"request_id", RequestIDFrom(req.ctx))
+		}
 		select {
 		// this case will only happen after executing "defer close(isReturn)"
 		case <-isReturn:
@@ -224,7 +498,13 @@ func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.
 		return
 	}
 	select {
-	case <-time.After(timeout):
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			// the connection is gone, the reply is dropped once the method returns
+			<-called
+			<-sent
+			return
+		}
 		req.h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
 		server.sendResponse(cc, req.h, invalidRequest, sending)
 	case <-called:
@@ -232,25 +512,34 @@ func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.
 	}
 }
 
+// sendResponse writes the response of the request of h, metadata of the request
+// is not sent back
 func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
+	resp := *h
+	resp.Metadata = nil
 	sending.Lock()
 	defer sending.Unlock()
-	if err := cc.Write(h, body); err != nil {
-		log.Println("rpc server: write response error:", err)
+	if err := cc.Write(&resp, body); err != nil {
+		rpclog.Error("rpc server: write response", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
 	}
 }
 
 // ServeHTTP implements a http.Handler that answers RPC requests.
+// A POST request is a single call, see DialHTTP2 and DialHTTPPoll.
 func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		server.servePost(w, req)
+		return
+	}
 	if req.Method != "CONNECT" {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusMethodNotAllowed)
-		_, _ = io.WriteString(w, "405 must CONNECT\n")
+		_, _ = io.WriteString(w, "405 must CONNECT or POST\n")
 		return
 	}
 	conn, _, err := w.(http.Hijacker).Hijack()
 	if err != nil {
-		log.Print("rpc hijacking ", req.RemoteAddr, ": ", err.Error())
+		rpclog.Error("rpc server: hijack", "peer", req.RemoteAddr, "err", err)
 		return
 	}
 	_, _ = io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
@@ -262,7 +551,7 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 func (server *Server) HandleHTTP() {
 	http.Handle(defaultRPCPath, server)
 	http.Handle(defaultDebugPath, debugHTTP{server})
-	log.Println("rpc server debug path:", defaultDebugPath)
+	rpclog.Info("rpc server: handle debug HTTP", "path", defaultDebugPath)
 }
 
 // HandleHTTP is a convenient approach for default server to register HTTP handlers
@@ -1,9 +1,13 @@
 package myRPC
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type Foo int
@@ -43,6 +47,102 @@ func TestMethodType_Call(t *testing.T) {
 	argv := mType.newArgv()
 	replyv := mType.newReplyv()
 	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 3}))
-	err := s.call(mType, argv, replyv)
+	err := s.call(context.Background(), mType, argv, replyv)
 	_assert(err == nil && *replyv.Interface().(*int) == 4 && mType.NumCalls() == 1, "failed to call Foo.Sum")
 }
+
+type Slow int
+
+func (s Slow) Sleep(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	*reply = 1
+	return nil
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	server := NewServer()
+	var s Slow
+	_ = server.Register(&s)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String())
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = client.Close() }()
+
+	called := make(chan error)
+	go func() {
+		var reply int
+		called <- client.Call(context.Background(), "Slow.Sleep", time.Millisecond*200, &reply)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	_assert(err == nil, "expect shutdown after requests are finished, but got %v", err)
+	_assert(<-called == nil, "expect the request being handled is finished")
+	_, err = Dial("tcp", l.Addr().String())
+	_assert(err != nil, "expect no connection accepted after shutdown")
+	var reply int
+	err = client.Call(context.Background(), "Slow.Sleep", time.Duration(0), &reply)
+	_assert(err != nil, "expect no request handled after shutdown")
+}
+
+// Waiter waits for the duration of args unless the context of the call is canceled before
+type Waiter chan error
+
+func (w Waiter) Wait(ctx context.Context, d time.Duration, reply *int) error {
+	select {
+	case <-ctx.Done():
+		w <- ctx.Err()
+		return ctx.Err()
+	case <-time.After(d):
+		w <- nil
+		return nil
+	}
+}
+
+func TestServer_CallContext(t *testing.T) {
+	server := NewServer()
+	waiter := make(Waiter, 1)
+	_ = server.Register(waiter)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+	expectCanceled := func(expect error) {
+		select {
+		case err := <-waiter:
+			if err != expect {
+				t.Fatalf("expect the context of the call canceled by %v, but got %v", expect, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expect the context of the call canceled")
+		}
+	}
+
+	// canceled once the call times out
+	client, err := Dial("tcp", l.Addr().String(), &Option{HandleTimeout: time.Millisecond * 100})
+	_assert(err == nil, "failed to dial: %v", err)
+	var reply int
+	err = client.Call(context.Background(), "Waiter.Wait", time.Second*5, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "handle timeout"), "expect the call timed out, but got %v", err)
+	expectCanceled(context.DeadlineExceeded)
+	_ = client.Close()
+
+	// canceled once the client is gone
+	client, err = Dial("tcp", l.Addr().String())
+	_assert(err == nil, "failed to dial: %v", err)
+	client.Go("Waiter.Wait", time.Second*5, &reply, nil)
+	time.Sleep(time.Millisecond * 50)
+	_ = client.Close()
+	expectCanceled(context.Canceled)
+
+	// not canceled by a stream closing writing after the request
+	mux, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(ListenMux(mux))
+	client, err = DialMux(mux.Addr().String())
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = client.Close() }()
+	err = client.Call(context.Background(), "Waiter.Wait", time.Millisecond*100, &reply)
+	_assert(err == nil, "expect the call over a stream finished, but got %v", err)
+	expectCanceled(nil)
+}
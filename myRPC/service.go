@@ -1,19 +1,24 @@
 package myRPC
 
 import (
+	"context"
 	"go/ast"
 	"log"
+	"myRPC/internal/rpclog"
 	"reflect"
 	"sync/atomic"
 )
 
 type methodType struct {
-	method    reflect.Method
-	ArgType   reflect.Type
-	ReplyType reflect.Type
-	numCalls  uint64
+	method      reflect.Method
+	ArgType     reflect.Type
+	ReplyType   reflect.Type
+	withContext bool // the method takes the context of the call first
+	numCalls    uint64
 }
 
+var typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 func (m *methodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&m.numCalls)
 }
@@ -68,8 +73,10 @@ func (s *service) registerMethods() {
 	for i := 0; i < s.typ.NumMethod(); i++ {
 		method := s.typ.Method(i)
 		mType := method.Type
-		// For each method,check whether params passed in are 3
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		// For each method,check whether params passed in are 3,
+		// or 4 with a context.Context first
+		withContext := mType.NumIn() == 4 && mType.In(1) == typeOfContext
+		if (mType.NumIn() != 3 && !withContext) || mType.NumOut() != 1 {
 			continue
 		}
 		// Check whether return value is error
@@ -78,16 +85,20 @@ func (s *service) registerMethods() {
 			continue
 		}
 		argType, replyType := mType.In(1), mType.In(2)
+		if withContext {
+			argType, replyType = mType.In(2), mType.In(3)
+		}
 		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
 			continue
 		}
 		// Put method into Map(s.method)
 		s.methods[method.Name] = &methodType{
-			method:    method,
-			ArgType:   argType,
-			ReplyType: replyType,
+			method:      method,
+			ArgType:     argType,
+			ReplyType:   replyType,
+			withContext: withContext,
 		}
-		log.Printf("rpc server: register %s.%s\n", s.name, method.Name)
+		rpclog.Info("rpc server: register", "method", s.name+"."+method.Name)
 	}
 }
 
@@ -95,10 +106,15 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
-func (s *service) call(m *methodType, argv, replyv reflect.Value) error {
+// call calls the method, ctx is passed to it if it takes a context
+func (s *service) call(ctx context.Context, m *methodType, argv, replyv reflect.Value) error {
 	atomic.AddUint64(&m.numCalls, 1)
 	f := m.method.Func
-	returnValues := f.Call([]reflect.Value{s.rcvr, argv, replyv})
+	in := []reflect.Value{s.rcvr, argv, replyv}
+	if m.withContext {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	returnValues := f.Call(in)
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		return errInter.(error)
 	}
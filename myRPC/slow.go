@@ -0,0 +1,55 @@
+package myRPC
+
+import (
+	"context"
+	"time"
+)
+
+// SetSlowThreshold makes the server log requests handled longer than threshold,
+// with their method, duration, peer, seq and size of request. 0 means never.
+// It should be called before serving. Clients log slow calls by SlowThreshold of Option.
+func (server *Server) SetSlowThreshold(threshold time.Duration) {
+	server.slow = threshold
+}
+
+// CallSize is bytes of the request and the response of a call on the connection,
+// each -1 if it's unknown, eg, the call failed before it, or its client made by a
+// codec has no connection to count on
+type CallSize struct {
+	Request  int64
+	Response int64
+}
+
+type callSizeKey struct{}
+
+type requestSizeKey struct{}
+
+// WithCallSize returns a context whose calls made by Client.Call record their sizes in size
+func WithCallSize(ctx context.Context, size *CallSize) context.Context {
+	return context.WithValue(ctx, callSizeKey{}, size)
+}
+
+// RequestSizeFrom returns bytes of the request being handled on the connection, it's
+// in the context passed to interceptors and methods taking a context.Context, -1 if
+// it's unknown
+func RequestSizeFrom(ctx context.Context) int64 {
+	size, ok := ctx.Value(requestSizeKey{}).(int64)
+	if !ok {
+		return -1
+	}
+	return size
+}
+
+// recordCallSize records size of a call made by ctx, see WithCallSize
+func recordCallSize(ctx context.Context, size CallSize) {
+	if recorded, ok := ctx.Value(callSizeKey{}).(*CallSize); ok {
+		*recorded = size
+	}
+}
+
+func withRequestSize(ctx context.Context, size int64) context.Context {
+	if size < 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, requestSizeKey{}, size)
+}
@@ -0,0 +1,101 @@
+package myRPC
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlowThreshold(t *testing.T) {
+	var buf safeBuffer
+	SetLogger(NewLogger(&buf, LevelWarn))
+	defer SetLogger(NewLogger(log.Writer(), LevelInfo))
+
+	server := NewServer()
+	var slow Slow
+	_ = server.Register(&slow)
+	server.SetSlowThreshold(time.Millisecond * 50)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+	client, err := Dial("tcp", l.Addr().String(), &Option{SlowThreshold: time.Millisecond * 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	_ = client.Call(context.Background(), "Slow.Sleep", time.Duration(0), &reply)
+	if buf.String() != "" {
+		t.Fatalf("expect a fast call not logged, but got %q", buf.String())
+	}
+	_ = client.Call(context.Background(), "Slow.Sleep", time.Millisecond*100, &reply)
+	logged := buf.String()
+	for _, expect := range []string{
+		"WARN rpc server: slow request method=Slow.Sleep duration=", "seq=2 size=",
+		"WARN rpc client: slow call method=Slow.Sleep duration=", "peer=" + l.Addr().String(),
+	} {
+		if !strings.Contains(logged, expect) {
+			t.Fatalf("expect %q logged, but got %q", expect, logged)
+		}
+	}
+}
+
+func TestCallSize(t *testing.T) {
+	server := NewServer()
+	var slow Slow
+	_ = server.Register(&slow)
+	handled := make(chan int64, 2)
+	server.SetInterceptors(func(ctx context.Context, serviceMethod string, args, reply interface{}, handler Handler) error {
+		handled <- RequestSizeFrom(ctx)
+		return handler(ctx)
+	})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	for i := 0; i < 2; i++ {
+		size := CallSize{Request: -1, Response: -1}
+		var reply int
+		if err := client.Call(WithCallSize(context.Background(), &size), "Slow.Sleep", time.Duration(i), &reply); err != nil {
+			t.Fatal(err)
+		}
+		if size.Request <= 0 || size.Response <= 0 {
+			t.Fatalf("expect sizes of the call recorded, but got %+v", size)
+		}
+		if n := <-handled; n != size.Request {
+			t.Fatalf("expect the size of the request %d on the server, but got %d", size.Request, n)
+		}
+	}
+	if RequestSizeFrom(context.Background()) != -1 {
+		t.Fatal("expect the size of no request unknown")
+	}
+}
+
+// safeBuffer is a bytes.Buffer written concurrently
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
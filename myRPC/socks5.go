@@ -0,0 +1,29 @@
+package myRPC
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/proxy"
+)
+
+// dialSOCKS5 connects to the server through a SOCKS5 proxy, address is
+// [user:password@]proxyhost:port/host:port, where the server is at host:port
+// seen from the proxy
+func dialSOCKS5(address string, opt *Option) (net.Conn, error) {
+	proxyAddr, target, ok := strings.Cut(address, "/")
+	if !ok || proxyAddr == "" || target == "" {
+		return nil, fmt.Errorf("rpc client: wrong socks5 address '%s', expect [user:password@]proxyhost:port/host:port", address)
+	}
+	var auth *proxy.Auth
+	if userinfo, host, ok := strings.Cut(proxyAddr, "@"); ok {
+		user, password, _ := strings.Cut(userinfo, ":")
+		auth, proxyAddr = &proxy.Auth{User: user, Password: password}, host
+	}
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, auth, &net.Dialer{Timeout: opt.ConnectTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return dialer.Dial("tcp", target)
+}
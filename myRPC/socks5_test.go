@@ -0,0 +1,96 @@
+package myRPC
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startSOCKS5 starts a SOCKS5 proxy for user alice with password secret
+func startSOCKS5(t *testing.T) string {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveSOCKS5(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	// greeting: version, methods, and username/password is chosen
+	b := make([]byte, 262)
+	if _, err := io.ReadFull(conn, b[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, b[:b[1]]); err != nil {
+		return
+	}
+	_, _ = conn.Write([]byte{5, 2})
+	// username and password
+	if _, err := io.ReadFull(conn, b[:2]); err != nil {
+		return
+	}
+	user := make([]byte, b[1])
+	_, _ = io.ReadFull(conn, user)
+	_, _ = io.ReadFull(conn, b[:1])
+	password := make([]byte, b[0])
+	_, _ = io.ReadFull(conn, password)
+	if string(user) != "alice" || string(password) != "secret" {
+		_, _ = conn.Write([]byte{1, 1})
+		return
+	}
+	_, _ = conn.Write([]byte{1, 0})
+	// connect request of an IPv4 address
+	if _, err := io.ReadFull(conn, b[:10]); err != nil || b[1] != 1 || b[3] != 1 {
+		return
+	}
+	target := net.JoinHostPort(net.IP(b[4:8]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(b[8:10]))))
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go func() { _, _ = io.Copy(upstream, conn) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func TestXDial_SOCKS5(t *testing.T) {
+	proxyAddr := startSOCKS5(t)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+
+	opt := &Option{ConnectTimeout: time.Second}
+	client, err := XDial("socks5@alice:secret@"+proxyAddr+"/"+l.Addr().String(), opt)
+	if err != nil {
+		t.Fatal("failed to connect through socks5:", err)
+	}
+	defer func() { _ = client.Close() }()
+	var reply int
+	if err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect the call through socks5 succeeds, but got %d, %v", reply, err)
+	}
+
+	if _, err = XDial("socks5@alice:wrong@"+proxyAddr+"/"+l.Addr().String(), opt); err == nil {
+		t.Fatal("expect the user not authenticated by the proxy")
+	}
+	if _, err = XDial("socks5@"+proxyAddr, opt); err == nil {
+		t.Fatal("expect a socks5 address without the server invalid")
+	}
+}
@@ -0,0 +1,57 @@
+package myRPC
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dialSSH connects to the server through an SSH bastion, address is
+// [user@]bastion[:port]/host:port, where the server is at host:port seen from
+// the bastion. SSHConfig of opt authenticates to the bastion, and user of address
+// overrides User of it.
+func dialSSH(address string, opt *Option) (net.Conn, error) {
+	bastion, target, ok := strings.Cut(address, "/")
+	if !ok || bastion == "" || target == "" {
+		return nil, fmt.Errorf("rpc client: wrong ssh address '%s', expect [user@]bastion/host:port", address)
+	}
+	if opt.SSHConfig == nil {
+		return nil, errors.New("rpc client: SSHConfig of Option is needed to dial through ssh")
+	}
+	config := *opt.SSHConfig
+	if user, host, ok := strings.Cut(bastion, "@"); ok {
+		config.User, bastion = user, host
+	}
+	if _, _, err := net.SplitHostPort(bastion); err != nil {
+		bastion = net.JoinHostPort(bastion, "22")
+	}
+	if config.Timeout == 0 {
+		config.Timeout = opt.ConnectTimeout
+	}
+	client, err := ssh.Dial("tcp", bastion, &config)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("tcp", target)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &sshConn{Conn: conn, client: client}, nil
+}
+
+// sshConn is a connection forwarded by the bastion, closing it closes
+// the SSH connection to the bastion
+type sshConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func (c *sshConn) Close() error {
+	err := c.Conn.Close()
+	_ = c.client.Close()
+	return err
+}
@@ -0,0 +1,108 @@
+package myRPC
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startBastion starts an SSH server forwarding connections for user alice with
+// password secret, and returns its address and host key
+func startBastion(t *testing.T) (string, ssh.PublicKey) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(key)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "alice" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(signer)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveBastion(conn, config)
+		}
+	}()
+	return l.Addr().String(), signer.PublicKey()
+}
+
+func serveBastion(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if nc.ChannelType() != "direct-tcpip" || ssh.Unmarshal(nc.ExtraData(), &target) != nil {
+			_ = nc.Reject(ssh.UnknownChannelType, "only direct-tcpip")
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, _ := nc.Accept()
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			_, _ = io.Copy(ch, upstream)
+			_ = ch.Close()
+		}()
+		go func() {
+			_, _ = io.Copy(upstream, ch)
+			_ = upstream.Close()
+		}()
+	}
+}
+
+func TestXDial_SSH(t *testing.T) {
+	bastion, hostKey := startBastion(t)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+
+	opt := &Option{ConnectTimeout: time.Second, SSHConfig: &ssh.ClientConfig{
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	}}
+	client, err := XDial("ssh@alice@"+bastion+"/"+l.Addr().String(), opt)
+	if err != nil {
+		t.Fatal("failed to connect through ssh:", err)
+	}
+	defer func() { _ = client.Close() }()
+	var reply int
+	if err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect the call through ssh succeeds, but got %d, %v", reply, err)
+	}
+
+	if _, err = XDial("ssh@bob@"+bastion+"/"+l.Addr().String(), opt); err == nil {
+		t.Fatal("expect the user not authenticated by the bastion")
+	}
+	if _, err = XDial("ssh@alice@"+bastion, opt); err == nil {
+		t.Fatal("expect an ssh address without the server invalid")
+	}
+}
@@ -0,0 +1,147 @@
+package myRPC
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// statistics of methods are kept for the latest minute, in slots of 10 seconds
+const (
+	statsSlots    = 6
+	statsSlotSize = time.Second * 10
+)
+
+// MethodStats is statistics of calls of a method in the latest minute
+type MethodStats struct {
+	Method string // "<service>.<method>"
+	Count  uint64
+	Errors uint64
+	P50    time.Duration // latencies at the percentiles, within about 6%
+	P95    time.Duration
+	P99    time.Duration
+}
+
+// statsTable keeps statistics of methods
+type statsTable struct {
+	mu      sync.Mutex
+	methods map[string]*methodStats
+}
+
+// methodStats is a ring of slots of a method
+type methodStats struct {
+	slots [statsSlots]statsSlot
+}
+
+type statsSlot struct {
+	epoch     int64 // index of the slot since the Unix epoch
+	count     uint64
+	errors    uint64
+	latencies map[int]uint64 // count of each bucket of latency, see histBucket
+}
+
+func (t *statsTable) record(method string, latency time.Duration, err error) {
+	epoch := time.Now().UnixNano() / int64(statsSlotSize)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.methods == nil {
+		t.methods = make(map[string]*methodStats)
+	}
+	m := t.methods[method]
+	if m == nil {
+		m = &methodStats{}
+		t.methods[method] = m
+	}
+	slot := &m.slots[epoch%statsSlots]
+	if slot.epoch != epoch {
+		*slot = statsSlot{epoch: epoch, latencies: make(map[int]uint64)}
+	}
+	slot.count++
+	if err != nil {
+		slot.errors++
+	}
+	slot.latencies[histBucket(uint64(latency.Microseconds()))]++
+}
+
+// snapshot returns statistics of methods called in the latest minute, by method
+func (t *statsTable) snapshot() []MethodStats {
+	epoch := time.Now().UnixNano() / int64(statsSlotSize)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var stats []MethodStats
+	for method, m := range t.methods {
+		s := MethodStats{Method: method}
+		latencies := make(map[int]uint64)
+		for _, slot := range m.slots {
+			if epoch-slot.epoch >= statsSlots {
+				continue // out of the window
+			}
+			s.Count += slot.count
+			s.Errors += slot.errors
+			for b, n := range slot.latencies {
+				latencies[b] += n
+			}
+		}
+		if s.Count == 0 {
+			continue
+		}
+		s.P50, s.P95, s.P99 = percentile(latencies, s.Count, .5), percentile(latencies, s.Count, .95), percentile(latencies, s.Count, .99)
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Method < stats[j].Method })
+	return stats
+}
+
+// percentile returns the latency at p of count latencies in buckets
+func percentile(buckets map[int]uint64, count uint64, p float64) time.Duration {
+	keys := make([]int, 0, len(buckets))
+	for b := range buckets {
+		keys = append(keys, b)
+	}
+	sort.Ints(keys)
+	rank := uint64(p*float64(count) + 0.5)
+	var seen uint64
+	for _, b := range keys {
+		seen += buckets[b]
+		if seen >= rank {
+			return time.Duration(histValue(b)) * time.Microsecond
+		}
+	}
+	return time.Duration(histValue(keys[len(keys)-1])) * time.Microsecond
+}
+
+// histSubBits is the bits of sub-buckets of each power of two, 16 sub-buckets keep
+// values within 1/16 of their bucket, like an HDR histogram of 1 significant digit
+const histSubBits = 4
+
+// histBucket returns the bucket of v, buckets are exact below 2^histSubBits,
+// and there are 2^histSubBits buckets of each power of two above
+func histBucket(v uint64) int {
+	if v < 1<<histSubBits {
+		return int(v)
+	}
+	shift := bits.Len64(v) - 1 - histSubBits
+	return (shift+1)<<histSubBits + int(v>>shift)&(1<<histSubBits-1)
+}
+
+// histValue returns the largest value of bucket b
+func histValue(b int) uint64 {
+	if b < 1<<histSubBits {
+		return uint64(b)
+	}
+	shift := b>>histSubBits - 1
+	sub := uint64(b & (1<<histSubBits - 1))
+	return (1<<histSubBits+sub+1)<<shift - 1
+}
+
+// MethodStats returns statistics of methods handled by the server in the latest minute
+func (server *Server) MethodStats() []MethodStats {
+	return server.stats.snapshot()
+}
+
+// MethodStats returns statistics of methods called by Call of the client in the
+// latest minute, a call canceled by its context counts as an error
+func (client *Client) MethodStats() []MethodStats {
+	return client.stats.snapshot()
+}
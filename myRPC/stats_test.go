@@ -0,0 +1,88 @@
+package myRPC
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistBucket(t *testing.T) {
+	for _, v := range []uint64{0, 1, 15, 16, 17, 31, 32, 33, 100, 1000, 123456, 1 << 40} {
+		b := histBucket(v)
+		if got := histValue(b); got < v || float64(got-v) > float64(v)/16 {
+			t.Fatalf("expect the bucket of %d within 1/16, but got %d", v, got)
+		}
+		if b > 0 && histValue(b-1) >= v {
+			t.Fatalf("expect %d above bucket %d", v, b-1)
+		}
+	}
+}
+
+func TestStatsTable(t *testing.T) {
+	var table statsTable
+	for i := 1; i <= 100; i++ {
+		var err error
+		if i%10 == 0 {
+			err = errors.New("failed")
+		}
+		table.record("Foo.Sum", time.Duration(i)*time.Millisecond, err)
+	}
+	stats := table.snapshot()
+	if len(stats) != 1 || stats[0].Method != "Foo.Sum" || stats[0].Count != 100 || stats[0].Errors != 10 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	near := func(got, expect time.Duration) bool {
+		return got >= expect && got <= expect+expect/16
+	}
+	if s := stats[0]; !near(s.P50, 50*time.Millisecond) || !near(s.P95, 95*time.Millisecond) || !near(s.P99, 99*time.Millisecond) {
+		t.Fatalf("unexpected percentiles %+v", s)
+	}
+
+	// slots out of the window are dropped
+	for i := range table.methods["Foo.Sum"].slots {
+		table.methods["Foo.Sum"].slots[i].epoch -= statsSlots
+	}
+	if stats = table.snapshot(); len(stats) != 0 {
+		t.Fatalf("expect no stats out of the window, but got %+v", stats)
+	}
+}
+
+func TestMethodStats(t *testing.T) {
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	for i := 0; i < 3; i++ {
+		_ = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	}
+	_ = client.Call(context.Background(), "Foo.Missing", Args{}, &reply)
+
+	stats := client.MethodStats()
+	if len(stats) != 2 || stats[0].Method != "Foo.Missing" || stats[0].Errors != 1 ||
+		stats[1].Method != "Foo.Sum" || stats[1].Count != 3 || stats[1].Errors != 0 {
+		t.Fatalf("unexpected client stats %+v", stats)
+	}
+	stats = server.MethodStats()
+	if len(stats) != 1 || stats[0].Method != "Foo.Sum" || stats[0].Count != 3 {
+		t.Fatalf("unexpected server stats %+v", stats)
+	}
+
+	w := httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath, nil))
+	if body := w.Body.String(); !strings.Contains(body, "Calls (1m)") || !strings.Contains(body, "<td align=center>3</td><td align=center>0</td>") {
+		t.Fatalf("expect stats on the debug page, but got %s", body)
+	}
+}
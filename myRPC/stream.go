@@ -0,0 +1,307 @@
+package myRPC
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"myRPC/codec"
+	"net"
+	"sync"
+)
+
+// streamSession is a connection carrying streams, eg, a QUIC connection, shared by
+// clients which call on a stream of their own for each call, see dialStreams
+type streamSession interface {
+	openStream(ctx context.Context) (sessionStream, error)
+	done() <-chan struct{} // closed once the connection is broken
+	err() error            // why the connection is broken
+	close()
+}
+
+// sessionStream is a stream of a streamSession as net.Conn, Close stops reading
+// and closes writing
+type sessionStream interface {
+	net.Conn
+	closeWrite() error // tells the peer nothing more is written
+	abort()            // stops both directions without waiting for the peer
+}
+
+// sharedSessions are sessions shared by clients of the same sessionKey
+var sharedSessions = struct {
+	sync.Mutex
+	m map[sessionKey]*sharedSession
+}{m: make(map[sessionKey]*sharedSession)}
+
+// sessionKey tells sessions apart by protocol, address and TLSConfig of Option
+type sessionKey struct {
+	protocol string
+	address  string
+	config   *tls.Config
+}
+
+// sharedSession is a session shared by clients, closed when the last client releases it
+type sharedSession struct {
+	key   sessionKey
+	refs  int           // protected by sharedSessions
+	ready chan struct{} // closed once dialing finishes
+	s     streamSession
+	err   error
+}
+
+// broken reports whether c failed to dial or has been closed, it must be ready
+func (c *sharedSession) broken() bool {
+	if c.err != nil {
+		return true
+	}
+	select {
+	case <-c.s.done():
+		return true
+	default:
+		return false
+	}
+}
+
+// acquireSession returns the session of key shared by clients, it's dialed if there
+// is none or the one shared is broken. Concurrent callers wait for the same dialing.
+func acquireSession(key sessionKey, dial func() (streamSession, error)) (*sharedSession, error) {
+	sharedSessions.Lock()
+	c := sharedSessions.m[key]
+	if c != nil {
+		select {
+		case <-c.ready:
+			if c.broken() {
+				delete(sharedSessions.m, key)
+				c = nil
+			}
+		default:
+		}
+	}
+	first := c == nil
+	if first {
+		c = &sharedSession{key: key, ready: make(chan struct{})}
+		sharedSessions.m[key] = c
+	}
+	c.refs++
+	sharedSessions.Unlock()
+
+	if first {
+		c.s, c.err = dial()
+		close(c.ready)
+	}
+	<-c.ready
+	if c.err != nil {
+		c.release()
+		return nil, c.err
+	}
+	return c, nil
+}
+
+// release drops a reference to c, and closes the session after the last one
+func (c *sharedSession) release() {
+	sharedSessions.Lock()
+	defer sharedSessions.Unlock()
+	c.refs--
+	if c.refs > 0 {
+		return
+	}
+	if sharedSessions.m[c.key] == c {
+		delete(sharedSessions.m, c.key)
+	}
+	if c.err == nil {
+		c.s.close()
+	}
+}
+
+// dialStream opens a stream of the session of key shared by clients, it's a single
+// connection for calls like a TCP connection, see dialStreams
+func dialStream(key sessionKey, opt *Option, dial func() (streamSession, error)) (net.Conn, error) {
+	c, err := acquireSession(key, dial)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if opt.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.ConnectTimeout)
+		defer cancel()
+	}
+	st, err := c.s.openStream(ctx)
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+	return &releasingStream{sessionStream: st, release: c.release}, nil
+}
+
+// releasingStream releases the shared session once it's closed
+type releasingStream struct {
+	sessionStream
+	release func()
+	once    sync.Once
+}
+
+func (s *releasingStream) Close() error {
+	err := s.sessionStream.Close()
+	s.once.Do(s.release)
+	return err
+}
+
+// dialStreams returns a client calling on the session of key shared by clients,
+// each call is sent on a stream of its own with Option ahead of it, so a large
+// or slow reply doesn't block others
+func dialStreams(key sessionKey, opt *Option, dial func() (streamSession, error)) (*Client, error) {
+	f := codec.NewCodecFuncMap[opt.CodecType]
+	if f == nil {
+		return nil, fmt.Errorf("invalid codec type %s", opt.CodecType)
+	}
+	c, err := acquireSession(key, dial)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cc := &streamCodec{
+		c:       c,
+		opt:     opt,
+		f:       f,
+		ctx:     ctx,
+		cancel:  cancel,
+		replies: make(chan *streamReply),
+		streams: make(map[sessionStream]struct{}),
+	}
+	return newClientCodec(cc, opt, key.address), nil
+}
+
+// streamCodec is the codec of a client calling on a shared session, Write opens
+// a stream for each call, and replies are read in the order they arrive
+type streamCodec struct {
+	c       *sharedSession
+	opt     *Option
+	f       codec.NewCodecFunc
+	ctx     context.Context
+	cancel  context.CancelFunc
+	replies chan *streamReply
+	reply   *streamReply // the reply being read
+
+	mu      sync.Mutex // protect following
+	streams map[sessionStream]struct{}
+	closed  bool
+}
+
+// streamReply is the header of a reply read from a stream, and the codec to read its body
+type streamReply struct {
+	h  codec.Header
+	cc codec.Codec // nil if the stream failed, h carries the error then
+}
+
+var _ codec.Codec = (*streamCodec)(nil)
+
+func (c *streamCodec) Write(h *codec.Header, body interface{}) error {
+	var buf bytes.Buffer
+	_ = json.NewEncoder(&buf).Encode(c.opt)
+	if err := c.f(&postStream{Writer: &buf}).Write(h, body); err != nil {
+		return err
+	}
+	st, err := c.c.s.openStream(c.ctx)
+	if err != nil {
+		return err
+	}
+	if !c.track(st) {
+		st.abort()
+		return net.ErrClosed
+	}
+	// closing the write direction tells the server the stream carries no more calls
+	if _, err = st.Write(buf.Bytes()); err == nil {
+		err = st.closeWrite()
+	}
+	if err != nil {
+		c.untrack(st)
+		st.abort()
+		return err
+	}
+	go c.receive(st, *h)
+	return nil
+}
+
+// receive reads the reply from st and passes it to ReadHeader, the reply is read
+// whole before, so that a large reply doesn't hold up replies of other streams
+// while its body is read. A failure of the stream fails the call of h only.
+func (c *streamCodec) receive(st sessionStream, h codec.Header) {
+	// the server closes the stream once the reply is written
+	data, err := io.ReadAll(st)
+	_ = st.Close()
+	c.untrack(st)
+	reply := &streamReply{cc: c.f(&postStream{Reader: bytes.NewReader(data)})}
+	if err == nil {
+		err = reply.cc.ReadHeader(&reply.h)
+	}
+	if err != nil {
+		reply.cc = nil
+		reply.h = codec.Header{ServiceMethod: h.ServiceMethod, Seq: h.Seq, Error: "rpc client: read stream: " + err.Error()}
+	}
+	select {
+	case c.replies <- reply:
+	case <-c.ctx.Done():
+	}
+}
+
+func (c *streamCodec) track(st sessionStream) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.streams[st] = struct{}{}
+	return true
+}
+
+func (c *streamCodec) untrack(st sessionStream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.streams, st)
+}
+
+// ReadHeader waits for the next reply, the client breaks once the session
+// is broken, so that it's dialed again
+func (c *streamCodec) ReadHeader(h *codec.Header) error {
+	select {
+	case c.reply = <-c.replies:
+	case <-c.ctx.Done():
+		return net.ErrClosed
+	case <-c.c.s.done():
+		return c.c.s.err()
+	}
+	*h = c.reply.h
+	return nil
+}
+
+func (c *streamCodec) ReadBody(body interface{}) error {
+	if c.reply.cc == nil {
+		c.reply = nil
+		return nil
+	}
+	err := c.reply.cc.ReadBody(body)
+	c.reply = nil
+	return err
+}
+
+// Close aborts streams of calls in flight and releases the shared session
+func (c *streamCodec) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	streams := c.streams
+	c.streams = nil
+	c.mu.Unlock()
+	c.cancel()
+	for st := range streams {
+		st.abort()
+	}
+	c.c.release()
+	return nil
+}
@@ -0,0 +1,100 @@
+// Package tracing traces calls of myRPC by OpenTelemetry, with a span of each call
+// on both client and server, and trace context carried by metadata of requests,
+// so calls join distributed traces of the tracer provider and propagator set globally.
+// Sizes of requests and responses are those counted on connections, so client spans
+// have both, and server spans that of the request, since the response is sent after.
+package tracing
+
+import (
+	"context"
+	"myRPC"
+	"myRPC/xclient"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "myRPC/tracing"
+
+// attributes of spans, named after the semantic conventions of RPC
+const (
+	rpcSystem    = attribute.Key("rpc.system")
+	rpcService   = attribute.Key("rpc.service")
+	rpcMethod    = attribute.Key("rpc.method")
+	rpcTarget    = attribute.Key("server.address")
+	requestSize  = attribute.Key("rpc.request.size")
+	responseSize = attribute.Key("rpc.response.size")
+)
+
+// ClientInterceptor returns an interceptor of XClient starting a client span of each
+// call to a server, whose trace context is carried with the request. tp is the
+// tracer provider, the global one if it's nil.
+func ClientInterceptor(tp trace.TracerProvider) xclient.Interceptor {
+	tracer := tracerOf(tp)
+	return func(ctx context.Context, serviceMethod string, args, reply interface{}, target string, invoker xclient.Invoker) error {
+		ctx, span := tracer.Start(ctx, serviceMethod, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(callAttributes(serviceMethod)...))
+		defer span.End()
+		span.SetAttributes(rpcTarget.String(target))
+
+		carrier := propagation.MapCarrier{}
+		otel.GetTextMapPropagator().Inject(ctx, carrier)
+		size := myRPC.CallSize{Request: -1, Response: -1}
+		err := invoker(myRPC.WithCallSize(myRPC.WithMetadata(ctx, carrier), &size), serviceMethod, args, reply, target)
+		setSize(span, requestSize, size.Request)
+		setSize(span, responseSize, size.Response)
+		end(span, err)
+		return err
+	}
+}
+
+// ServerInterceptor returns an interceptor of Server starting a server span of each
+// call handled, as a child of the span of the client if the request carries its
+// trace context. tp is the tracer provider, the global one if it's nil.
+func ServerInterceptor(tp trace.TracerProvider) myRPC.ServerInterceptor {
+	tracer := tracerOf(tp)
+	return func(ctx context.Context, serviceMethod string, args, reply interface{}, handler myRPC.Handler) error {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(myRPC.IncomingMetadata(ctx)))
+		ctx, span := tracer.Start(ctx, serviceMethod, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(callAttributes(serviceMethod)...))
+		defer span.End()
+		setSize(span, requestSize, myRPC.RequestSizeFrom(ctx))
+
+		err := handler(ctx)
+		end(span, err)
+		return err
+	}
+}
+
+func tracerOf(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(instrumentationName)
+}
+
+func callAttributes(serviceMethod string) []attribute.KeyValue {
+	service, method, _ := strings.Cut(serviceMethod, ".")
+	return []attribute.KeyValue{rpcSystem.String("myrpc"), rpcService.String(service), rpcMethod.String(method)}
+}
+
+// end records the status of the call
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetStatus(codes.Ok, "")
+}
+
+// setSize sets the attribute of a size on the connection if it's known
+func setSize(span trace.Span, key attribute.Key, size int64) {
+	if size >= 0 {
+		span.SetAttributes(key.Int64(size))
+	}
+}
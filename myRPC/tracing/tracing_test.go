@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"myRPC"
+	"myRPC/xclient"
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestInterceptors(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	server := myRPC.NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	server.SetInterceptors(ServerInterceptor(tp))
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer func() { _ = server.Shutdown(context.Background()) }()
+
+	addr := "tcp@" + l.Addr().String()
+	xc := xclient.NewXClient(xclient.NewMultiServersDiscovery([]string{addr}), xclient.RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetInterceptors(ClientInterceptor(tp))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	var reply int
+	if err := xc.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect the call traced succeeds, but got %d, %v", reply, err)
+	}
+	_ = xc.Call(ctx, "Foo.Missing", Args{}, &reply)
+	parent.End()
+
+	var client, handled, failed sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch {
+		case span.SpanKind() == trace.SpanKindClient && span.Name() == "Foo.Sum":
+			client = span
+		case span.SpanKind() == trace.SpanKindServer:
+			handled = span
+		case span.Name() == "Foo.Missing":
+			failed = span
+		}
+	}
+	if client == nil || handled == nil || failed == nil {
+		t.Fatalf("expect client and server spans, but got %v", recorder.Ended())
+	}
+	if client.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expect the client span a child of the span of the caller")
+	}
+	if handled.Parent().SpanID() != client.SpanContext().SpanID() || handled.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Fatal("expect the server span a child of the client span in the same trace")
+	}
+	if attr(client, "rpc.method").AsString() != "Sum" || attr(client, "server.address").AsString() != addr ||
+		attr(client, "rpc.request.size").AsInt64() <= 0 || attr(client, "rpc.response.size").AsInt64() <= 0 ||
+		attr(handled, "rpc.request.size").AsInt64() != attr(client, "rpc.request.size").AsInt64() {
+		t.Fatalf("expect attributes of the call, but got %v and %v", client.Attributes(), handled.Attributes())
+	}
+	if failed.Status().Code != codes.Error {
+		t.Fatalf("expect the failed call recorded as error, but got %v", failed.Status())
+	}
+}
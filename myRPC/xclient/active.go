@@ -0,0 +1,68 @@
+package xclient
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+)
+
+// activeCalls counts calls in flight to each server
+type activeCalls struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (a *activeCalls) start(server string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.counts == nil {
+		a.counts = make(map[string]int)
+	}
+	a.counts[server]++
+}
+
+func (a *activeCalls) done(server string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.counts[server]--; a.counts[server] <= 0 {
+		delete(a.counts, server)
+	}
+}
+
+// count returns the number of calls in flight to server
+func (a *activeCalls) count(server string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.counts[server]
+}
+
+// least returns the server with the fewest calls in flight among servers,
+// servers tied are chosen at random so that idle clients don't all pick the first one
+func (a *activeCalls) least(servers []string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var selected string
+	least, tied := -1, 0
+	for _, server := range servers {
+		n := a.counts[server]
+		switch {
+		case least < 0 || n < least:
+			selected, least, tied = server, n, 1
+		case n == least:
+			// reservoir sampling among servers tied
+			if tied++; rand.Intn(tied) == 0 {
+				selected = server
+			}
+		}
+	}
+	return selected
+}
+
+// leastActiveServer selects the server with the fewest calls in flight
+func (xc *XClient) leastActiveServer(ctx context.Context) (string, error) {
+	servers, err := xc.servers(ctx)
+	if err != nil {
+		return "", err
+	}
+	return xc.active.least(servers), nil
+}
@@ -0,0 +1,30 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+)
+
+func TestXClient_LeastActive(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2", "tcp@127.0.0.1:3"})
+	xc := NewXClient(d, LeastActiveSelect, nil)
+	xc.active.start("tcp@127.0.0.1:1")
+	xc.active.start("tcp@127.0.0.1:1")
+	xc.active.start("tcp@127.0.0.1:3")
+	for i := 0; i < 10; i++ {
+		if server, _ := xc.selectServer(context.Background()); server != "tcp@127.0.0.1:2" {
+			t.Fatalf("expect the server without calls in flight, but got %s", server)
+		}
+	}
+	xc.active.start("tcp@127.0.0.1:2")
+	xc.active.start("tcp@127.0.0.1:2")
+	xc.active.done("tcp@127.0.0.1:1")
+	selected := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		server, _ := xc.selectServer(context.Background())
+		selected[server] = true
+	}
+	if len(selected) != 2 || selected["tcp@127.0.0.1:2"] {
+		t.Fatalf("expect servers tied with the fewest calls selected at random, but got %v", selected)
+	}
+}
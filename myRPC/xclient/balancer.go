@@ -0,0 +1,148 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// CallInfo describes the call a Balancer picks a server for
+type CallInfo struct {
+	ServiceMethod string // format "<service>.<method>"
+	Args          interface{}
+}
+
+// Balancer picks the server of a call among servers, which are never empty.
+// done is called with the error of the call once it's finished if it's not nil,
+// so the balancer may learn how servers behave. Retries of a failed call may go
+// to other servers without asking the balancer.
+type Balancer interface {
+	Pick(ctx context.Context, call CallInfo, servers []string) (addr string, done func(err error))
+}
+
+var (
+	balancersMu sync.RWMutex
+	balancers   = map[string]func() Balancer{
+		"random":       func() Balancer { return randomBalancer{} },
+		"round_robin":  func() Balancer { return &roundRobinBalancer{} },
+		"least_active": func() Balancer { return &leastActiveBalancer{} },
+	}
+)
+
+// RegisterBalancer makes a balancing policy available by name, newBalancer builds
+// a balancer for each XClient using it. It panics if name is registered already.
+func RegisterBalancer(name string, newBalancer func() Balancer) {
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+	if _, ok := balancers[name]; ok {
+		panic("rpc xclient: balancer registered twice: " + name)
+	}
+	balancers[name] = newBalancer
+}
+
+// NewBalancer builds a balancer of the policy registered by name
+func NewBalancer(name string) (Balancer, error) {
+	balancersMu.RLock()
+	defer balancersMu.RUnlock()
+	newBalancer, ok := balancers[name]
+	if !ok {
+		return nil, fmt.Errorf("rpc xclient: unknown balancer %q", name)
+	}
+	return newBalancer(), nil
+}
+
+// SetBalancer makes xc delegate selecting servers to b, rather than selecting by
+// its mode, except for calls made with WithSelectMode. b picks among servers
+// filtered by xc, eg, by routes and circuit breakers. It should be called before
+// xc is used.
+func (xc *XClient) SetBalancer(b Balancer) {
+	xc.balancer = b
+}
+
+// balancedCall is the call picked a server by Balancer
+type balancedCall struct {
+	info CallInfo
+	mu   sync.Mutex
+	addr string
+	done func(err error)
+}
+
+// withBalancedCall returns a context carrying the call to be picked a server by Balancer
+func (xc *XClient) withBalancedCall(ctx context.Context, serviceMethod string, args interface{}) context.Context {
+	if xc.balancer == nil {
+		return ctx
+	}
+	call := &balancedCall{info: CallInfo{ServiceMethod: serviceMethod, Args: args}}
+	return withCallOptions(ctx, []CallOption{func(o *callOptions) { o.balanced = call }})
+}
+
+// balance picks the server of the call made with ctx by Balancer
+func (xc *XClient) balance(ctx context.Context) (string, error) {
+	servers, err := xc.servers(ctx)
+	if err != nil {
+		return "", err
+	}
+	call := callOptionsFrom(ctx).balanced
+	var info CallInfo
+	if call != nil {
+		info = call.info
+	}
+	addr, done := xc.balancer.Pick(ctx, info, servers)
+	if addr == "" {
+		return "", ErrNoAvailableServers
+	}
+	if call != nil {
+		call.mu.Lock()
+		call.addr, call.done = addr, done
+		call.mu.Unlock()
+	} else if done != nil {
+		// nobody is going to tell how the call goes
+		done(nil)
+	}
+	return addr, nil
+}
+
+// balanced tells Balancer the call made with ctx to rpcAddr is finished with err,
+// if the server is picked by it
+func (xc *XClient) balanced(ctx context.Context, rpcAddr string, err error) {
+	call := callOptionsFrom(ctx).balanced
+	if call == nil {
+		return
+	}
+	call.mu.Lock()
+	var done func(err error)
+	if call.addr == rpcAddr {
+		done, call.done = call.done, nil
+	}
+	call.mu.Unlock()
+	if done != nil {
+		done(err)
+	}
+}
+
+type randomBalancer struct{}
+
+func (randomBalancer) Pick(_ context.Context, _ CallInfo, servers []string) (string, func(error)) {
+	return servers[rand.Intn(len(servers))], nil
+}
+
+type roundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobinBalancer) Pick(_ context.Context, _ CallInfo, servers []string) (string, func(error)) {
+	return servers[(b.next.Add(1)-1)%uint64(len(servers))], nil
+}
+
+// leastActiveBalancer picks the server with the fewest calls in flight it picked
+type leastActiveBalancer struct {
+	active activeCalls
+}
+
+func (b *leastActiveBalancer) Pick(_ context.Context, _ CallInfo, servers []string) (string, func(error)) {
+	addr := b.active.least(servers)
+	b.active.start(addr)
+	return addr, func(error) { b.active.done(addr) }
+}
@@ -0,0 +1,80 @@
+package xclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// lastBalancer picks the last server and records errors of calls
+type lastBalancer struct {
+	mu    sync.Mutex
+	calls []CallInfo
+	errs  []error
+}
+
+func (b *lastBalancer) Pick(_ context.Context, call CallInfo, servers []string) (string, func(error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, call)
+	return servers[len(servers)-1], func(err error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.errs = append(b.errs, err)
+	}
+}
+
+func TestXClient_SetBalancer(t *testing.T) {
+	a, b := startServer(t, 0), startServer(t, 0)
+	xc := NewXClient(NewMultiServersDiscovery([]string{a, b}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	balancer := &lastBalancer{}
+	xc.SetBalancer(balancer)
+	var reply int
+	args := &Args{Num1: 1, Num2: 2}
+	if err := xc.Call(context.Background(), "Foo.Sum", args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := xc.Call(context.Background(), "Foo.Fail", args, &reply); err == nil {
+		t.Fatal("expect Foo.Fail failed")
+	}
+	balancer.mu.Lock()
+	defer balancer.mu.Unlock()
+	if len(balancer.calls) != 2 || balancer.calls[0].ServiceMethod != "Foo.Sum" || balancer.calls[0].Args != args {
+		t.Fatalf("expect balancer told about calls, but got %+v", balancer.calls)
+	}
+	if len(balancer.errs) != 2 || balancer.errs[0] != nil || balancer.errs[1] == nil {
+		t.Fatalf("expect balancer told how calls go, but got %v", balancer.errs)
+	}
+	xc.mu.Lock()
+	_, dialedA := xc.clients[a]
+	xc.mu.Unlock()
+	if dialedA {
+		t.Fatal("expect only the server picked by balancer called")
+	}
+}
+
+func TestNewBalancer(t *testing.T) {
+	if _, err := NewBalancer("last"); err != nil {
+		// registered once when the test runs repeatedly
+		RegisterBalancer("last", func() Balancer { return &lastBalancer{} })
+	}
+	b, err := NewBalancer("last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, _ := b.Pick(context.Background(), CallInfo{}, []string{"a", "b"}); addr != "b" {
+		t.Fatalf("expect the registered balancer, but it picks %s", addr)
+	}
+	if _, err = NewBalancer("unknown"); err == nil {
+		t.Fatal("expect error for an unknown balancer")
+	}
+
+	// least_active spreads calls in flight
+	b, _ = NewBalancer("least_active")
+	first, done := b.Pick(context.Background(), CallInfo{}, []string{"a", "b"})
+	if second, _ := b.Pick(context.Background(), CallInfo{}, []string{"a", "b"}); second == first {
+		t.Fatalf("expect the idle server picked, but got %s twice", first)
+	}
+	done(nil)
+}
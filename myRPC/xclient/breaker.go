@@ -0,0 +1,98 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// breakers keeps a circuit breaker of each server, a breaker trips open after
+// consecutive failures of calls to the server, which isn't selected then until
+// cool-down passes. The first call after cool-down probes the server half-open,
+// the breaker closes if it succeeds or opens again if it fails.
+type breakers struct {
+	mu       sync.Mutex
+	failures int // consecutive failures tripping a breaker
+	coolDown time.Duration
+	servers  map[string]*breaker
+}
+
+type breaker struct {
+	failures int       // consecutive failures
+	openedAt time.Time // zero if the breaker is closed
+	probing  bool      // a call is probing the server half-open
+}
+
+// SetCircuitBreaker stops selecting a server for coolDown after failures calls to it
+// fail in a row, then lets a call probe whether it recovers. Errors returned by the
+// method called don't count, see SetFailMode. If breakers of all servers are open,
+// they're all selected. It should be called before xc is used.
+func (xc *XClient) SetCircuitBreaker(failures int, coolDown time.Duration) {
+	xc.breakers = &breakers{failures: max(failures, 1), coolDown: coolDown, servers: make(map[string]*breaker)}
+}
+
+// allow reports whether server can be selected
+func (b *breakers) allow(server string, now time.Time) bool {
+	s := b.servers[server]
+	switch {
+	case s == nil || s.openedAt.IsZero():
+		return true
+	case now.Sub(s.openedAt) < b.coolDown:
+		return false
+	default:
+		// half-open, one call probes it at a time
+		return !s.probing
+	}
+}
+
+// filter returns servers whose breakers allow calls, or all servers if there is none
+func (b *breakers) filter(servers []string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	allowed := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if b.allow(server, now) {
+			allowed = append(allowed, server)
+		}
+	}
+	if len(allowed) == 0 {
+		return servers
+	}
+	return allowed
+}
+
+// start is called before a call to server
+func (b *breakers) start(server string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s := b.servers[server]; s != nil && !s.openedAt.IsZero() && time.Since(s.openedAt) >= b.coolDown {
+		s.probing = true
+	}
+}
+
+// done records the result of a call to server
+func (b *breakers) done(server string, err error) {
+	if err != nil && (errors.Is(err, context.Canceled) || !retryable(err)) {
+		// canceled by the caller, or failed by the method, the server is working
+		err = nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.servers[server]
+	if err == nil {
+		if s != nil {
+			delete(b.servers, server)
+		}
+		return
+	}
+	if s == nil {
+		s = &breaker{}
+		b.servers[server] = s
+	}
+	s.failures++
+	if s.probing || s.failures >= b.failures {
+		s.openedAt, s.probing = time.Now(), false
+	}
+}
@@ -0,0 +1,69 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"myRPC"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBreakers(t *testing.T) {
+	b := &breakers{failures: 2, coolDown: time.Millisecond * 50, servers: make(map[string]*breaker)}
+	servers := []string{"a", "b"}
+	failed := errors.New("connection refused")
+	b.done("a", failed)
+	if got := b.filter(servers); !reflect.DeepEqual(got, servers) {
+		t.Fatalf("breaker trips after 1 failure: %v", got)
+	}
+	// the server replies, so failures in a row are reset
+	b.done("a", myRPC.ServerError("failed by method"))
+	b.done("a", failed)
+	if got := b.filter(servers); !reflect.DeepEqual(got, servers) {
+		t.Fatalf("breaker trips after failures not in a row: %v", got)
+	}
+	b.done("a", failed)
+	if got := b.filter(servers); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("servers allowed = %v, expect [b]", got)
+	}
+	b.done("b", failed)
+	b.done("b", failed)
+	if got := b.filter(servers); !reflect.DeepEqual(got, servers) {
+		t.Fatalf("servers allowed = %v when all breakers are open", got)
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	// half-open, a failed probe opens it again
+	b.start("a")
+	if got := b.filter([]string{"a", "b", "c"}); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("servers allowed = %v while a is probed", got)
+	}
+	b.done("a", failed)
+	if got := b.filter([]string{"a", "c"}); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Fatalf("servers allowed = %v after probe fails", got)
+	}
+	// a successful probe closes it
+	b.start("b")
+	b.done("b", nil)
+	if got := b.filter([]string{"b", "c"}); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("servers allowed = %v after probe succeeds", got)
+	}
+}
+
+func TestXClient_CircuitBreaker(t *testing.T) {
+	alive, dead := startServer(t, 0), deadServer()
+	xc := NewXClient(NewMultiServersDiscovery([]string{alive, dead}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetCircuitBreaker(1, time.Minute)
+	var reply int
+	failures := 0
+	for i := 0; i < 10; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			failures++
+		}
+	}
+	if failures != 1 {
+		t.Fatalf("%d calls fail, expect only 1 before the breaker trips", failures)
+	}
+}
@@ -0,0 +1,42 @@
+package xclient
+
+import (
+	"context"
+	"time"
+)
+
+// SetBroadcastLimit makes Broadcast, BroadcastAll and QuorumCall call at most
+// concurrency servers at a time if it's positive, and each call times out after
+// timeout if it's positive, so broadcasting to a large fleet doesn't dial every
+// server at once. It should be called before xc is used.
+func (xc *XClient) SetBroadcastLimit(concurrency int, timeout time.Duration) {
+	xc.broadcastConcurrency = concurrency
+	xc.broadcastTimeout = timeout
+}
+
+// broadcastSlots returns slots of calls of a broadcast, nil if calls aren't limited
+func (xc *XClient) broadcastSlots() chan struct{} {
+	if xc.broadcastConcurrency <= 0 {
+		return nil
+	}
+	return make(chan struct{}, xc.broadcastConcurrency)
+}
+
+// broadcastCall calls server at rpcAddr once a slot is free, a call waiting
+// for a slot fails if ctx is done first
+func (xc *XClient) broadcastCall(slots chan struct{}, rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if xc.broadcastTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, xc.broadcastTimeout)
+		defer cancel()
+	}
+	return xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+}
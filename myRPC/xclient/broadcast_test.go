@@ -0,0 +1,35 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestXClient_SetBroadcastLimit(t *testing.T) {
+	servers := make([]string, 4)
+	for i := range servers {
+		servers[i] = startServer(t, time.Millisecond*50)
+	}
+	xc := NewXClient(NewMultiServersDiscovery(servers), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetBroadcastLimit(2, 0)
+	var reply int
+	start := time.Now()
+	if err := xc.Broadcast(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	// 4 calls, 2 at a time
+	if elapsed := time.Since(start); elapsed < time.Millisecond*100 {
+		t.Fatalf("broadcast took %v, expect calls limited to 2 at a time", elapsed)
+	}
+
+	xc.SetBroadcastLimit(0, time.Millisecond*10)
+	results, _ := xc.BroadcastAll(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	for server, result := range results {
+		if !errors.Is(result.Err, context.DeadlineExceeded) {
+			t.Fatalf("expect the call to %s timed out, but got %v", server, result.Err)
+		}
+	}
+}
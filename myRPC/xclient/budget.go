@@ -0,0 +1,52 @@
+package xclient
+
+import (
+	"math"
+	"sync"
+)
+
+// tokenUnit is how many units a token of retry budget is counted in, so that
+// shares of tokens add up exactly
+const tokenUnit = 1000
+
+// retryBudget is a token bucket of retries, each call earns ratio of a token
+// and each retry spends a token, so retries can't exceed ratio of calls for long
+type retryBudget struct {
+	mu     sync.Mutex
+	share  int // units earned by a call
+	burst  int // units saved at most
+	tokens int // units saved
+}
+
+// SetRetryBudget limits retries of Failover and Failtry, and backup calls of
+// Failbackup, to ratio of calls, eg, 0.1 for 10%, with up to burst retries
+// saved for quiet times. Once the budget is spent, a failed call fails at once,
+// so retries don't multiply traffic to servers all failing. It should be called
+// before xc is used.
+func (xc *XClient) SetRetryBudget(ratio float64, burst int) {
+	burst = max(burst, 1) * tokenUnit
+	xc.retryBudget = &retryBudget{share: int(math.Round(ratio * tokenUnit)), burst: burst, tokens: burst}
+}
+
+// deposit earns a call its share of tokens
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.share, b.burst)
+}
+
+// withdraw spends a token for a retry, it reports false if there isn't one
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < tokenUnit {
+		return false
+	}
+	b.tokens -= tokenUnit
+	return true
+}
+
+// canRetry reports whether a call may be retried under the retry budget of xc
+func (xc *XClient) canRetry() bool {
+	return xc.retryBudget == nil || xc.retryBudget.withdraw()
+}
@@ -0,0 +1,46 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+)
+
+func TestXClient_SetRetryBudget(t *testing.T) {
+	addr := startServer(t, 0)
+	xc := NewXClient(NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1"}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	metrics := NewMetrics()
+	xc.SetStatsHandler(metrics)
+	xc.SetFailMode(Failtry, 10)
+	xc.SetRetryBudget(0.1, 2)
+	calls := func() uint64 {
+		return metrics.Targets()["tcp@127.0.0.1:1"].Calls
+	}
+
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err == nil {
+		t.Fatal("expect call to the dead server failed")
+	}
+	// the first try and 2 retries saved
+	if n := calls(); n != 3 {
+		t.Fatalf("%d calls made, expect 3", n)
+	}
+	for i := 0; i < 10; i++ {
+		_ = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	}
+	// 10 calls earn a retry
+	if n := calls(); n != 14 {
+		t.Fatalf("%d calls made, expect 14", n)
+	}
+
+	// successful calls refill the budget
+	_ = xc.d.Update([]string{addr})
+	for i := 0; i < 10; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !xc.canRetry() {
+		t.Fatal("expect budget refilled by successful calls")
+	}
+}
@@ -0,0 +1,55 @@
+package xclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"myRPC/internal/rpclog"
+	"os"
+)
+
+// SetCache keeps servers of d in the file at path, and loads servers cached there if d
+// has none, so that a client restarted while registry is down can still reach servers
+// known before. The file is rewritten whenever servers change, in the format of
+// FileDiscovery. Loads of servers aren't cached.
+func (d *MultiServersDiscovery) SetCache(path string) error {
+	d.mu.Lock()
+	d.cachePath = path
+	if len(d.servers) == 0 {
+		servers, meta, err := readServersFile(path)
+		switch {
+		case err == nil:
+			d.servers, d.meta = servers, meta
+			d.changed()
+		case !errors.Is(err, fs.ErrNotExist):
+			d.mu.Unlock()
+			return err
+		}
+	}
+	d.mu.Unlock()
+	d.Subscribe(func(_, _ []string) { d.saveCache(path) })
+	return nil
+}
+
+// saveCache writes servers to the cache file at path
+func (d *MultiServersDiscovery) saveCache(path string) {
+	d.mu.RLock()
+	cached := make([]registryServer, 0, len(d.servers))
+	for _, addr := range d.servers {
+		meta := d.meta[addr]
+		meta.Load = nil
+		cached = append(cached, registryServer{Addr: addr, ServerMeta: meta})
+	}
+	d.mu.RUnlock()
+	b, err := json.MarshalIndent(cached, "", "  ")
+	if err == nil {
+		// replace the file at once, so that it's never read half written
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, b, 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		rpclog.Warn("rpc discovery: save cache", "path", path, "err", err)
+	}
+}
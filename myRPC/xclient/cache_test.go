@@ -0,0 +1,46 @@
+package xclient
+
+import (
+	"myRPC/registry"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCenterRegistryDiscovery_Cache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	ts := httptest.NewServer(registry.New(time.Minute))
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:1", Zone: "z1"}, time.Minute)
+	d := NewCenterRegistryDiscovery(ts.URL, time.Minute)
+	if err := d.SetCache(path); err != nil {
+		t.Fatal(err)
+	}
+	if servers, err := d.GetAll(); err != nil || len(servers) != 1 {
+		t.Fatalf("servers = %v, err: %v", servers, err)
+	}
+	for i := 0; ; i++ {
+		if servers, _, _ := readServersFile(path); len(servers) == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("servers aren't cached")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	ts.Close()
+
+	// restarted while registry is down
+	d = NewCenterRegistryDiscovery(ts.URL, time.Minute)
+	if err := d.SetCache(path); err != nil {
+		t.Fatal(err)
+	}
+	servers, err := d.GetAll()
+	if err != nil || !reflect.DeepEqual(servers, []string{"tcp@127.0.0.1:1"}) {
+		t.Fatalf("servers = %v, err: %v, expect servers cached", servers, err)
+	}
+	if meta, _ := d.Meta("tcp@127.0.0.1:1"); meta.Zone != "z1" {
+		t.Fatalf("meta = %+v, expect metadata cached", meta)
+	}
+}
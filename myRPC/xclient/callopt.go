@@ -0,0 +1,102 @@
+package xclient
+
+import (
+	"context"
+	"time"
+)
+
+// CallOption changes how XClient makes a single call, overriding options of XClient
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	mode       SelectMode
+	hasMode    bool   // mode is overridden
+	target     string // server called if it's not empty
+	timeout    time.Duration
+	retries    int
+	hasRetries bool          // retries is overridden
+	hedgeDelay time.Duration // the call is hedged after it if it's positive
+	discovery  Discovery     // of the service called, nil if it's the discovery of XClient
+	balanced   *balancedCall // the call picked a server by Balancer of XClient
+}
+
+type callOptionsKey struct{}
+
+// WithTimeout limits how long the call takes along with all its retries
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetries sets the most times the call is retried if it fails, instead of
+// retries of XClient. A Failfast call is retried on other servers like Failover.
+func WithRetries(retries int) CallOption {
+	return func(o *callOptions) {
+		o.retries, o.hasRetries = retries, true
+	}
+}
+
+// WithHedging hedges the call: if no reply arrives within delay, the same call is
+// made to another server as well, the first successful reply is taken and the
+// other call is canceled. It's Failbackup of XClient for this call only, so that
+// calls dominated by a few slow servers are hedged without doubling others.
+func WithHedging(delay time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.hedgeDelay = delay
+	}
+}
+
+// WithSelectMode selects the server of the call by mode instead of the mode of XClient,
+// eg, ConsistentHashSelect for a lookup affine to a cache
+func WithSelectMode(mode SelectMode) CallOption {
+	return func(o *callOptions) {
+		o.mode, o.hasMode = mode, true
+	}
+}
+
+// WithTargetServer makes the call go to the server at rpcAddr, eg, a call for
+// administration of the server. It isn't retried on or backed up by other servers.
+func WithTargetServer(rpcAddr string) CallOption {
+	return func(o *callOptions) {
+		o.target = rpcAddr
+	}
+}
+
+// withCallOptions returns a context carrying opts along with the options ctx carries
+func withCallOptions(ctx context.Context, opts []CallOption) context.Context {
+	o := callOptionsFrom(ctx)
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+// callOptionsFrom returns the options of the call made with ctx
+func callOptionsFrom(ctx context.Context) callOptions {
+	o, _ := ctx.Value(callOptionsKey{}).(callOptions)
+	return o
+}
+
+// failModeOf returns the fail mode and retries of the call made with ctx
+func (xc *XClient) failModeOf(ctx context.Context) (FailMode, int) {
+	o := callOptionsFrom(ctx)
+	if o.hedgeDelay > 0 {
+		return Failbackup, 0
+	}
+	if !o.hasRetries {
+		return xc.failMode, xc.retries
+	}
+	if xc.failMode == Failfast {
+		return Failover, o.retries
+	}
+	return xc.failMode, o.retries
+}
+
+// modeOf returns the select mode of the call made with ctx
+func (xc *XClient) modeOf(ctx context.Context) SelectMode {
+	if o := callOptionsFrom(ctx); o.hasMode {
+		return o.mode
+	}
+	return xc.mode
+}
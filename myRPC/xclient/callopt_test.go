@@ -0,0 +1,100 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestXClient_CallOptions(t *testing.T) {
+	a, b := startServer(t, 0), startServer(t, 0)
+	d := NewMultiServersDiscovery([]string{a, b})
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	ctx := context.Background()
+	var reply int
+	for i := 0; i < 4; i++ {
+		if err := xc.Call(ctx, "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply, WithTargetServer(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	xc.mu.Lock()
+	_, dialedA := xc.clients[a]
+	xc.mu.Unlock()
+	if dialedA {
+		t.Fatal("calls to target server go to another server")
+	}
+
+	// the same hash key goes to the same server though xc selects by round robin
+	ctx = WithHashKey(ctx, "user-1")
+	opt := WithSelectMode(ConsistentHashSelect)
+	first, err := xc.selectServer(withCallOptions(ctx, []CallOption{opt}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if server, _ := xc.selectServer(withCallOptions(ctx, []CallOption{opt})); server != first {
+			t.Fatalf("server = %s, expect %s", server, first)
+		}
+	}
+	if err = xc.Call(ctx, "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply, opt); err != nil || reply != 3 {
+		t.Fatalf("reply = %d, err: %v", reply, err)
+	}
+}
+
+func TestXClient_TargetServerNotFailover(t *testing.T) {
+	alive, dead := startServer(t, 0), deadServer()
+	xc := NewXClient(NewMultiServersDiscovery([]string{alive, dead}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetFailMode(Failover, 3)
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply, WithTargetServer(dead)); err == nil {
+		t.Fatal("call to dead target server fails over to another server")
+	}
+}
+
+func TestXClient_TimeoutAndRetries(t *testing.T) {
+	alive, dead := startServer(t, 0), deadServer()
+	d := NewMultiServersDiscovery([]string{dead, alive})
+	d.index = 0
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetDialCoolDown(0) // the dead server is selected again
+	var reply int
+	args := &Args{Num1: 1, Num2: 2}
+	// the dead server is selected first, and the retry goes to the alive one
+	if err := xc.Call(context.Background(), "Foo.Sum", args, &reply, WithRetries(1)); err != nil || reply != 3 {
+		t.Fatalf("reply = %d, err: %v", reply, err)
+	}
+	d.index = 0
+	if err := xc.Call(context.Background(), "Foo.Sum", args, &reply, WithRetries(0)); err == nil {
+		t.Fatal("call to dead server without retries succeeds")
+	}
+
+	slow := startServer(t, time.Second)
+	xc = NewXClient(NewMultiServersDiscovery([]string{slow}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	start := time.Now()
+	if err := xc.Call(context.Background(), "Foo.Sum", args, &reply, WithTimeout(time.Millisecond*100)); err == nil {
+		t.Fatal("call longer than timeout succeeds")
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("call takes %v with timeout 100ms", elapsed)
+	}
+}
+
+func TestXClient_WithHedging(t *testing.T) {
+	slow, fast := startServer(t, time.Second), startServer(t, 0)
+	d := NewMultiServersDiscovery([]string{slow, fast})
+	d.index = 0
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	start := time.Now()
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply, WithHedging(time.Millisecond*20)); err != nil || reply != 3 {
+		t.Fatalf("expect the reply of the hedged call, but got %d, %v", reply, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("expect the hedged call replies before the slow server, but took %s", elapsed)
+	}
+}
@@ -0,0 +1,68 @@
+package xclient
+
+import (
+	. "myRPC"
+	"sort"
+)
+
+// debugDiscovery is a discovery whose state can be taken without refreshing it,
+// eg, those embedding MultiServersDiscovery
+type debugDiscovery interface {
+	debugState() (servers []string, unhealthy map[string]bool, refreshErr error)
+}
+
+// debugState returns servers known, those failed the latest health check and the
+// latest refresh error
+func (d *MultiServersDiscovery) debugState() ([]string, map[string]bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	unhealthy := make(map[string]bool, len(d.unhealthy))
+	for server := range d.unhealthy {
+		unhealthy[server] = true
+	}
+	return append([]string(nil), d.servers...), unhealthy, d.refreshErr
+}
+
+// DebugState returns servers discovered with their connections, and calls pending
+// on all connections, it's shown on the debug page by Server.AddDebugClient.
+// Discoveries aren't refreshed for it, except those not keeping their state.
+func (xc *XClient) DebugState() ClientState {
+	var state ClientState
+	seen := make(map[string]bool)
+	for _, d := range xc.discoveries() {
+		var servers []string
+		var unhealthy map[string]bool
+		var err error
+		if dd, ok := d.(debugDiscovery); ok {
+			servers, unhealthy, err = dd.debugState()
+		} else {
+			servers, err = d.GetAll()
+		}
+		if err != nil && state.RefreshError == "" {
+			state.RefreshError = err.Error()
+		}
+		for _, server := range servers {
+			if !seen[server] {
+				seen[server] = true
+				state.Servers = append(state.Servers, ServerState{Addr: server, Healthy: !unhealthy[server]})
+			}
+		}
+	}
+	xc.mu.Lock()
+	var clients []*Client
+	for i := range state.Servers {
+		if pool, ok := xc.clients[state.Servers[i].Addr]; ok {
+			state.Servers[i].Connections = len(pool.clients)
+		}
+	}
+	for _, pool := range xc.clients {
+		clients = append(clients, pool.clients...)
+	}
+	xc.mu.Unlock()
+	for _, client := range clients {
+		state.Pending = append(state.Pending, client.PendingCalls()...)
+	}
+	sort.Slice(state.Servers, func(i, j int) bool { return state.Servers[i].Addr < state.Servers[j].Addr })
+	sort.SliceStable(state.Pending, func(i, j int) bool { return state.Pending[i].Age > state.Pending[j].Age })
+	return state
+}
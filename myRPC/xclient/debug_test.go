@@ -0,0 +1,39 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestXClient_DebugState(t *testing.T) {
+	slow, idle := startServer(t, time.Millisecond*300), startServer(t, 0)
+	d := NewMultiServersDiscovery([]string{slow, idle})
+	d.unhealthy = map[string]bool{idle: true}
+	d.refreshErr = errors.New("registry down")
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	done := make(chan error)
+	go func() {
+		var reply int
+		done <- xc.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	}()
+	time.Sleep(time.Millisecond * 100)
+	state := xc.DebugState()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Servers) != 2 || state.RefreshError != "registry down" {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	for _, s := range state.Servers {
+		if s.Addr == slow && (!s.Healthy || s.Connections != 1) || s.Addr == idle && (s.Healthy || s.Connections != 0) {
+			t.Fatalf("unexpected server %+v", s)
+		}
+	}
+	if len(state.Pending) != 1 || state.Pending[0].ServiceMethod != "Foo.Sum" || state.Pending[0].Age <= 0 {
+		t.Fatalf("expect the call pending, but got %+v", state.Pending)
+	}
+}
@@ -0,0 +1,84 @@
+package xclient
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultDialCoolDown is how long a server failing to dial isn't selected by default
+const defaultDialCoolDown = time.Second * 5
+
+// dialFailures keeps servers failed to dial recently, they're not selected until
+// cool-down passes, so calls don't wait for connect timeouts of the same server
+// one after another during partial outages
+type dialFailures struct {
+	mu       sync.Mutex
+	coolDown time.Duration
+	until    map[string]time.Time // servers cooling down until
+}
+
+// SetDialCoolDown stops selecting a server for coolDown after dialing it fails,
+// 5s by default, it's disabled if coolDown is not positive. If all servers are
+// cooling down, they're all selected. It should be called before xc is used.
+func (xc *XClient) SetDialCoolDown(coolDown time.Duration) {
+	xc.dialFailures.mu.Lock()
+	defer xc.dialFailures.mu.Unlock()
+	xc.dialFailures.coolDown = coolDown
+	if coolDown <= 0 {
+		xc.dialFailures.until = nil
+	}
+}
+
+// fail records that dialing server failed
+func (f *dialFailures) fail(server string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.coolDown <= 0 {
+		return
+	}
+	if f.until == nil {
+		f.until = make(map[string]time.Time)
+	}
+	f.until[server] = time.Now().Add(f.coolDown)
+}
+
+// succeed records that server is dialed
+func (f *dialFailures) succeed(server string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.until, server)
+}
+
+// any reports whether any server is cooling down
+func (f *dialFailures) any() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for server, until := range f.until {
+		if now.Before(until) {
+			return true
+		}
+		delete(f.until, server)
+	}
+	return false
+}
+
+// filter returns servers not cooling down, or all servers if there is none
+func (f *dialFailures) filter(servers []string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.until) == 0 {
+		return servers
+	}
+	now := time.Now()
+	allowed := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if until, ok := f.until[server]; !ok || !now.Before(until) {
+			allowed = append(allowed, server)
+		}
+	}
+	if len(allowed) == 0 {
+		return servers
+	}
+	return allowed
+}
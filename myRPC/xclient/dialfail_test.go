@@ -0,0 +1,34 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestXClient_DialCoolDown(t *testing.T) {
+	dead, live := deadServer(), startServer(t, 0)
+	xc := NewXClient(NewMultiServersDiscovery([]string{dead, live}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	metrics := NewMetrics()
+	xc.SetStatsHandler(metrics)
+	var reply int
+	if err := xc.call(dead, context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err == nil {
+		t.Fatal("expect dialing the dead server failed")
+	}
+	for i := 0; i < 20; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal("expect the dead server not selected during cool-down, but got", err)
+		}
+	}
+	if n := metrics.Targets()[dead].Calls; n != 1 {
+		t.Fatalf("the dead server is called %d times, expect 1", n)
+	}
+
+	xc.SetDialCoolDown(time.Millisecond * 10)
+	_ = xc.call(dead, context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	time.Sleep(time.Millisecond * 20)
+	if xc.dialFailures.any() {
+		t.Fatal("expect the dead server selected again after cool-down")
+	}
+}
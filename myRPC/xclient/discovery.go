@@ -2,17 +2,28 @@ package xclient
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"math/rand"
+	. "myRPC"
 	"sync"
 	"time"
 )
 
+// ErrNoAvailableServers is returned when discovery has no server to select,
+// it may be wrapped with the latest error of refreshing servers
+var ErrNoAvailableServers = errors.New("rpc discovery: no available servers")
+
 type SelectMode int
 
 const (
-	RandomSelect     SelectMode = iota // select randomly from existing service
-	RoundRobinSelect                   // select using robin algorithm
+	RandomSelect         SelectMode = iota // select randomly from existing service
+	RoundRobinSelect                       // select using robin algorithm
+	LeastLoadSelect                        // select the less loaded of two random servers by their reported loads
+	ConsistentHashSelect                   // select by hash key of the call on a consistent hash ring, see WithHashKey
+	LeastActiveSelect                      // select the server with the fewest calls in flight from the XClient
+	P2CSelect                              // select the better of two random servers by latency and error rate of recent calls
+	WeightedRandomSelect                   // select randomly in proportion to weights of servers
 )
 
 type Discovery interface {
@@ -22,13 +33,53 @@ type Discovery interface {
 	GetAll() ([]string, error)
 }
 
+// ServerMeta is metadata of a server reported by discovery,
+// eg, the metadata registered to CenterRegistry
+type ServerMeta struct {
+	Weight  int               `json:"weight,omitempty"`  // relative weight for load balancing, 0 means default
+	Zone    string            `json:"zone,omitempty"`    // availability zone the server located in
+	Version string            `json:"version,omitempty"` // build version of the server
+	Codecs  []string          `json:"codecs,omitempty"`  // codec types supported by the server
+	Labels  map[string]string `json:"labels,omitempty"`  // arbitrary metadata, eg, track=canary
+	Load    *ServerLoad       `json:"load,omitempty"`    // load reported by the latest heartbeat of the server
+}
+
+// ServerLoad is the load of a server reported to registry
+type ServerLoad struct {
+	InFlight int     `json:"inflight"`        // requests being handled
+	CPU      float64 `json:"cpu"`             // CPU utilization between 0 and 1
+	Queue    int     `json:"queue,omitempty"` // requests waiting to be handled
+}
+
+// loadScore estimates how long a request waits on the server of meta, lower is better.
+// A server without load reported is scored as idle, it's likely just started.
+func loadScore(meta ServerMeta) float64 {
+	weight := meta.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	if meta.Load == nil {
+		return 1 / float64(weight)
+	}
+	return float64(meta.Load.InFlight+meta.Load.Queue+1) * (1 + meta.Load.CPU) / float64(weight)
+}
+
 // MultiServersDiscovery is a discovery for multi servers without a registry center
 // user provides the server address explicitly instead
 type MultiServersDiscovery struct {
-	r       *rand.Rand   // generate a random number
-	mu      sync.RWMutex // protect following
-	servers []string     // all server instance
-	index   int          // record the selected position for robin algorithm
+	r          *rand.Rand   // generate a random number
+	mu         sync.RWMutex // protect following
+	servers    []string     // all server instance
+	index      int          // record the selected position for robin algorithm
+	meta       map[string]ServerMeta
+	unhealthy  map[string]bool  // servers failed the latest health check
+	listeners  []*listener      // told about changes of servers
+	notify     chan struct{}    // wakes up dispatch of changes, nil if nobody listens
+	weighted   *weightedServers // built of the latest servers for WeightedRandomSelect
+	refreshErr error            // of the latest refresh, nil if it succeeded
+	onRefresh  func(err error)  // told about every refresh, see SetRefreshHook
+	cachePath  string           // file servers are cached in if it's not empty
+	events     EventBus         // publishes RegistryRefreshed
 }
 
 var _ Discovery = &MultiServersDiscovery{}
@@ -42,35 +93,101 @@ func (d *MultiServersDiscovery) Update(servers []string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.servers = servers
+	d.changed()
 	return nil
 }
 
 func (d *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	n := len(d.servers)
+	servers := d.available()
+	n := len(servers)
 	if n == 0 {
-		return "", errors.New("rpc discovery: no available servers")
+		return "", d.noServers()
 	}
 	switch mode {
 	case RandomSelect:
-		return d.servers[d.r.Intn(n)], nil
+		return servers[d.r.Intn(n)], nil
 	case RoundRobinSelect:
-		s := d.servers[d.index%n]
+		s := servers[d.index%n]
 		d.index = (d.index + 1) % n
 		return s, nil
+	case LeastLoadSelect:
+		// loads reported are stale between heartbeats, choosing between two random
+		// servers keeps clients from piling onto the one looked least loaded
+		a, b := servers[d.r.Intn(n)], servers[d.r.Intn(n)]
+		if loadScore(d.meta[b]) < loadScore(d.meta[a]) {
+			return b, nil
+		}
+		return a, nil
+	case WeightedRandomSelect:
+		// weights are built once for each set of servers
+		if d.weighted == nil || !d.weighted.of(servers) {
+			d.weighted = newWeightedServers(servers, func(server string) ServerMeta { return d.meta[server] })
+		}
+		return d.weighted.pick(d.r.Intn), nil
 	default:
 		return "", errors.New("rpc discovery: not supported select mode")
 	}
 }
 
+// LastRefreshError returns the error of the latest refresh of servers, nil if it succeeded,
+// eg, why there is no server
+func (d *MultiServersDiscovery) LastRefreshError() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.refreshErr
+}
+
+// SetRefreshHook sets the hook told about the result of every refresh of servers from
+// a remote source, eg, a registry, including watches. It's called with the lock of
+// discovery held, so it must return quickly and not call the discovery.
+func (d *MultiServersDiscovery) SetRefreshHook(hook func(err error)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onRefresh = hook
+}
+
+// Events returns the bus of events of d, that is RegistryRefreshed, XClients
+// of d publish them as well
+func (d *MultiServersDiscovery) Events() *EventBus {
+	return &d.events
+}
+
+// refreshed records the result of a refresh and publishes it, d.mu must be held
+func (d *MultiServersDiscovery) refreshed(err error) {
+	d.refreshErr = err
+	if d.onRefresh != nil {
+		d.onRefresh(err)
+	}
+	if d.events.Subscribed() {
+		d.events.Publish(RegistryRefreshed{Time: time.Now(), Servers: append([]string(nil), d.servers...), Err: err})
+	}
+}
+
+// noServers returns ErrNoAvailableServers with the latest refresh error, d.mu must be held
+func (d *MultiServersDiscovery) noServers() error {
+	if d.refreshErr != nil {
+		return fmt.Errorf("%w, last refresh err: %v", ErrNoAvailableServers, d.refreshErr)
+	}
+	return ErrNoAvailableServers
+}
+
+// Meta returns metadata of the server at addr if discovery knows it
+func (d *MultiServersDiscovery) Meta(addr string) (ServerMeta, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	meta, ok := d.meta[addr]
+	return meta, ok
+}
+
 func (d *MultiServersDiscovery) GetAll() ([]string, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	n := len(d.servers)
-	servers := make([]string, n)
-	copy(servers, d.servers)
+	available := d.available()
+	servers := make([]string, len(available))
+	copy(servers, available)
 	return servers, nil
 }
 
@@ -0,0 +1,100 @@
+package xclient
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// AggregateDiscovery merges servers of several discoveries, eg, registries in
+// different regions, a server discovered by more than one of them is counted once.
+// If a discovery fails, the servers it discovered last time are kept, so that
+// servers are still discovered while a registry is unreachable.
+type AggregateDiscovery struct {
+	*MultiServersDiscovery
+	discoveries []Discovery
+	refreshMu   sync.Mutex // serializes refreshing and protects known
+	known       [][]string // servers discovered by each discovery last time
+}
+
+var _ Discovery = &AggregateDiscovery{}
+
+// NewAggregateDiscovery returns a discovery of servers of all discoveries,
+// metadata of a server is taken from the first discovery knowing it
+func NewAggregateDiscovery(discoveries ...Discovery) *AggregateDiscovery {
+	return &AggregateDiscovery{
+		MultiServersDiscovery: NewMultiServersDiscovery(make([]string, 0)),
+		discoveries:           discoveries,
+		known:                 make([][]string, len(discoveries)),
+	}
+}
+
+func (d *AggregateDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	d.changed()
+	return nil
+}
+
+// Refresh merges servers of all discoveries, it fails only if all of them fail
+// and none of them has discovered servers before
+func (d *AggregateDiscovery) Refresh() error {
+	d.refreshMu.Lock()
+	defer d.refreshMu.Unlock()
+	var errs []error
+	for i, discovery := range d.discoveries {
+		servers, err := discovery.GetAll()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		d.known[i] = servers
+	}
+	seen := make(map[string]bool)
+	servers := make([]string, 0)
+	meta := make(map[string]ServerMeta)
+	for i, known := range d.known {
+		md, _ := d.discoveries[i].(metaDiscovery)
+		for _, server := range known {
+			if seen[server] {
+				continue
+			}
+			seen[server] = true
+			servers = append(servers, server)
+			if md != nil {
+				if m, ok := md.Meta(server); ok {
+					meta[server] = m
+				}
+			}
+		}
+	}
+	sort.Strings(servers)
+	var err error
+	if len(errs) == len(d.discoveries) && len(servers) == 0 {
+		err = errors.Join(errs...)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refreshed(err)
+	if err == nil && (!reflect.DeepEqual(d.servers, servers) || !reflect.DeepEqual(d.meta, meta)) {
+		d.servers, d.meta = servers, meta
+		d.changed()
+	}
+	return err
+}
+
+func (d *AggregateDiscovery) Get(mode SelectMode) (string, error) {
+	if err := d.Refresh(); err != nil {
+		return "", err
+	}
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+func (d *AggregateDiscovery) GetAll() ([]string, error) {
+	if err := d.Refresh(); err != nil {
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAll()
+}
@@ -0,0 +1,43 @@
+package xclient
+
+import (
+	"myRPC/registry"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregateDiscovery(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:3", Zone: "z2"}, time.Minute)
+	local := NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2"})
+	remote := NewCenterRegistryDiscovery(ts.URL, time.Millisecond)
+	other := NewMultiServersDiscovery([]string{"tcp@127.0.0.1:2"})
+	d := NewAggregateDiscovery(local, other, remote)
+
+	expect := []string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2", "tcp@127.0.0.1:3"}
+	servers, err := d.GetAll()
+	if err != nil || !reflect.DeepEqual(servers, expect) {
+		t.Fatalf("expect servers merged, but got %v, %v", servers, err)
+	}
+	if meta, _ := d.Meta("tcp@127.0.0.1:3"); meta.Zone != "z2" {
+		t.Fatalf("expect metadata from the registry, but got %+v", meta)
+	}
+
+	// servers of the registry are kept while it's unreachable
+	ts.Close()
+	time.Sleep(time.Millisecond * 2)
+	if servers, err = d.GetAll(); err != nil || !reflect.DeepEqual(servers, expect) {
+		t.Fatalf("expect servers kept when a registry is down, but got %v, %v", servers, err)
+	}
+	_ = local.Update([]string{"tcp@127.0.0.1:1"})
+	_ = other.Update([]string{})
+	if servers, _ = d.GetAll(); !reflect.DeepEqual(servers, []string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:3"}) {
+		t.Fatalf("expect the server removed from all discoveries gone, but got %v", servers)
+	}
+
+	if _, err = NewAggregateDiscovery(NewCenterRegistryDiscovery(ts.URL, 0)).GetAll(); err == nil {
+		t.Fatal("expect error when all discoveries fail")
+	}
+}
@@ -1,8 +1,17 @@
 package xclient
 
 import (
-	"log"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"myRPC/internal/rpclog"
+	"myRPC/registry"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -10,12 +19,27 @@ import (
 type CenterRegistryDiscovery struct {
 	*MultiServersDiscovery
 	registryAddr string
+	client       *registry.Client
+	namespace    string // only discover servers of the namespace
+	service      string // only discover servers exposing the service if it's not empty
+	zone         string // only discover servers in the zone if it's not empty
+	labels       map[string]string
+	seeds        []string // servers always discovered, used alone when registry is unavailable
 	timeout      time.Duration
 	lastUpdate   time.Time
+	version      uint64        // version of server set known, 0 if it's unknown
+	stop         chan struct{} // closed to stop refreshing in background, nil if it's not started
+	refreshing   chan struct{} // closed once the refresh in flight is done, nil if there is none
 }
 
-const defaultUpdateTimeout = time.Second * 10
+const (
+	defaultUpdateTimeout      = time.Second * 10
+	defaultWatchRetryInterval = time.Second
+	maxEventSize              = 1 << 24 // max size of an event pushed by registry
+)
 
+// NewCenterRegistryDiscovery returns a discovery of servers registered to registry,
+// registerAddr may list addresses of several registry nodes separated by commas
 func NewCenterRegistryDiscovery(registerAddr string, timeout time.Duration) *CenterRegistryDiscovery {
 	if timeout == 0 {
 		timeout = defaultUpdateTimeout
@@ -23,51 +47,409 @@ func NewCenterRegistryDiscovery(registerAddr string, timeout time.Duration) *Cen
 	d := &CenterRegistryDiscovery{
 		MultiServersDiscovery: NewMultiServersDiscovery(make([]string, 0)),
 		registryAddr:          registerAddr,
+		client:                registry.NewClient(registerAddr),
 		timeout:               timeout,
 	}
 	return d
 }
 
+// NewServiceDiscovery returns a discovery which only fetches servers
+// exposing the named service from registry
+func NewServiceDiscovery(registerAddr, service string, timeout time.Duration) *CenterRegistryDiscovery {
+	d := NewCenterRegistryDiscovery(registerAddr, timeout)
+	d.service = service
+	return d
+}
+
+// NewNamespaceDiscovery is like NewServiceDiscovery, but discovers servers
+// registered to the namespace, like prod or staging, instead of the default one
+func NewNamespaceDiscovery(registerAddr, namespace, service string, timeout time.Duration) *CenterRegistryDiscovery {
+	d := NewServiceDiscovery(registerAddr, service, timeout)
+	d.namespace = namespace
+	return d
+}
+
+// SetFilter makes discovery only fetch servers in zone, if it's not empty,
+// and having all the labels, so that registry doesn't send the whole fleet.
+// It should be called before discovery is used.
+func (d *CenterRegistryDiscovery) SetFilter(zone string, labels map[string]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.zone, d.labels = zone, labels
+	d.lastUpdate, d.version = time.Time{}, 0
+}
+
+// SetTLSConfig sets the TLS config of HTTPS requests to registry,
+// it should be called before discovery is used
+func (d *CenterRegistryDiscovery) SetTLSConfig(config *tls.Config) {
+	d.client.SetTLSConfig(config)
+}
+
+// SetSeeds sets a static list of servers merged with servers from registry,
+// so that discovery degrades to the seeds instead of failing when registry is down
+func (d *CenterRegistryDiscovery) SetSeeds(seeds []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seeds = seeds
+	d.mergeSeeds()
+}
+
+// mergeSeeds adds seeds missing from servers after they're changed, d.mu must be held
+func (d *CenterRegistryDiscovery) mergeSeeds() {
+	d.changed()
+	if len(d.seeds) == 0 {
+		return
+	}
+	found := make(map[string]bool, len(d.servers))
+	for _, addr := range d.servers {
+		found[addr] = true
+	}
+	for _, addr := range d.seeds {
+		if !found[addr] {
+			found[addr] = true
+			d.servers = append(d.servers, addr)
+		}
+	}
+}
+
 func (d *CenterRegistryDiscovery) Update(servers []string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.servers = servers
+	d.mergeSeeds()
 	d.lastUpdate = time.Now()
+	// servers set by hand can't be updated by changes of registry
+	d.version = 0
 	return nil
 }
 
+// Refresh fetches servers from registry if they're older than the timeout of d, within
+// the timeout. Callers meanwhile wait for the refresh in flight instead of fetching again.
 func (d *CenterRegistryDiscovery) Refresh() error {
 	d.mu.Lock()
-	defer d.mu.Unlock()
 	if d.lastUpdate.Add(d.timeout).After(time.Now()) {
+		d.mu.Unlock()
 		return nil
 	}
-	log.Println("rpc registry: refresh servers from registry", d.registryAddr)
-	resp, err := http.Get(d.registryAddr)
+	if refreshing := d.refreshing; refreshing != nil {
+		d.mu.Unlock()
+		<-refreshing
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		return d.refreshErr
+	}
+	refreshing := make(chan struct{})
+	d.refreshing = refreshing
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.refreshing = nil
+		d.mu.Unlock()
+		close(refreshing)
+	}()
+	rpclog.Debug("rpc discovery: refresh from registry", "registry", d.registryAddr)
+	return d.refreshNow()
+}
+
+// applyList applies servers or changes fetched, d.mu must be held
+func (d *CenterRegistryDiscovery) applyList(list *registryList) {
+	if list.changes {
+		d.applyUpdate(&registryUpdate{Version: list.Version, Added: list.Added, Removed: list.Removed, Loads: list.Loads})
+	} else {
+		d.apply(list)
+	}
+}
+
+// Watch long-polls registry for changes of servers until ctx is done,
+// so that discovery learns about added or removed servers immediately.
+// It's typically invoked in a go statement.
+func (d *CenterRegistryDiscovery) Watch(ctx context.Context) {
+	var version uint64
+	for ctx.Err() == nil {
+		query := url.Values{"since": {strconv.FormatUint(version, 10)}}
+		list, err := d.fetch(ctx, "/watch", query)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			rpclog.Warn("rpc discovery: watch registry", "registry", d.registryAddr, "err", err)
+			select {
+			case <-time.After(defaultWatchRetryInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		version = list.Version
+		if list.Servers != nil {
+			d.mu.Lock()
+			d.apply(list)
+			d.mu.Unlock()
+		}
+	}
+}
+
+// registryList is the list of servers returned by registry
+type registryList struct {
+	Version uint64                 `json:"version"`
+	Servers []registryServer       `json:"servers"` // nil if the server set isn't modified or changes are returned
+	Added   []registryServer       `json:"added"`
+	Removed []string               `json:"removed"`
+	Loads   map[string]*ServerLoad `json:"loads"`
+	changes bool                   // whether only changes since the version asked are returned
+}
+
+// registryServer is a server in the JSON body returned by registry
+type registryServer struct {
+	Addr string `json:"addr"`
+	ServerMeta
+}
+
+// fetch gets servers from registry, path is appended to the path of registry address
+func (d *CenterRegistryDiscovery) fetch(ctx context.Context, path string, query url.Values) (*registryList, error) {
+	resp, err := d.client.Do(ctx, "GET", path, d.query(query), http.Header{"Accept": {"application/json"}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	version, _ := strconv.ParseUint(resp.Header.Get("X-Myrpc-Registry-Version"), 10, 64)
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return &registryList{Version: version}, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	case !strings.Contains(resp.Header.Get("Content-Type"), "application/json"):
+		// registry of old version only responds in headers
+		return readServersHeader(resp.Header), nil
+	}
+	list := &registryList{Version: version, changes: resp.Header.Get("X-Myrpc-Registry-Since") != ""}
+	if err = json.NewDecoder(resp.Body).Decode(list); err != nil {
+		return nil, err
+	}
+	if list.Servers == nil && !list.changes {
+		list.Servers = make([]registryServer, 0)
+	}
+	return list, nil
+}
+
+// query returns query appended namespace and service to discover
+func (d *CenterRegistryDiscovery) query(query url.Values) url.Values {
+	q := make(url.Values, len(query)+2)
+	for k, v := range query {
+		q[k] = v
+	}
+	if d.namespace != "" {
+		q.Set("namespace", d.namespace)
+	}
+	if d.service != "" {
+		q.Set("service", d.service)
+	}
+	if d.zone != "" {
+		q.Set("zone", d.zone)
+	}
+	for k, v := range d.labels {
+		q.Add("label", k+"="+v)
+	}
+	return q
+}
+
+// Stream subscribes to the server list pushed by registry as Server-Sent Events
+// until ctx is done, it's an alternative to Watch without polling.
+// It's typically invoked in a go statement.
+func (d *CenterRegistryDiscovery) Stream(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := d.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		rpclog.Warn("rpc discovery: stream from registry", "registry", d.registryAddr, "err", err)
+		select {
+		case <-time.After(defaultWatchRetryInterval):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// registryUpdate is the data of an "update" event pushed by registry
+type registryUpdate struct {
+	Version uint64                 `json:"version"`
+	Added   []registryServer       `json:"added"`
+	Removed []string               `json:"removed"`
+	Loads   map[string]*ServerLoad `json:"loads"` // latest loads of servers not changed
+}
+
+func (d *CenterRegistryDiscovery) stream(ctx context.Context) error {
+	resp, err := d.client.Do(ctx, "GET", "/stream", d.query(nil), http.Header{"Accept": {"text/event-stream"}}, nil)
 	if err != nil {
-		log.Println("rpc registry refresh err:", err)
 		return err
 	}
-	servers := strings.Split(resp.Header.Get("X-Myrpc-Servers"), ",")
-	d.servers = make([]string, 0, len(servers))
-	for _, server := range servers {
-		if strings.TrimSpace(server) != "" {
-			d.servers = append(d.servers, strings.TrimSpace(server))
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var event, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, maxEventSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(line[len("event:"):])
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(line[len("data:"):])
+		case line == "":
+			// a blank line dispatches the event
+			if err = d.applyEvent(event, data); err != nil {
+				return err
+			}
+			event, data = "", ""
+		}
+	}
+	if err = scanner.Err(); err == nil {
+		err = io.EOF
+	}
+	return err
+}
+
+func (d *CenterRegistryDiscovery) applyEvent(event, data string) error {
+	switch event {
+	case "servers":
+		var list registryList
+		if err := json.Unmarshal([]byte(data), &list); err != nil {
+			return err
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.apply(&list)
+	case "update":
+		var update registryUpdate
+		if err := json.Unmarshal([]byte(data), &update); err != nil {
+			return err
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.applyUpdate(&update)
+	}
+	return nil
+}
+
+// applyUpdate adds and removes servers changed, d.mu must be held
+func (d *CenterRegistryDiscovery) applyUpdate(update *registryUpdate) {
+	if d.meta == nil {
+		d.meta = make(map[string]ServerMeta)
+	}
+	changed := make(map[string]bool, len(update.Removed)+len(update.Added))
+	for _, addr := range update.Removed {
+		changed[addr] = true
+		delete(d.meta, addr)
+	}
+	for _, server := range update.Added {
+		changed[server.Addr] = true
+	}
+	servers := make([]string, 0, len(d.servers)+len(update.Added))
+	for _, addr := range d.servers {
+		if !changed[addr] {
+			servers = append(servers, addr)
+		}
+	}
+	for _, server := range update.Added {
+		servers = append(servers, server.Addr)
+		d.meta[server.Addr] = server.ServerMeta
+	}
+	for addr, load := range update.Loads {
+		if meta, ok := d.meta[addr]; ok {
+			meta.Load = load
+			d.meta[addr] = meta
+		}
+	}
+	d.servers = servers
+	d.mergeSeeds()
+	d.version = update.Version
+	d.lastUpdate = time.Now()
+}
+
+// apply updates servers and their metadata, d.mu must be held
+func (d *CenterRegistryDiscovery) apply(list *registryList) {
+	d.version = list.Version
+	d.servers = make([]string, 0, len(list.Servers))
+	d.meta = make(map[string]ServerMeta, len(list.Servers))
+	for _, server := range list.Servers {
+		d.servers = append(d.servers, server.Addr)
+		d.meta[server.Addr] = server.ServerMeta
+	}
+	d.mergeSeeds()
+	d.lastUpdate = time.Now()
+}
+
+// readServersHeader reads servers from X-Myrpc-Servers and X-Myrpc-Server-Meta headers
+func readServersHeader(h http.Header) *registryList {
+	metas := parseServerMeta(h.Values("X-Myrpc-Server-Meta"))
+	list := &registryList{Servers: make([]registryServer, 0)}
+	for _, server := range strings.Split(h.Get("X-Myrpc-Servers"), ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			list.Servers = append(list.Servers, registryServer{Addr: server, ServerMeta: metas[server]})
+		}
+	}
+	return list
+}
+
+// parseServerMeta parses metadata of servers sent by registry,
+// each value is encoded as URL query, eg, addr=tcp%40127.0.0.1%3A9999&weight=2
+func parseServerMeta(values []string) map[string]ServerMeta {
+	metas := make(map[string]ServerMeta, len(values))
+	for _, value := range values {
+		v, err := url.ParseQuery(value)
+		if err != nil || v.Get("addr") == "" {
+			continue
+		}
+		meta := ServerMeta{Zone: v.Get("zone"), Version: v.Get("version")}
+		meta.Weight, _ = strconv.Atoi(v.Get("weight"))
+		if codecs := v.Get("codecs"); codecs != "" {
+			meta.Codecs = strings.Split(codecs, ",")
+		}
+		if v.Has("inflight") {
+			meta.Load = new(ServerLoad)
+			meta.Load.InFlight, _ = strconv.Atoi(v.Get("inflight"))
+			meta.Load.CPU, _ = strconv.ParseFloat(v.Get("cpu"), 64)
+			meta.Load.Queue, _ = strconv.Atoi(v.Get("queue"))
 		}
+		for _, label := range v["label"] {
+			if meta.Labels == nil {
+				meta.Labels = make(map[string]string)
+			}
+			k, value, _ := strings.Cut(label, "=")
+			meta.Labels[k] = value
+		}
+		metas[v.Get("addr")] = meta
+	}
+	return metas
+}
+
+// refresh is like Refresh, but the error is ignored if there are seeds or servers cached
+// to fall back to, then servers known before registry became unavailable are kept
+func (d *CenterRegistryDiscovery) refresh() error {
+	err := d.Refresh()
+	if err == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.seeds) == 0 && (d.cachePath == "" || len(d.servers) == 0) {
+		return err
 	}
+	// don't block every call on registry down, try it again after timeout
 	d.lastUpdate = time.Now()
 	return nil
 }
 
 func (d *CenterRegistryDiscovery) Get(mode SelectMode) (string, error) {
-	if err := d.Refresh(); err != nil {
+	if err := d.refresh(); err != nil {
 		return "", err
 	}
 	return d.MultiServersDiscovery.Get(mode)
 }
 
 func (d *CenterRegistryDiscovery) GetAll() ([]string, error) {
-	if err := d.Refresh(); err != nil {
+	if err := d.refresh(); err != nil {
 		return nil, err
 	}
 	return d.MultiServersDiscovery.GetAll()
@@ -0,0 +1,80 @@
+package xclient
+
+import (
+	"context"
+	"math/rand"
+	"myRPC/internal/rpclog"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// refreshJitter is the most fraction of interval a background refresh is moved by,
+// so that clients started together don't refresh at the same moment
+const refreshJitter = 0.1
+
+// Start refreshes servers from registry every interval in background, so that
+// calls don't wait for registry after servers get stale. Servers are still
+// refreshed on Get if they're older than the timeout of d. Stop stops it.
+func (d *CenterRegistryDiscovery) Start(interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		return
+	}
+	d.stop = make(chan struct{})
+	go d.refreshEvery(interval, d.stop)
+}
+
+// Stop stops refreshing servers in background started by Start
+func (d *CenterRegistryDiscovery) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+}
+
+func (d *CenterRegistryDiscovery) refreshEvery(interval time.Duration, stop chan struct{}) {
+	for {
+		jitter := time.Duration((rand.Float64()*2 - 1) * refreshJitter * float64(interval))
+		t := time.NewTimer(interval + jitter)
+		select {
+		case <-t.C:
+		case <-stop:
+			t.Stop()
+			return
+		}
+		_ = d.refreshNow()
+	}
+}
+
+// refreshNow fetches servers within the timeout of d without holding d.mu, so that
+// Get isn't blocked by registry meanwhile
+func (d *CenterRegistryDiscovery) refreshNow() error {
+	d.mu.Lock()
+	version := d.version
+	d.mu.Unlock()
+	var query url.Values
+	if version > 0 {
+		// only fetch changes since the version known
+		query = url.Values{"since": {strconv.FormatUint(version, 10)}}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	list, err := d.fetch(ctx, "", query)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refreshed(err)
+	if err != nil {
+		rpclog.Warn("rpc discovery: refresh from registry", "registry", d.registryAddr, "err", err)
+		return err
+	}
+	if d.version != version {
+		// servers are updated meanwhile, eg, by Watch, they're as fresh
+		return nil
+	}
+	d.applyList(list)
+	return nil
+}
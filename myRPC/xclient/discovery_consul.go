@@ -0,0 +1,230 @@
+package xclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"myRPC/internal/rpclog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultConsulWait is how long a blocking query of Consul waits for changes
+const defaultConsulWait = time.Minute * 5
+
+// ConsulDiscovery is a discovery of instances of a service registered to Consul,
+// only instances passing all their health checks are discovered. Servers are kept
+// current by blocking queries of Consul rather than polling. The protocol of an
+// instance is its "protocol" metadata, tcp by default, its zone and version are
+// the "zone" and "version" metadata, and its weight is the passing weight.
+// It talks to the HTTP API of Consul, so no Consul client library is needed.
+type ConsulDiscovery struct {
+	*MultiServersDiscovery
+	addr    string // eg, http://127.0.0.1:8500
+	service string
+	timeout time.Duration
+	client  *http.Client
+	fetchMu sync.Mutex // serializes fetching servers
+	index   uint64     // Consul index of servers known, 0 if they're unknown
+}
+
+var _ Discovery = &ConsulDiscovery{}
+
+// NewConsulDiscovery returns a discovery of instances of service registered to the
+// Consul agent at addr. Watch should be started to keep servers current, eg, go d.Watch(ctx).
+func NewConsulDiscovery(addr, service string, timeout time.Duration) *ConsulDiscovery {
+	if timeout == 0 {
+		timeout = defaultUpdateTimeout
+	}
+	return &ConsulDiscovery{
+		MultiServersDiscovery: NewMultiServersDiscovery(make([]string, 0)),
+		addr:                  strings.TrimSuffix(addr, "/"),
+		service:               service,
+		timeout:               timeout,
+		client:                &http.Client{},
+	}
+}
+
+func (d *ConsulDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	d.changed()
+	return nil
+}
+
+// Refresh fetches servers from Consul if they're unknown, watch keeps them current then
+func (d *ConsulDiscovery) Refresh() error {
+	d.mu.Lock()
+	known := d.index != 0
+	d.mu.Unlock()
+	if known {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	err := d.fetch(ctx, 0, 0)
+	d.mu.Lock()
+	d.refreshed(err)
+	d.mu.Unlock()
+	return err
+}
+
+// Watch keeps servers current by blocking queries of Consul until ctx is done,
+// each query returns once servers change or the wait of Consul passes.
+// It's typically invoked in a go statement.
+func (d *ConsulDiscovery) Watch(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := d.Refresh()
+		if err == nil {
+			d.mu.Lock()
+			index := d.index
+			d.mu.Unlock()
+			// the query waits a little longer than Consul, which adds up to wait/16 of jitter
+			queryCtx, cancel := context.WithTimeout(ctx, defaultConsulWait+defaultConsulWait/16+d.timeout)
+			err = d.fetch(queryCtx, index, defaultConsulWait)
+			cancel()
+			if err == nil {
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		rpclog.Warn("rpc discovery: consul watch", "err", err)
+		d.mu.Lock()
+		d.refreshed(err)
+		d.mu.Unlock()
+		select {
+		case <-time.After(defaultWatchRetryInterval):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// consulEntry is an instance of a service in the health API of Consul
+type consulEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		ID      string
+		Address string
+		Port    int
+		Tags    []string
+		Meta    map[string]string
+		Weights struct {
+			Passing int
+		}
+	}
+	Checks []struct {
+		Status string
+	}
+}
+
+// fetch gets instances passing health checks, it blocks until the Consul index
+// passes index for up to wait if index is not 0
+func (d *ConsulDiscovery) fetch(ctx context.Context, index uint64, wait time.Duration) error {
+	d.fetchMu.Lock()
+	defer d.fetchMu.Unlock()
+	query := url.Values{"passing": {"true"}}
+	if index != 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", wait.String())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		d.addr+"/v1/health/service/"+url.PathEscape(d.service)+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc discovery: consul %s responds %s", d.addr, resp.Status)
+	}
+	var entries []consulEntry
+	if err = json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return err
+	}
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refreshed(nil)
+	if index != 0 && newIndex == index {
+		// the wait passed without changes
+		return nil
+	}
+	if newIndex < index {
+		// the index went backwards, eg, Consul is restored, start over as Consul suggests
+		newIndex = 0
+	}
+	d.index = max(newIndex, 1)
+	d.applyEntries(entries)
+	return nil
+}
+
+// applyEntries sets servers of instances passing all health checks, d.mu must be held
+func (d *ConsulDiscovery) applyEntries(entries []consulEntry) {
+	servers := make([]string, 0, len(entries))
+	meta := make(map[string]ServerMeta, len(entries))
+	for _, e := range entries {
+		if !e.passing() {
+			continue
+		}
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		protocol := e.Service.Meta["protocol"]
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		addr := protocol + "@" + net.JoinHostPort(host, strconv.Itoa(e.Service.Port))
+		if _, ok := meta[addr]; !ok {
+			servers = append(servers, addr)
+		}
+		meta[addr] = ServerMeta{
+			Weight:  e.Service.Weights.Passing,
+			Zone:    e.Service.Meta["zone"],
+			Version: e.Service.Meta["version"],
+			Labels:  e.Service.Meta,
+		}
+	}
+	sort.Strings(servers)
+	d.servers, d.meta = servers, meta
+	d.changed()
+}
+
+// passing reports whether all health checks of the instance pass, Consul filters
+// others out already, but an old agent may not
+func (e *consulEntry) passing() bool {
+	for _, check := range e.Checks {
+		if check.Status != "passing" {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *ConsulDiscovery) Get(mode SelectMode) (string, error) {
+	if err := d.Refresh(); err != nil {
+		return "", err
+	}
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+func (d *ConsulDiscovery) GetAll() ([]string, error) {
+	if err := d.Refresh(); err != nil {
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAll()
+}
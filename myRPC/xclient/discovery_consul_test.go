@@ -0,0 +1,87 @@
+package xclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul serves the health API of Consul, a blocking query waits for set
+type fakeConsul struct {
+	mu      sync.Mutex
+	index   int
+	entries string
+	changed chan struct{}
+}
+
+func (c *fakeConsul) set(entries string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.index++
+	c.entries = entries
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/v1/health/service/Foo" || req.URL.Query().Get("passing") != "true" {
+		http.NotFound(w, req)
+		return
+	}
+	c.mu.Lock()
+	changed := c.changed
+	blocked := req.URL.Query().Get("index") == strconv.Itoa(c.index)
+	c.mu.Unlock()
+	if blocked {
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.Itoa(c.index))
+	_, _ = w.Write([]byte(c.entries))
+}
+
+func TestConsulDiscovery(t *testing.T) {
+	consul := &fakeConsul{changed: make(chan struct{})}
+	consul.set(`[
+		{"Node": {"Address": "10.0.0.1"}, "Service": {"Port": 9999, "Meta": {"zone": "z1"}, "Weights": {"Passing": 2}},
+		 "Checks": [{"Status": "passing"}]},
+		{"Node": {"Address": "10.0.0.9"}, "Service": {"Address": "10.0.0.2", "Port": 9999, "Meta": {"protocol": "http"}}},
+		{"Node": {"Address": "10.0.0.3"}, "Service": {"Port": 9999}, "Checks": [{"Status": "critical"}]}
+	]`)
+	ts := httptest.NewServer(consul)
+	defer ts.Close()
+
+	d := NewConsulDiscovery(ts.URL, "Foo", 0)
+	servers, err := d.GetAll()
+	if err != nil || !reflect.DeepEqual(servers, []string{"http@10.0.0.2:9999", "tcp@10.0.0.1:9999"}) {
+		t.Fatalf("expect instances passing health checks, but got %v, %v", servers, err)
+	}
+	if meta, _ := d.Meta("tcp@10.0.0.1:9999"); meta.Zone != "z1" || meta.Weight != 2 {
+		t.Fatalf("expect metadata of the instance, but got %+v", meta)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Watch(ctx)
+	time.Sleep(time.Millisecond * 20) // the blocking query is waiting
+	consul.set(`[{"Node": {"Address": "10.0.0.4"}, "Service": {"Port": 9999}}]`)
+	for i := 0; ; i++ {
+		if servers, _ = d.GetAll(); reflect.DeepEqual(servers, []string{"tcp@10.0.0.4:9999"}) {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("expect the blocking query learns the change, but got %v", servers)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
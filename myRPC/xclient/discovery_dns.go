@@ -0,0 +1,145 @@
+package xclient
+
+import (
+	"context"
+	"myRPC/internal/rpclog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDNSRefreshInterval = time.Second * 30
+	dnsLookupTimeout          = time.Second * 5
+)
+
+// DNSDiscovery is a discovery of servers resolved from DNS, eg, a Kubernetes
+// headless service or DNS round-robin, without running CenterRegistry
+type DNSDiscovery struct {
+	*MultiServersDiscovery
+	name       string
+	port       int
+	interval   time.Duration
+	lastUpdate time.Time
+	// Resolver resolves name, net.DefaultResolver is used if it's nil
+	Resolver *net.Resolver
+	// Protocol of servers resolved, "tcp" by default
+	Protocol string
+}
+
+var _ Discovery = &DNSDiscovery{}
+
+// NewDNSDiscovery returns a discovery resolving name every refreshInterval.
+// If name is an SRV name like _myrpc._tcp.example.com, servers are the targets
+// of its SRV records with their ports and weights, port is ignored then.
+// Otherwise servers are the addresses of A and AAAA records of name at port.
+func NewDNSDiscovery(name string, port int, refreshInterval time.Duration) *DNSDiscovery {
+	if refreshInterval == 0 {
+		refreshInterval = defaultDNSRefreshInterval
+	}
+	return &DNSDiscovery{
+		MultiServersDiscovery: NewMultiServersDiscovery(make([]string, 0)),
+		name:                  name,
+		port:                  port,
+		interval:              refreshInterval,
+	}
+}
+
+func (d *DNSDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	d.changed()
+	d.lastUpdate = time.Now()
+	return nil
+}
+
+// Refresh resolves name again if servers resolved are older than refresh interval,
+// servers are kept if it fails
+func (d *DNSDiscovery) Refresh() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lastUpdate.Add(d.interval).After(time.Now()) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+	servers, meta, err := d.resolve(ctx)
+	d.refreshed(err)
+	if err != nil {
+		rpclog.Warn("rpc discovery: resolve", "name", d.name, "err", err)
+		return err
+	}
+	d.servers, d.meta = servers, meta
+	d.changed()
+	d.lastUpdate = time.Now()
+	return nil
+}
+
+// resolve looks up servers of name and their metadata
+func (d *DNSDiscovery) resolve(ctx context.Context) ([]string, map[string]ServerMeta, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	protocol := d.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	var servers []string
+	meta := make(map[string]ServerMeta)
+	if strings.HasPrefix(d.name, "_") {
+		_, records, err := resolver.LookupSRV(ctx, "", "", d.name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, srv := range records {
+			addr := protocol + "@" + net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+			servers = append(servers, addr)
+			meta[addr] = ServerMeta{Weight: int(srv.Weight)}
+		}
+	} else {
+		hosts, err := resolver.LookupHost(ctx, d.name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, host := range hosts {
+			servers = append(servers, protocol+"@"+net.JoinHostPort(host, strconv.Itoa(d.port)))
+		}
+	}
+	sort.Strings(servers)
+	return servers, meta, nil
+}
+
+// refresh is like Refresh, but the error is ignored if servers were resolved before,
+// stale servers are better than none when DNS fails for a moment
+func (d *DNSDiscovery) refresh() error {
+	err := d.Refresh()
+	if err == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.servers) == 0 {
+		return err
+	}
+	// try again after refresh interval instead of every call
+	d.lastUpdate = time.Now()
+	return nil
+}
+
+func (d *DNSDiscovery) Get(mode SelectMode) (string, error) {
+	if err := d.refresh(); err != nil {
+		return "", err
+	}
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+func (d *DNSDiscovery) GetAll() ([]string, error) {
+	if err := d.refresh(); err != nil {
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAll()
+}
@@ -0,0 +1,49 @@
+package xclient
+
+import (
+	"context"
+	"myRPC/registry"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDNSDiscovery(t *testing.T) {
+	r := registry.New(time.Minute)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	defer func() { _ = conn.Close() }()
+	go func() { _ = r.ServeDNS(conn, "") }()
+	resolver := &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return net.Dial("udp", conn.LocalAddr().String())
+	}}
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	for _, item := range []*registry.ServerItem{
+		{Addr: "tcp@10.0.0.1:9999", Services: []string{"Foo"}, Weight: 2},
+		{Addr: "tcp@10.0.0.2:9998", Services: []string{"Foo"}},
+	} {
+		if _, err = registry.NewClient(ts.URL).Register(context.Background(), item); err != nil {
+			t.Fatal("failed to register:", err)
+		}
+	}
+
+	d := NewDNSDiscovery("_foo._tcp.myrpc.local", 0, time.Minute)
+	d.Resolver = resolver
+	servers, err := d.GetAll()
+	if err != nil || len(servers) != 2 || servers[0] != "tcp@10-0-0-1.myrpc.local:9999" {
+		t.Fatalf("expect servers of SRV records, but got %v, %v", servers, err)
+	}
+	if meta, _ := d.Meta(servers[0]); meta.Weight != 2 {
+		t.Fatalf("expect weight of SRV record, but got %+v", meta)
+	}
+
+	d = NewDNSDiscovery("10-0-0-2.myrpc.local", 7001, time.Minute)
+	d.Resolver = resolver
+	if servers, err = d.GetAll(); err != nil || len(servers) != 1 || servers[0] != "tcp@10.0.0.2:7001" {
+		t.Fatalf("expect servers of A records, but got %v, %v", servers, err)
+	}
+}
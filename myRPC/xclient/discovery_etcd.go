@@ -0,0 +1,301 @@
+package xclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myRPC/internal/rpclog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EtcdDiscovery is a discovery of servers kept in etcd under a key prefix,
+// the value of a key is a server registered like {"addr": "tcp@10.0.0.1:9999", "weight": 2},
+// or just its address. Servers are kept current by an etcd watch rather than polling.
+// It talks to the JSON gateway of etcd v3, so no etcd client library is needed.
+type EtcdDiscovery struct {
+	*MultiServersDiscovery
+	endpoints []string // eg, http://127.0.0.1:2379
+	prefix    string
+	timeout   time.Duration
+	client    *http.Client
+	watchMu   sync.Mutex                // serializes fetching servers
+	revision  int64                     // etcd revision of servers known, 0 if they're unknown
+	keys      map[string]registryServer // servers by etcd key
+}
+
+var _ Discovery = &EtcdDiscovery{}
+
+// NewEtcdDiscovery returns a discovery of servers under prefix in etcd, endpoints are
+// tried in order. Watch should be started to keep servers current, eg, go d.Watch(ctx).
+func NewEtcdDiscovery(endpoints []string, prefix string, timeout time.Duration) *EtcdDiscovery {
+	if timeout == 0 {
+		timeout = defaultUpdateTimeout
+	}
+	return &EtcdDiscovery{
+		MultiServersDiscovery: NewMultiServersDiscovery(make([]string, 0)),
+		endpoints:             endpoints,
+		prefix:                prefix,
+		timeout:               timeout,
+		client:                &http.Client{},
+		keys:                  make(map[string]registryServer),
+	}
+}
+
+func (d *EtcdDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	d.changed()
+	return nil
+}
+
+// Refresh fetches servers from etcd if they're unknown, watch keeps them current then
+func (d *EtcdDiscovery) Refresh() error {
+	d.mu.Lock()
+	known := d.revision != 0
+	d.mu.Unlock()
+	if known {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	err := d.fetch(ctx)
+	d.mu.Lock()
+	d.refreshed(err)
+	d.mu.Unlock()
+	return err
+}
+
+// Watch keeps servers current by watching the prefix in etcd until ctx is done,
+// it reconnects if the watch breaks, and fetches all servers again if the
+// revision watched has been compacted. It's typically invoked in a go statement.
+func (d *EtcdDiscovery) Watch(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := d.Refresh()
+		if err == nil {
+			err = d.watch(ctx)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		rpclog.Warn("rpc discovery: etcd watch", "err", err)
+		d.mu.Lock()
+		d.refreshed(err)
+		d.mu.Unlock()
+		select {
+		case <-time.After(defaultWatchRetryInterval):
+		case <-ctx.Done():
+		}
+	}
+}
+
+type etcdKV struct {
+	Key   []byte `json:"key"` // []byte is base64 in JSON like etcd gateway
+	Value []byte `json:"value"`
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type etcdRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader `json:"header"`
+	Kvs    []etcdKV   `json:"kvs"`
+}
+
+type etcdWatchRequest struct {
+	CreateRequest struct {
+		etcdRangeRequest
+		StartRevision int64 `json:"start_revision,string"`
+	} `json:"create_request"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Header          etcdHeader `json:"header"`
+		Canceled        bool       `json:"canceled"`
+		CancelReason    string     `json:"cancel_reason"`
+		CompactRevision int64      `json:"compact_revision,string"`
+		Events          []struct {
+			Type string `json:"type"` // empty for PUT
+			Kv   etcdKV `json:"kv"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// fetch gets all servers under prefix
+func (d *EtcdDiscovery) fetch(ctx context.Context) error {
+	d.watchMu.Lock()
+	defer d.watchMu.Unlock()
+	resp, err := d.post(ctx, "/v3/kv/range", &etcdRangeRequest{Key: []byte(d.prefix), RangeEnd: prefixEnd(d.prefix)})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var r etcdRangeResponse
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	keys := make(map[string]registryServer, len(r.Kvs))
+	for _, kv := range r.Kvs {
+		if server, ok := d.parseServer(kv); ok {
+			keys[string(kv.Key)] = server
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys = keys
+	d.revision = max(r.Header.Revision, 1)
+	d.applyKeys()
+	return nil
+}
+
+// watch applies changes under prefix since the revision known until the watch breaks
+func (d *EtcdDiscovery) watch(ctx context.Context) error {
+	req := &etcdWatchRequest{}
+	req.CreateRequest.Key, req.CreateRequest.RangeEnd = []byte(d.prefix), prefixEnd(d.prefix)
+	d.mu.Lock()
+	req.CreateRequest.StartRevision = d.revision + 1
+	d.mu.Unlock()
+	resp, err := d.post(ctx, "/v3/watch", req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var w etcdWatchResponse
+		if err = dec.Decode(&w); err != nil {
+			return err
+		}
+		if w.Error != nil {
+			return errors.New("rpc discovery: etcd watch: " + w.Error.Message)
+		}
+		if w.Result.CompactRevision > 0 || w.Result.Canceled {
+			// changes are lost, fetch all servers again
+			d.mu.Lock()
+			d.revision = 0
+			d.mu.Unlock()
+			return fmt.Errorf("rpc discovery: etcd watch canceled, compacted at %d: %s",
+				w.Result.CompactRevision, w.Result.CancelReason)
+		}
+		d.mu.Lock()
+		for _, e := range w.Result.Events {
+			if e.Type == "DELETE" {
+				delete(d.keys, string(e.Kv.Key))
+			} else if server, ok := d.parseServer(e.Kv); ok {
+				d.keys[string(e.Kv.Key)] = server
+			}
+		}
+		d.revision = max(d.revision, w.Result.Header.Revision)
+		d.refreshed(nil)
+		if len(w.Result.Events) > 0 {
+			d.applyKeys()
+		}
+		d.mu.Unlock()
+	}
+}
+
+// post sends req as JSON to the first etcd endpoint which responds
+func (d *EtcdDiscovery) post(ctx context.Context, path string, req interface{}) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	err = errors.New("rpc discovery: no etcd endpoint")
+	for _, endpoint := range d.endpoints {
+		var httpReq *http.Request
+		httpReq, err = http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		var resp *http.Response
+		resp, err = d.client.Do(httpReq)
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			err = fmt.Errorf("rpc discovery: etcd %s responds %s", endpoint, resp.Status)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, err
+}
+
+// parseServer parses the server kept by kv, the address is the key without
+// prefix if the value is empty
+func (d *EtcdDiscovery) parseServer(kv etcdKV) (registryServer, bool) {
+	var server registryServer
+	value := bytes.TrimSpace(kv.Value)
+	switch {
+	case len(value) == 0:
+		server.Addr = strings.TrimPrefix(string(kv.Key), d.prefix)
+	case value[0] == '{':
+		if err := json.Unmarshal(value, &server); err != nil {
+			rpclog.Warn("rpc discovery: invalid server in etcd", "key", string(kv.Key), "err", err)
+			return server, false
+		}
+	default:
+		server.Addr = string(value)
+	}
+	return server, server.Addr != ""
+}
+
+// applyKeys sets servers kept by keys, d.mu must be held
+func (d *EtcdDiscovery) applyKeys() {
+	servers := make([]string, 0, len(d.keys))
+	meta := make(map[string]ServerMeta, len(d.keys))
+	for _, server := range d.keys {
+		if _, ok := meta[server.Addr]; !ok {
+			servers = append(servers, server.Addr)
+		}
+		meta[server.Addr] = server.ServerMeta
+	}
+	sort.Strings(servers)
+	d.servers, d.meta = servers, meta
+	d.changed()
+}
+
+// prefixEnd is the range end covering all keys with prefix
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// every key after prefix
+	return []byte{0}
+}
+
+func (d *EtcdDiscovery) Get(mode SelectMode) (string, error) {
+	if err := d.Refresh(); err != nil {
+		return "", err
+	}
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+func (d *EtcdDiscovery) GetAll() ([]string, error) {
+	if err := d.Refresh(); err != nil {
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAll()
+}
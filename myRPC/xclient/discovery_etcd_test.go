@@ -0,0 +1,90 @@
+package xclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeEtcd serves range and watch of etcd JSON gateway, events sent to it are pushed to the watch
+func fakeEtcd(t *testing.T, kvs []etcdKV, events chan string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/kv/range", func(w http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(w).Encode(&etcdRangeResponse{Header: etcdHeader{Revision: 5}, Kvs: kvs})
+	})
+	mux.HandleFunc("/v3/watch", func(w http.ResponseWriter, req *http.Request) {
+		var r etcdWatchRequest
+		if err := json.NewDecoder(req.Body).Decode(&r); err != nil || r.CreateRequest.StartRevision != 6 {
+			t.Errorf("watch request %+v, err: %v", r, err)
+		}
+		_, _ = w.Write([]byte(`{"result":{"header":{"revision":"5"},"created":true}}` + "\n"))
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case e := <-events:
+				_, _ = w.Write([]byte(e + "\n"))
+				w.(http.Flusher).Flush()
+			case <-req.Context().Done():
+				return
+			}
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestEtcdDiscovery(t *testing.T) {
+	events := make(chan string, 1)
+	s := fakeEtcd(t, []etcdKV{
+		{Key: []byte("/myrpc/a"), Value: []byte(`{"addr": "tcp@a:1", "weight": 2}`)},
+		{Key: []byte("/myrpc/tcp@b:1")},
+	}, events)
+	defer s.Close()
+	d := NewEtcdDiscovery([]string{"http://127.0.0.1:1", s.URL}, "/myrpc/", 0)
+	servers, err := d.GetAll()
+	if err != nil || !reflect.DeepEqual(servers, []string{"tcp@a:1", "tcp@b:1"}) {
+		t.Fatalf("servers = %v, err: %v", servers, err)
+	}
+	if meta, _ := d.Meta("tcp@a:1"); meta.Weight != 2 {
+		t.Fatalf("meta = %+v", meta)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Watch(ctx)
+	b64 := func(s string) string {
+		b, _ := json.Marshal([]byte(s))
+		return string(b)
+	}
+	events <- `{"result":{"header":{"revision":"7"},"events":[` +
+		`{"type":"DELETE","kv":{"key":` + b64("/myrpc/a") + `}},` +
+		`{"kv":{"key":` + b64("/myrpc/c") + `,"value":` + b64("tcp@c:1") + `}}]}}`
+	for i := 0; ; i++ {
+		servers, _ = d.GetAll()
+		if reflect.DeepEqual(servers, []string{"tcp@b:1", "tcp@c:1"}) {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("servers after watch = %v", servers)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.revision != 7 {
+		t.Fatal("revision = " + strconv.FormatInt(d.revision, 10))
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	if end := string(prefixEnd("/a/")); end != "/a0" {
+		t.Fatalf("prefixEnd = %q", end)
+	}
+	if end := prefixEnd("\xff"); !reflect.DeepEqual(end, []byte{0}) {
+		t.Fatalf("prefixEnd = %v", end)
+	}
+}
@@ -0,0 +1,135 @@
+package xclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"myRPC/internal/rpclog"
+	"os"
+	"time"
+)
+
+const defaultFileCheckInterval = time.Second * 5
+
+// FileDiscovery is a discovery of servers listed in a JSON file, eg, pushed by
+// configuration management. The file is reloaded when it's modified.
+// It's an array of servers, each of them is an address or an object with metadata:
+//
+//	["tcp@10.0.0.1:9999", {"addr": "tcp@10.0.0.2:9999", "weight": 2, "zone": "z1"}]
+type FileDiscovery struct {
+	*MultiServersDiscovery
+	path      string
+	interval  time.Duration
+	lastCheck time.Time
+	modTime   time.Time // of the file loaded
+	size      int64
+}
+
+var _ Discovery = &FileDiscovery{}
+
+// NewFileDiscovery loads servers from the file at path, and checks whether it's
+// modified every checkInterval when servers are asked
+func NewFileDiscovery(path string, checkInterval time.Duration) (*FileDiscovery, error) {
+	if checkInterval == 0 {
+		checkInterval = defaultFileCheckInterval
+	}
+	d := &FileDiscovery{
+		MultiServersDiscovery: NewMultiServersDiscovery(make([]string, 0)),
+		path:                  path,
+		interval:              checkInterval,
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *FileDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	d.changed()
+	return nil
+}
+
+// Refresh reloads the file if it's modified since loaded,
+// servers are kept if the file can't be loaded
+func (d *FileDiscovery) Refresh() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lastCheck.Add(d.interval).After(time.Now()) {
+		return nil
+	}
+	d.lastCheck = time.Now()
+	info, err := os.Stat(d.path)
+	if err == nil && info.ModTime().Equal(d.modTime) && info.Size() == d.size {
+		return nil
+	}
+	if err == nil {
+		err = d.load()
+	}
+	d.refreshed(err)
+	if err != nil {
+		rpclog.Warn("rpc discovery: reload", "path", d.path, "err", err)
+	}
+	return err
+}
+
+// load reads servers from the file, d.mu must be held
+func (d *FileDiscovery) load() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+	servers, meta, err := readServersFile(d.path)
+	if err != nil {
+		return err
+	}
+	d.servers, d.meta = servers, meta
+	d.changed()
+	d.modTime, d.size = info.ModTime(), info.Size()
+	d.lastCheck = time.Now()
+	return nil
+}
+
+// readServersFile reads servers and their metadata from a JSON file like FileDiscovery
+func readServersFile(path string) ([]string, map[string]ServerMeta, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []json.RawMessage
+	if err = json.Unmarshal(b, &entries); err != nil {
+		return nil, nil, fmt.Errorf("rpc discovery: invalid servers file %s: %v", path, err)
+	}
+	servers := make([]string, 0, len(entries))
+	meta := make(map[string]ServerMeta, len(entries))
+	for _, entry := range entries {
+		var server registryServer
+		if err = json.Unmarshal(entry, &server.Addr); err != nil {
+			if err = json.Unmarshal(entry, &server); err != nil {
+				return nil, nil, fmt.Errorf("rpc discovery: invalid server %s in %s", entry, path)
+			}
+		}
+		if server.Addr == "" {
+			return nil, nil, errors.New("rpc discovery: server address is missing in " + path)
+		}
+		servers = append(servers, server.Addr)
+		meta[server.Addr] = server.ServerMeta
+	}
+	return servers, meta, nil
+}
+
+// Get returns a server loaded last time if the file can't be reloaded,
+// it's likely being rewritten
+func (d *FileDiscovery) Get(mode SelectMode) (string, error) {
+	_ = d.Refresh()
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+func (d *FileDiscovery) GetAll() ([]string, error) {
+	_ = d.Refresh()
+	return d.MultiServersDiscovery.GetAll()
+}
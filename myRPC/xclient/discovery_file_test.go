@@ -0,0 +1,52 @@
+package xclient
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileDiscovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	write := func(content string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// mtime may not change within the resolution of file system
+		_ = os.Chtimes(path, modTime, modTime)
+	}
+	now := time.Now()
+	write(`["tcp@a:1", {"addr": "tcp@b:1", "weight": 2, "zone": "z1"}]`, now)
+	d, err := NewFileDiscovery(path, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers, _ := d.GetAll()
+	if !reflect.DeepEqual(servers, []string{"tcp@a:1", "tcp@b:1"}) {
+		t.Fatalf("servers = %v", servers)
+	}
+	if meta, _ := d.Meta("tcp@b:1"); meta.Weight != 2 || meta.Zone != "z1" {
+		t.Fatalf("meta = %+v", meta)
+	}
+
+	write(`["tcp@c:1"]`, now.Add(time.Second))
+	time.Sleep(time.Millisecond * 2)
+	servers, _ = d.GetAll()
+	if !reflect.DeepEqual(servers, []string{"tcp@c:1"}) {
+		t.Fatalf("servers after reload = %v", servers)
+	}
+
+	// an invalid file keeps servers loaded
+	write(`["tcp@d:1"`, now.Add(time.Second*2))
+	time.Sleep(time.Millisecond * 2)
+	servers, _ = d.GetAll()
+	if !reflect.DeepEqual(servers, []string{"tcp@c:1"}) {
+		t.Fatalf("servers after invalid file = %v", servers)
+	}
+
+	if _, err = NewFileDiscovery(filepath.Join(t.TempDir(), "missing.json"), 0); err == nil {
+		t.Fatal("expect error for missing file")
+	}
+}
@@ -0,0 +1,327 @@
+package xclient
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	mrand "math/rand"
+	"myRPC/internal/rpclog"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultGossipInterval = time.Second
+	gossipFanout          = 3        // members gossiped to every interval
+	gossipSuspectRounds   = 5        // intervals without a heartbeat before a member is dead
+	gossipForgetRounds    = 20       // intervals before a dead or left member is forgotten
+	maxGossipPacket       = 64 << 10 // members of a few hundred nodes fit in a datagram
+)
+
+// GossipDiscovery is a discovery of servers learned by gossip, without a registry.
+// Every node, server or client, runs one and joins by any member as seed: it
+// gossips its heartbeat and the members it knows to a few random members every
+// interval over UDP, so all members know each other in a few rounds. A member
+// whose heartbeat isn't heard for a few intervals is dead, and one closed leaves
+// at once. Servers are members with an RPC address, so servers discover each
+// other as clients discover them.
+type GossipDiscovery struct {
+	*MultiServersDiscovery
+	conn     *net.UDPConn
+	seeds    []string
+	interval time.Duration
+	self     gossipMember            // protected by mu
+	members  map[string]*gossipState // others by ID, protected by mu
+	done     chan struct{}
+	once     sync.Once
+}
+
+// gossipMember is a member as gossiped
+type gossipMember struct {
+	ID        string      `json:"id"`
+	Gossip    string      `json:"gossip"`         // UDP address it gossips on
+	Addr      string      `json:"addr,omitempty"` // RPC address, eg, tcp@10.0.0.1:9999, empty if it's a client
+	Meta      *ServerMeta `json:"meta,omitempty"`
+	Heartbeat uint64      `json:"heartbeat"`
+	Left      bool        `json:"left,omitempty"`
+}
+
+// gossipState is a member known, seen is when its heartbeat was raised last
+type gossipState struct {
+	gossipMember
+	seen time.Time
+}
+
+// gossipMessage carries members known by the sender, the first one is the sender,
+// a message not replying is answered with members known by the receiver
+type gossipMessage struct {
+	Members []gossipMember `json:"members"`
+	Reply   bool           `json:"reply,omitempty"`
+}
+
+var _ Discovery = &GossipDiscovery{}
+
+// NewGossipDiscovery gossips on the UDP address bind every interval, and joins the
+// members by seeds, the gossip addresses of some members. addr is the RPC address
+// of the server running it, eg, tcp@10.0.0.1:9999, or empty if it's a client.
+// Close leaves the members.
+func NewGossipDiscovery(bind, addr string, seeds []string, interval time.Duration) (*GossipDiscovery, error) {
+	if interval == 0 {
+		interval = defaultGossipInterval
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", bind)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	d := &GossipDiscovery{
+		MultiServersDiscovery: NewMultiServersDiscovery(make([]string, 0)),
+		conn:                  conn,
+		seeds:                 seeds,
+		interval:              interval,
+		// heartbeats begin at the time, so those of a member restarted are newer
+		self: gossipMember{
+			ID:        hex.EncodeToString(id),
+			Gossip:    conn.LocalAddr().String(),
+			Addr:      addr,
+			Heartbeat: uint64(time.Now().UnixNano()),
+		},
+		members: make(map[string]*gossipState),
+		done:    make(chan struct{}),
+	}
+	d.mu.Lock()
+	d.apply()
+	d.mu.Unlock()
+	go d.receive()
+	go d.loop()
+	return d, nil
+}
+
+// LocalAddr returns the UDP address it gossips on, eg, to be a seed of others
+func (d *GossipDiscovery) LocalAddr() string {
+	return d.conn.LocalAddr().String()
+}
+
+// SetMeta sets metadata of the server running it, which is gossiped with its heartbeat
+func (d *GossipDiscovery) SetMeta(meta ServerMeta) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.self.Meta = &meta
+	d.apply()
+}
+
+func (d *GossipDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	d.changed()
+	return nil
+}
+
+// Refresh does nothing, servers are kept current by gossip
+func (d *GossipDiscovery) Refresh() error {
+	return nil
+}
+
+// Close leaves the members and stops gossiping
+func (d *GossipDiscovery) Close() error {
+	return d.close(true)
+}
+
+// close stops gossiping, the members are told if leave, or see it dead later otherwise
+func (d *GossipDiscovery) close(leave bool) error {
+	var err error
+	d.once.Do(func() {
+		close(d.done)
+		if leave {
+			d.mu.Lock()
+			d.self.Heartbeat++
+			d.self.Left = true
+			targets := d.alive()
+			msg := d.message(false)
+			d.mu.Unlock()
+			for _, m := range targets {
+				d.send(m.Gossip, msg)
+			}
+		}
+		err = d.conn.Close()
+	})
+	return err
+}
+
+// loop gossips every interval until closed
+func (d *GossipDiscovery) loop() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.gossip()
+		select {
+		case <-ticker.C:
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// gossip raises the heartbeat, and sends members known to a few random members
+func (d *GossipDiscovery) gossip() {
+	d.mu.Lock()
+	d.self.Heartbeat++
+	d.sweep()
+	var targets []string
+	alive := d.alive()
+	mrand.Shuffle(len(alive), func(i, j int) { alive[i], alive[j] = alive[j], alive[i] })
+	for i := 0; i < len(alive) && i < gossipFanout; i++ {
+		targets = append(targets, alive[i].Gossip)
+	}
+	// a seed not known alive is tried every round, so members joined by different
+	// seeds at the same time, or split by a partition, find each other
+	if len(d.seeds) > 0 {
+		seed := d.seeds[mrand.Intn(len(d.seeds))]
+		known := false
+		for _, m := range alive {
+			known = known || m.Gossip == seed
+		}
+		if !known {
+			targets = append(targets, seed)
+		}
+	}
+	msg := d.message(false)
+	d.mu.Unlock()
+	for _, target := range targets {
+		d.send(target, msg)
+	}
+}
+
+// receive merges members gossiped until closed
+func (d *GossipDiscovery) receive() {
+	buf := make([]byte, maxGossipPacket)
+	for {
+		n, from, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-d.done:
+				return
+			default:
+			}
+			rpclog.Error("rpc discovery: gossip read", "err", err)
+			time.Sleep(d.interval)
+			continue
+		}
+		var msg gossipMessage
+		if err = json.Unmarshal(buf[:n], &msg); err != nil || len(msg.Members) == 0 {
+			continue
+		}
+		// the sender may listen on an unspecified address, it's reached where it sends from
+		if host, _, err := net.SplitHostPort(msg.Members[0].Gossip); err != nil || net.ParseIP(host).IsUnspecified() {
+			msg.Members[0].Gossip = from.String()
+		}
+		d.mu.Lock()
+		d.merge(msg.Members)
+		var reply []byte
+		if !msg.Reply {
+			reply = d.message(true)
+		}
+		d.mu.Unlock()
+		if reply != nil {
+			d.send(from.String(), reply)
+		}
+	}
+}
+
+// merge takes members whose heartbeats are newer than known, d.mu must be held
+func (d *GossipDiscovery) merge(members []gossipMember) {
+	now := time.Now()
+	for _, m := range members {
+		if m.ID == d.self.ID {
+			continue
+		}
+		if known, ok := d.members[m.ID]; ok && known.Heartbeat >= m.Heartbeat {
+			continue
+		}
+		d.members[m.ID] = &gossipState{gossipMember: m, seen: now}
+	}
+	d.apply()
+}
+
+// sweep forgets members not heard for long, and applies those dead, d.mu must be held
+func (d *GossipDiscovery) sweep() {
+	for id, m := range d.members {
+		if time.Since(m.seen) > d.interval*gossipForgetRounds {
+			delete(d.members, id)
+		}
+	}
+	d.apply()
+}
+
+// alive returns members alive, d.mu must be held
+func (d *GossipDiscovery) alive() []gossipMember {
+	var members []gossipMember
+	for _, m := range d.members {
+		if !m.Left && time.Since(m.seen) <= d.interval*gossipSuspectRounds {
+			members = append(members, m.gossipMember)
+		}
+	}
+	return members
+}
+
+// message encodes itself and members alive or left, those left are gossiped until
+// forgotten, so that stale heartbeats of them don't bring them back
+func (d *GossipDiscovery) message(reply bool) []byte {
+	msg := gossipMessage{Members: []gossipMember{d.self}, Reply: reply}
+	msg.Members = append(msg.Members, d.alive()...)
+	for _, m := range d.members {
+		if m.Left {
+			msg.Members = append(msg.Members, m.gossipMember)
+		}
+	}
+	b, _ := json.Marshal(msg)
+	return b
+}
+
+func (d *GossipDiscovery) send(target string, msg []byte) {
+	if len(msg) > maxGossipPacket {
+		rpclog.Warn("rpc discovery: gossip is too large", "bytes", len(msg))
+		return
+	}
+	addr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		rpclog.Warn("rpc discovery: gossip", "target", target, "err", err)
+		return
+	}
+	_, _ = d.conn.WriteToUDP(msg, addr)
+}
+
+// apply takes servers of itself and members alive, d.mu must be held
+func (d *GossipDiscovery) apply() {
+	meta := make(map[string]ServerMeta)
+	members := append(d.alive(), d.self)
+	for _, m := range members {
+		if m.Addr == "" || m.Left {
+			continue
+		}
+		if m.Meta != nil {
+			meta[m.Addr] = *m.Meta
+		} else {
+			meta[m.Addr] = ServerMeta{}
+		}
+	}
+	servers := make([]string, 0, len(meta))
+	for addr := range meta {
+		servers = append(servers, addr)
+	}
+	sort.Strings(servers)
+	if reflect.DeepEqual(servers, d.servers) && reflect.DeepEqual(meta, d.meta) {
+		return
+	}
+	d.servers, d.meta = servers, meta
+	d.changed()
+}
@@ -0,0 +1,51 @@
+package xclient
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGossipDiscovery(t *testing.T) {
+	interval := time.Millisecond * 20
+	a, err := NewGossipDiscovery("127.0.0.1:0", "tcp@127.0.0.1:1", nil, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = a.Close() }()
+	a.SetMeta(ServerMeta{Zone: "z1"})
+	b, _ := NewGossipDiscovery("127.0.0.1:0", "tcp@127.0.0.1:2", []string{a.LocalAddr()}, interval)
+	defer func() { _ = b.Close() }()
+	// the client knows b only, and learns a from it
+	c, _ := NewGossipDiscovery("127.0.0.1:0", "", []string{b.LocalAddr()}, interval)
+	defer func() { _ = c.Close() }()
+
+	waitServers := func(d *GossipDiscovery, expect []string) {
+		t.Helper()
+		var servers []string
+		for i := 0; i < 100; i++ {
+			if servers, _ = d.GetAll(); reflect.DeepEqual(servers, expect) {
+				return
+			}
+			time.Sleep(interval / 2)
+		}
+		t.Fatalf("expect servers %v, but got %v", expect, servers)
+	}
+	waitServers(c, []string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2"})
+	waitServers(a, []string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2"})
+	if meta, ok := c.Meta("tcp@127.0.0.1:1"); !ok || meta.Zone != "z1" {
+		t.Fatalf("expect metadata gossiped, but got %+v", meta)
+	}
+
+	// a server leaving is dropped at once
+	_ = a.Close()
+	waitServers(c, []string{"tcp@127.0.0.1:2"})
+
+	// a server gone silently is dropped when its heartbeat isn't heard
+	_ = b.close(false)
+	start := time.Now()
+	waitServers(c, []string{})
+	if elapsed := time.Since(start); elapsed < interval*gossipSuspectRounds/2 {
+		t.Fatalf("expect the silent server dead after a few intervals, but dropped in %v", elapsed)
+	}
+}
@@ -0,0 +1,228 @@
+package xclient
+
+import (
+	"context"
+	"myRPC/registry"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCenterRegistryDiscovery(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:1", Services: []string{"Foo"}, Zone: "z1"}, time.Minute)
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:2", Services: []string{"Bar"}}, time.Minute)
+
+	d := NewServiceDiscovery(ts.URL, "Foo", 0)
+	servers, err := d.GetAll()
+	if err != nil || len(servers) != 1 || servers[0] != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect the server exposing Foo, but got %v, %v", servers, err)
+	}
+	if meta, ok := d.Meta("tcp@127.0.0.1:1"); !ok || meta.Zone != "z1" {
+		t.Fatalf("expect metadata of the server, but got %+v", meta)
+	}
+}
+
+func TestCenterRegistryDiscovery_Watch(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	d := NewCenterRegistryDiscovery(ts.URL, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Watch(ctx)
+
+	registry.Heartbeat(ts.URL, "tcp@127.0.0.1:1", time.Minute)
+	for i := 0; i < 100; i++ {
+		if servers, _ := d.GetAll(); len(servers) == 1 {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("expect watch learns the new server within a second")
+}
+
+func TestCenterRegistryDiscovery_Stream(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	registry.Heartbeat(ts.URL, "tcp@127.0.0.1:1", time.Minute)
+	d := NewCenterRegistryDiscovery(ts.URL, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Stream(ctx)
+
+	waitServers := func(expect int) {
+		for i := 0; i < 100; i++ {
+			if servers, _ := d.MultiServersDiscovery.GetAll(); len(servers) == expect {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		t.Fatalf("expect %d servers pushed by registry", expect)
+	}
+	waitServers(1)
+	registry.Heartbeat(ts.URL, "tcp@127.0.0.1:2", time.Minute)
+	waitServers(2)
+	_ = registry.Deregister(ts.URL, "tcp@127.0.0.1:1")
+	waitServers(1)
+}
+
+func TestNamespaceDiscovery(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:1", Namespace: "prod"}, time.Minute)
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:2", Namespace: "staging"}, time.Minute)
+	registry.Heartbeat(ts.URL, "tcp@127.0.0.1:3", time.Minute)
+
+	for namespace, expect := range map[string]string{"prod": "tcp@127.0.0.1:1", "staging": "tcp@127.0.0.1:2", "": "tcp@127.0.0.1:3"} {
+		servers, err := NewNamespaceDiscovery(ts.URL, namespace, "", 0).GetAll()
+		if err != nil || len(servers) != 1 || servers[0] != expect {
+			t.Fatalf("expect only %s in namespace %q, but got %v, %v", expect, namespace, servers, err)
+		}
+	}
+}
+
+func TestCenterRegistryDiscovery_Since(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	registry.Heartbeat(ts.URL, "tcp@127.0.0.1:1", time.Minute)
+	registry.Heartbeat(ts.URL, "tcp@127.0.0.1:2", time.Minute)
+	d := NewCenterRegistryDiscovery(ts.URL, time.Millisecond)
+	if servers, _ := d.GetAll(); len(servers) != 2 || d.version == 0 {
+		t.Fatalf("expect 2 servers and the version, but got %v, %d", servers, d.version)
+	}
+
+	_ = registry.Deregister(ts.URL, "tcp@127.0.0.1:1")
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:3", Zone: "z1"}, time.Minute)
+	time.Sleep(time.Millisecond * 2)
+	servers, err := d.GetAll()
+	if err != nil || len(servers) != 2 || servers[0] != "tcp@127.0.0.1:2" || servers[1] != "tcp@127.0.0.1:3" {
+		t.Fatalf("expect changes applied, but got %v, %v", servers, err)
+	}
+	if meta, ok := d.Meta("tcp@127.0.0.1:3"); !ok || meta.Zone != "z1" {
+		t.Fatalf("expect metadata of the added server, but got %+v", meta)
+	}
+}
+
+func TestCenterRegistryDiscovery_SetFilter(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:1", Zone: "z1", Labels: map[string]string{"track": "canary"}}, time.Minute)
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:2", Zone: "z1"}, time.Minute)
+	registry.HeartbeatServer(ts.URL, &registry.ServerItem{Addr: "tcp@127.0.0.1:3", Zone: "z2", Labels: map[string]string{"track": "canary"}}, time.Minute)
+
+	d := NewCenterRegistryDiscovery(ts.URL, 0)
+	d.SetFilter("z1", map[string]string{"track": "canary"})
+	servers, err := d.GetAll()
+	if err != nil || len(servers) != 1 || servers[0] != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect only the canary in z1, but got %v, %v", servers, err)
+	}
+	if meta, _ := d.Meta("tcp@127.0.0.1:1"); meta.Labels["track"] != "canary" {
+		t.Fatalf("expect labels of the server, but got %+v", meta)
+	}
+}
+
+func TestCenterRegistryDiscovery_LeastLoad(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	client := registry.NewClient(ts.URL)
+	lease, _ := client.Register(context.Background(), &registry.ServerItem{Addr: "tcp@127.0.0.1:1"})
+	_, _ = client.Register(context.Background(), &registry.ServerItem{Addr: "tcp@127.0.0.1:2"})
+	d := NewCenterRegistryDiscovery(ts.URL, time.Millisecond)
+	_, _ = d.GetAll()
+
+	// the load renewed is learned from changes since the version known
+	_ = client.RenewLoad(context.Background(), lease, &registry.Load{InFlight: 10, CPU: 0.9})
+	time.Sleep(time.Millisecond * 2)
+	_ = d.Refresh()
+	if meta, _ := d.Meta("tcp@127.0.0.1:1"); meta.Load == nil || meta.Load.InFlight != 10 {
+		t.Fatalf("expect load of the server, but got %+v", meta)
+	}
+	loaded := 0
+	for i := 0; i < 200; i++ {
+		server, err := d.MultiServersDiscovery.Get(LeastLoadSelect)
+		if err != nil {
+			t.Fatal("failed to get server:", err)
+		}
+		if server == "tcp@127.0.0.1:1" {
+			loaded++
+		}
+	}
+	// the loaded server is selected only if it's drawn twice, which is a quarter of the time
+	if loaded > 90 {
+		t.Fatalf("expect the idle server selected mostly, but the loaded one is selected %d times", loaded)
+	}
+}
+
+func TestCenterRegistryDiscovery_RefreshTimeout(t *testing.T) {
+	// registry hangs until the test ends
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-hang
+	}))
+	defer ts.Close()
+	defer close(hang)
+	d := NewCenterRegistryDiscovery(ts.URL, time.Millisecond*100)
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- d.Refresh() }()
+	}
+	// servers known are read while registry is being fetched
+	time.Sleep(time.Millisecond * 20)
+	start := time.Now()
+	if _, ok := d.Meta("tcp@127.0.0.1:1"); ok || time.Since(start) > time.Millisecond*50 {
+		t.Fatal("expect servers read without waiting for registry")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Fatal("expect the refresh to time out")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expect the refresh bounded by the timeout of discovery")
+		}
+	}
+}
+
+func TestCenterRegistryDiscovery_Seeds(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	registry.Heartbeat(ts.URL, "tcp@127.0.0.1:1", time.Minute)
+	d := NewCenterRegistryDiscovery(ts.URL, time.Millisecond)
+	d.SetSeeds([]string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2"})
+	servers, err := d.GetAll()
+	if err != nil || len(servers) != 2 || servers[0] != "tcp@127.0.0.1:1" || servers[1] != "tcp@127.0.0.1:2" {
+		t.Fatalf("expect seeds merged with servers from registry, but got %v, %v", servers, err)
+	}
+
+	ts.Close()
+	time.Sleep(time.Millisecond * 2)
+	if servers, err = d.GetAll(); err != nil || len(servers) != 2 {
+		t.Fatalf("expect seeds when registry is down, but got %v, %v", servers, err)
+	}
+	if _, err = NewCenterRegistryDiscovery(ts.URL, 0).Get(RandomSelect); err == nil {
+		t.Fatal("expect error when registry is down without seeds")
+	}
+}
+
+func TestCenterRegistryDiscovery_Start(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	d := NewCenterRegistryDiscovery(ts.URL, time.Minute)
+	if servers, _ := d.GetAll(); len(servers) != 0 {
+		t.Fatalf("servers = %v before registered", servers)
+	}
+	d.Start(time.Millisecond * 20)
+	defer d.Stop()
+
+	registry.Heartbeat(ts.URL, "tcp@127.0.0.1:1", time.Minute)
+	for i := 0; i < 100; i++ {
+		// servers are fresh for a minute, only refreshed in background
+		if servers, _ := d.GetAll(); len(servers) == 1 {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("expect background refresh learns the new server within a second")
+}
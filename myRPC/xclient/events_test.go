@@ -0,0 +1,34 @@
+package xclient
+
+import (
+	"errors"
+	"myRPC"
+	"reflect"
+	"testing"
+)
+
+func TestDiscovery_RegistryRefreshed(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1"})
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var events, forwarded []myRPC.RegistryRefreshed
+	d.Events().Subscribe(func(event myRPC.Event) {
+		events = append(events, event.(myRPC.RegistryRefreshed))
+	})
+	xc.Events().Subscribe(func(event myRPC.Event) {
+		forwarded = append(forwarded, event.(myRPC.RegistryRefreshed))
+	})
+
+	failed := errors.New("registry down")
+	d.mu.Lock()
+	d.refreshed(nil)
+	d.refreshed(failed)
+	d.mu.Unlock()
+	if len(events) != 2 || !reflect.DeepEqual(events[0].Servers, []string{"tcp@127.0.0.1:1"}) ||
+		events[0].Err != nil || events[1].Err != failed {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if !reflect.DeepEqual(forwarded, events) {
+		t.Fatalf("expect events of the discovery published by XClient, but got %+v", forwarded)
+	}
+}
@@ -0,0 +1,64 @@
+package xclient
+
+import (
+	"time"
+)
+
+const minEvictInterval = time.Second
+
+// SetMaxIdle closes clients which haven't been used for a call within maxIdle,
+// they're dialed again when needed. Clients of servers which are unavailable
+// or not discovered any more are closed as well. It should be called before xc is used.
+func (xc *XClient) SetMaxIdle(maxIdle time.Duration) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if xc.stopEvict != nil || maxIdle <= 0 {
+		return
+	}
+	xc.maxIdle = maxIdle
+	xc.lastUsed = make(map[string]time.Time)
+	xc.stopEvict = make(chan struct{})
+	go xc.evictEvery(max(maxIdle/2, minEvictInterval), xc.stopEvict)
+}
+
+func (xc *XClient) evictEvery(interval time.Duration, stop chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			xc.evict()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// evict closes clients unavailable, idle too long or of servers departed
+func (xc *XClient) evict() {
+	// discovered is nil if a discovery fails, servers are kept then
+	discovered := make(map[string]bool)
+	for _, d := range xc.discoveries() {
+		servers, err := d.GetAll()
+		if err != nil {
+			discovered = nil
+			break
+		}
+		for _, server := range servers {
+			discovered[server] = true
+		}
+	}
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	now := time.Now()
+	for rpcAddr, pool := range xc.clients {
+		if pool.isAvailable() && xc.active.count(rpcAddr) > 0 {
+			continue
+		}
+		idle := now.Sub(xc.lastUsed[rpcAddr]) > xc.maxIdle
+		departed := discovered != nil && !discovered[rpcAddr]
+		if !pool.isAvailable() || idle || departed {
+			xc.removeClient(rpcAddr)
+		}
+	}
+}
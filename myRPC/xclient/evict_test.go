@@ -0,0 +1,48 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestXClient_Evict(t *testing.T) {
+	a, b := startServer(t, 0), startServer(t, 0)
+	d := NewMultiServersDiscovery([]string{a, b})
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetMaxIdle(time.Hour)
+	var reply int
+	for i := 0; i < 2; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clients := func() int {
+		xc.mu.Lock()
+		defer xc.mu.Unlock()
+		return len(xc.clients)
+	}
+	xc.evict()
+	if n := clients(); n != 2 {
+		t.Fatalf("%d clients left, expect 2", n)
+	}
+
+	// a broken client is evicted
+	xc.mu.Lock()
+	_ = xc.clients[a].clients[0].Close()
+	xc.mu.Unlock()
+	xc.evict()
+	if n := clients(); n != 1 {
+		t.Fatalf("%d clients left after one is closed, expect 1", n)
+	}
+
+	// an idle client is evicted
+	xc.mu.Lock()
+	xc.lastUsed[b] = time.Now().Add(-time.Hour * 2)
+	xc.mu.Unlock()
+	xc.evict()
+	if n := clients(); n != 0 {
+		t.Fatalf("%d clients left after idle, expect 0", n)
+	}
+}
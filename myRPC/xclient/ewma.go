@@ -0,0 +1,122 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// ewmaDecay is how fast the past is forgotten, an outcome weighs e^-1
+	// of a new one after ewmaDecay, so a recovered server is trusted again soon
+	ewmaDecay = time.Second * 10
+	// ewmaMinWeight is the least weight of a new outcome, so that a burst of
+	// calls in a short time counts as well
+	ewmaMinWeight = 0.1
+)
+
+// serverStats is the exponentially weighted moving average of latency and
+// error rate of calls to a server
+type serverStats struct {
+	latency float64 // in nanoseconds
+	errRate float64 // between 0 and 1
+	last    time.Time
+}
+
+// callStats tracks outcomes of calls to each server
+type callStats struct {
+	mu      sync.Mutex
+	servers map[string]*serverStats
+}
+
+// observe records the outcome of a call to server, a call canceled by its caller
+// says nothing about the server
+func (c *callStats) observe(server string, latency time.Duration, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.servers == nil {
+		c.servers = make(map[string]*serverStats)
+	}
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+	now := time.Now()
+	s := c.servers[server]
+	if s == nil {
+		c.servers[server] = &serverStats{latency: float64(latency), errRate: failed, last: now}
+		return
+	}
+	w := math.Min(math.Exp(-float64(now.Sub(s.last))/float64(ewmaDecay)), 1-ewmaMinWeight)
+	s.latency = s.latency*w + float64(latency)*(1-w)
+	s.errRate = s.errRate*w + failed*(1-w)
+	s.last = now
+}
+
+// cost estimates how long a call to server takes with active calls in flight,
+// failures inflate it like the retries they cause. A server never called costs 0,
+// so that it's tried soon.
+func (c *callStats) cost(server string, active int) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.servers[server]
+	if s == nil {
+		return 0
+	}
+	return s.latency * float64(active+1) / (1 - math.Min(s.errRate, 0.99))
+}
+
+// errRate returns the recent error rate of calls to server, it decays over time
+// without calls, so that a server avoided for errors is tried again later
+func (c *callStats) errRate(server string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.servers[server]; s != nil {
+		return s.errRate * math.Exp(-float64(time.Since(s.last))/float64(ewmaDecay))
+	}
+	return 0
+}
+
+// forget drops stats of servers which are not in servers any more
+func (c *callStats) forget(servers []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.servers) <= len(servers) {
+		return
+	}
+	alive := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		alive[server] = true
+	}
+	for server := range c.servers {
+		if !alive[server] {
+			delete(c.servers, server)
+		}
+	}
+}
+
+// p2cServer samples two random servers and selects the one costs less
+func (xc *XClient) p2cServer(ctx context.Context) (string, error) {
+	servers, err := xc.servers(ctx)
+	if err != nil {
+		return "", err
+	}
+	xc.stats.forget(servers)
+	n := len(servers)
+	i := rand.Intn(n)
+	a, b := servers[i], servers[i]
+	if n > 1 {
+		// the other one is a different server
+		b = servers[(i+1+rand.Intn(n-1))%n]
+	}
+	if xc.stats.cost(b, xc.active.count(b)) < xc.stats.cost(a, xc.active.count(a)) {
+		return b, nil
+	}
+	return a, nil
+}
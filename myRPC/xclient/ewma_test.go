@@ -0,0 +1,35 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestXClient_P2C(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2"})
+	xc := NewXClient(d, P2CSelect, nil)
+	for i := 0; i < 10; i++ {
+		xc.stats.observe("tcp@127.0.0.1:1", time.Millisecond*100, nil)
+		xc.stats.observe("tcp@127.0.0.1:2", time.Millisecond*10, nil)
+	}
+	for i := 0; i < 10; i++ {
+		if server, _ := xc.selectServer(context.Background()); server != "tcp@127.0.0.1:2" {
+			t.Fatalf("expect the faster server selected, but got %s", server)
+		}
+	}
+	// failures make the faster one cost more
+	for i := 0; i < 30; i++ {
+		xc.stats.observe("tcp@127.0.0.1:2", time.Millisecond*10, errors.New("rpc client: call failed"))
+	}
+	if server, _ := xc.selectServer(context.Background()); server != "tcp@127.0.0.1:1" {
+		t.Fatalf("expect the server without errors selected, but got %s", server)
+	}
+	// calls canceled by caller are ignored
+	before := xc.stats.cost("tcp@127.0.0.1:1", 0)
+	xc.stats.observe("tcp@127.0.0.1:1", time.Second, context.Canceled)
+	if cost := xc.stats.cost("tcp@127.0.0.1:1", 0); cost != before {
+		t.Fatalf("expect cost unchanged by canceled calls, but got %f, %f", before, cost)
+	}
+}
@@ -0,0 +1,170 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	. "myRPC"
+	"reflect"
+	"time"
+)
+
+// FailMode decides what XClient does when a call fails
+type FailMode int
+
+const (
+	Failfast   FailMode = iota // return the error at once
+	Failover                   // retry on other servers
+	Failtry                    // retry on the same server
+	Failbackup                 // call another server as well if the first one doesn't reply in time, take the first reply
+)
+
+const defaultBackupDelay = time.Millisecond * 10
+
+// SetFailMode sets how xc handles failed calls, Failfast by default.
+// retries is the most times a failed call is retried by Failover and Failtry.
+// A call is only retried if it may not reach the server, errors returned by
+// the method called aren't retried, except a server shutting down.
+// It should be called before xc is used.
+func (xc *XClient) SetFailMode(mode FailMode, retries int) {
+	xc.failMode, xc.retries = mode, retries
+}
+
+// SetBackupDelay sets how long Failbackup waits for the first server before
+// calling another one, 10ms by default. It should be called before xc is used.
+func (xc *XClient) SetBackupDelay(delay time.Duration) {
+	xc.backupDelay = delay
+}
+
+// retryable reports whether a call failed by err may succeed on retry
+func retryable(err error) bool {
+	if errors.Is(err, ErrConcurrencyLimited) {
+		// retrying makes it worse
+		return false
+	}
+	var serverErr ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.Error() == ErrServerClosed.Error()
+	}
+	return true
+}
+
+// callFailover calls servers until one succeeds, each retry goes to a server not tried yet
+func (xc *XClient) callFailover(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	rpcAddr, err := xc.selectServer(ctx)
+	if err != nil {
+		return err
+	}
+	tried := map[string]bool{rpcAddr: true}
+	for _, retries := xc.failModeOf(ctx); ; retries-- {
+		err = xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+		if err == nil || retries <= 0 || !retryable(err) || ctx.Err() != nil || !xc.canRetry() {
+			return err
+		}
+		if callOptionsFrom(ctx).target != "" {
+			// a call to the target server can only be retried on it
+			continue
+		}
+		servers, e := xc.servers(ctx)
+		if e != nil {
+			return err
+		}
+		var rest []string
+		for _, server := range servers {
+			if !tried[server] {
+				rest = append(rest, server)
+			}
+		}
+		if len(rest) == 0 {
+			return err
+		}
+		rpcAddr = rest[rand.Intn(len(rest))]
+		tried[rpcAddr] = true
+	}
+}
+
+// callFailtry calls the same server again until it succeeds
+func (xc *XClient) callFailtry(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	rpcAddr, err := xc.selectServer(ctx)
+	if err != nil {
+		return err
+	}
+	for _, retries := xc.failModeOf(ctx); ; retries-- {
+		err = xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+		if err == nil || retries <= 0 || !retryable(err) || ctx.Err() != nil || !xc.canRetry() {
+			return err
+		}
+	}
+}
+
+// callBackup calls a second server if the first one doesn't reply within
+// the backup delay, and takes the reply which arrives first
+func (xc *XClient) callBackup(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	first, err := xc.selectServer(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancel the call not taken
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	done := make(chan *result, 2)
+	call := func(rpcAddr string) {
+		// each call decodes into its own reply, they may arrive at the same time
+		var cloned interface{}
+		if reply != nil {
+			cloned = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+		}
+		err := xc.call(rpcAddr, ctx, serviceMethod, args, cloned)
+		done <- &result{reply: cloned, err: err}
+	}
+	go call(first)
+	delay := xc.backupDelay
+	if hedgeDelay := callOptionsFrom(ctx).hedgeDelay; hedgeDelay > 0 {
+		delay = hedgeDelay
+	}
+	if delay <= 0 {
+		delay = defaultBackupDelay
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	calls := 1
+	var res *result
+	select {
+	case res = <-done:
+	case <-t.C:
+		if second := xc.backupServer(ctx, first); second != "" && callOptionsFrom(ctx).target == "" && xc.canRetry() {
+			calls++
+			go call(second)
+		}
+		res = <-done
+	}
+	if res.err != nil && calls == 2 {
+		// the other call may still succeed
+		res = <-done
+	}
+	if res.err == nil && reply != nil {
+		reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(res.reply).Elem())
+	}
+	return res.err
+}
+
+// backupServer selects a server other than first, empty if there is none
+func (xc *XClient) backupServer(ctx context.Context, first string) string {
+	servers, err := xc.servers(ctx)
+	if err != nil {
+		return ""
+	}
+	rest := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if server != first {
+			rest = append(rest, server)
+		}
+	}
+	if len(rest) == 0 {
+		return ""
+	}
+	return rest[rand.Intn(len(rest))]
+}
@@ -0,0 +1,98 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"myRPC"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Foo struct {
+	delay time.Duration
+	calls atomic.Int64 // calls of Sum
+}
+
+type Args struct{ Num1, Num2 int }
+
+func (f *Foo) Sum(args Args, reply *int) error {
+	f.calls.Add(1)
+	time.Sleep(f.delay)
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (f *Foo) Delay(args Args, reply *time.Duration) error {
+	*reply = f.delay
+	return nil
+}
+
+func (f *Foo) Fail(args Args, reply *int) error {
+	return errors.New("failed")
+}
+
+// startServer starts a server of Foo replying after delay and returns its address
+func startServer(t *testing.T, delay time.Duration) string {
+	server := myRPC.NewServer()
+	_ = server.Register(&Foo{delay: delay})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+	go server.Accept(l)
+	return "tcp@" + l.Addr().String()
+}
+
+func deadServer() string {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	_ = l.Close()
+	return "tcp@" + l.Addr().String()
+}
+
+func TestXClient_FailMode(t *testing.T) {
+	alive, dead := startServer(t, 0), deadServer()
+	newXClient := func(mode FailMode, retries int) *XClient {
+		d := NewMultiServersDiscovery([]string{dead, alive})
+		d.index = 0
+		xc := NewXClient(d, RoundRobinSelect, nil)
+		xc.SetFailMode(mode, retries)
+		t.Cleanup(func() { _ = xc.Close() })
+		return xc
+	}
+	var reply int
+	if err := newXClient(Failfast, 0).Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err == nil {
+		t.Fatal("expect the error of the dead server")
+	}
+	if err := newXClient(Failtry, 2).Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err == nil {
+		t.Fatal("expect the dead server retried in vain")
+	}
+	xc := newXClient(Failover, 1)
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect the call failed over to the alive server, but got %d, %v", reply, err)
+	}
+	// errors of the method aren't retried
+	xc.d.(*MultiServersDiscovery).index = 1
+	if err := xc.Call(context.Background(), "Foo.Fail", Args{1, 2}, &reply); err == nil || !errors.As(err, new(myRPC.ServerError)) {
+		t.Fatalf("expect the error of the method, but got %v", err)
+	}
+}
+
+func TestXClient_Failbackup(t *testing.T) {
+	slow, fast := startServer(t, time.Second), startServer(t, 0)
+	d := NewMultiServersDiscovery([]string{slow, fast})
+	d.index = 0
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetFailMode(Failbackup, 0)
+	start := time.Now()
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect the reply of the backup call, but got %d, %v", reply, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("expect the backup call replies before the slow server, but took %s", elapsed)
+	}
+}
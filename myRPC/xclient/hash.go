@@ -0,0 +1,98 @@
+package xclient
+
+import (
+	"context"
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// hashReplicas is the number of virtual nodes of each server on the ring,
+// more virtual nodes spread keys more evenly
+const hashReplicas = 160
+
+type hashKey struct{}
+
+type affinityKey struct{}
+
+// WithHashKey returns a context carrying key, calls made by XClient in
+// ConsistentHashSelect mode with the same key are routed to the same server
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+// WithAffinityKey returns a context carrying key, eg, a user ID set by middleware,
+// calls made with the same key are kept on the same server by XClient in
+// ConsistentHashSelect mode, or by sessions of SetSticky. A hash key of WithHashKey,
+// or a session key of SetSticky, takes precedence over it.
+func WithAffinityKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, affinityKey{}, key)
+}
+
+// hashKeyFrom returns the hash key carried by ctx, or the affinity key if there is none
+func hashKeyFrom(ctx context.Context) (string, bool) {
+	if key, ok := ctx.Value(hashKey{}).(string); ok {
+		return key, true
+	}
+	return affinityKeyFrom(ctx)
+}
+
+// affinityKeyFrom returns the affinity key carried by ctx
+func affinityKeyFrom(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(affinityKey{}).(string)
+	return key, ok
+}
+
+// hashRing places servers on a ring of hashes by their virtual nodes, a key is
+// routed to the first virtual node clockwise from its hash, so that only keys
+// of a server added or removed are remapped when the server set changes
+type hashRing struct {
+	servers []string          // servers on the ring, sorted
+	hashes  []uint32          // hashes of virtual nodes, sorted
+	nodes   map[uint32]string // server of each virtual node
+}
+
+func newHashRing(servers []string) *hashRing {
+	r := &hashRing{
+		servers: append([]string(nil), servers...),
+		hashes:  make([]uint32, 0, len(servers)*hashReplicas),
+		nodes:   make(map[uint32]string, len(servers)*hashReplicas),
+	}
+	sort.Strings(r.servers)
+	for _, server := range r.servers {
+		for i := 0; i < hashReplicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + server))
+			if _, ok := r.nodes[hash]; ok {
+				// collided with a virtual node of another server, keep the first one
+				continue
+			}
+			r.hashes = append(r.hashes, hash)
+			r.nodes[hash] = server
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// has reports whether the ring is built of servers, which are sorted
+func (r *hashRing) has(servers []string) bool {
+	if len(r.servers) != len(servers) {
+		return false
+	}
+	for i, server := range servers {
+		if r.servers[i] != server {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the server of key, empty if there is no server
+func (r *hashRing) get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	return r.nodes[r.hashes[i%len(r.hashes)]]
+}
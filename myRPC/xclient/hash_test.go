@@ -0,0 +1,52 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestHashRing(t *testing.T) {
+	servers := []string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2", "tcp@127.0.0.1:3"}
+	before := newHashRing(servers)
+	after := newHashRing(append(servers, "tcp@127.0.0.1:4"))
+	counts := make(map[string]int)
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprint("user", i)
+		server := before.get(key)
+		counts[server]++
+		if s := after.get(key); s != server {
+			moved++
+			if s != "tcp@127.0.0.1:4" {
+				t.Fatalf("expect key %s only remapped to the new server, but got %s", key, s)
+			}
+		}
+	}
+	for _, server := range servers {
+		if counts[server] < 2000 {
+			t.Fatalf("expect keys spread evenly, but got %v", counts)
+		}
+	}
+	if moved < 1000 || moved > 4000 {
+		t.Fatalf("expect about a quarter of keys remapped, but got %d", moved)
+	}
+}
+
+func TestXClient_ConsistentHash(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2", "tcp@127.0.0.1:3"})
+	xc := NewXClient(d, ConsistentHashSelect, nil)
+	ctx := WithHashKey(context.Background(), "user42")
+	first, err := xc.selectServer(ctx)
+	if err != nil {
+		t.Fatal("failed to select server:", err)
+	}
+	for i := 0; i < 10; i++ {
+		if server, _ := xc.selectServer(ctx); server != first {
+			t.Fatalf("expect calls with the same key routed to %s, but got %s", first, server)
+		}
+	}
+	if _, err = xc.selectServer(context.Background()); err != nil {
+		t.Fatal("expect a call without key routed anywhere, but got", err)
+	}
+}
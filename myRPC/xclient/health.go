@@ -0,0 +1,114 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	. "myRPC"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Probe checks whether the server at addr in format protocol@addr is healthy
+type Probe func(ctx context.Context, addr string) error
+
+// DialProbe is a Probe which connects to the server and closes the connection at once
+func DialProbe(ctx context.Context, addr string) error {
+	protocol, address, ok := strings.Cut(addr, "@")
+	if !ok {
+		return fmt.Errorf("rpc discovery: wrong format '%s', expect protocol@addr", addr)
+	}
+	switch protocol {
+	case "http", "h2", "httppoll", "tls", "mux":
+		protocol = "tcp"
+	case "unix+tls":
+		protocol = "unix"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, protocol, address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// CallProbe returns a Probe which calls serviceMethod of the server with args,
+// eg, a Ping method of a health service. reply is a pointer to a value of the
+// reply type of the method, it's only used for its type.
+func CallProbe(serviceMethod string, args, reply interface{}, opt *Option) Probe {
+	replyType := reflect.TypeOf(reply).Elem()
+	return func(ctx context.Context, addr string) error {
+		client, err := XDial(addr, opt)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = client.Close() }()
+		return client.Call(ctx, serviceMethod, args, reflect.New(replyType).Interface())
+	}
+}
+
+// HealthCheck probes servers every interval until ctx is done, a server failing
+// the probe is excluded from Get and GetAll until it passes again. If all servers
+// fail, none of them is excluded, the probe itself may be broken.
+// It's typically invoked in a go statement.
+func (d *MultiServersDiscovery) HealthCheck(ctx context.Context, interval time.Duration, probe Probe) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		d.checkHealth(ctx, interval, probe)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkHealth probes all servers at once, each probe times out after timeout
+func (d *MultiServersDiscovery) checkHealth(ctx context.Context, timeout time.Duration, probe Probe) {
+	d.mu.RLock()
+	servers := append([]string(nil), d.servers...)
+	d.mu.RUnlock()
+	var wg sync.WaitGroup
+	var mu sync.Mutex // protect unhealthy
+	unhealthy := make(map[string]bool)
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			if err := probe(ctx, server); err != nil && ctx.Err() != context.Canceled {
+				mu.Lock()
+				unhealthy[server] = true
+				mu.Unlock()
+			}
+		}(server)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.unhealthy = unhealthy
+}
+
+// available returns servers except unhealthy ones, d.mu must be held
+func (d *MultiServersDiscovery) available() []string {
+	if len(d.unhealthy) == 0 {
+		return d.servers
+	}
+	servers := make([]string, 0, len(d.servers))
+	for _, server := range d.servers {
+		if !d.unhealthy[server] {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		return d.servers
+	}
+	return servers
+}
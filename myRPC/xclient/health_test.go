@@ -0,0 +1,43 @@
+package xclient
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMultiServersDiscovery_HealthCheck(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	_ = dead.Close()
+	alive, down := "tcp@"+l.Addr().String(), "tcp@"+dead.Addr().String()
+
+	d := NewMultiServersDiscovery([]string{alive, down})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.HealthCheck(ctx, time.Millisecond*50, DialProbe)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if servers, _ := d.GetAll(); len(servers) == 1 && servers[0] == alive {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expect the server down excluded")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	for i := 0; i < 10; i++ {
+		if server, _ := d.Get(RoundRobinSelect); server != alive {
+			t.Fatalf("expect only the healthy server selected, but got %s", server)
+		}
+	}
+
+	// none is excluded if all servers fail
+	cancel()
+	d.checkHealth(context.Background(), time.Millisecond*50, func(ctx context.Context, addr string) error { return net.ErrClosed })
+	if servers, _ := d.GetAll(); len(servers) != 2 {
+		t.Fatalf("expect all servers if none of them is healthy, but got %v", servers)
+	}
+}
@@ -0,0 +1,30 @@
+package xclient
+
+import (
+	"context"
+)
+
+// Invoker makes the call of serviceMethod to the server at target
+type Invoker func(ctx context.Context, serviceMethod string, args, reply interface{}, target string) error
+
+// Interceptor wraps each call to a server made by XClient, including retries,
+// broadcasts and mirrored calls, eg, for tracing or authentication. It calls
+// invoker to go on with the call, or returns an error to stop it.
+type Interceptor func(ctx context.Context, serviceMethod string, args, reply interface{}, target string, invoker Invoker) error
+
+// SetInterceptors makes calls of xc go through interceptors, the first one is
+// the outermost. It should be called before xc is used.
+func (xc *XClient) SetInterceptors(interceptors ...Interceptor) {
+	xc.interceptors = interceptors
+}
+
+// intercept chains interceptors of xc around invoker
+func (xc *XClient) intercept(invoker Invoker) Invoker {
+	for i := len(xc.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := xc.interceptors[i], invoker
+		invoker = func(ctx context.Context, serviceMethod string, args, reply interface{}, target string) error {
+			return interceptor(ctx, serviceMethod, args, reply, target, next)
+		}
+	}
+	return invoker
+}
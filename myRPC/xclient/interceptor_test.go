@@ -0,0 +1,39 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestXClient_SetInterceptors(t *testing.T) {
+	addr := startServer(t, 0)
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var trace []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, serviceMethod string, args, reply interface{}, target string, invoker Invoker) error {
+			trace = append(trace, name+" "+serviceMethod+" "+target)
+			return invoker(ctx, serviceMethod, args, reply, target)
+		}
+	}
+	denied := errors.New("denied")
+	deny := func(ctx context.Context, serviceMethod string, args, reply interface{}, target string, invoker Invoker) error {
+		if serviceMethod == "Foo.Fail" {
+			return denied
+		}
+		return invoker(ctx, serviceMethod, args, reply, target)
+	}
+	xc.SetInterceptors(record("outer"), record("inner"), deny)
+
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect the call passes interceptors, but got %d, %v", reply, err)
+	}
+	if len(trace) != 2 || trace[0] != "outer Foo.Sum "+addr || trace[1] != "inner Foo.Sum "+addr {
+		t.Fatalf("expect interceptors called in order, but got %v", trace)
+	}
+	if err := xc.Call(context.Background(), "Foo.Fail", &Args{}, &reply); err != denied {
+		t.Fatalf("expect the call stopped by interceptor, but got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrConcurrencyLimited is returned by a call rejected by the concurrency limit of XClient
+var ErrConcurrencyLimited = errors.New("rpc xclient: concurrency limit exceeded")
+
+const (
+	// limitTolerance is how many times of the usual latency a call may take
+	// before it's taken as a sign of servers queueing
+	limitTolerance = 2.0
+	// limitBackoff is the ratio the limit is cut to when servers slow down
+	limitBackoff = 0.9
+	// rttWeight is the weight of a new sample in the usual latency
+	rttWeight = 0.05
+)
+
+// limiter limits calls in flight, the limit is adapted by AIMD: it grows by one each
+// round trip while calls are as fast as usual, and is cut by limitBackoff once a call
+// times out or takes limitTolerance times of the usual latency
+type limiter struct {
+	mu       sync.Mutex
+	limit    float64
+	min, max int
+	inFlight int
+	rtt      float64 // usual latency in nanoseconds, 0 if it's unknown
+}
+
+// SetConcurrencyLimit limits calls in flight from xc to a limit adapted to latency of
+// calls, between minLimit and maxLimit, starting at initial. Calls beyond the limit
+// fail at once with ErrConcurrencyLimited rather than piling onto slow servers,
+// each retry of a call counts. It should be called before xc is used.
+func (xc *XClient) SetConcurrencyLimit(initial, minLimit, maxLimit int) {
+	minLimit = max(minLimit, 1)
+	maxLimit = max(maxLimit, minLimit)
+	initial = min(max(initial, minLimit), maxLimit)
+	xc.limiter = &limiter{limit: float64(initial), min: minLimit, max: maxLimit}
+}
+
+// Limit returns the current concurrency limit of xc, 0 if there is no limit
+func (xc *XClient) Limit() int {
+	if xc.limiter == nil {
+		return 0
+	}
+	xc.limiter.mu.Lock()
+	defer xc.limiter.mu.Unlock()
+	return int(xc.limiter.limit)
+}
+
+// acquire reports whether a call can be made under the limit
+func (l *limiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// release adapts the limit to the outcome of a call acquired
+func (l *limiter) release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	inFlight := l.inFlight
+	l.inFlight--
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	sample := float64(latency)
+	slow := errors.Is(err, context.DeadlineExceeded) || l.rtt > 0 && sample > l.rtt*limitTolerance
+	switch {
+	case l.rtt == 0:
+		l.rtt = sample
+	case !errors.Is(err, context.DeadlineExceeded):
+		l.rtt = l.rtt*(1-rttWeight) + sample*rttWeight
+	}
+	if slow {
+		l.limit = max(l.limit*limitBackoff, float64(l.min))
+	} else if float64(inFlight)*2 >= l.limit {
+		// only grow while the limit is in use
+		l.limit = min(l.limit+1/l.limit, float64(l.max))
+	}
+}
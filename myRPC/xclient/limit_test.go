@@ -0,0 +1,63 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	xc := &XClient{}
+	xc.SetConcurrencyLimit(2, 1, 4)
+	l := xc.limiter
+	if !l.acquire() || !l.acquire() || l.acquire() {
+		t.Fatal("limit 2 isn't enforced")
+	}
+	l.release(time.Millisecond*10, nil)
+	l.release(time.Millisecond*10, nil)
+	// grows while calls are as fast as usual
+	for i := 0; i < 100; i++ {
+		l.acquire()
+		l.acquire()
+		l.release(time.Millisecond*10, nil)
+		l.release(time.Millisecond*10, nil)
+	}
+	if n := xc.Limit(); n != 4 {
+		t.Fatalf("limit = %d, expect it grows to max 4", n)
+	}
+	// cut when servers slow down
+	l.acquire()
+	l.release(time.Millisecond*100, nil)
+	if n := xc.Limit(); n != 3 {
+		t.Fatalf("limit = %d after a slow call, expect 3", n)
+	}
+	for i := 0; i < 20; i++ {
+		l.acquire()
+		l.release(time.Second, fmt.Errorf("rpc client: call failed: %w", context.DeadlineExceeded))
+	}
+	if n := xc.Limit(); n != 1 {
+		t.Fatalf("limit = %d after timeouts, expect min 1", n)
+	}
+}
+
+func TestXClient_ConcurrencyLimit(t *testing.T) {
+	addr := startServer(t, time.Millisecond*100)
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetConcurrencyLimit(1, 1, 1)
+	xc.SetFailMode(Failover, 3)
+	done := make(chan error)
+	go func() {
+		var reply int
+		done <- xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	}()
+	time.Sleep(time.Millisecond * 30)
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != ErrConcurrencyLimited {
+		t.Fatalf("err = %v, expect ErrConcurrencyLimited", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
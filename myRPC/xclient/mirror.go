@@ -0,0 +1,64 @@
+package xclient
+
+import (
+	"context"
+	"math/rand"
+	"myRPC/internal/rpclog"
+	"reflect"
+	"time"
+)
+
+const (
+	defaultMirrorTimeout = time.Second * 10
+	// maxMirrorCalls is the most mirrored calls in flight, calls beyond are not mirrored,
+	// so that a slow shadow server can't pile up goroutines
+	maxMirrorCalls = 64
+)
+
+// SetMirror mirrors fraction of calls to the shadow server at rpcAddr, eg, a new build
+// to validate against real traffic. Mirrored calls are made asynchronously, once for
+// each call however it's retried, calls to a target server aren't mirrored. Replies and
+// errors of mirrored calls are ignored, and they don't affect how servers are selected. Args of a mirrored call are read after Call returns, so they
+// shouldn't be modified then. It should be called before xc is used.
+func (xc *XClient) SetMirror(rpcAddr string, fraction float64) {
+	xc.mirrorAddr, xc.mirrorFraction = rpcAddr, fraction
+	xc.mirrorCalls = make(chan struct{}, maxMirrorCalls)
+}
+
+// mirror calls the shadow server in a new goroutine if the call is sampled
+func (xc *XClient) mirror(ctx context.Context, serviceMethod string, args, reply interface{}) {
+	if xc.mirrorAddr == "" || rand.Float64() >= xc.mirrorFraction || callOptionsFrom(ctx).target != "" {
+		return
+	}
+	select {
+	case xc.mirrorCalls <- struct{}{}:
+	default:
+		return
+	}
+	if !xc.begin() {
+		<-xc.mirrorCalls
+		return
+	}
+	// the mirrored call isn't canceled with the call, but has the same deadline
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultMirrorTimeout)
+	}
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	var shadowReply interface{}
+	if reply != nil {
+		shadowReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+	}
+	go func() {
+		defer func() { <-xc.mirrorCalls }()
+		defer xc.end()
+		defer cancel()
+		client, err := xc.dial(xc.mirrorAddr)
+		if err == nil {
+			err = client.Call(ctx, serviceMethod, args, shadowReply)
+		}
+		if err != nil {
+			rpclog.Warn("rpc xclient: mirror call", "server", xc.mirrorAddr, "err", err)
+		}
+	}()
+}
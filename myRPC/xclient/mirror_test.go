@@ -0,0 +1,40 @@
+package xclient
+
+import (
+	"context"
+	"myRPC"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestXClient_Mirror(t *testing.T) {
+	primary := startServer(t, 0)
+	shadow := &Foo{}
+	server := myRPC.NewServer()
+	_ = server.Register(shadow)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+	go server.Accept(l)
+
+	xc := NewXClient(NewMultiServersDiscovery([]string{primary}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetMirror("tcp@"+l.Addr().String(), 1)
+	var reply int
+	for i := 0; i < 5; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("reply = %d, err: %v", reply, err)
+		}
+	}
+	_ = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply, WithTargetServer(primary))
+	for i := 0; shadow.calls.Load() < 5; i++ {
+		if i == 100 {
+			t.Fatalf("%d calls mirrored, expect 5", shadow.calls.Load())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	time.Sleep(time.Millisecond * 20)
+	if n := shadow.calls.Load(); n != 5 {
+		t.Fatalf("%d calls mirrored, expect 5", n)
+	}
+}
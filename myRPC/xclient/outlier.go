@@ -0,0 +1,170 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	. "myRPC"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutlierDetection configures how XClient ejects servers performing much worse
+// than the others, zero fields are set to their defaults
+type OutlierDetection struct {
+	Interval           time.Duration // how often servers are evaluated by calls in the interval, 10s by default
+	BaseEjectionTime   time.Duration // a server is ejected for it, doubled each time it's ejected again, 30s by default
+	MaxEjectionPercent int           // most servers ejected at the same time, 10% by default, but at least one
+	MinRequests        int           // calls a server is evaluated by at least, 5 by default
+	MinErrRate         float64       // error rate a server is ejected above at least, 0.1 by default
+	ErrRateFactor      float64       // eject a server whose error rate exceeds the mean of the pool by this factor, 1.5 by default
+	LatencyFactor      float64       // eject a server whose mean latency exceeds the median of the pool by this factor, 0 means never
+}
+
+// outliers evaluates servers every interval and ejects outliers
+type outliers struct {
+	mu      sync.Mutex
+	opt     OutlierDetection
+	last    time.Time // when servers were evaluated last time
+	servers map[string]*outlierStats
+	events  *EventBus // of the XClient, ServerEvicted of servers ejected is published on it
+}
+
+type outlierStats struct {
+	calls     int
+	failures  int
+	latency   time.Duration // sum of latency of calls
+	ejections int           // times ejected in a row, reset once the server is fine
+	until     time.Time     // ejected until
+}
+
+// SetOutlierDetection ejects servers whose error rate or latency is an outlier of
+// servers, they're not selected until ejection time passes. A server ejected again
+// is ejected twice as long as the last time. If all servers are ejected, they're
+// all selected. It should be called before xc is used.
+func (xc *XClient) SetOutlierDetection(opt OutlierDetection) {
+	if opt.Interval <= 0 {
+		opt.Interval = time.Second * 10
+	}
+	if opt.BaseEjectionTime <= 0 {
+		opt.BaseEjectionTime = time.Second * 30
+	}
+	if opt.MaxEjectionPercent <= 0 {
+		opt.MaxEjectionPercent = 10
+	}
+	if opt.MinRequests <= 0 {
+		opt.MinRequests = 5
+	}
+	if opt.MinErrRate <= 0 {
+		opt.MinErrRate = 0.1
+	}
+	if opt.ErrRateFactor <= 0 {
+		opt.ErrRateFactor = 1.5
+	}
+	xc.outliers = &outliers{opt: opt, last: time.Now(), servers: make(map[string]*outlierStats), events: &xc.events}
+}
+
+// observe records the result of a call to server, like breakers
+// errors returned by the method don't count
+func (o *outliers) observe(server string, latency time.Duration, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := o.servers[server]
+	if s == nil {
+		s = &outlierStats{}
+		o.servers[server] = s
+	}
+	s.calls++
+	s.latency += latency
+	if err != nil && retryable(err) {
+		s.failures++
+	}
+}
+
+// filter returns servers not ejected, or all servers if they're all ejected,
+// servers are evaluated first if the interval has passed
+func (o *outliers) filter(servers []string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	if now.Sub(o.last) >= o.opt.Interval {
+		o.evaluate(servers, now)
+	}
+	allowed := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if s := o.servers[server]; s == nil || !now.Before(s.until) {
+			allowed = append(allowed, server)
+		}
+	}
+	if len(allowed) == 0 {
+		return servers
+	}
+	return allowed
+}
+
+// evaluate ejects outliers of servers by calls in the past interval, o.mu must be held
+func (o *outliers) evaluate(servers []string, now time.Time) {
+	o.last = now
+	type candidate struct {
+		server  string
+		errRate float64
+		latency time.Duration
+	}
+	var candidates []candidate
+	var errRateSum float64
+	ejected := 0
+	for _, server := range servers {
+		s := o.servers[server]
+		if s == nil {
+			continue
+		}
+		if now.Before(s.until) {
+			ejected++
+		} else if s.calls >= o.opt.MinRequests {
+			c := candidate{server, float64(s.failures) / float64(s.calls), s.latency / time.Duration(s.calls)}
+			candidates = append(candidates, c)
+			errRateSum += c.errRate
+		}
+	}
+	if len(candidates) > 1 {
+		meanErrRate := errRateSum / float64(len(candidates))
+		latencies := make([]time.Duration, len(candidates))
+		for i, c := range candidates {
+			latencies[i] = c.latency
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		medianLatency := latencies[len(latencies)/2]
+		maxEjected := max(len(servers)*o.opt.MaxEjectionPercent/100, 1)
+		// the worst ones first
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].errRate > candidates[j].errRate })
+		for _, c := range candidates {
+			s := o.servers[c.server]
+			erroneous := c.errRate > o.opt.MinErrRate && c.errRate > meanErrRate*o.opt.ErrRateFactor
+			slow := o.opt.LatencyFactor > 0 && float64(c.latency) > float64(medianLatency)*o.opt.LatencyFactor
+			switch {
+			case (erroneous || slow) && ejected < maxEjected:
+				ejected++
+				s.ejections++
+				s.until = now.Add(o.opt.BaseEjectionTime << min(s.ejections-1, 16))
+				o.events.Publish(ServerEvicted{Time: now, Addr: c.server, Reason: "outlier"})
+			case !erroneous && !slow:
+				s.ejections = 0
+			}
+		}
+	}
+	// start counting the next interval
+	alive := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		alive[server] = true
+	}
+	for server, s := range o.servers {
+		if !alive[server] {
+			delete(o.servers, server)
+		} else {
+			s.calls, s.failures, s.latency = 0, 0, 0
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package xclient
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOutliers(t *testing.T) {
+	xc := &XClient{}
+	xc.SetOutlierDetection(OutlierDetection{Interval: time.Hour, BaseEjectionTime: time.Minute, MaxEjectionPercent: 50})
+	o := xc.outliers
+	servers := []string{"a", "b", "c", "d"}
+	failed := errors.New("connection refused")
+	for i := 0; i < 10; i++ {
+		for _, server := range servers {
+			o.observe(server, time.Millisecond, nil)
+		}
+		o.observe("a", time.Millisecond, failed)
+	}
+	o.last = time.Time{} // evaluate now
+	if got := o.filter(servers); !reflect.DeepEqual(got, []string{"b", "c", "d"}) {
+		t.Fatalf("servers after evaluation = %v, expect a ejected", got)
+	}
+	if until := o.servers["a"].until; time.Until(until) > time.Minute {
+		t.Fatalf("ejected for %v the first time", time.Until(until))
+	}
+
+	// ejected again for twice as long after the ejection passes
+	o.servers["a"].until = time.Now()
+	for i := 0; i < 10; i++ {
+		o.observe("a", time.Millisecond, failed)
+		o.observe("b", time.Millisecond, nil)
+	}
+	o.last = time.Time{}
+	if got := o.filter(servers); !reflect.DeepEqual(got, []string{"b", "c", "d"}) {
+		t.Fatalf("servers after evaluation = %v, expect a ejected again", got)
+	}
+	if d := time.Until(o.servers["a"].until); d <= time.Minute || d > time.Minute*2 {
+		t.Fatalf("ejected for %v the second time", d)
+	}
+
+	// failures of the whole pool aren't outliers
+	o.servers["a"].until = time.Now()
+	for i := 0; i < 10; i++ {
+		for _, server := range servers {
+			o.observe(server, time.Millisecond, failed)
+		}
+	}
+	o.last = time.Time{}
+	if got := o.filter(servers); !reflect.DeepEqual(got, servers) {
+		t.Fatalf("servers after evaluation = %v, expect none ejected", got)
+	}
+	if n := o.servers["a"].ejections; n != 0 {
+		t.Fatalf("ejections = %d after a is fine, expect 0", n)
+	}
+}
+
+func TestOutliers_Latency(t *testing.T) {
+	xc := &XClient{}
+	xc.SetOutlierDetection(OutlierDetection{Interval: time.Hour, LatencyFactor: 3})
+	o := xc.outliers
+	servers := []string{"a", "b", "c"}
+	for i := 0; i < 5; i++ {
+		o.observe("a", time.Second, nil)
+		o.observe("b", time.Millisecond*10, nil)
+		o.observe("c", time.Millisecond*12, nil)
+	}
+	o.last = time.Time{}
+	if got := o.filter(servers); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("servers after evaluation = %v, expect slow a ejected", got)
+	}
+}
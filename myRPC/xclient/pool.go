@@ -0,0 +1,135 @@
+package xclient
+
+import (
+	. "myRPC"
+	"myRPC/internal/rpclog"
+	"time"
+)
+
+// clientPool is the connections to a server, used in turn
+type clientPool struct {
+	clients []*Client
+	next    int // index of the client used for the next call
+}
+
+// isAvailable reports whether any connection of the pool is still usable
+func (p *clientPool) isAvailable() bool {
+	for _, client := range p.clients {
+		if client.IsAvailable() {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPoolSize keeps up to size connections to each server, calls are spread over
+// them in turn so that a busy server isn't bottlenecked on a single connection.
+// Connections are dialed as calls need them, or as soon as servers are discovered
+// if warm is true. Idle connections are closed as SetMaxIdle says.
+// It should be called before xc is used.
+func (xc *XClient) SetPoolSize(size int, warm bool) {
+	xc.mu.Lock()
+	xc.poolSize, xc.warm = max(size, 1), warm
+	xc.mu.Unlock()
+	if !warm {
+		return
+	}
+	// servers discovered so far were told about before warm is set
+	for _, d := range xc.discoveries() {
+		if all, err := d.GetAll(); err == nil {
+			xc.warmUp(d, all)
+		}
+	}
+}
+
+// warmUp dials connections to servers of d in background until their pools are full,
+// only servers of the subset of xc are dialed
+func (xc *XClient) warmUp(d Discovery, servers []string) {
+	xc.mu.Lock()
+	warm := xc.warm
+	xc.mu.Unlock()
+	if !warm || len(servers) == 0 {
+		return
+	}
+	go func() {
+		if xc.subsetSize > 0 {
+			all, err := d.GetAll()
+			if err != nil {
+				rpclog.Warn("rpc xclient: warm up", "err", err)
+				return
+			}
+			servers = inSubset(servers, xc.subset(all))
+		}
+		for _, rpcAddr := range servers {
+			if err := xc.fill(rpcAddr); err != nil {
+				rpclog.Warn("rpc xclient: warm up", "server", rpcAddr, "err", err)
+			}
+		}
+	}()
+}
+
+// inSubset returns servers which are in subset
+func inSubset(servers, subset []string) []string {
+	in := make(map[string]bool, len(subset))
+	for _, server := range subset {
+		in[server] = true
+	}
+	var filtered []string
+	for _, server := range servers {
+		if in[server] {
+			filtered = append(filtered, server)
+		}
+	}
+	return filtered
+}
+
+// fill dials connections to server at rpcAddr until its pool is full. They are dialed
+// without holding xc.mu, so those beyond the pool size once dialed, eg, made by calls
+// meanwhile, or dialed once xc is closed, are closed.
+func (xc *XClient) fill(rpcAddr string) error {
+	xc.mu.Lock()
+	missing := xc.poolSize
+	if pool := xc.clients[rpcAddr]; pool != nil {
+		missing -= len(pool.clients)
+	}
+	xc.mu.Unlock()
+	var dialed []*Client
+	var err error
+	for len(dialed) < missing {
+		var client *Client
+		if client, err = XDial(rpcAddr, xc.opt); err != nil {
+			break
+		}
+		dialed = append(dialed, client)
+	}
+	if len(dialed) == 0 {
+		return err
+	}
+
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	pool := xc.clients[rpcAddr]
+	if pool == nil {
+		pool = &clientPool{}
+	}
+	for _, client := range dialed {
+		if xc.closing.Load() || len(pool.clients) >= xc.poolSize {
+			_ = client.Close()
+			continue
+		}
+		pool.clients = append(pool.clients, client)
+		if xc.statsHandler != nil {
+			xc.statsHandler.HandleConn(rpcAddr, true)
+		}
+	}
+	if len(pool.clients) == 0 {
+		return err
+	}
+	xc.clients[rpcAddr] = pool
+	if xc.lastUsed != nil {
+		if _, ok := xc.lastUsed[rpcAddr]; !ok {
+			xc.lastUsed[rpcAddr] = time.Now()
+		}
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package xclient
+
+import (
+	"context"
+	"myRPC"
+	"testing"
+	"time"
+)
+
+func TestXClient_SetPoolSize(t *testing.T) {
+	addr := startServer(t, 0)
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetPoolSize(3, false)
+	poolSize := func() int {
+		xc.mu.Lock()
+		defer xc.mu.Unlock()
+		if pool := xc.clients[addr]; pool != nil {
+			return len(pool.clients)
+		}
+		return 0
+	}
+	var reply int
+	for i := 0; i < 5; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := poolSize(); n != 3 {
+		t.Fatalf("%d connections dialed, expect 3", n)
+	}
+
+	// a broken connection is replaced alone
+	xc.mu.Lock()
+	broken := xc.clients[addr].clients[0]
+	_ = broken.Close()
+	xc.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	xc.mu.Lock()
+	pool := xc.clients[addr]
+	replaced := len(pool.clients) == 3 && pool.clients[0] != broken && pool.isAvailable()
+	xc.mu.Unlock()
+	if !replaced {
+		t.Fatal("expect the broken connection replaced")
+	}
+}
+
+func TestXClient_WarmPool(t *testing.T) {
+	addr := startServer(t, 0)
+	d := NewMultiServersDiscovery([]string{})
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetPoolSize(2, true)
+	_ = d.Update([]string{addr})
+	for i := 0; ; i++ {
+		xc.mu.Lock()
+		pool := xc.clients[addr]
+		warm := pool != nil && len(pool.clients) == 2
+		xc.mu.Unlock()
+		if warm {
+			return
+		}
+		if i == 100 {
+			t.Fatal("expect connections dialed once the server is discovered")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestXClient_DialDropsBroken(t *testing.T) {
+	addr := startServer(t, 0)
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	broken, err := myRPC.XDial(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = broken.Close()
+	// nothing listens at the port, so redialing fails
+	refused := "tcp@127.0.0.1:1"
+	xc.mu.Lock()
+	xc.clients[refused] = &clientPool{clients: []*myRPC.Client{broken}}
+	xc.mu.Unlock()
+	if _, err := xc.dial(refused); err == nil {
+		t.Fatal("expect redialing the server to fail")
+	}
+	xc.mu.Lock()
+	_, ok := xc.clients[refused]
+	xc.mu.Unlock()
+	if ok {
+		t.Fatal("expect the broken connection dropped though redialing fails")
+	}
+}
+
+func TestXClient_WarmSubset(t *testing.T) {
+	servers := []string{startServer(t, 0), startServer(t, 0), startServer(t, 0)}
+	d := NewMultiServersDiscovery([]string{})
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetSubset("client", 1)
+	xc.SetPoolSize(1, true)
+	_ = d.Update(servers)
+	subset := xc.subset(servers)[0]
+	for i := 0; ; i++ {
+		xc.mu.Lock()
+		warm := xc.clients[subset] != nil
+		xc.mu.Unlock()
+		if warm {
+			break
+		}
+		if i == 100 {
+			t.Fatal("expect connections dialed to the server of the subset")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if len(xc.clients) != 1 {
+		t.Fatalf("expect only the server of the subset warmed up, but got %d servers", len(xc.clients))
+	}
+}
@@ -0,0 +1,37 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestXClient_PriorityGroups(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"local", "remote", "other"})
+	d.meta = map[string]ServerMeta{"local": {Zone: "dc1"}, "remote": {Zone: "dc2"}}
+	xc := NewXClient(d, RandomSelect, nil)
+	xc.SetPriorityGroups(Route{Zone: "dc1"}, Route{Zone: "dc2"})
+	expect := func(want string) {
+		t.Helper()
+		for i := 0; i < 20; i++ {
+			if server, err := xc.selectServer(context.Background()); err != nil || server != want {
+				t.Fatalf("server = %s, err: %v, expect %s", server, err, want)
+			}
+		}
+	}
+	expect("local")
+	// local fails, remote is the fallback
+	for i := 0; i < 10; i++ {
+		xc.stats.observe("local", 0, errors.New("connection refused"))
+	}
+	expect("remote")
+	_ = d.Update([]string{"other", "local"})
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		server, _ := xc.selectServer(context.Background())
+		counts[server]++
+	}
+	if counts["other"] == 0 || counts["local"] == 0 {
+		t.Fatalf("servers selected %v, expect all when no group is available", counts)
+	}
+}
@@ -0,0 +1,92 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// QuorumCall invokes the named function for every server registered in discovery,
+// and succeeds as soon as n servers return equal replies, which is set to reply,
+// then the unfinished calls are canceled. It fails once n equal replies can't be
+// reached any more, with the error of a failed call if there is one.
+func (xc *XClient) QuorumCall(ctx context.Context, serviceMethod string, args, reply interface{}, n int) error {
+	if !xc.begin() {
+		return ErrClosed
+	}
+	defer xc.end()
+	servers, err := xc.discovery(xc.withService(ctx, serviceMethod)).GetAll()
+	if err != nil {
+		return err
+	}
+	if n <= 0 || n > len(servers) {
+		return fmt.Errorf("rpc xclient: quorum %d of %d servers can't be reached", n, len(servers))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancel unfinished calls when quorum is reached
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	done := make(chan *result, len(servers))
+	slots := xc.broadcastSlots()
+	for _, rpcAddr := range servers {
+		go func(rpcAddr string) {
+			var clonedReply interface{}
+			if reply != nil {
+				clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+			}
+			err := xc.broadcastCall(slots, rpcAddr, ctx, serviceMethod, args, clonedReply)
+			done <- &result{reply: clonedReply, err: err}
+		}(rpcAddr)
+	}
+	var groups []*quorumGroup // successful replies grouped by equality
+	var firstErr error
+	for pending := len(servers); pending > 0; pending-- {
+		r := <-done
+		largest := 0
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		} else {
+			g := findGroup(groups, r.reply)
+			if g == nil {
+				g = &quorumGroup{reply: r.reply}
+				groups = append(groups, g)
+			}
+			if g.count++; g.count >= n {
+				if reply != nil {
+					reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(g.reply).Elem())
+				}
+				return nil
+			}
+		}
+		for _, g := range groups {
+			largest = max(largest, g.count)
+		}
+		if largest+pending-1 < n {
+			// even if all calls left agree with the largest group
+			break
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return fmt.Errorf("rpc xclient: replies of %d servers don't agree", n)
+}
+
+// quorumGroup is a reply and how many servers returned it
+type quorumGroup struct {
+	reply interface{}
+	count int
+}
+
+func findGroup(groups []*quorumGroup, reply interface{}) *quorumGroup {
+	for _, g := range groups {
+		if reflect.DeepEqual(g.reply, reply) {
+			return g
+		}
+	}
+	return nil
+}
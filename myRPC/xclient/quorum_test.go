@@ -0,0 +1,27 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestXClient_QuorumCall(t *testing.T) {
+	a, b, c := startServer(t, 0), startServer(t, 0), startServer(t, time.Millisecond*50)
+	xc := NewXClient(NewMultiServersDiscovery([]string{a, b, c, deadServer()}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var reply int
+	if err := xc.QuorumCall(context.Background(), "Foo.Sum", Args{1, 2}, &reply, 3); err != nil || reply != 3 {
+		t.Fatalf("expect quorum of 3 reached, but got %d, %v", reply, err)
+	}
+	if err := xc.QuorumCall(context.Background(), "Foo.Sum", Args{1, 2}, &reply, 4); err == nil {
+		t.Fatal("expect quorum of 4 not reached with a dead server")
+	}
+	var delay time.Duration
+	if err := xc.QuorumCall(context.Background(), "Foo.Delay", Args{}, &delay, 2); err != nil || delay != 0 {
+		t.Fatalf("expect the reply 2 servers agree, but got %s, %v", delay, err)
+	}
+	if err := xc.QuorumCall(context.Background(), "Foo.Delay", Args{}, &delay, 3); err == nil {
+		t.Fatal("expect quorum of 3 not reached with replies differing")
+	}
+}
@@ -0,0 +1,123 @@
+package xclient
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+)
+
+// Route matches servers by their metadata, eg, registered to CenterRegistry
+type Route struct {
+	Version string            // version of servers, any version if it's empty
+	Zone    string            // zone of servers, any zone if it's empty
+	Labels  map[string]string // labels servers have all of
+}
+
+// match reports whether a server of meta matches r
+func (r Route) match(meta ServerMeta) bool {
+	if r.Version != "" && meta.Version != r.Version || r.Zone != "" && meta.Zone != r.Zone {
+		return false
+	}
+	for k, v := range r.Labels {
+		if meta.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// routes decides which servers a call may go to
+type routes struct {
+	keyed    []keyedRoute
+	versions []string // versions calls are split among
+	weights  []int    // cumulative weights of versions
+}
+
+// keyedRoute routes calls carrying key=value to servers matching route
+type keyedRoute struct {
+	key, value string
+	route      Route
+}
+
+type routeKey struct{ key string }
+
+// WithRouteKey returns a context carrying key=value, a call made with it goes
+// to servers of the route set for key=value by XClient.SetRoute
+func WithRouteKey(ctx context.Context, key, value string) context.Context {
+	return context.WithValue(ctx, routeKey{key}, value)
+}
+
+// SetRoute sends calls carrying key=value by WithRouteKey to servers matching route,
+// eg, canary=true to servers labeled track=canary. Servers matching route only
+// serve such calls. Calls go to other servers if none matches route.
+// It should be called before xc is used.
+func (xc *XClient) SetRoute(key, value string, route Route) {
+	if xc.routes == nil {
+		xc.routes = &routes{}
+	}
+	xc.routes.keyed = append(xc.routes.keyed, keyedRoute{key: key, value: value, route: route})
+}
+
+// SetVersionSplit splits calls among servers by their versions, in proportion to
+// weights of versions, eg, {"v1": 95, "v2": 5} sends 5% of calls to servers of v2,
+// and the rest to v1. Calls split to a version without servers go to any server.
+// It should be called before xc is used.
+func (xc *XClient) SetVersionSplit(weights map[string]int) {
+	if xc.routes == nil {
+		xc.routes = &routes{}
+	}
+	versions := make([]string, 0, len(weights))
+	for version, weight := range weights {
+		if weight > 0 {
+			versions = append(versions, version)
+		}
+	}
+	sort.Strings(versions)
+	total := 0
+	xc.routes.versions, xc.routes.weights = versions, make([]int, len(versions))
+	for i, version := range versions {
+		total += weights[version]
+		xc.routes.weights[i] = total
+	}
+}
+
+// route returns servers the call made with ctx may go to
+func (xc *XClient) route(ctx context.Context, servers []string) []string {
+	r := xc.routes
+	var reserved []Route // routes of keys the call doesn't carry
+	for _, kr := range r.keyed {
+		if value, ok := ctx.Value(routeKey{kr.key}).(string); ok && value == kr.value {
+			if matched := xc.matchRoute(servers, kr.route, true); len(matched) > 0 {
+				return matched
+			}
+			continue
+		}
+		reserved = append(reserved, kr.route)
+	}
+	rest := servers
+	for _, route := range reserved {
+		if left := xc.matchRoute(rest, route, false); len(left) > 0 {
+			rest = left
+		}
+	}
+	if len(r.versions) == 0 {
+		return rest
+	}
+	n := rand.Intn(r.weights[len(r.weights)-1])
+	version := r.versions[sort.SearchInts(r.weights, n+1)]
+	if matched := xc.matchRoute(rest, Route{Version: version}, true); len(matched) > 0 {
+		return matched
+	}
+	return rest
+}
+
+// matchRoute returns servers which match route if matched is true, or which don't otherwise
+func (xc *XClient) matchRoute(servers []string, route Route, matched bool) []string {
+	var result []string
+	for _, server := range servers {
+		if route.match(xc.meta(server)) == matched {
+			result = append(result, server)
+		}
+	}
+	return result
+}
@@ -0,0 +1,42 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+)
+
+func TestXClient_Route(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"v1-a", "v1-b", "v2", "canary"})
+	d.meta = map[string]ServerMeta{
+		"v1-a":   {Version: "v1"},
+		"v1-b":   {Version: "v1"},
+		"v2":     {Version: "v2"},
+		"canary": {Version: "v2", Labels: map[string]string{"track": "canary"}},
+	}
+	xc := NewXClient(d, RandomSelect, nil)
+	xc.SetRoute("canary", "true", Route{Labels: map[string]string{"track": "canary"}})
+	xc.SetVersionSplit(map[string]int{"v1": 80, "v2": 20})
+
+	canaryCtx := WithRouteKey(context.Background(), "canary", "true")
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		server, err := xc.selectServer(canaryCtx)
+		if err != nil || server != "canary" {
+			t.Fatalf("canary call goes to %s, err: %v", server, err)
+		}
+		server, _ = xc.selectServer(context.Background())
+		counts[server]++
+	}
+	if counts["canary"] > 0 {
+		t.Fatalf("%d calls without key go to canary", counts["canary"])
+	}
+	if v2 := counts["v2"]; v2 < 120 || v2 > 280 {
+		t.Fatalf("%d of 1000 calls go to v2, expect about 200", v2)
+	}
+
+	// calls go to any server if no server matches
+	xc.SetVersionSplit(map[string]int{"v3": 1})
+	if server, err := xc.selectServer(context.Background()); err != nil || server == "canary" {
+		t.Fatalf("call goes to %s, err: %v", server, err)
+	}
+}
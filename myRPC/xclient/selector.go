@@ -0,0 +1,78 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SelectorFunc selects the server of the call made with ctx among servers,
+// which are never empty
+type SelectorFunc func(ctx context.Context, servers []string) (string, error)
+
+// firstCustomSelectMode is the first mode of selectors registered, modes before
+// it are kept for modes of this package
+const firstCustomSelectMode SelectMode = 100
+
+var (
+	selectorsMu sync.RWMutex
+	selectors   = make(map[SelectMode]SelectorFunc)
+	selectModes = map[string]SelectMode{
+		"random":          RandomSelect,
+		"round_robin":     RoundRobinSelect,
+		"least_load":      LeastLoadSelect,
+		"consistent_hash": ConsistentHashSelect,
+		"least_active":    LeastActiveSelect,
+		"p2c":             P2CSelect,
+		"weighted_random": WeightedRandomSelect,
+	}
+)
+
+// RegisterSelector adds a select mode of selector named name, and returns the mode,
+// which can be used like modes of this package, eg, NewXClient(d, mode, opt), or be
+// looked up by name with ParseSelectMode. XClient selects by selector among servers
+// filtered by it, eg, by routes and circuit breakers. It panics if name is registered
+// already, it's typically called in an init function.
+func RegisterSelector(name string, selector SelectorFunc) SelectMode {
+	selectorsMu.Lock()
+	defer selectorsMu.Unlock()
+	if _, ok := selectModes[name]; ok {
+		panic("rpc xclient: select mode registered twice: " + name)
+	}
+	mode := firstCustomSelectMode + SelectMode(len(selectors))
+	selectors[mode] = selector
+	selectModes[name] = mode
+	return mode
+}
+
+// ParseSelectMode returns the select mode named name, eg, "round_robin", or a
+// mode registered by RegisterSelector
+func ParseSelectMode(name string) (SelectMode, error) {
+	selectorsMu.RLock()
+	defer selectorsMu.RUnlock()
+	mode, ok := selectModes[name]
+	if !ok {
+		return 0, fmt.Errorf("rpc xclient: unknown select mode %q", name)
+	}
+	return mode, nil
+}
+
+// selectorOf returns the selector registered of mode
+func selectorOf(mode SelectMode) (SelectorFunc, bool) {
+	if mode < firstCustomSelectMode {
+		return nil, false
+	}
+	selectorsMu.RLock()
+	defer selectorsMu.RUnlock()
+	selector, ok := selectors[mode]
+	return selector, ok
+}
+
+// selectBy selects the server of the call made with ctx by selector
+func (xc *XClient) selectBy(ctx context.Context, selector SelectorFunc) (string, error) {
+	servers, err := xc.servers(ctx)
+	if err != nil {
+		return "", err
+	}
+	return selector(ctx, servers)
+}
@@ -0,0 +1,34 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegisterSelector(t *testing.T) {
+	first := func(_ context.Context, servers []string) (string, error) {
+		return servers[0], nil
+	}
+	mode, err := ParseSelectMode("first")
+	if err != nil {
+		// registered once when the test runs repeatedly
+		mode = RegisterSelector("first", first)
+	}
+	if m, err := ParseSelectMode("first"); err != nil || m != mode {
+		t.Fatalf("expect the mode registered looked up by name, but got %d, %v", m, err)
+	}
+	if m, _ := ParseSelectMode("round_robin"); m != RoundRobinSelect {
+		t.Fatalf("expect modes of the package looked up by name, but got %d", m)
+	}
+	if _, err = ParseSelectMode("unknown"); err == nil {
+		t.Fatal("expect error for an unknown mode")
+	}
+
+	d := NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2"})
+	xc := NewXClient(d, mode, nil)
+	for i := 0; i < 10; i++ {
+		if server, err := xc.selectServer(context.Background()); err != nil || server != "tcp@127.0.0.1:1" {
+			t.Fatalf("expect the server selected by selector, but got %s, %v", server, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package xclient
+
+import (
+	"context"
+	"strings"
+)
+
+// SetServiceDiscovery makes calls of service discover servers by d instead of the
+// discovery of xc, so that one XClient calls several pools of servers, eg, User.Get
+// goes to servers of NewServiceDiscovery(registryAddr, "User", 0), and Order.Create
+// to another pool. It should be called before xc is used.
+func (xc *XClient) SetServiceDiscovery(service string, d Discovery) {
+	if xc.services == nil {
+		xc.services = make(map[string]Discovery)
+	}
+	xc.services[service] = d
+	xc.subscribe(d)
+}
+
+// withService returns a context carrying the discovery of the service of serviceMethod
+func (xc *XClient) withService(ctx context.Context, serviceMethod string) context.Context {
+	if len(xc.services) == 0 {
+		return ctx
+	}
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return ctx
+	}
+	d, ok := xc.services[serviceMethod[:dot]]
+	if !ok {
+		return ctx
+	}
+	return withCallOptions(ctx, []CallOption{func(o *callOptions) { o.discovery = d }})
+}
+
+// discovery returns the discovery of the call made with ctx
+func (xc *XClient) discovery(ctx context.Context) Discovery {
+	if d := callOptionsFrom(ctx).discovery; d != nil {
+		return d
+	}
+	return xc.d
+}
+
+// discoveries returns all discoveries of xc
+func (xc *XClient) discoveries() []Discovery {
+	discoveries := []Discovery{xc.d}
+	for _, d := range xc.services {
+		discoveries = append(discoveries, d)
+	}
+	return discoveries
+}
@@ -0,0 +1,32 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+)
+
+func TestXClient_ServiceDiscovery(t *testing.T) {
+	fooServer, otherServer := startServer(t, 0), startServer(t, 0)
+	xc := NewXClient(NewMultiServersDiscovery([]string{otherServer}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetServiceDiscovery("Foo", NewMultiServersDiscovery([]string{fooServer}))
+	var reply int
+	for i := 0; i < 5; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	xc.mu.Lock()
+	_, dialedOther := xc.clients[otherServer]
+	xc.mu.Unlock()
+	if dialedOther {
+		t.Fatal("calls of Foo go to servers of the discovery of xc")
+	}
+	if server, _ := xc.selectServer(xc.withService(context.Background(), "Bar.Get")); server != otherServer {
+		t.Fatalf("call of Bar goes to %s, expect %s", server, otherServer)
+	}
+	results, err := xc.BroadcastAll(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	if err != nil || len(results) != 1 || results[fooServer] == nil {
+		t.Fatalf("broadcast results = %v, err: %v", results, err)
+	}
+}
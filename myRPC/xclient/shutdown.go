@@ -0,0 +1,47 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed is returned by calls made after XClient is closed or shutting down
+var ErrClosed = errors.New("rpc xclient: client is closed")
+
+// shutdownPollInterval is how often Shutdown checks whether calls are finished
+const shutdownPollInterval = time.Millisecond * 10
+
+// Shutdown gracefully closes xc: new calls fail with ErrClosed at once, and clients
+// are closed once calls in flight are finished. If ctx is done before that, clients
+// are closed at once, failing the remaining calls, and ctx.Err() is returned.
+func (xc *XClient) Shutdown(ctx context.Context) error {
+	xc.closing.Store(true)
+	t := time.NewTicker(shutdownPollInterval)
+	defer t.Stop()
+	for xc.calls.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			_ = xc.Close()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return xc.Close()
+}
+
+// begin counts a call in flight, it reports false if xc is closing
+func (xc *XClient) begin() bool {
+	// counted before checking, so Shutdown either sees the call or the call sees closing
+	xc.calls.Add(1)
+	if xc.closing.Load() {
+		xc.calls.Add(-1)
+		return false
+	}
+	return true
+}
+
+// end is called when a call counted by begin is finished
+func (xc *XClient) end() {
+	xc.calls.Add(-1)
+}
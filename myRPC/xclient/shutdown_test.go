@@ -0,0 +1,43 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestXClient_Shutdown(t *testing.T) {
+	addr := startServer(t, time.Millisecond*200)
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil)
+	done := make(chan error, 1)
+	call := func() {
+		var reply int
+		done <- xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	}
+	go call()
+	time.Sleep(time.Millisecond * 50)
+	if err := xc.Shutdown(context.Background()); err != nil {
+		t.Fatal("failed to shut down:", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal("expect the call in flight finished, but got", err)
+	}
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); !errors.Is(err, ErrClosed) {
+		t.Fatal("expect a new call rejected, but got", err)
+	}
+
+	// calls still in flight fail when ctx is done
+	xc = NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil)
+	go call()
+	time.Sleep(time.Millisecond * 50)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := xc.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expect shutdown timed out, but got", err)
+	}
+	if err := <-done; err == nil {
+		t.Fatal("expect the call in flight failed by closing")
+	}
+}
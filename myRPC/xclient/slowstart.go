@@ -0,0 +1,81 @@
+package xclient
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// slowStart ramps up the share of calls of servers added after the first discovery
+type slowStart struct {
+	mu      sync.Mutex
+	window  time.Duration
+	started bool                 // servers known at first are not ramped up
+	added   map[string]time.Time // when servers were added, until the window passes
+}
+
+// SetSlowStart ramps up the share of calls of a server added to discovery over window,
+// rather than giving it a full share at once, so its caches and connections warm up
+// first. Servers discovered when it's called are not ramped up. It works with all
+// select modes decided by xc rather than by discovery. It should be called before
+// xc is used.
+func (xc *XClient) SetSlowStart(window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	s := &slowStart{window: window, added: make(map[string]time.Time)}
+	xc.slowStart = s
+	for _, d := range xc.discoveries() {
+		if sub, ok := d.(Subscriber); ok {
+			xc.unsubscribes = append(xc.unsubscribes, sub.Subscribe(s.update))
+		}
+	}
+}
+
+// update records when servers are added
+func (s *slowStart) update(added, removed []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		s.started = true
+		return
+	}
+	now := time.Now()
+	for _, server := range added {
+		s.added[server] = now
+	}
+	for _, server := range removed {
+		delete(s.added, server)
+	}
+}
+
+// filter drops each server warming up at random, it's kept with the probability
+// of the part of window passed since it's added. If all servers are dropped,
+// they're all kept.
+func (s *slowStart) filter(servers []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.added) == 0 {
+		return servers
+	}
+	now := time.Now()
+	kept := make([]string, 0, len(servers))
+	for _, server := range servers {
+		added, ok := s.added[server]
+		if !ok {
+			kept = append(kept, server)
+			continue
+		}
+		age := now.Sub(added)
+		if age >= s.window {
+			delete(s.added, server)
+			kept = append(kept, server)
+		} else if rand.Float64()*float64(s.window) < float64(age) {
+			kept = append(kept, server)
+		}
+	}
+	if len(kept) == 0 {
+		return servers
+	}
+	return kept
+}
@@ -0,0 +1,48 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestXClient_SetSlowStart(t *testing.T) {
+	a, b := "tcp@127.0.0.1:1", "tcp@127.0.0.1:2"
+	d := NewMultiServersDiscovery([]string{a})
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetSlowStart(time.Millisecond * 200)
+	waitFor := func(cond func(s *slowStart) bool) {
+		for i := 0; i < 100; i++ {
+			xc.slowStart.mu.Lock()
+			ok := cond(xc.slowStart)
+			xc.slowStart.mu.Unlock()
+			if ok {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		t.Fatal("expect slow start told about servers")
+	}
+	waitFor(func(s *slowStart) bool { return s.started })
+	_ = d.Update([]string{a, b})
+	waitFor(func(s *slowStart) bool { return !s.added[b].IsZero() })
+
+	selected := func() int {
+		n := 0
+		for i := 0; i < 1000; i++ {
+			if server, _ := xc.selectServer(context.Background()); server == b {
+				n++
+			}
+		}
+		return n
+	}
+	// b has a small share just after added
+	if n := selected(); n > 250 {
+		t.Fatalf("the server added is selected %d times of 1000, expect much less than half", n)
+	}
+	time.Sleep(time.Millisecond * 200)
+	if n := selected(); n < 400 {
+		t.Fatalf("the server added is selected %d times of 1000 after window, expect about half", n)
+	}
+}
@@ -0,0 +1,138 @@
+package xclient
+
+import (
+	"myRPC/internal/rpcmetrics"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StatsHandler is told about calls and connections of XClient, eg, to see how calls
+// are balanced among servers and how each server performs from the client side.
+// Its methods are called concurrently and should return quickly.
+type StatsHandler interface {
+	// HandleCall is called when a call to the server at rpcAddr completes,
+	// err includes failures of dialing the server
+	HandleCall(rpcAddr, serviceMethod string, latency time.Duration, err error)
+	// HandleConn is called when a connection to the server at rpcAddr is made or closed
+	HandleConn(rpcAddr string, connected bool)
+}
+
+// SetStatsHandler makes xc tell h about its calls and connections,
+// eg, a Metrics. It should be called before xc is used.
+func (xc *XClient) SetStatsHandler(h StatsHandler) {
+	xc.statsHandler = h
+}
+
+var (
+	callsDesc = prometheus.NewDesc("myrpc_xclient_calls_total",
+		"Number of calls to each server.", []string{"server"}, nil)
+	errorsDesc = prometheus.NewDesc("myrpc_xclient_errors_total",
+		"Number of failed calls to each server.", []string{"server"}, nil)
+	connectionsDesc = prometheus.NewDesc("myrpc_xclient_connections",
+		"Number of connections open to each server.", []string{"server"}, nil)
+	latencyDesc = prometheus.NewDesc("myrpc_xclient_call_duration_seconds",
+		"Latency of calls to each server, dialing included.", []string{"server"}, nil)
+)
+
+// Metrics is a StatsHandler counting calls and connections of each server,
+// they are exported to Prometheus by ServeHTTP, or as a prometheus.Collector
+type Metrics struct {
+	mu      sync.Mutex
+	targets map[string]*TargetStats
+	handler http.Handler
+}
+
+var (
+	_ StatsHandler         = &Metrics{}
+	_ prometheus.Collector = &Metrics{}
+)
+
+// TargetStats is what an XClient sees of a server
+type TargetStats struct {
+	Calls       uint64
+	Errors      uint64
+	Connections int      // connections open
+	Latency     []uint64 // count of calls in each bucket of rpcmetrics.LatencyBuckets, not cumulative
+	LatencySum  time.Duration
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{targets: make(map[string]*TargetStats)}
+	m.handler = rpcmetrics.Handler(m)
+	return m
+}
+
+// target returns stats of the server at rpcAddr, m.mu must be held
+func (m *Metrics) target(rpcAddr string) *TargetStats {
+	t := m.targets[rpcAddr]
+	if t == nil {
+		t = &TargetStats{Latency: make([]uint64, len(rpcmetrics.LatencyBuckets))}
+		m.targets[rpcAddr] = t
+	}
+	return t
+}
+
+func (m *Metrics) HandleCall(rpcAddr, _ string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.target(rpcAddr)
+	t.Calls++
+	if err != nil {
+		t.Errors++
+	}
+	seconds := latency.Seconds()
+	for i, bound := range rpcmetrics.LatencyBuckets {
+		if seconds <= bound {
+			t.Latency[i]++
+			break
+		}
+	}
+	t.LatencySum += latency
+}
+
+func (m *Metrics) HandleConn(rpcAddr string, connected bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if connected {
+		m.target(rpcAddr).Connections++
+	} else {
+		m.target(rpcAddr).Connections--
+	}
+}
+
+// Targets returns a copy of stats of every server called
+func (m *Metrics) Targets() map[string]TargetStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	targets := make(map[string]TargetStats, len(m.targets))
+	for rpcAddr, t := range m.targets {
+		stats := *t
+		stats.Latency = append([]uint64(nil), t.Latency...)
+		targets[rpcAddr] = stats
+	}
+	return targets
+}
+
+// ServeHTTP serves metrics to Prometheus
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.handler.ServeHTTP(w, req)
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- callsDesc
+	ch <- errorsDesc
+	ch <- connectionsDesc
+	ch <- latencyDesc
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for rpcAddr, t := range m.Targets() {
+		ch <- prometheus.MustNewConstMetric(callsDesc, prometheus.CounterValue, float64(t.Calls), rpcAddr)
+		ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(t.Errors), rpcAddr)
+		ch <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(t.Connections), rpcAddr)
+		ch <- rpcmetrics.ConstHistogram(latencyDesc, t.Latency, t.Calls, t.LatencySum.Seconds(), rpcAddr)
+	}
+}
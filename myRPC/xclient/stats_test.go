@@ -0,0 +1,46 @@
+package xclient
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestXClient_Metrics(t *testing.T) {
+	alive, dead := startServer(t, 0), deadServer()
+	xc := NewXClient(NewMultiServersDiscovery([]string{alive, dead}), RandomSelect, nil)
+	m := NewMetrics()
+	xc.SetStatsHandler(m)
+	var reply int
+	for i := 0; i < 3; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply, WithTargetServer(alive)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = xc.Call(context.Background(), "Foo.Sum", &Args{}, &reply, WithTargetServer(dead))
+	targets := m.Targets()
+	if s := targets[alive]; s.Calls != 3 || s.Errors != 0 || s.Connections != 1 {
+		t.Fatalf("stats of alive server = %+v", s)
+	}
+	if s := targets[dead]; s.Calls != 1 || s.Errors != 1 || s.Connections != 0 {
+		t.Fatalf("stats of dead server = %+v", s)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`myrpc_xclient_calls_total{server="` + alive + `"} 3`,
+		`myrpc_xclient_errors_total{server="` + dead + `"} 1`,
+		`myrpc_xclient_call_duration_seconds_count{server="` + alive + `"} 3`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("metrics miss %s:\n%s", want, w.Body.String())
+		}
+	}
+
+	_ = xc.Close()
+	if s := m.Targets()[alive]; s.Connections != 0 {
+		t.Fatalf("%d connections left after close", s.Connections)
+	}
+}
@@ -0,0 +1,106 @@
+package xclient
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+const defaultMaxSessions = 1 << 16
+
+// sessions remembers the server chosen for each session key,
+// the least recently used session is forgotten beyond max sessions
+type sessions struct {
+	mu    sync.Mutex
+	keyOf func(ctx context.Context) (string, bool)
+	max   int
+	lru   *list.List // of *session, the most recently used first
+	keys  map[string]*list.Element
+}
+
+type session struct {
+	key    string
+	server string
+}
+
+// SetSticky makes calls of the same session go to the same server until it leaves
+// discovery, the session of a call is keyed by keyOf, eg, a user ID carried by ctx,
+// or by the affinity key of WithAffinityKey if keyOf is nil or finds no key.
+// Calls without session key are routed by mode of xc. At most maxSessions sessions
+// are remembered, the least recently used ones are forgotten, 0 means the default 65536.
+// It should be called before xc is used.
+func (xc *XClient) SetSticky(keyOf func(ctx context.Context) (string, bool), maxSessions int) {
+	if maxSessions <= 0 {
+		maxSessions = defaultMaxSessions
+	}
+	xc.sessions = &sessions{keyOf: keyOf, max: maxSessions, lru: list.New(), keys: make(map[string]*list.Element)}
+}
+
+// key returns the session key of the call made with ctx
+func (s *sessions) key(ctx context.Context) (string, bool) {
+	if s.keyOf != nil {
+		if key, ok := s.keyOf(ctx); ok {
+			return key, true
+		}
+	}
+	return affinityKeyFrom(ctx)
+}
+
+// get returns the server of session key if it's one of servers
+func (s *sessions) get(key string, servers []string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.keys[key]
+	if !ok {
+		return "", false
+	}
+	server := e.Value.(*session).server
+	for _, addr := range servers {
+		if addr == server {
+			s.lru.MoveToFront(e)
+			return server, true
+		}
+	}
+	// the server has left
+	s.lru.Remove(e)
+	delete(s.keys, key)
+	return "", false
+}
+
+func (s *sessions) put(key, server string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.keys[key]; ok {
+		e.Value.(*session).server = server
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.keys[key] = s.lru.PushFront(&session{key: key, server: server})
+	if s.lru.Len() > s.max {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.keys, oldest.Value.(*session).key)
+	}
+}
+
+// stickyServer selects the server of the session of ctx, or selects one by mode
+// and remembers it for the session
+func (xc *XClient) stickyServer(ctx context.Context) (string, error) {
+	key, ok := xc.sessions.key(ctx)
+	if !ok {
+		return xc.selectByMode(ctx)
+	}
+	servers, err := xc.servers(ctx)
+	if err != nil {
+		return "", err
+	}
+	if server, ok := xc.sessions.get(key, servers); ok {
+		return server, nil
+	}
+	server, err := xc.selectByMode(ctx)
+	if err != nil {
+		return "", err
+	}
+	xc.sessions.put(key, server)
+	return server, nil
+}
@@ -0,0 +1,70 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+)
+
+type userKey struct{}
+
+func TestXClient_Sticky(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2", "tcp@127.0.0.1:3"})
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	xc.SetSticky(func(ctx context.Context) (string, bool) {
+		user, ok := ctx.Value(userKey{}).(string)
+		return user, ok
+	}, 2)
+	alice := context.WithValue(context.Background(), userKey{}, "alice")
+	server, _ := xc.selectServer(alice)
+	for i := 0; i < 10; i++ {
+		if s, _ := xc.selectServer(alice); s != server {
+			t.Fatalf("expect the session stuck to %s, but got %s", server, s)
+		}
+	}
+
+	// the session moves when its server leaves
+	var rest []string
+	for _, s := range d.servers {
+		if s != server {
+			rest = append(rest, s)
+		}
+	}
+	_ = d.Update(rest)
+	moved, _ := xc.selectServer(alice)
+	if moved == server {
+		t.Fatalf("expect the session moved from the server left, but got %s", moved)
+	}
+	if s, _ := xc.selectServer(alice); s != moved {
+		t.Fatalf("expect the session stuck to %s, but got %s", moved, s)
+	}
+
+	// the least recently used session is forgotten
+	_, _ = xc.selectServer(context.WithValue(context.Background(), userKey{}, "bob"))
+	_, _ = xc.selectServer(context.WithValue(context.Background(), userKey{}, "carol"))
+	if _, ok := xc.sessions.get("alice", rest); ok {
+		t.Fatal("expect the least recently used session forgotten")
+	}
+}
+
+func TestXClient_AffinityKey(t *testing.T) {
+	servers := []string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2", "tcp@127.0.0.1:3"}
+	sticky := NewXClient(NewMultiServersDiscovery(servers), RoundRobinSelect, nil)
+	sticky.SetSticky(nil, 0)
+	hashed := NewXClient(NewMultiServersDiscovery(servers), ConsistentHashSelect, nil)
+	for _, xc := range []*XClient{sticky, hashed} {
+		ctx := WithAffinityKey(context.Background(), "alice")
+		server, _ := xc.selectServer(ctx)
+		for i := 0; i < 10; i++ {
+			if s, _ := xc.selectServer(ctx); s != server {
+				t.Fatalf("expect calls with the affinity key kept on %s, but got %s", server, s)
+			}
+		}
+	}
+
+	// a hash key takes precedence
+	ctx := WithHashKey(WithAffinityKey(context.Background(), "alice"), "bob")
+	server, _ := hashed.selectServer(ctx)
+	if s, _ := hashed.selectServer(WithHashKey(context.Background(), "bob")); s != server {
+		t.Fatalf("expect the hash key routes the call to %s, but got %s", s, server)
+	}
+}
@@ -0,0 +1,99 @@
+package xclient
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// Subscriber is a Discovery which tells listeners about changes of its servers,
+// all discoveries of this package are subscribers
+type Subscriber interface {
+	// Subscribe calls listener with servers added and removed whenever servers change,
+	// and with all servers known at first. Changes close together may be merged,
+	// listener is called in a goroutine of discovery one change after another.
+	// The returned function stops calling listener.
+	Subscribe(listener func(added, removed []string)) (unsubscribe func())
+}
+
+var _ Subscriber = &MultiServersDiscovery{}
+
+type listener struct {
+	fn    func(added, removed []string)
+	known map[string]bool // servers the listener was told about
+	done  atomic.Bool     // unsubscribed
+}
+
+func (d *MultiServersDiscovery) Subscribe(fn func(added, removed []string)) func() {
+	l := &listener{fn: fn, known: make(map[string]bool)}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.listeners = append(d.listeners, l)
+	if d.notify == nil {
+		d.notify = make(chan struct{}, 1)
+		go d.dispatch(d.notify)
+	}
+	d.changed()
+	return func() {
+		l.done.Store(true)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for i, other := range d.listeners {
+			if other == l {
+				d.listeners = append(d.listeners[:i:i], d.listeners[i+1:]...)
+				break
+			}
+		}
+		d.changed()
+	}
+}
+
+// changed drops what's built of servers and wakes up listeners after servers
+// are changed, d.mu must be held
+func (d *MultiServersDiscovery) changed() {
+	d.weighted = nil
+	select {
+	case d.notify <- struct{}{}:
+	default: // listeners are going to see the latest servers
+	}
+}
+
+// dispatch tells listeners about changes until no listener is left
+func (d *MultiServersDiscovery) dispatch(notify chan struct{}) {
+	for range notify {
+		d.mu.Lock()
+		if len(d.listeners) == 0 {
+			d.notify = nil
+			d.mu.Unlock()
+			return
+		}
+		servers := append([]string(nil), d.servers...)
+		listeners := append([]*listener(nil), d.listeners...)
+		d.mu.Unlock()
+		for _, l := range listeners {
+			l.tell(servers)
+		}
+	}
+}
+
+// tell calls the listener with the difference between servers and servers known
+func (l *listener) tell(servers []string) {
+	var added, removed []string
+	current := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		current[server] = true
+		if !l.known[server] {
+			added = append(added, server)
+		}
+	}
+	for server := range l.known {
+		if !current[server] {
+			removed = append(removed, server)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 || l.done.Load() {
+		return
+	}
+	sort.Strings(removed)
+	l.known = current
+	l.fn(added, removed)
+}
@@ -0,0 +1,59 @@
+package xclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMultiServersDiscovery_Subscribe(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"a", "b"})
+	type change struct{ added, removed []string }
+	changes := make(chan change, 4)
+	unsubscribe := d.Subscribe(func(added, removed []string) { changes <- change{added, removed} })
+	next := func() change {
+		select {
+		case c := <-changes:
+			return c
+		case <-time.After(time.Second):
+			t.Fatal("no change told")
+			return change{}
+		}
+	}
+	if c := next(); !reflect.DeepEqual(c, change{added: []string{"a", "b"}}) {
+		t.Fatalf("first change = %+v", c)
+	}
+	_ = d.Update([]string{"b", "c"})
+	if c := next(); !reflect.DeepEqual(c, change{added: []string{"c"}, removed: []string{"a"}}) {
+		t.Fatalf("change = %+v", c)
+	}
+	unsubscribe()
+	_ = d.Update([]string{"d"})
+	select {
+	case c := <-changes:
+		t.Fatalf("change %+v told after unsubscribe", c)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestXClient_CloseRemovedClients(t *testing.T) {
+	addr := startServer(t, 0)
+	d := NewMultiServersDiscovery([]string{addr})
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	xc.mu.Lock()
+	client := xc.clients[addr].clients[0]
+	xc.mu.Unlock()
+	_ = d.Update([]string{})
+	for i := 0; client.IsAvailable(); i++ {
+		if i == 100 {
+			t.Fatal("client of removed server isn't closed")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
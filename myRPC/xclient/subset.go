@@ -0,0 +1,45 @@
+package xclient
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// SetSubset makes xc only call size servers out of all servers in discovery,
+// so that each client keeps connections to a few servers of a large fleet.
+// The subset is chosen deterministically by clientID with rendezvous hashing:
+// clients of different IDs spread evenly over servers, and a server joining
+// or leaving only changes the subsets it belongs to.
+// 0 size means all servers. It should be called before xc is used.
+func (xc *XClient) SetSubset(clientID string, size int) {
+	xc.clientID, xc.subsetSize = clientID, size
+}
+
+// subset returns the servers of the subset of xc
+func (xc *XClient) subset(servers []string) []string {
+	if xc.subsetSize <= 0 || len(servers) <= xc.subsetSize {
+		return servers
+	}
+	scores := make(map[string]uint64, len(servers))
+	for _, server := range servers {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(xc.clientID))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(server))
+		scores[server] = mix(h.Sum64())
+	}
+	sorted := append([]string(nil), servers...)
+	sort.Slice(sorted, func(i, j int) bool { return scores[sorted[i]] < scores[sorted[j]] })
+	return sorted[:xc.subsetSize]
+}
+
+// mix scrambles bits of an FNV hash by the finalizer of splitmix64,
+// FNV hashes of similar strings are too close to order them randomly
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,38 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestXClient_Subset(t *testing.T) {
+	var servers []string
+	for i := 1; i <= 100; i++ {
+		servers = append(servers, fmt.Sprint("tcp@127.0.0.1:", i))
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		xc := NewXClient(NewMultiServersDiscovery(servers), RoundRobinSelect, nil)
+		xc.SetSubset(fmt.Sprint("client", i), 5)
+		subset := xc.subset(servers)
+		if len(subset) != 5 || fmt.Sprint(subset) != fmt.Sprint(xc.subset(servers)) {
+			t.Fatalf("expect a deterministic subset of 5 servers, but got %v", subset)
+		}
+		in := make(map[string]bool)
+		for _, server := range subset {
+			counts[server]++
+			in[server] = true
+		}
+		for j := 0; j < 10; j++ {
+			if server, _ := xc.selectServer(context.Background()); !in[server] {
+				t.Fatalf("expect servers selected from subset %v, but got %s", subset, server)
+			}
+		}
+	}
+	for _, server := range servers {
+		if counts[server] == 0 || counts[server] > 30 {
+			t.Fatalf("expect clients spread over servers, but %s is in %d subsets", server, counts[server])
+		}
+	}
+}
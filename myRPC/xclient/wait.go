@@ -0,0 +1,61 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	minWaitInterval = time.Millisecond * 10
+	maxWaitInterval = time.Millisecond * 500
+)
+
+// refreshErrorer is a Discovery telling why it failed to refresh servers
+type refreshErrorer interface {
+	LastRefreshError() error
+}
+
+// SetWaitForServers makes a call wait up to timeout for servers, instead of failing
+// at once with ErrNoAvailableServers, if discovery has none for a moment, eg, before
+// servers are fetched from registry. Discovery is asked again with backoff.
+// It should be called before xc is used.
+func (xc *XClient) SetWaitForServers(timeout time.Duration) {
+	xc.waitForServers = timeout
+}
+
+// waitServer selects the server of a call again and again until discovery has servers
+func (xc *XClient) waitServer(ctx context.Context) (string, error) {
+	deadline := time.Now().Add(xc.waitForServers)
+	interval := minWaitInterval
+	for {
+		wait := min(interval, time.Until(deadline))
+		if wait <= 0 {
+			return "", xc.noServers(ctx)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return "", ctx.Err()
+		case <-t.C:
+		}
+		server, err := xc.selectOnce(ctx)
+		if !errors.Is(err, ErrNoAvailableServers) {
+			return server, err
+		}
+		interval = min(interval*2, maxWaitInterval)
+	}
+}
+
+// noServers returns ErrNoAvailableServers with the latest refresh error of discovery
+// of the call made with ctx
+func (xc *XClient) noServers(ctx context.Context) error {
+	if d, ok := xc.discovery(ctx).(refreshErrorer); ok {
+		if err := d.LastRefreshError(); err != nil {
+			return fmt.Errorf("%w, last refresh err: %v", ErrNoAvailableServers, err)
+		}
+	}
+	return ErrNoAvailableServers
+}
@@ -0,0 +1,35 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXClient_WaitForServers(t *testing.T) {
+	addr := startServer(t, 0)
+	d := NewMultiServersDiscovery(nil)
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var reply int
+	args := &Args{Num1: 1, Num2: 2}
+	if err := xc.Call(context.Background(), "Foo.Sum", args, &reply); !errors.Is(err, ErrNoAvailableServers) {
+		t.Fatalf("err = %v, expect ErrNoAvailableServers", err)
+	}
+
+	xc.SetWaitForServers(time.Second)
+	time.AfterFunc(time.Millisecond*50, func() { _ = d.Update([]string{addr}) })
+	if err := xc.Call(context.Background(), "Foo.Sum", args, &reply); err != nil || reply != 3 {
+		t.Fatalf("reply = %d, err: %v", reply, err)
+	}
+
+	_ = d.Update(nil)
+	d.refreshErr = errors.New("registry is down")
+	xc.SetWaitForServers(time.Millisecond * 50)
+	err := xc.Call(context.Background(), "Foo.Sum", args, &reply)
+	if !errors.Is(err, ErrNoAvailableServers) || !strings.Contains(err.Error(), "registry is down") {
+		t.Fatalf("err = %v, expect ErrNoAvailableServers with the refresh error", err)
+	}
+}
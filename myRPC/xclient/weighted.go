@@ -0,0 +1,33 @@
+package xclient
+
+import (
+	"sort"
+)
+
+// weightedServers is servers with cumulative weights for WeightedRandomSelect,
+// a server is selected by binary search of a random number in the weights
+type weightedServers struct {
+	servers    []string
+	cumulative []int
+}
+
+func newWeightedServers(servers []string, meta func(server string) ServerMeta) *weightedServers {
+	w := &weightedServers{servers: servers, cumulative: make([]int, len(servers))}
+	total := 0
+	for i, server := range servers {
+		total += max(meta(server).Weight, 1)
+		w.cumulative[i] = total
+	}
+	return w
+}
+
+// of reports whether w is built of servers, they're the same slice
+func (w *weightedServers) of(servers []string) bool {
+	return len(w.servers) == len(servers) && (len(servers) == 0 || &w.servers[0] == &servers[0])
+}
+
+// pick selects a server, intn returns a random number in [0, n)
+func (w *weightedServers) pick(intn func(n int) int) string {
+	n := intn(w.cumulative[len(w.cumulative)-1])
+	return w.servers[sort.SearchInts(w.cumulative, n+1)]
+}
@@ -0,0 +1,35 @@
+package xclient
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWeightedRandomSelect(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"a", "b", "c"})
+	d.meta = map[string]ServerMeta{"a": {Weight: 1}, "b": {Weight: 3}}
+	xc := NewXClient(d, WeightedRandomSelect, nil)
+	counts := make(map[string]int)
+	const n = 10000
+	for i := 0; i < n; i++ {
+		server, err := d.Get(WeightedRandomSelect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[server]++
+		server, _ = xc.pick(WeightedRandomSelect, []string{"a", "b", "c"})
+		counts[server]++
+	}
+	// c weighs the default 1
+	for server, weight := range map[string]float64{"a": 1, "b": 3, "c": 1} {
+		want := 2 * n * weight / 5
+		if math.Abs(float64(counts[server])-want) > want*0.1 {
+			t.Fatalf("%s is selected %d times, expect about %.0f", server, counts[server], want)
+		}
+	}
+
+	_ = d.Update([]string{"d"})
+	if server, _ := d.Get(WeightedRandomSelect); server != "d" {
+		t.Fatalf("server = %s after update, expect d", server)
+	}
+}
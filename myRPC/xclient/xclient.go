@@ -2,10 +2,15 @@ package xclient
 
 import (
 	"context"
+	"errors"
 	"io"
+	"math/rand"
 	. "myRPC"
 	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type XClient struct {
@@ -13,69 +18,371 @@ type XClient struct {
 	mode    SelectMode
 	opt     *Option
 	mu      sync.Mutex
-	clients map[string]*Client
+	clients map[string]*clientPool
+	ringMu  sync.Mutex
+	ring    *hashRing // built of the latest servers for ConsistentHashSelect
+	active  activeCalls
+	stats   callStats
+	zone    string        // prefer servers in the zone if it's not empty
+	index   atomic.Uint64 // for RoundRobinSelect among servers preferred
+	// failMode decides what to do when a call fails, along with retries and backupDelay
+	failMode       FailMode
+	retries        int
+	backupDelay    time.Duration
+	sessions       *sessions            // servers chosen for sessions if it's not nil
+	clientID       string               // decides the subset of servers
+	subsetSize     int                  // only call a subset of servers if it's positive
+	unsubscribes   []func()             // stop listening to changes of discoveries
+	services       map[string]Discovery // discoveries of services other than d
+	lastUsed       map[string]time.Time // when clients were dialed for a call last time
+	maxIdle        time.Duration        // clients idle longer are closed if it's positive
+	stopEvict      chan struct{}        // closed to stop evicting clients
+	statsHandler   StatsHandler         // told about calls and connections if it's not nil
+	events         EventBus             // publishes ServerEvicted and events of discoveries
+	breakers       *breakers            // stop selecting failing servers if it's not nil
+	outliers       *outliers            // eject servers much worse than others if it's not nil
+	slowStart      *slowStart           // ramp up calls to servers added if it's not nil
+	dialFailures   dialFailures         // servers failed to dial are not selected for a while
+	balancer       Balancer             // selects servers instead of mode if it's not nil
+	interceptors   []Interceptor        // wrap each call to a server
+	closing        atomic.Bool          // new calls are rejected
+	calls          atomic.Int64         // calls in flight, waited for by Shutdown
+	routes         *routes              // route calls by versions and keys of calls if it's not nil
+	limiter        *limiter             // limits calls in flight if it's not nil
+	retryBudget    *retryBudget         // limits retries to a ratio of calls if it's not nil
+	priorities     []Route              // groups of servers in order of priority
+	waitForServers time.Duration        // how long to wait if discovery has no server
+	poolSize       int                  // connections to each server, 1 if it's not positive
+	warm           bool                 // dial connections to servers as soon as they're discovered
+	// calls of a broadcast in flight at most and timeout of each, unlimited if they're not positive
+	broadcastConcurrency int
+	broadcastTimeout     time.Duration
+	// mirror fraction of calls to the shadow server at mirrorAddr if it's not empty
+	mirrorAddr     string
+	mirrorFraction float64
+	mirrorCalls    chan struct{} // mirrored calls in flight
 }
 
 var _ io.Closer = &XClient{}
 
 func NewXClient(d Discovery, mode SelectMode, opt *Option) *XClient {
-	return &XClient{d: d, mode: mode, opt: opt, clients: make(map[string]*Client)}
+	xc := &XClient{d: d, mode: mode, opt: opt, clients: make(map[string]*clientPool)}
+	xc.dialFailures.coolDown = defaultDialCoolDown
+	xc.subscribe(d)
+	return xc
 }
 
+// subscribe closes clients of servers removed from d if it's a Subscriber,
+// and warms up pools of servers added. Events of d are published on the bus of xc.
+func (xc *XClient) subscribe(d Discovery) {
+	if s, ok := d.(Subscriber); ok {
+		xc.unsubscribes = append(xc.unsubscribes, s.Subscribe(func(added, removed []string) {
+			xc.closeClients(removed)
+			xc.warmUp(d, added)
+		}))
+	}
+	if p, ok := d.(interface{ Events() *EventBus }); ok {
+		xc.unsubscribes = append(xc.unsubscribes, p.Events().Subscribe(xc.events.Publish))
+	}
+}
+
+// Events returns the bus of events of xc, that is ServerEvicted of servers ejected
+// as outliers, and RegistryRefreshed of its discoveries
+func (xc *XClient) Events() *EventBus {
+	return &xc.events
+}
+
+// closeClients closes clients of servers removed from discovery
+func (xc *XClient) closeClients(removed []string) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for _, rpcAddr := range removed {
+		if _, ok := xc.clients[rpcAddr]; ok {
+			xc.removeClient(rpcAddr)
+		}
+	}
+}
+
+// Close closes xc at once, calls in flight fail, see Shutdown for a graceful close
 func (xc *XClient) Close() error {
+	xc.closing.Store(true)
+	for _, unsubscribe := range xc.unsubscribes {
+		unsubscribe()
+	}
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
-	for index, client := range xc.clients {
-		_ = client.Close()
-		delete(xc.clients, index)
+	if xc.stopEvict != nil {
+		close(xc.stopEvict)
+		xc.stopEvict = nil
+	}
+	for rpcAddr := range xc.clients {
+		xc.removeClient(rpcAddr)
 	}
 	return nil
 }
 
+// removeClient closes clients of server at rpcAddr and forgets them, xc.mu must be held
+func (xc *XClient) removeClient(rpcAddr string) {
+	for _, client := range xc.clients[rpcAddr].clients {
+		xc.closeClient(rpcAddr, client)
+	}
+	delete(xc.clients, rpcAddr)
+	delete(xc.lastUsed, rpcAddr)
+}
+
+func (xc *XClient) closeClient(rpcAddr string, client *Client) {
+	_ = client.Close()
+	if xc.statsHandler != nil {
+		xc.statsHandler.HandleConn(rpcAddr, false)
+	}
+}
+
+// dial returns a client of server at rpcAddr, connections to the server are
+// used in turn, and made until there are as many as the pool size of xc
 func (xc *XClient) dial(rpcAddr string) (*Client, error) {
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
 
-	client, ok := xc.clients[rpcAddr]
-	// in case of client is unavailable
-	if ok && !client.IsAvailable() {
-		_ = client.Close()
-		delete(xc.clients, rpcAddr)
-		client = nil
+	pool := xc.clients[rpcAddr]
+	if pool == nil {
+		pool = &clientPool{}
+		xc.clients[rpcAddr] = pool
+	}
+	var client *Client
+	if len(pool.clients) >= max(xc.poolSize, 1) {
+		i := pool.next % len(pool.clients)
+		pool.next++
+		client = pool.clients[i]
+		// in case of client is unavailable, it's dropped from the pool even if redialing fails
+		if !client.IsAvailable() {
+			xc.closeClient(rpcAddr, client)
+			pool.clients = append(pool.clients[:i], pool.clients[i+1:]...)
+			client = nil
+		}
 	}
 	if client == nil {
 		var err error
 		client, err = XDial(rpcAddr, xc.opt)
 		if err != nil {
+			if len(pool.clients) == 0 {
+				delete(xc.clients, rpcAddr)
+			}
 			return nil, err
 		}
-		xc.clients[rpcAddr] = client
+		pool.clients = append(pool.clients, client)
+		if xc.statsHandler != nil {
+			xc.statsHandler.HandleConn(rpcAddr, true)
+		}
+	}
+	if xc.lastUsed != nil {
+		xc.lastUsed[rpcAddr] = time.Now()
 	}
 	return client, nil
 }
 
 // Call invokes the named function, waits for it to complete,
 // and returns its error status.
-// xc will choose a proper server.
-func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	rpcAddr, err := xc.d.Get(xc.mode)
+// xc will choose a proper server, and handle failures by its FailMode,
+// opts override them for this call.
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}, opts ...CallOption) error {
+	if !xc.begin() {
+		return ErrClosed
+	}
+	defer xc.end()
+	ctx = xc.withService(ctx, serviceMethod)
+	ctx = xc.withBalancedCall(ctx, serviceMethod, args)
+	if len(opts) > 0 {
+		ctx = withCallOptions(ctx, opts)
+		if timeout := callOptionsFrom(ctx).timeout; timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
+	xc.mirror(ctx, serviceMethod, args, reply)
+	if xc.retryBudget != nil {
+		xc.retryBudget.deposit()
+	}
+	failMode, _ := xc.failModeOf(ctx)
+	switch failMode {
+	case Failover:
+		return xc.callFailover(ctx, serviceMethod, args, reply)
+	case Failtry:
+		return xc.callFailtry(ctx, serviceMethod, args, reply)
+	case Failbackup:
+		return xc.callBackup(ctx, serviceMethod, args, reply)
+	}
+	rpcAddr, err := xc.selectServer(ctx)
 	if err != nil {
 		return err
 	}
 	return xc.call(rpcAddr, ctx, serviceMethod, args, reply)
 }
 
+// selectServer selects the server of a call, waits for servers if discovery has none
+// and xc is set to wait
+func (xc *XClient) selectServer(ctx context.Context) (string, error) {
+	server, err := xc.selectOnce(ctx)
+	if xc.waitForServers <= 0 || !errors.Is(err, ErrNoAvailableServers) {
+		return server, err
+	}
+	return xc.waitServer(ctx)
+}
+
+// selectOnce selects the server of a call, the target server if the call has one,
+// or by its session if xc is sticky
+func (xc *XClient) selectOnce(ctx context.Context) (string, error) {
+	if target := callOptionsFrom(ctx).target; target != "" {
+		return target, nil
+	}
+	if xc.sessions != nil {
+		return xc.stickyServer(ctx)
+	}
+	return xc.selectByMode(ctx)
+}
+
+// selectByMode selects the server of a call by mode of the call
+func (xc *XClient) selectByMode(ctx context.Context) (string, error) {
+	if xc.balancer != nil && !callOptionsFrom(ctx).hasMode {
+		return xc.balance(ctx)
+	}
+	mode := xc.modeOf(ctx)
+	switch mode {
+	case ConsistentHashSelect:
+		return xc.hashServer(ctx)
+	case LeastActiveSelect:
+		return xc.leastActiveServer(ctx)
+	case P2CSelect:
+		return xc.p2cServer(ctx)
+	}
+	if selector, ok := selectorOf(mode); ok {
+		return xc.selectBy(ctx, selector)
+	}
+	if xc.selectedByDiscovery() {
+		return xc.discovery(ctx).Get(mode)
+	}
+	servers, err := xc.servers(ctx)
+	if err != nil {
+		return "", err
+	}
+	return xc.pick(mode, servers)
+}
+
+// hashServer selects the server of hash key carried by ctx
+func (xc *XClient) hashServer(ctx context.Context) (string, error) {
+	servers, err := xc.servers(ctx)
+	if err != nil {
+		return "", err
+	}
+	key, ok := hashKeyFrom(ctx)
+	if !ok {
+		// a call without key can go anywhere
+		return servers[rand.Intn(len(servers))], nil
+	}
+	servers = append([]string(nil), servers...)
+	sort.Strings(servers)
+	xc.ringMu.Lock()
+	defer xc.ringMu.Unlock()
+	if xc.ring == nil || !xc.ring.has(servers) {
+		xc.ring = newHashRing(servers)
+	}
+	return xc.ring.get(key), nil
+}
+
+// selectedByDiscovery reports whether discovery can select servers by itself,
+// because none of servers is filtered by xc
+func (xc *XClient) selectedByDiscovery() bool {
+	return xc.zone == "" && xc.subsetSize <= 0 && xc.breakers == nil && xc.outliers == nil &&
+		xc.routes == nil && len(xc.priorities) == 0 && xc.slowStart == nil && !xc.dialFailures.any()
+}
+
+// servers returns servers from discovery to select the server of the call made with ctx,
+// an error if there is none. Only servers routed to, of the subset of xc, and in the zone
+// of xc if some of them are available, are returned.
+func (xc *XClient) servers(ctx context.Context) ([]string, error) {
+	servers, err := xc.discovery(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, xc.noServers(ctx)
+	}
+	if xc.routes != nil {
+		servers = xc.route(ctx, servers)
+	}
+	servers = xc.subset(servers)
+	if xc.breakers != nil {
+		servers = xc.breakers.filter(servers)
+	}
+	if xc.outliers != nil {
+		servers = xc.outliers.filter(servers)
+	}
+	servers = xc.dialFailures.filter(servers)
+	if xc.slowStart != nil {
+		servers = xc.slowStart.filter(servers)
+	}
+	if len(xc.priorities) > 0 {
+		servers = xc.prioritize(servers)
+	}
+	if xc.zone != "" {
+		servers = xc.preferZone(servers)
+	}
+	return servers, nil
+}
+
 func (xc *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if len(xc.interceptors) == 0 {
+		return xc.invoke(ctx, serviceMethod, args, reply, rpcAddr)
+	}
+	return xc.intercept(xc.invoke)(ctx, serviceMethod, args, reply, rpcAddr)
+}
+
+// invoke calls the server at rpcAddr, it's the Invoker innermost of interceptors
+func (xc *XClient) invoke(ctx context.Context, serviceMethod string, args, reply interface{}, rpcAddr string) error {
+	if xc.limiter != nil {
+		if !xc.limiter.acquire() {
+			xc.balanced(ctx, rpcAddr, ErrConcurrencyLimited)
+			return ErrConcurrencyLimited
+		}
+	}
+	start := time.Now()
+	if xc.breakers != nil {
+		xc.breakers.start(rpcAddr)
+	}
 	client, err := xc.dial(rpcAddr)
 	if err != nil {
-		return err
+		xc.dialFailures.fail(rpcAddr)
+	} else {
+		xc.dialFailures.succeed(rpcAddr)
+		xc.active.start(rpcAddr)
+		err = client.Call(ctx, serviceMethod, args, reply)
+		xc.active.done(rpcAddr)
+	}
+	latency := time.Since(start)
+	if xc.limiter != nil {
+		xc.limiter.release(latency, err)
+	}
+	xc.stats.observe(rpcAddr, latency, err)
+	if xc.breakers != nil {
+		xc.breakers.done(rpcAddr, err)
+	}
+	if xc.outliers != nil {
+		xc.outliers.observe(rpcAddr, latency, err)
 	}
-	return client.Call(ctx, serviceMethod, args, reply)
+	if xc.statsHandler != nil {
+		xc.statsHandler.HandleCall(rpcAddr, serviceMethod, latency, err)
+	}
+	xc.balanced(ctx, rpcAddr, err)
+	return err
 }
 
 // Broadcast invokes the named function for every server registered in discovery
 func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	servers, err := xc.d.GetAll()
+	if !xc.begin() {
+		return ErrClosed
+	}
+	defer xc.end()
+	servers, err := xc.discovery(xc.withService(ctx, serviceMethod)).GetAll()
 	if err != nil {
 		return err
 	}
@@ -84,6 +391,8 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 	var e error
 	replyDone := reply == nil // if reply is nil, don't need to set value
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	slots := xc.broadcastSlots()
 	for _, rpcAddr := range servers {
 		wg.Add(1)
 		go func(rpcAddr string) {
@@ -92,15 +401,14 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 			if reply != nil {
 				clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
 			}
-			err := xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+			err := xc.broadcastCall(slots, rpcAddr, ctx, serviceMethod, args, clonedReply)
 			mu.Lock()
 			if err != nil && e == nil {
 				e = err
 				cancel() // if any call failed, cancel unfinished calls
 			}
 			if err == nil && !replyDone {
-				//reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(clonedReply).Elem())
-				reply = clonedReply
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(clonedReply).Elem())
 				replyDone = true
 			}
 			mu.Unlock()
@@ -109,3 +417,48 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 	wg.Wait()
 	return e
 }
+
+// BroadcastResult is the outcome of a call to a server made by BroadcastAll
+type BroadcastResult struct {
+	Reply interface{} // pointer to the reply of the server, nil if the call failed
+	Err   error
+}
+
+// BroadcastAll invokes the named function for every server registered in discovery,
+// and returns the result of each server by its address. Unlike Broadcast, a failed
+// call doesn't cancel the others, so it tells exactly which servers failed.
+// reply is a pointer to a value of the reply type, it's only used for its type,
+// it can be nil if replies are not needed. The error is only returned if discovery fails.
+func (xc *XClient) BroadcastAll(ctx context.Context, serviceMethod string, args, reply interface{}) (map[string]*BroadcastResult, error) {
+	if !xc.begin() {
+		return nil, ErrClosed
+	}
+	defer xc.end()
+	servers, err := xc.discovery(xc.withService(ctx, serviceMethod)).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex // protect results
+	results := make(map[string]*BroadcastResult, len(servers))
+	slots := xc.broadcastSlots()
+	for _, rpcAddr := range servers {
+		wg.Add(1)
+		go func(rpcAddr string) {
+			defer wg.Done()
+			var clonedReply interface{}
+			if reply != nil {
+				clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+			}
+			result := &BroadcastResult{Err: xc.broadcastCall(slots, rpcAddr, ctx, serviceMethod, args, clonedReply)}
+			if result.Err == nil {
+				result.Reply = clonedReply
+			}
+			mu.Lock()
+			results[rpcAddr] = result
+			mu.Unlock()
+		}(rpcAddr)
+	}
+	wg.Wait()
+	return results, nil
+}
@@ -0,0 +1,58 @@
+package xclient
+
+import (
+	"context"
+	"myRPC"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestXClient_Broadcast(t *testing.T) {
+	a, b, dead := startServer(t, 0), startServer(t, 0), deadServer()
+	xc := NewXClient(NewMultiServersDiscovery([]string{a, b}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	var reply int
+	if err := xc.Broadcast(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect reply set by broadcast, but got %d, %v", reply, err)
+	}
+
+	xc = NewXClient(NewMultiServersDiscovery([]string{a, b, dead}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	results, err := xc.BroadcastAll(context.Background(), "Foo.Sum", Args{1, 2}, &reply)
+	if err != nil || len(results) != 3 {
+		t.Fatalf("expect results of 3 servers, but got %v, %v", results, err)
+	}
+	for _, server := range []string{a, b} {
+		if r := results[server]; r.Err != nil || *r.Reply.(*int) != 3 {
+			t.Fatalf("expect reply of %s, but got %+v", server, r)
+		}
+	}
+	if r := results[dead]; r.Err == nil || r.Reply != nil {
+		t.Fatalf("expect the error of the dead server, but got %+v", r)
+	}
+}
+
+func TestXClient_MixedProtocols(t *testing.T) {
+	server := myRPC.NewServer()
+	_ = server.Register(&Foo{})
+	l, err := net.Listen("unix", filepath.Join(t.TempDir(), "foo.sock"))
+	if err != nil {
+		t.Fatal("failed to listen unix socket:", err)
+	}
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+	go server.Accept(l)
+	servers := []string{startServer(t, 0), "unix@" + l.Addr().String()}
+
+	xc := NewXClient(NewMultiServersDiscovery(servers), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	results, err := xc.BroadcastAll(context.Background(), "Foo.Sum", Args{1, 2}, new(int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range servers {
+		if r := results[server]; r == nil || r.Err != nil || *r.Reply.(*int) != 3 {
+			t.Fatalf("expect %s called over its own protocol, but got %+v", server, r)
+		}
+	}
+}
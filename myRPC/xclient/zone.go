@@ -0,0 +1,122 @@
+package xclient
+
+import (
+	"errors"
+	"math/rand"
+)
+
+const (
+	// a server failing more often is unhealthy, calls are spilled to other zones
+	maxZoneErrRate = 0.5
+	// a server busier than it is overloaded, calls are spilled to other zones
+	maxZoneCPU = 0.9
+)
+
+// metaDiscovery is a Discovery knowing metadata of servers, like CenterRegistryDiscovery
+type metaDiscovery interface {
+	Meta(addr string) (ServerMeta, bool)
+}
+
+// SetZone makes xc prefer servers in zone, which is learned from metadata of
+// servers in discovery, eg, registered to CenterRegistry. Calls are spilled to
+// servers in other zones only when no server in zone is available, because they
+// are failing or overloaded by the loads they report.
+// It should be called before xc is used.
+func (xc *XClient) SetZone(zone string) {
+	xc.zone = zone
+}
+
+// meta returns metadata of server if a discovery knows it
+func (xc *XClient) meta(server string) ServerMeta {
+	if d, ok := xc.d.(metaDiscovery); ok {
+		if meta, ok := d.Meta(server); ok || len(xc.services) == 0 {
+			return meta
+		}
+	}
+	for _, d := range xc.services {
+		if d, ok := d.(metaDiscovery); ok {
+			if meta, ok := d.Meta(server); ok {
+				return meta
+			}
+		}
+	}
+	return ServerMeta{}
+}
+
+// available reports whether server is healthy and not overloaded
+func (xc *XClient) available(server string) bool {
+	if xc.stats.errRate(server) > maxZoneErrRate {
+		return false
+	}
+	load := xc.meta(server).Load
+	return load == nil || load.CPU < maxZoneCPU
+}
+
+// preferZone returns servers available in the zone of xc, or servers available in
+// other zones if there is none, or all servers if none of them is available
+func (xc *XClient) preferZone(servers []string) []string {
+	var local, remote []string
+	for _, server := range servers {
+		switch {
+		case !xc.available(server):
+		case xc.meta(server).Zone == xc.zone:
+			local = append(local, server)
+		default:
+			remote = append(remote, server)
+		}
+	}
+	switch {
+	case len(local) > 0:
+		return local
+	case len(remote) > 0:
+		return remote
+	default:
+		return servers
+	}
+}
+
+// SetPriorityGroups makes xc select servers of the first group which has servers
+// available, eg, the local datacenter first and a remote one second. A group is servers
+// matching its route. Servers of no group are selected only when no group has servers
+// available. It should be called before xc is used.
+func (xc *XClient) SetPriorityGroups(groups ...Route) {
+	xc.priorities = groups
+}
+
+// prioritize returns servers available of the group of the highest priority,
+// or all servers if no group has servers available
+func (xc *XClient) prioritize(servers []string) []string {
+	for _, group := range xc.priorities {
+		var matched []string
+		for _, server := range servers {
+			if group.match(xc.meta(server)) && xc.available(server) {
+				matched = append(matched, server)
+			}
+		}
+		if len(matched) > 0 {
+			return matched
+		}
+	}
+	return servers
+}
+
+// pick selects a server from servers by mode, for modes selected by discovery
+func (xc *XClient) pick(mode SelectMode, servers []string) (string, error) {
+	n := len(servers)
+	switch mode {
+	case RandomSelect:
+		return servers[rand.Intn(n)], nil
+	case RoundRobinSelect:
+		return servers[(xc.index.Add(1)-1)%uint64(n)], nil
+	case LeastLoadSelect:
+		a, b := servers[rand.Intn(n)], servers[rand.Intn(n)]
+		if loadScore(xc.meta(b)) < loadScore(xc.meta(a)) {
+			return b, nil
+		}
+		return a, nil
+	case WeightedRandomSelect:
+		return newWeightedServers(servers, xc.meta).pick(rand.Intn), nil
+	default:
+		return "", errors.New("rpc discovery: not supported select mode")
+	}
+}
@@ -0,0 +1,30 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestXClient_Zone(t *testing.T) {
+	d := NewMultiServersDiscovery([]string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2", "tcp@127.0.0.1:3"})
+	d.meta = map[string]ServerMeta{
+		"tcp@127.0.0.1:1": {Zone: "z1"},
+		"tcp@127.0.0.1:2": {Zone: "z1", Load: &ServerLoad{CPU: 0.95}},
+		"tcp@127.0.0.1:3": {Zone: "z2"},
+	}
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	xc.SetZone("z1")
+	for i := 0; i < 10; i++ {
+		if server, _ := xc.selectServer(context.Background()); server != "tcp@127.0.0.1:1" {
+			t.Fatalf("expect the available server in local zone, but got %s", server)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		xc.stats.observe("tcp@127.0.0.1:1", time.Millisecond, errors.New("rpc client: call failed"))
+	}
+	if server, _ := xc.selectServer(context.Background()); server != "tcp@127.0.0.1:3" {
+		t.Fatalf("expect calls spilled to other zones, but got %s", server)
+	}
+}